@@ -0,0 +1,148 @@
+package dns
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// AdditionalFiller is a handler that adds the addresses of the target names of
+// MX, SRV, and NS records in the answer section to the additional section of
+// the response, for resolvers that do not query for them separately. It
+// forwards queries upstream, and looks up the A and AAAA records of the target
+// names in the Zone or the Cache.
+type AdditionalFiller struct {
+	// Zone provides the address records of target names within the zone.
+	Zone *Zone
+
+	// Cache provides the cached address records of target names outside the
+	// zone. Target names are not resolved on a cache miss.
+	Cache *Cache
+
+	// MaxSize is the size budget of the packed response, in bytes. Address
+	// records that would exceed the budget are not added. If zero, the size
+	// limit of the transport reported by Remaining is used, or the 512 byte
+	// limit of UDP messages if the MessageWriter does not report it.
+	MaxSize int
+}
+
+// ServeDNS forwards the query upstream and writes the response with the
+// addresses of the answer targets.
+func (f *AdditionalFiller) ServeDNS(ctx context.Context, w MessageWriter, r *Query) {
+	msg, err := w.Recur(ctx)
+	if err != nil || msg == nil {
+		w.Status(ServFail)
+		return
+	}
+
+	f.fill(ctx, msg, f.limit(w, msg))
+	writeMessage(w, msg)
+}
+
+// limit returns the size budget of the response msg written to w.
+func (f *AdditionalFiller) limit(w MessageWriter, msg *Message) int {
+	if f.MaxSize > 0 {
+		return f.MaxSize
+	}
+
+	if n, ok := Remaining(w); ok {
+		// only the header and questions of the response are written to w
+		if buf, err := (&Message{Questions: msg.Questions}).Pack(nil, true); err == nil {
+			return len(buf) + n
+		}
+	}
+	return maxPacketLen
+}
+
+// fill adds the address records of the answer targets to the additional
+// section of msg, before any OPT or TSIG record, until the size budget is
+// reached. The records of a name and type are added together or not at all.
+func (f *AdditionalFiller) fill(ctx context.Context, msg *Message, limit int) {
+	var records, pseudo []Resource
+	seen := make(map[string]bool)
+	for _, res := range msg.Additionals {
+		switch res.Record.Type() {
+		case TypeOPT, TypeTSIG:
+			pseudo = append(pseudo, res)
+			continue
+		case TypeA, TypeAAAA:
+			seen[strings.ToLower(res.Name)] = true
+		}
+		records = append(records, res)
+	}
+
+	now := time.Now()
+	for _, res := range msg.Answers {
+		target := glueTarget(res.Record)
+		if target == "" || seen[strings.ToLower(target)] {
+			continue
+		}
+		seen[strings.ToLower(target)] = true
+
+		for _, typ := range []Type{TypeA, TypeAAAA} {
+			rrs := f.addresses(ctx, target, typ, now)
+			if len(rrs) == 0 {
+				continue
+			}
+
+			msg.Additionals = append(append(records[:len(records):len(records)], rrs...), pseudo...)
+			if buf, err := msg.Pack(nil, true); err != nil || len(buf) > limit {
+				msg.Additionals = append(records[:len(records):len(records)], pseudo...)
+				return
+			}
+			records = append(records, rrs...)
+		}
+	}
+	msg.Additionals = append(records[:len(records):len(records)], pseudo...)
+}
+
+// addresses returns the address records of the type for the target name. The
+// records of names within the zone are only looked up in the zone.
+func (f *AdditionalFiller) addresses(ctx context.Context, target string, typ Type, now time.Time) []Resource {
+	if z := f.Zone; z != nil {
+		if dn, ok := z.relative(target); ok {
+			recs, _, err := z.store().Lookup(ctx, dn, typ)
+			if err != nil {
+				return nil
+			}
+
+			var rrs []Resource
+			ttl := z.ttl()
+			for _, rec := range recs {
+				if rec.Type() == typ {
+					rrs = append(rrs, Resource{Name: target, Class: ClassIN, TTL: ttl, Record: rec})
+				}
+			}
+			return rrs
+		}
+	}
+
+	if f.Cache != nil {
+		return f.Cache.answers(Question{Name: target, Type: typ, Class: ClassIN}, now)
+	}
+	return nil
+}
+
+// answers returns the unexpired cached answers of the question's name and
+// type.
+func (c *Cache) answers(q Question, now time.Time) []Resource {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	msg := c.get(q, nil)
+	if msg == nil {
+		return nil
+	}
+	entry, ok := cacheEntry(q, msg, now)
+	if !ok {
+		return nil
+	}
+
+	var rrs []Resource
+	for _, res := range entry.Answers {
+		if res.Record.Type() == q.Type && strings.EqualFold(res.Name, q.Name) {
+			rrs = append(rrs, res)
+		}
+	}
+	return rrs
+}
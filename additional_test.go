@@ -0,0 +1,265 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAdditionalFiller(t *testing.T) {
+	t.Parallel()
+
+	zone := &Zone{
+		Origin: "example.",
+		TTL:    time.Hour,
+		RRs: RRSet{
+			"": {
+				TypeMX: {
+					&MX{Pref: 10, MX: "mx1.example."},
+					&MX{Pref: 20, MX: "mx2.example."},
+					&MX{Pref: 30, MX: "mail.other."},
+					&MX{Pref: 40, MX: "mx1.example."},
+				},
+			},
+			"_sip._tcp": {
+				TypeSRV: {
+					&SRV{Priority: 10, Weight: 1, Port: 5060, Target: "sip.example."},
+				},
+			},
+			"mx1": {
+				TypeA:    {&A{A: net.IPv4(192, 0, 2, 1).To4()}},
+				TypeAAAA: {&AAAA{AAAA: net.ParseIP("2001:db8::1")}},
+			},
+			"mx2": {
+				TypeA: {&A{A: net.IPv4(192, 0, 2, 2).To4()}},
+			},
+			"sip": {
+				TypeA: {&A{A: net.IPv4(192, 0, 2, 3).To4()}},
+			},
+		},
+	}
+
+	// upstream answers without the addresses of the targets.
+	upstream := HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+		q := r.Questions[0]
+		dn, _ := zone.relative(q.Name)
+		for _, rec := range zone.RRs[dn][q.Type] {
+			w.Answer(q.Name, time.Hour, rec)
+		}
+	})
+
+	cache := &Cache{
+		Upstream: &Client{
+			Transport: nopDialer{},
+			Resolver: HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+				w.Answer("mail.other.", time.Minute, &A{A: net.IPv4(198, 51, 100, 1).To4()})
+			}),
+		},
+	}
+	if err := cache.Warm(context.Background(), Question{Name: "mail.other.", Type: TypeA, Class: ClassIN}); err != nil {
+		t.Fatal(err)
+	}
+
+	type additional struct {
+		Name string
+		Type Type
+	}
+
+	tests := []struct {
+		name string
+
+		question Question
+		maxSize  int
+
+		additionals []additional
+	}{
+		{
+			name: "mx",
+
+			question: Question{Name: "example.", Type: TypeMX, Class: ClassIN},
+
+			additionals: []additional{
+				{"mx1.example.", TypeA},
+				{"mx1.example.", TypeAAAA},
+				{"mx2.example.", TypeA},
+				{"mail.other.", TypeA},
+			},
+		},
+		{
+			name: "srv",
+
+			question: Question{Name: "_sip._tcp.example.", Type: TypeSRV, Class: ClassIN},
+
+			additionals: []additional{
+				{"sip.example.", TypeA},
+			},
+		},
+		{
+			name: "budget",
+
+			question: Question{Name: "example.", Type: TypeMX, Class: ClassIN},
+			maxSize:  -1, // room for only the first A record
+
+			additionals: []additional{
+				{"mx1.example.", TypeA},
+			},
+		},
+		{
+			name: "no-targets",
+
+			question: Question{Name: "mx1.example.", Type: TypeA, Class: ClassIN},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			query := &Query{
+				RemoteAddr: &net.UDPAddr{IP: net.IPv4(192, 0, 2, 53), Port: 53},
+				Message: &Message{
+					Questions: []Question{test.question},
+				},
+			}
+
+			maxSize := test.maxSize
+			if maxSize < 0 {
+				// A compressed A record is 16 bytes, and an AAAA record
+				// is 28 bytes.
+				msg, err := (&Client{Transport: nopDialer{}, Resolver: upstream}).Do(context.Background(), query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				buf, err := msg.Pack(nil, true)
+				if err != nil {
+					t.Fatal(err)
+				}
+				maxSize = len(buf) + 20
+			}
+
+			filler := &AdditionalFiller{
+				Zone:    zone,
+				Cache:   cache,
+				MaxSize: maxSize,
+			}
+
+			client := &Client{
+				Transport: nopDialer{},
+				Resolver:  Chain{filler, upstream},
+			}
+
+			msg, err := client.Do(context.Background(), query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var additionals []additional
+			for _, res := range msg.Additionals {
+				additionals = append(additionals, additional{res.Name, res.Record.Type()})
+			}
+			if want, got := test.additionals, additionals; !reflect.DeepEqual(want, got) {
+				t.Errorf("want additionals %+v, got %+v", want, got)
+			}
+
+			if buf, err := msg.Pack(nil, true); err != nil {
+				t.Fatal(err)
+			} else if len(buf) > maxSize && test.maxSize != 0 {
+				t.Errorf("want response within %d bytes, got %d", maxSize, len(buf))
+			}
+		})
+	}
+}
+
+func TestAdditionalFillerRemaining(t *testing.T) {
+	t.Parallel()
+
+	var addrs []Record
+	for i := 0; i < 40; i++ {
+		addrs = append(addrs, &A{A: net.IPv4(192, 0, 2, byte(i)).To4()})
+	}
+
+	zone := &Zone{
+		Origin: "example.",
+		TTL:    time.Hour,
+		RRs: RRSet{
+			"": {
+				TypeMX: {&MX{Pref: 10, MX: "mx.example."}},
+			},
+			"mx": {
+				TypeA: addrs,
+			},
+		},
+	}
+
+	upstream := HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+		w.Answer(r.Questions[0].Name, time.Hour, zone.RRs[""][TypeMX][0])
+	})
+
+	srv := mustServer(Chain{&AdditionalFiller{Zone: zone}, upstream})
+
+	tests := []struct {
+		name string
+
+		network string
+
+		additionals int
+	}{
+		{
+			name: "udp",
+
+			network: "udp",
+
+			// the addresses exceed the 512 byte limit of UDP messages
+			additionals: 0,
+		},
+		{
+			name: "tcp",
+
+			network: "tcp",
+
+			additionals: len(addrs),
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var addr net.Addr
+			var err error
+			if test.network == "tcp" {
+				addr, err = net.ResolveTCPAddr("tcp", srv.Addr)
+			} else {
+				addr, err = net.ResolveUDPAddr("udp", srv.Addr)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			query := &Query{
+				RemoteAddr: addr,
+				Message: &Message{
+					Questions: []Question{{Name: "example.", Type: TypeMX, Class: ClassIN}},
+				},
+			}
+
+			msg, err := new(Client).Do(context.Background(), query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want, got := 1, len(msg.Answers); want != got {
+				t.Fatalf("want %d answers, got %d", want, got)
+			}
+			if want, got := test.additionals, len(msg.Additionals); want != got {
+				t.Errorf("want %d additionals, got %d", want, got)
+			}
+		})
+	}
+}
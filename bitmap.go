@@ -0,0 +1,94 @@
+package dns
+
+import (
+	"errors"
+	"sort"
+)
+
+var errInvalidBitmap = errors.New("invalid type bitmap")
+
+// TypeBitmap is a set of RR types in the windowed type bitmap format of NSEC,
+// NSEC3 and CSYNC records, as described in RFC 4034 section 4.1.2.
+type TypeBitmap []Type
+
+// Length returns the encoded size of the bitmap.
+func (t TypeBitmap) Length() int {
+	var n int
+	t.windows(func(_ byte, bitmap []byte) {
+		n += 2 + len(bitmap)
+	})
+	return n
+}
+
+// Pack encodes the bitmap onto b. The types are encoded in ascending order,
+// and duplicate types are ignored.
+func (t TypeBitmap) Pack(b []byte) ([]byte, error) {
+	t.windows(func(window byte, bitmap []byte) {
+		b = append(append(b, window, byte(len(bitmap))), bitmap...)
+	})
+	return b, nil
+}
+
+// Unpack decodes the bitmap from b. The decoded types are in ascending order.
+func (t *TypeBitmap) Unpack(b []byte) ([]byte, error) {
+	types := (*t)[:0]
+
+	last := -1
+	for len(b) > 0 {
+		if len(b) < 2 {
+			return nil, errInvalidBitmap
+		}
+
+		window, length := int(b[0]), int(b[1])
+		if window <= last || length == 0 || length > 32 || len(b) < 2+length {
+			return nil, errInvalidBitmap
+		}
+
+		for i, octet := range b[2 : 2+length] {
+			for bit := 0; bit < 8; bit++ {
+				if octet&(0x80>>uint(bit)) != 0 {
+					types = append(types, Type(window<<8|i<<3|bit))
+				}
+			}
+		}
+
+		last, b = window, b[2+length:]
+	}
+
+	*t = types
+	return nil, nil
+}
+
+// Has reports whether typ is in the bitmap.
+func (t TypeBitmap) Has(typ Type) bool {
+	for _, v := range t {
+		if v == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// windows calls fn with the bitmap of each window containing a type.
+func (t TypeBitmap) windows(fn func(window byte, bitmap []byte)) {
+	types := append(TypeBitmap(nil), t...)
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+
+	var bitmap [32]byte
+	for i := 0; i < len(types); {
+		window := byte(types[i] >> 8)
+
+		var length int
+		for ; i < len(types) && byte(types[i]>>8) == window; i++ {
+			octet := int(types[i]&0xFF) >> 3
+			bitmap[octet] |= 0x80 >> uint(types[i]&0x07)
+
+			if octet >= length {
+				length = octet + 1
+			}
+		}
+
+		fn(window, bitmap[:length])
+		bitmap = [32]byte{}
+	}
+}
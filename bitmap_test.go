@@ -0,0 +1,130 @@
+package dns
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestTypeBitmap(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+
+		bitmap TypeBitmap
+		types  TypeBitmap
+
+		raw []byte
+	}{
+		{
+			name: "empty",
+		},
+		{
+			// RFC 4034 section 4.3
+			name: "A MX RRSIG NSEC TYPE1234",
+
+			bitmap: TypeBitmap{TypeA, TypeMX, 46, 47, 1234},
+
+			raw: []byte{
+				0x00, 0x06, 0x40, 0x01, 0x00, 0x00, 0x00, 0x03,
+				0x04, 0x1B, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x20,
+			},
+		},
+		{
+			name: "unsorted-duplicates",
+
+			bitmap: TypeBitmap{TypeCAA, TypeAAAA, TypeA, TypeAAAA},
+			types:  TypeBitmap{TypeA, TypeAAAA, TypeCAA},
+
+			raw: []byte{
+				0x00, 0x04, 0x40, 0x00, 0x00, 0x08,
+				0x01, 0x01, 0x40,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			if want, got := len(test.raw), test.bitmap.Length(); want != got {
+				t.Errorf("want length %d, got %d", want, got)
+			}
+
+			raw, err := test.bitmap.Pack(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, got := test.raw, raw; !bytes.Equal(want, got) {
+				t.Errorf("want raw bitmap %x, got %x", want, got)
+			}
+
+			var bitmap TypeBitmap
+			if _, err := bitmap.Unpack(raw); err != nil {
+				t.Fatal(err)
+			}
+
+			types := test.types
+			if types == nil {
+				types = test.bitmap
+			}
+			if want, got := types, bitmap; !reflect.DeepEqual(want, got) {
+				t.Errorf("want types %v, got %v", want, got)
+			}
+			for _, typ := range types {
+				if !bitmap.Has(typ) {
+					t.Errorf("want type %d in bitmap", typ)
+				}
+			}
+		})
+	}
+}
+
+func TestTypeBitmapUnpackInvalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		raw  []byte
+	}{
+		{
+			name: "short",
+			raw:  []byte{0x00},
+		},
+		{
+			name: "zero-length",
+			raw:  []byte{0x00, 0x00},
+		},
+		{
+			name: "oversized",
+			raw:  append([]byte{0x00, 0x21}, make([]byte, 33)...),
+		},
+		{
+			name: "truncated",
+			raw:  []byte{0x00, 0x02, 0x40},
+		},
+		{
+			name: "unordered-windows",
+			raw:  []byte{0x01, 0x01, 0x40, 0x00, 0x01, 0x40},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var bitmap TypeBitmap
+			if _, err := bitmap.Unpack(test.raw); err != errInvalidBitmap {
+				t.Errorf("want error %v, got %v", errInvalidBitmap, err)
+			}
+		})
+	}
+}
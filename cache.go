@@ -2,29 +2,89 @@ package dns
 
 import (
 	"context"
+	"errors"
 	"math/rand"
+	"net"
+	"sort"
 	"sync"
 	"time"
+
+	"github.com/benburkert/dns/edns"
 )
 
+var errNoUpstream = errors.New("cache has no upstream")
+
 // Cache is a DNS query cache handler.
 type Cache struct {
-	mu    sync.RWMutex
-	cache map[Question]*Message
+	// Upstream resolves the questions passed to Warm, by sending queries to
+	// the resolver at UpstreamAddr.
+	Upstream     RoundTripper
+	UpstreamAddr net.Addr
+
+	mu        sync.RWMutex
+	cache     map[Question]*Message
+	scoped    map[Question][]scopedMessage
+	upstreams map[upstreamKey]*Cache
+}
+
+// upstreamKey identifies the responses cached for a Transport, which differ
+// by the DNS server and the DNSSEC flags of the query.
+type upstreamKey struct {
+	addr   string // network and address of the DNS server
+	do, cd bool
+}
+
+// upstream returns the cache of the responses to queries of the key, sent by
+// a Transport.
+func (c *Cache) upstream(key upstreamKey) *Cache {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.upstreams == nil {
+		c.upstreams = make(map[upstreamKey]*Cache)
+	}
+
+	uc, ok := c.upstreams[key]
+	if !ok {
+		uc = new(Cache)
+		c.upstreams[key] = uc
+	}
+	return uc
+}
+
+// scopedMessage is a cached response that applies only to clients within an
+// EDNS Client Subnet (RFC7871) scope.
+type scopedMessage struct {
+	subnet *net.IPNet
+	msg    *Message
 }
 
 // ServeDNS answers query questions from a local cache, and forwards unanswered
 // questions upstream, then caches the answers from the response.
+//
+// The status and sections of the upstream response are passed through to w, so
+// negative answers (and their authority SOA) reach the client intact. If the
+// upstream query fails, the response status is ServFail.
+//
+// Responses carrying an EDNS Client Subnet option with a non-zero scope prefix
+// are cached per scope network, and only answer queries whose client subnet
+// falls within that network.
 func (c *Cache) ServeDNS(ctx context.Context, w MessageWriter, r *Query) {
+	if len(r.Questions) == 0 {
+		w.Status(FormErr)
+		return
+	}
+
 	var (
 		miss bool
 
-		now = time.Now()
+		now    = time.Now()
+		subnet = clientSubnet(r.Message)
 	)
 
 	c.mu.RLock()
 	for _, q := range r.Questions {
-		if hit := c.lookup(q, w, now); !hit {
+		if hit := c.lookup(q, subnet, w, now); !hit {
 			miss = true
 		}
 	}
@@ -39,61 +99,253 @@ func (c *Cache) ServeDNS(ctx context.Context, w MessageWriter, r *Query) {
 		w.Status(ServFail)
 		return
 	}
-	if msg.RCode == NoError {
+	if cacheable(msg) {
 		c.insert(msg, now)
 	}
 	writeMessage(w, msg)
 }
 
-// c.mu.RLock held
-func (c *Cache) lookup(q Question, w MessageWriter, now time.Time) bool {
-	msg, ok := c.cache[q]
-	if !ok {
-		return false
+// Warm resolves each question via the Upstream round tripper, and caches the
+// successful answers. Questions are resolved concurrently; the first error
+// encountered is returned after all queries complete.
+func (c *Cache) Warm(ctx context.Context, questions ...Question) error {
+	if c.Upstream == nil {
+		return errNoUpstream
 	}
 
-	var answers, authorities, additionals []Resource
+	var (
+		wg   sync.WaitGroup
+		once sync.Once
+		err  error
+	)
 
-	for _, res := range msg.Answers {
-		if res.TTL = cacheTTL(res.TTL, now); res.TTL <= 0 {
-			return false
-		}
+	for _, q := range questions {
+		wg.Add(1)
+		go func(q Question) {
+			defer wg.Done()
 
-		answers = append(answers, res)
+			if qerr := c.warm(ctx, q); qerr != nil {
+				once.Do(func() { err = qerr })
+			}
+		}(q)
 	}
-	for _, res := range msg.Authorities {
-		if res.TTL = cacheTTL(res.TTL, now); res.TTL <= 0 {
-			return false
+	wg.Wait()
+
+	return err
+}
+
+func (c *Cache) warm(ctx context.Context, q Question) error {
+	query := &Query{
+		RemoteAddr: c.UpstreamAddr,
+		Message: &Message{
+			RecursionDesired: true,
+			Questions:        []Question{q},
+		},
+	}
+
+	now := time.Now()
+
+	msg, err := c.Upstream.Do(ctx, query)
+	if err != nil {
+		return err
+	}
+	if cacheable(msg) {
+		c.insert(msg, now)
+	}
+	return nil
+}
+
+// CacheEntry is a snapshot of a cached response.
+type CacheEntry struct {
+	Question Question
+
+	// TTL is the remaining time until the first resource of the entry
+	// expires.
+	TTL time.Duration
+
+	// Subnet is the client subnet scope of the entry, or nil if the entry
+	// applies to all clients.
+	Subnet *net.IPNet
+
+	// Answers, Authorities, and Additionals are the cached resources, with
+	// their TTLs set to the remaining time until expiry.
+	Answers     []Resource
+	Authorities []Resource
+	Additionals []Resource
+}
+
+// Walk calls fn for each unexpired cache entry, in no particular order. If fn
+// returns an error, the walk stops and the error is returned. The cache is
+// locked for reading while fn is called, so fn must not modify the cache.
+func (c *Cache) Walk(fn func(CacheEntry) error) error {
+	now := time.Now()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for q, msg := range c.cache {
+		entry, ok := cacheEntry(q, msg, now)
+		if !ok {
+			continue
 		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	for q, sms := range c.scoped {
+		for _, sm := range sms {
+			entry, ok := cacheEntry(q, sm.msg, now)
+			if !ok {
+				continue
+			}
+			entry.Subnet = sm.subnet
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
 
-		authorities = append(authorities, res)
+// Entries returns a snapshot of the unexpired cache entries, sorted by
+// question name, type, class, and subnet.
+func (c *Cache) Entries() []CacheEntry {
+	var entries []CacheEntry
+	c.Walk(func(entry CacheEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+
+	sort.Slice(entries, func(i, j int) bool {
+		qi, qj := entries[i].Question, entries[j].Question
+		if qi.Name != qj.Name {
+			return qi.Name < qj.Name
+		}
+		if qi.Type != qj.Type {
+			return qi.Type < qj.Type
+		}
+		if qi.Class != qj.Class {
+			return qi.Class < qj.Class
+		}
+		si, sj := entries[i].Subnet, entries[j].Subnet
+		if si == nil || sj == nil {
+			return si == nil && sj != nil
+		}
+		return si.String() < sj.String()
+	})
+	return entries
+}
+
+func cacheEntry(q Question, msg *Message, now time.Time) (CacheEntry, bool) {
+	entry := CacheEntry{Question: q, TTL: -1}
+
+	sections := []struct {
+		src []Resource
+		dst *[]Resource
+	}{
+		{msg.Answers, &entry.Answers},
+		{msg.Authorities, &entry.Authorities},
+		{msg.Additionals, &entry.Additionals},
 	}
-	for _, res := range msg.Additionals {
-		if res.TTL = cacheTTL(res.TTL, now); res.TTL <= 0 {
-			return false
+
+	for _, section := range sections {
+		for _, res := range section.src {
+			if res.TTL = cacheTTL(res.TTL, now); res.TTL <= 0 {
+				return CacheEntry{}, false
+			}
+			if entry.TTL < 0 || res.TTL < entry.TTL {
+				entry.TTL = res.TTL
+			}
+
+			*section.dst = append(*section.dst, res)
 		}
+	}
+	if entry.TTL < 0 {
+		entry.TTL = 0
+	}
+	return entry, true
+}
 
-		additionals = append(additionals, res)
+// c.mu.RLock held
+func (c *Cache) lookup(q Question, subnet *edns.ClientSubnet, w MessageWriter, now time.Time) bool {
+	msg := c.get(q, subnet)
+	if msg == nil {
+		return false
 	}
 
-	randomize(answers)
-	for _, res := range answers {
+	entry, ok := cacheEntry(q, msg, now)
+	if !ok {
+		return false
+	}
+
+	if msg.RCode != NoError {
+		w.Status(msg.RCode)
+	}
+	if msg.RecursionAvailable {
+		w.Recursion(true)
+	}
+
+	randomize(entry.Answers)
+	for _, res := range entry.Answers {
 		w.Answer(res.Name, res.TTL, res.Record)
 	}
-	for _, res := range authorities {
+	for _, res := range entry.Authorities {
 		w.Authority(res.Name, res.TTL, res.Record)
 	}
-	for _, res := range additionals {
+	for _, res := range entry.Additionals {
 		w.Additional(res.Name, res.TTL, res.Record)
 	}
 
 	return true
 }
 
+// get returns the cached response for q. If the query carries a client
+// subnet, the response with the longest scope containing the subnet is
+// preferred over an unscoped response.
+//
+// c.mu.RLock held
+func (c *Cache) get(q Question, subnet *edns.ClientSubnet) *Message {
+	if subnet != nil {
+		var (
+			msg   *Message
+			scope = -1
+		)
+
+		for _, sm := range c.scoped[q] {
+			ones, _ := sm.subnet.Mask.Size()
+			if ones > subnet.SourcePrefix || ones <= scope {
+				continue
+			}
+			if !sm.subnet.Contains(subnet.Address) {
+				continue
+			}
+
+			msg, scope = sm.msg, ones
+		}
+
+		if msg != nil {
+			return msg
+		}
+	}
+
+	return c.cache[q]
+}
+
 func (c *Cache) insert(msg *Message, now time.Time) {
+	var scope *net.IPNet
+	if subnet := clientSubnet(msg); subnet != nil && subnet.ScopePrefix > 0 {
+		if scope = subnet.Network(subnet.ScopePrefix); scope == nil {
+			return
+		}
+	}
+
 	cache := make(map[Question]*Message, len(msg.Questions))
 	for _, q := range msg.Questions {
-		m := new(Message)
+		m := &Message{
+			RCode:              msg.RCode,
+			RecursionAvailable: msg.RecursionAvailable,
+			AuthenticatedData:  msg.AuthenticatedData,
+		}
 		for _, res := range msg.Answers {
 			res.TTL = cacheEpoch(res.TTL, now)
 			m.Answers = append(m.Answers, res)
@@ -103,6 +355,10 @@ func (c *Cache) insert(msg *Message, now time.Time) {
 			m.Authorities = append(m.Authorities, res)
 		}
 		for _, res := range msg.Additionals {
+			if res.Record.Type() == TypeOPT {
+				continue // OPT records are hop-by-hop, and never cached
+			}
+
 			res.TTL = cacheEpoch(res.TTL, now)
 			m.Additionals = append(m.Additionals, res)
 		}
@@ -113,6 +369,11 @@ func (c *Cache) insert(msg *Message, now time.Time) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	if scope != nil {
+		c.insertScoped(cache, scope)
+		return
+	}
+
 	if c.cache == nil {
 		c.cache = cache
 		return
@@ -123,6 +384,64 @@ func (c *Cache) insert(msg *Message, now time.Time) {
 	}
 }
 
+// cacheable reports whether the response msg may be cached. Successful
+// responses are cacheable, as are name errors with an authority section to
+// bound the negative TTL.
+func cacheable(msg *Message) bool {
+	switch msg.RCode {
+	case NoError:
+		return true
+	case NXDomain:
+		return len(msg.Authorities) > 0
+	default:
+		return false
+	}
+}
+
+// c.mu held
+func (c *Cache) insertScoped(cache map[Question]*Message, scope *net.IPNet) {
+	if c.scoped == nil {
+		c.scoped = make(map[Question][]scopedMessage, len(cache))
+	}
+
+outer:
+	for q, m := range cache {
+		sms := c.scoped[q]
+		for i, sm := range sms {
+			if sm.subnet.String() == scope.String() {
+				sms[i].msg = m
+				continue outer
+			}
+		}
+		c.scoped[q] = append(sms, scopedMessage{subnet: scope, msg: m})
+	}
+}
+
+// clientSubnet returns the last EDNS Client Subnet option of msg, or nil if
+// msg has none.
+func clientSubnet(msg *Message) *edns.ClientSubnet {
+	var subnet *edns.ClientSubnet
+	for _, res := range msg.Additionals {
+		opt, ok := res.Record.(*OPT)
+		if !ok {
+			continue
+		}
+
+		for _, o := range opt.Options {
+			if o.Code != edns.OptionCodeEDNSClientSubnet {
+				continue
+			}
+
+			s := new(edns.ClientSubnet)
+			if _, err := s.Unpack(o.Data); err != nil {
+				continue
+			}
+			subnet = s
+		}
+	}
+	return subnet
+}
+
 func cacheEpoch(ttl time.Duration, now time.Time) time.Duration {
 	return time.Duration(now.Add(ttl).UnixNano())
 }
@@ -153,3 +472,139 @@ func shuffle(s []Resource) {
 		s[i], s[j] = s[j], s[i]
 	}
 }
+
+// cacheConn is a Conn that answers queries from a Cache, and caches the
+// responses received from the underlying connection. Responses are cached
+// per DNS server, and per DO and CD bits of the query.
+type cacheConn struct {
+	Conn
+
+	cache *Cache
+	addr  net.Addr // the dialed address
+
+	mu      sync.Mutex
+	hit     []*Message
+	raw     []byte
+	pending map[int]upstreamKey
+}
+
+// Send answers msg from the cache if possible, otherwise msg is sent on the
+// underlying connection.
+func (c *cacheConn) Send(msg *Message) error {
+	key := c.key(msg)
+	if res := c.lookup(key, msg, time.Now()); res != nil {
+		c.mu.Lock()
+		c.hit = append(c.hit, res)
+		c.mu.Unlock()
+		return nil
+	}
+
+	c.mu.Lock()
+	if c.pending == nil {
+		c.pending = make(map[int]upstreamKey)
+	}
+	c.pending[msg.ID] = key
+	c.mu.Unlock()
+
+	return c.Conn.Send(msg)
+}
+
+// key returns the key of the cached responses to the query msg.
+func (c *cacheConn) key(msg *Message) upstreamKey {
+	key := upstreamKey{
+		do: dnssecOK(msg),
+		cd: msg.CheckingDisabled,
+	}
+	if addr := upstreamAddr(c.Conn, c.addr); addr != nil {
+		key.addr = addr.Network() + "/" + addr.String()
+	}
+	return key
+}
+
+// Recv returns a cached response if one is pending, otherwise a response is
+// read from the underlying connection and cached.
+func (c *cacheConn) Recv(msg *Message) error {
+	c.mu.Lock()
+	if len(c.hit) > 0 {
+		*msg = *c.hit[0]
+		c.hit = c.hit[1:]
+		c.raw = nil
+		c.mu.Unlock()
+		return nil
+	}
+	c.mu.Unlock()
+
+	if err := c.Conn.Recv(msg); err != nil {
+		return err
+	}
+
+	raw, _ := rawBytes(c.Conn)
+	c.mu.Lock()
+	c.raw = raw
+	c.mu.Unlock()
+
+	c.mu.Lock()
+	key, ok := c.pending[msg.ID]
+	delete(c.pending, msg.ID)
+	c.mu.Unlock()
+
+	if ok && msg.OpCode == OpQuery && !msg.Truncated && len(msg.Questions) == 1 && cacheable(msg) {
+		c.cache.upstream(key).insert(msg, time.Now())
+	}
+	return nil
+}
+
+// Raw returns the wire format of the last message read by Recv from the
+// underlying connection, or nil if the message was answered from the cache.
+func (c *cacheConn) Raw() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.raw
+}
+
+// Upstream returns the address of the DNS server the underlying connection
+// is connected to, if it is known.
+func (c *cacheConn) Upstream() net.Addr {
+	if uc, ok := c.Conn.(upstreamAddrConn); ok {
+		return uc.Upstream()
+	}
+	return nil
+}
+
+// lookup returns the cached response of the key to the single question query
+// msg, or nil if there is none.
+func (c *cacheConn) lookup(key upstreamKey, msg *Message, now time.Time) *Message {
+	if msg.OpCode != OpQuery || len(msg.Questions) != 1 {
+		return nil
+	}
+	q := msg.Questions[0]
+
+	cache := c.cache.upstream(key)
+	cache.mu.RLock()
+	cached := cache.get(q, clientSubnet(msg))
+	cache.mu.RUnlock()
+	if cached == nil {
+		return nil
+	}
+
+	entry, ok := cacheEntry(q, cached, now)
+	if !ok {
+		return nil
+	}
+
+	return &Message{
+		ID:                 msg.ID,
+		Response:           true,
+		OpCode:             msg.OpCode,
+		RecursionDesired:   msg.RecursionDesired,
+		RecursionAvailable: cached.RecursionAvailable,
+		AuthenticatedData:  cached.AuthenticatedData,
+		CheckingDisabled:   msg.CheckingDisabled,
+		RCode:              cached.RCode,
+		Questions:          []Question{q},
+		Answers:            entry.Answers,
+		Authorities:        entry.Authorities,
+		Additionals:        entry.Additionals,
+	}
+}
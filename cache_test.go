@@ -5,8 +5,12 @@ import (
 	"errors"
 	"math/rand"
 	"net"
+	"reflect"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/benburkert/dns/edns"
 )
 
 func TestCache(t *testing.T) {
@@ -168,3 +172,615 @@ var badSend = errors.New("bad send")
 func (badConn) Send(_ *Message) error {
 	return badSend
 }
+
+func TestCacheWarm(t *testing.T) {
+	t.Parallel()
+
+	var queries int32
+
+	upstream := &Client{
+		Transport: nopDialer{},
+		Resolver: HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+			atomic.AddInt32(&queries, 1)
+
+			switch r.Questions[0].Name {
+			case "a.test.local.":
+				w.Answer("a.test.local.", time.Minute, &A{A: net.IPv4(127, 0, 0, 1).To4()})
+			case "b.test.local.":
+				w.Answer("b.test.local.", time.Minute, &A{A: net.IPv4(127, 0, 0, 2).To4()})
+			default:
+				w.Status(NXDomain)
+			}
+		}),
+	}
+
+	cache := &Cache{Upstream: upstream}
+
+	questions := []Question{
+		{Name: "a.test.local.", Type: TypeA, Class: ClassIN},
+		{Name: "b.test.local.", Type: TypeA, Class: ClassIN},
+		{Name: "c.test.local.", Type: TypeA, Class: ClassIN},
+	}
+
+	if err := cache.Warm(context.Background(), questions...); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := int32(3), atomic.LoadInt32(&queries); want != got {
+		t.Fatalf("want %d upstream queries, got %d", want, got)
+	}
+
+	client := &Client{
+		Transport: badDialer{},
+		Resolver:  cache,
+	}
+
+	for i, want := range []string{"127.0.0.1", "127.0.0.2"} {
+		query := &Query{
+			Message: &Message{
+				Questions: []Question{questions[i]},
+			},
+		}
+
+		msg, err := client.Do(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := msg.Answers[0].Record.(*A).A.String(); want != got {
+			t.Errorf("want A record %q, got %q", want, got)
+		}
+	}
+
+	query := &Query{
+		Message: &Message{
+			Questions: []Question{questions[2]},
+		},
+	}
+
+	if _, err := client.Do(context.Background(), query); err != badSend {
+		t.Errorf("want uncached error %q, got %v", badSend, err)
+	}
+
+	if want, got := errNoUpstream, new(Cache).Warm(context.Background(), questions...); want != got {
+		t.Errorf("want error %q, got %v", want, got)
+	}
+}
+
+func TestCacheEntries(t *testing.T) {
+	t.Parallel()
+
+	cache := new(Cache)
+	now := time.Now()
+
+	cache.insert(&Message{
+		Questions: []Question{{Name: "b.test.local.", Type: TypeA, Class: ClassIN}},
+		Answers: []Resource{
+			{Name: "b.test.local.", Class: ClassIN, TTL: time.Minute, Record: &A{A: net.IPv4(127, 0, 0, 2).To4()}},
+		},
+		Authorities: []Resource{
+			{Name: "test.local.", Class: ClassIN, TTL: 30 * time.Second, Record: &NS{NS: "ns.test.local."}},
+		},
+	}, now)
+	cache.insert(&Message{
+		Questions: []Question{{Name: "a.test.local.", Type: TypeA, Class: ClassIN}},
+		Answers: []Resource{
+			{Name: "a.test.local.", Class: ClassIN, TTL: time.Minute, Record: &A{A: net.IPv4(127, 0, 0, 1).To4()}},
+		},
+	}, now)
+	cache.insert(&Message{
+		Questions: []Question{{Name: "expired.test.local.", Type: TypeA, Class: ClassIN}},
+		Answers: []Resource{
+			{Name: "expired.test.local.", Class: ClassIN, TTL: -time.Second, Record: &A{A: net.IPv4(127, 0, 0, 3).To4()}},
+		},
+	}, now)
+
+	entries := cache.Entries()
+	if want, got := 2, len(entries); want != got {
+		t.Fatalf("want %d entries, got %d", want, got)
+	}
+
+	if want, got := "a.test.local.", entries[0].Question.Name; want != got {
+		t.Errorf("want first entry %q, got %q", want, got)
+	}
+	if want, got := "b.test.local.", entries[1].Question.Name; want != got {
+		t.Errorf("want second entry %q, got %q", want, got)
+	}
+
+	entry := entries[1]
+	if ttl := entry.TTL; ttl <= 0 || ttl > 30*time.Second {
+		t.Errorf("want entry TTL in (0, 30s], got %s", ttl)
+	}
+	if want, got := 1, len(entry.Answers); want != got {
+		t.Fatalf("want %d answers, got %d", want, got)
+	}
+	if ttl := entry.Answers[0].TTL; ttl <= 30*time.Second || ttl > time.Minute {
+		t.Errorf("want answer TTL in (30s, 1m], got %s", ttl)
+	}
+	if want, got := 1, len(entry.Authorities); want != got {
+		t.Fatalf("want %d authorities, got %d", want, got)
+	}
+	if want, got := "ns.test.local.", entry.Authorities[0].Record.(*NS).NS; want != got {
+		t.Errorf("want authority NS %q, got %q", want, got)
+	}
+
+	errStop := errors.New("stop")
+
+	var calls int
+	err := cache.Walk(func(CacheEntry) error {
+		calls++
+		return errStop
+	})
+	if want, got := errStop, err; want != got {
+		t.Errorf("want walk error %q, got %v", want, got)
+	}
+	if want, got := 1, calls; want != got {
+		t.Errorf("want %d walk calls, got %d", want, got)
+	}
+}
+
+func TestCacheSections(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+
+		msg *Message
+	}{
+		{
+			name: "referral",
+
+			msg: &Message{
+				RecursionAvailable: true,
+				Answers: []Resource{
+					{Name: "test.local.", Class: ClassIN, TTL: time.Minute, Record: &A{A: net.IPv4(127, 0, 0, 1).To4()}},
+				},
+				Authorities: []Resource{
+					{Name: "test.local.", Class: ClassIN, TTL: time.Minute, Record: &NS{NS: "ns1.test.local."}},
+					{Name: "test.local.", Class: ClassIN, TTL: time.Minute, Record: &NS{NS: "ns2.test.local."}},
+				},
+				Additionals: []Resource{
+					{Name: "ns1.test.local.", Class: ClassIN, TTL: time.Minute, Record: &A{A: net.IPv4(127, 0, 1, 1).To4()}},
+					{Name: "ns2.test.local.", Class: ClassIN, TTL: time.Minute, Record: &AAAA{AAAA: net.ParseIP("::1")}},
+				},
+			},
+		},
+		{
+			name: "nxdomain",
+
+			msg: &Message{
+				RCode: NXDomain,
+				Authorities: []Resource{
+					{Name: "local.", Class: ClassIN, TTL: time.Minute, Record: &SOA{
+						NS:      "ns.local.",
+						MBox:    "hostmaster.local.",
+						Serial:  1,
+						Refresh: time.Hour,
+						Retry:   time.Minute,
+						Expire:  24 * time.Hour,
+						MinTTL:  time.Minute,
+					}},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var queries int32
+
+			upstream := HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+				atomic.AddInt32(&queries, 1)
+				writeMessage(w, test.msg)
+			})
+
+			cache := new(Cache)
+			client := &Client{
+				Transport: nopDialer{},
+				Resolver: HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+					cache.ServeDNS(ctx, &recurWriter{MessageWriter: w, upstream: upstream, query: r}, r)
+				}),
+			}
+
+			query := &Query{
+				Message: &Message{
+					Questions: []Question{{Name: "test.local.", Type: TypeA, Class: ClassIN}},
+				},
+			}
+
+			for i := 0; i < 2; i++ {
+				msg, err := client.Do(context.Background(), query)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if want, got := test.msg.RCode, msg.RCode; want != got {
+					t.Errorf("response %d: want rcode %d, got %d", i, want, got)
+				}
+				if want, got := test.msg.RecursionAvailable, msg.RecursionAvailable; want != got {
+					t.Errorf("response %d: want recursion available %t, got %t", i, want, got)
+				}
+
+				sections := []struct {
+					name      string
+					want, got []Resource
+				}{
+					{"answer", test.msg.Answers, msg.Answers},
+					{"authority", test.msg.Authorities, msg.Authorities},
+					{"additional", test.msg.Additionals, msg.Additionals},
+				}
+
+				for _, section := range sections {
+					if want, got := len(section.want), len(section.got); want != got {
+						t.Errorf("response %d: want %d %s resources, got %d", i, want, section.name, got)
+						continue
+					}
+					for j, res := range section.want {
+						got := section.got[j]
+						if res.Name != got.Name || !reflect.DeepEqual(res.Record, got.Record) {
+							t.Errorf("response %d: want %s resource %+v, got %+v", i, section.name, res, got)
+						}
+					}
+				}
+			}
+
+			if want, got := int32(1), atomic.LoadInt32(&queries); want != got {
+				t.Errorf("want %d upstream queries, got %d", want, got)
+			}
+		})
+	}
+}
+
+// recurWriter forwards Recur calls to an upstream handler.
+type recurWriter struct {
+	MessageWriter
+
+	upstream Handler
+	query    *Query
+}
+
+func (w *recurWriter) Recur(ctx context.Context) (*Message, error) {
+	client := &Client{
+		Transport: nopDialer{},
+		Resolver:  w.upstream,
+	}
+	return client.Do(ctx, w.query)
+}
+
+func TestCacheClientSubnet(t *testing.T) {
+	t.Parallel()
+
+	var queries int32
+
+	upstream := HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+		atomic.AddInt32(&queries, 1)
+
+		subnet := clientSubnet(r.Message)
+		if subnet == nil {
+			w.Answer("test.local.", time.Minute, &A{A: net.IPv4(127, 0, 0, 1).To4()})
+			return
+		}
+
+		// answer with the second octet of the client subnet, scoped to /16
+		ip := subnet.Address.To4()
+		w.Answer("test.local.", time.Minute, &A{A: net.IPv4(127, 0, ip[1], 1).To4()})
+
+		scoped := *subnet
+		scoped.ScopePrefix = 16
+		opt, err := scoped.Option()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Additional(".", 0, &OPT{Options: []edns.Option{opt}})
+	})
+
+	cache := new(Cache)
+	client := &Client{
+		Transport: nopDialer{},
+		Resolver: HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+			cache.ServeDNS(ctx, &recurWriter{MessageWriter: w, upstream: upstream, query: r}, r)
+		}),
+	}
+
+	tests := []struct {
+		subnet string
+
+		answer  string
+		queries int32
+	}{
+		{subnet: "10.1.2.0/24", answer: "127.0.1.1", queries: 1},
+		{subnet: "10.2.2.0/24", answer: "127.0.2.1", queries: 2},
+		{subnet: "10.1.9.0/24", answer: "127.0.1.1", queries: 2},
+		{subnet: "10.2.200.0/24", answer: "127.0.2.1", queries: 2},
+		{subnet: "10.1.0.0/8", answer: "127.0.0.1", queries: 3},
+		{subnet: "", answer: "127.0.0.1", queries: 4},
+		{subnet: "", answer: "127.0.0.1", queries: 4},
+	}
+
+	for _, test := range tests {
+		query := &Query{
+			Message: &Message{
+				Questions: []Question{{Name: "test.local.", Type: TypeA, Class: ClassIN}},
+			},
+		}
+
+		if test.subnet != "" {
+			ip, ipnet, err := net.ParseCIDR(test.subnet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ones, _ := ipnet.Mask.Size()
+
+			opt, err := edns.ClientSubnet{
+				Family:       edns.FamilyIPv4,
+				SourcePrefix: ones,
+				Address:      ip,
+			}.Option()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			query.Additionals = []Resource{
+				{Name: ".", Record: &OPT{Options: []edns.Option{opt}}},
+			}
+		}
+
+		msg, err := client.Do(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := test.answer, msg.Answers[0].Record.(*A).A.String(); want != got {
+			t.Errorf("subnet %q: want A record %q, got %q", test.subnet, want, got)
+		}
+		if want, got := test.queries, atomic.LoadInt32(&queries); want != got {
+			t.Errorf("subnet %q: want %d upstream queries, got %d", test.subnet, want, got)
+		}
+	}
+
+	entries := cache.Entries()
+	if want, got := 4, len(entries); want != got {
+		t.Fatalf("want %d cache entries, got %d", want, got)
+	}
+	if entries[0].Subnet != nil {
+		t.Errorf("want unscoped first entry, got %s", entries[0].Subnet)
+	}
+	for i, want := range []string{"10.0.0.0/16", "10.1.0.0/16", "10.2.0.0/16"} {
+		if got := entries[i+1].Subnet.String(); want != got {
+			t.Errorf("want entry subnet %q, got %q", want, got)
+		}
+	}
+	if want, got := 0, len(entries[1].Additionals); want != got {
+		t.Errorf("want %d cached additionals, got %d", want, got)
+	}
+}
+
+func TestCacheUpstreamStatus(t *testing.T) {
+	t.Parallel()
+
+	soa := Resource{
+		Name:  "local.",
+		Class: ClassIN,
+		TTL:   time.Minute,
+		Record: &SOA{
+			NS:      "ns.local.",
+			MBox:    "hostmaster.local.",
+			Serial:  1,
+			Refresh: time.Hour,
+			Retry:   time.Minute,
+			Expire:  24 * time.Hour,
+			MinTTL:  time.Minute,
+		},
+	}
+
+	tests := []struct {
+		name string
+
+		rcode       RCode
+		authorities []Resource
+		err         error
+
+		wantRCode       RCode
+		wantAuthorities int
+	}{
+		{
+			name: "nxdomain",
+
+			rcode:       NXDomain,
+			authorities: []Resource{soa},
+
+			wantRCode:       NXDomain,
+			wantAuthorities: 1,
+		},
+		{
+			name: "nodata",
+
+			rcode:       NoError,
+			authorities: []Resource{soa},
+
+			wantRCode:       NoError,
+			wantAuthorities: 1,
+		},
+		{
+			name: "servfail",
+
+			rcode: ServFail,
+
+			wantRCode: ServFail,
+		},
+		{
+			name: "refused",
+
+			rcode: Refused,
+
+			wantRCode: Refused,
+		},
+		{
+			name: "recur-error",
+
+			err: errors.New("upstream unreachable"),
+
+			wantRCode: ServFail,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			cache := new(Cache)
+			handler := HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+				cache.ServeDNS(ctx, &statusWriter{
+					MessageWriter: w,
+
+					msg: &Message{
+						RCode:       test.rcode,
+						Authorities: test.authorities,
+					},
+					err: test.err,
+				}, r)
+			})
+
+			client := &Client{
+				Transport: nopDialer{},
+				Resolver:  handler,
+			}
+
+			query := &Query{
+				Message: &Message{
+					Questions: []Question{{Name: "test.local.", Type: TypeA, Class: ClassIN}},
+				},
+			}
+
+			msg, err := client.Do(context.Background(), query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want, got := test.wantRCode, msg.RCode; want != got {
+				t.Errorf("want rcode %d, got %d", want, got)
+			}
+			if want, got := test.wantAuthorities, len(msg.Authorities); want != got {
+				t.Fatalf("want %d authorities, got %d", want, got)
+			}
+			if test.wantAuthorities > 0 {
+				if _, ok := msg.Authorities[0].Record.(*SOA); !ok {
+					t.Errorf("want authority SOA, got %T", msg.Authorities[0].Record)
+				}
+			}
+		})
+	}
+}
+
+// statusWriter answers Recur calls with a fixed response or error.
+type statusWriter struct {
+	MessageWriter
+
+	msg *Message
+	err error
+}
+
+func (w *statusWriter) Recur(context.Context) (*Message, error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	return w.msg, nil
+}
+
+func TestCacheConnKey(t *testing.T) {
+	t.Parallel()
+
+	cache := new(Cache)
+
+	addrA := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 53}
+	addrB := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 53}
+
+	// the tests run in order, each with the responses cached by the
+	// previous tests
+	tests := []struct {
+		name string
+
+		addr   net.Addr
+		do, cd bool
+
+		sent bool
+	}{
+		{
+			name: "miss",
+
+			addr: addrA,
+
+			sent: true,
+		},
+		{
+			name: "hit",
+
+			addr: addrA,
+		},
+		{
+			name: "other-upstream",
+
+			addr: addrB,
+
+			sent: true,
+		},
+		{
+			name: "dnssec-ok",
+
+			addr: addrA,
+			do:   true,
+
+			sent: true,
+		},
+		{
+			name: "checking-disabled",
+
+			addr: addrA,
+			cd:   true,
+
+			sent: true,
+		},
+		{
+			name: "dnssec-ok-hit",
+
+			addr: addrA,
+			do:   true,
+		},
+	}
+
+	for i, test := range tests {
+		conn := &adConn{}
+		cc := &cacheConn{Conn: conn, cache: cache, addr: test.addr}
+
+		req := &Message{
+			ID:               i,
+			CheckingDisabled: test.cd,
+			Questions:        []Question{{Name: "test.local.", Type: TypeA, Class: ClassIN}},
+		}
+		if test.do {
+			req.Additionals = []Resource{
+				{Name: ".", Class: 4096, TTL: ednsDO * time.Second, Record: new(OPT)},
+			}
+		}
+
+		if err := cc.Send(req); err != nil {
+			t.Fatal(err)
+		}
+
+		var res Message
+		if err := cc.Recv(&res); err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := test.sent, conn.query != nil; want != got {
+			t.Errorf("%s: want query sent %t, got %t", test.name, want, got)
+		}
+		if !res.AuthenticatedData {
+			t.Errorf("%s: want AD bit of cached response kept", test.name)
+		}
+	}
+}
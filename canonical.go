@@ -0,0 +1,151 @@
+package dns
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// canonicalCompressor packs domain names uncompressed and in lowercase, for
+// comparing messages regardless of the case of names.
+type canonicalCompressor struct{}
+
+func (canonicalCompressor) Length(names ...string) (int, error) {
+	return compressor{}.Length(names...)
+}
+
+func (canonicalCompressor) Pack(b []byte, fqdn string) ([]byte, error) {
+	return compressor{}.Pack(b, strings.ToLower(fqdn))
+}
+
+// canonicalRR is a resource record in canonical form.
+type canonicalRR struct {
+	name  string
+	typ   Type
+	rdata []byte
+	wire  []byte
+
+	res Resource
+}
+
+func newCanonicalRR(res Resource) (canonicalRR, error) {
+	crr := res
+	crr.Name = strings.ToLower(res.Name)
+	crr.Record = canonicalRecord(res.Record)
+
+	wire, err := crr.Pack(nil, compressor{})
+	if err != nil {
+		return canonicalRR{}, err
+	}
+
+	rdata, err := crr.Record.Pack(nil, compressor{})
+	if err != nil {
+		return canonicalRR{}, err
+	}
+
+	return canonicalRR{
+		name:  res.Name,
+		typ:   res.Record.Type(),
+		rdata: rdata,
+		wire:  wire,
+		res:   res,
+	}, nil
+}
+
+// canonicalRecord returns rec with the domain names of its RDATA in
+// lowercase, if the type of rec is listed in RFC 4034, section 6.2, as
+// updated by RFC 6840, section 5.1. The names in the RDATA of other types
+// keep their case in the canonical RR form.
+func canonicalRecord(rec Record) Record {
+	switch rec := rec.(type) {
+	case *NS:
+		return &NS{NS: strings.ToLower(rec.NS)}
+	case *CNAME:
+		return &CNAME{CNAME: strings.ToLower(rec.CNAME)}
+	case *SOA:
+		soa := *rec
+		soa.NS, soa.MBox = strings.ToLower(rec.NS), strings.ToLower(rec.MBox)
+		return &soa
+	case *PTR:
+		return &PTR{PTR: strings.ToLower(rec.PTR)}
+	case *MX:
+		return &MX{Pref: rec.Pref, MX: strings.ToLower(rec.MX)}
+	case *RP:
+		return &RP{MBox: strings.ToLower(rec.MBox), TXT: strings.ToLower(rec.TXT)}
+	case *AFSDB:
+		return &AFSDB{Subtype: rec.Subtype, Hostname: strings.ToLower(rec.Hostname)}
+	case *SRV:
+		srv := *rec
+		srv.Target = strings.ToLower(rec.Target)
+		return &srv
+	case *NAPTR:
+		naptr := *rec
+		naptr.Replacement = strings.ToLower(rec.Replacement)
+		return &naptr
+	case *DNAME:
+		return &DNAME{DNAME: strings.ToLower(rec.DNAME)}
+	case *RRSIG:
+		sig := *rec
+		sig.SignerName = strings.ToLower(rec.SignerName)
+		return &sig
+	}
+	return rec
+}
+
+// sortCanonical sorts rrs by owner name, type, and RDATA in canonical order
+// and removes duplicate records.
+func sortCanonical(rrs []canonicalRR) []canonicalRR {
+	sort.Slice(rrs, func(i, j int) bool {
+		return compareCanonical(rrs[i], rrs[j]) < 0
+	})
+
+	var uniq []canonicalRR
+	for i, rr := range rrs {
+		if i > 0 && bytes.Equal(rrs[i-1].wire, rr.wire) {
+			continue
+		}
+		uniq = append(uniq, rr)
+	}
+	return uniq
+}
+
+func compareCanonical(a, b canonicalRR) int {
+	if c := compareNames(a.name, b.name); c != 0 {
+		return c
+	}
+	switch {
+	case a.typ < b.typ:
+		return -1
+	case a.typ > b.typ:
+		return 1
+	}
+	return bytes.Compare(a.rdata, b.rdata)
+}
+
+// compareNames compares two domain names in the canonical DNS name order
+// defined in RFC 4034, section 6.1.
+func compareNames(a, b string) int {
+	as, bs := labels(strings.ToLower(a)), labels(strings.ToLower(b))
+	for i, j := len(as)-1, len(bs)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if c := strings.Compare(as[i], bs[j]); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+	return 0
+}
+
+// labels returns the labels of a domain name, excluding the root label.
+func labels(name string) []string {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" {
+		return nil
+	}
+	return strings.Split(name, ".")
+}
@@ -3,7 +3,9 @@ package dns
 import (
 	"context"
 	"net"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // Client is a DNS client.
@@ -13,12 +15,76 @@ type Client struct {
 
 	// Resolver is a handler that may answer all or portions of a query.
 	// Any questions answered by the handler are not sent to the upstream
-	// server.
+	// server. Multiple handlers may be composed with a Chain.
 	Resolver Handler
 
+	// PreserveID disables rewriting of query message IDs. By default, each
+	// query sent upstream is assigned an ID from an internal counter, and the
+	// original ID is restored on the response. If PreserveID is set, queries
+	// are sent with the caller supplied ID unchanged.
+	PreserveID bool
+
+	// RequestAD sets the AD bit of queries sent upstream, to request that a
+	// validating resolver indicate if the response data is authenticated
+	// (RFC 6840, section 5.7).
+	RequestAD bool
+
+	// ADPolicy is the trust of the AD bit in upstream responses.
+	ADPolicy ADPolicy
+
+	// RetryUpstream is the number of times a query answered by the upstream
+	// server with a "Server Failure", "Query Refused", or "Not Implemented"
+	// message is sent again, over a new connection to the server picked by
+	// the Transport, such as the next server of a RoundRobin Proxy. A
+	// pipelined connection to the failed server is not reused, and is closed
+	// once its queries in flight are answered. The last response is returned
+	// if every attempt fails.
+	RetryUpstream int
+
+	// Cookies optionally adds DNS Cookies (RFC 7873) to queries sent
+	// upstream. A response with a client cookie that does not match the
+	// query is rejected, and a BADCOOKIE response is retried once with the
+	// new server cookie.
+	Cookies *ClientCookies
+
 	id uint32
 }
 
+// ADPolicy is the trust of the AD bit of responses from upstream servers. An
+// AD bit is only meaningful if the path to the validating resolver is
+// secure (RFC 6840, section 5.8).
+type ADPolicy int
+
+const (
+	// ADTrustAll leaves the AD bit of all responses unchanged.
+	ADTrustAll ADPolicy = iota
+
+	// ADTrustNone clears the AD bit of all responses.
+	ADTrustNone
+
+	// ADTrustSecure clears the AD bit of responses not received over an
+	// authenticated transport, DNS-over-TLS, DNS-over-HTTPS, or
+	// DNS-over-QUIC. The transport is that of the upstream server the query
+	// is sent to, after any Proxy of the Transport.
+	ADTrustSecure
+)
+
+// trust reports whether the AD bit of a response from addr is trusted.
+func (p ADPolicy) trust(addr net.Addr) bool {
+	switch p {
+	case ADTrustNone:
+		return false
+	case ADTrustSecure:
+		switch addr.(type) {
+		case OverTLSAddr, OverHTTPSAddr, OverQUICAddr:
+			return true
+		}
+		return false
+	default:
+		return true
+	}
+}
+
 // Dial dials a DNS server and returns a net Conn that reads and writes DNS
 // messages.
 func (c *Client) Dial(ctx context.Context, network, address string) (net.Conn, error) {
@@ -68,18 +134,79 @@ func (c *Client) Dial(ctx context.Context, network, address string) (net.Conn, e
 
 // Do sends a DNS query to a server and returns the response message.
 func (c *Client) Do(ctx context.Context, query *Query) (*Message, error) {
-	conn, err := c.dial(ctx, query.RemoteAddr)
+	conn, err := c.dialQuery(ctx, query.RemoteAddr)
 	if err != nil {
 		return nil, err
 	}
 
-	if t, ok := ctx.Deadline(); ok {
-		if err := conn.SetDeadline(t); err != nil {
-			return nil, err
-		}
+	return c.do(ctx, conn, query)
+}
+
+// DoInto is like Do, but the response is decoded into res instead of a newly
+// allocated Message. The section slices of res are reused if they have
+// sufficient capacity, so a caller issuing many queries can avoid allocating
+// a response for each.
+func (c *Client) DoInto(ctx context.Context, query *Query, res *Message) error {
+	conn, err := c.dialQuery(ctx, query.RemoteAddr)
+	if err != nil {
+		return err
 	}
 
-	return c.do(ctx, conn, query)
+	if c.Resolver == nil && c.RetryUpstream <= 0 {
+		return c.roundtripInto(conn, query, res)
+	}
+
+	msg, err := c.do(ctx, conn, query)
+	if err != nil {
+		return err
+	}
+
+	copyMessage(res, msg)
+	return nil
+}
+
+// A QuestionResult is the response to a single question of a query sent by
+// DoEach, or the error sending it.
+type QuestionResult struct {
+	Question Question
+	Message  *Message
+	Err      error
+}
+
+// DoEach sends each question of the query to the server in a separate query,
+// concurrently, and returns a channel of the results in the order the queries
+// complete. Each query is bounded by the timeout if it is positive, so a slow
+// question does not delay the results of the others. The channel is closed
+// after the results of all questions are sent.
+func (c *Client) DoEach(ctx context.Context, query *Query, timeout time.Duration) <-chan QuestionResult {
+	results := make(chan QuestionResult, len(query.Questions))
+
+	var wg sync.WaitGroup
+	for _, q := range query.Questions {
+		req := *query.Message // shallow copy
+		req.Questions = []Question{q}
+
+		wg.Add(1)
+		go func(q Question, req *Message) {
+			defer wg.Done()
+
+			qctx := ctx
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				qctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+
+			msg, err := c.Do(qctx, &Query{Message: req, RemoteAddr: query.RemoteAddr})
+			results <- QuestionResult{Question: q, Message: msg, Err: err}
+		}(q, &req)
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
 }
 
 func (c *Client) dial(ctx context.Context, addr net.Addr) (Conn, error) {
@@ -91,9 +218,50 @@ func (c *Client) dial(ctx context.Context, addr net.Addr) (Conn, error) {
 	return tport.DialAddr(ctx, addr)
 }
 
+// redialer is an AddrDialer that can dial a new connection for an address,
+// instead of reusing a connection to the server picked before.
+type redialer interface {
+	redialAddr(context.Context, net.Addr) (Conn, error)
+}
+
+// dialQuery dials the server at addr, and sets the deadline of the
+// connection to the deadline of ctx.
+func (c *Client) dialQuery(ctx context.Context, addr net.Addr) (Conn, error) {
+	conn, err := c.dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	return queryConn(ctx, conn)
+}
+
+// redialQuery is like dialQuery, but dials a new connection if the Transport
+// reuses connections, so the Transport picks the server again.
+func (c *Client) redialQuery(ctx context.Context, addr net.Addr) (Conn, error) {
+	rd, ok := c.Transport.(redialer)
+	if !ok {
+		return c.dialQuery(ctx, addr)
+	}
+
+	conn, err := rd.redialAddr(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	return queryConn(ctx, conn)
+}
+
+// queryConn sets the deadline of conn to the deadline of ctx.
+func queryConn(ctx context.Context, conn Conn) (Conn, error) {
+	if t, ok := ctx.Deadline(); ok && conn != nil {
+		if err := conn.SetDeadline(t); err != nil {
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
 func (c *Client) do(ctx context.Context, conn Conn, query *Query) (*Message, error) {
 	if c.Resolver == nil {
-		return c.roundtrip(conn, query)
+		return c.exchange(ctx, conn, query)
 	}
 
 	w := &clientWriter{
@@ -105,7 +273,7 @@ func (c *Client) do(ctx context.Context, conn Conn, query *Query) (*Message, err
 		addr: query.RemoteAddr,
 		conn: conn,
 
-		roundtrip: c.roundtrip,
+		roundtrip: c.exchange,
 	}
 
 	c.Resolver.ServeDNS(ctx, w, query)
@@ -115,22 +283,94 @@ func (c *Client) do(ctx context.Context, conn Conn, query *Query) (*Message, err
 	return response(w.msg), nil
 }
 
-func (c *Client) roundtrip(conn Conn, query *Query) (*Message, error) {
-	id := query.ID
+// exchange sends the query over conn and returns the response. A response
+// with a failure rcode is retried up to RetryUpstream times, each over a new
+// connection, which is closed after the response is read.
+func (c *Client) exchange(ctx context.Context, conn Conn, query *Query) (*Message, error) {
+	msg, err := c.roundtrip(conn, query)
+	for i := 0; i < c.RetryUpstream && err == nil && retryRCode(msg.RCode); i++ {
+		if conn, err = c.redialQuery(ctx, query.RemoteAddr); err != nil {
+			return nil, err
+		}
+		msg, err = c.roundtrip(conn, query)
+		conn.Close()
+	}
+	return msg, err
+}
 
-	msg := *query.Message
-	msg.ID = c.nextID()
+// retryRCode reports whether a response with the rcode may be answered
+// differently by another server.
+func retryRCode(rcode RCode) bool {
+	switch rcode {
+	case ServFail, Refused, NotImp:
+		return true
+	}
+	return false
+}
 
-	if err := conn.Send(&msg); err != nil {
+func (c *Client) roundtrip(conn Conn, query *Query) (*Message, error) {
+	msg := new(Message)
+	if err := c.roundtripInto(conn, query, msg); err != nil {
 		return nil, err
 	}
+	return msg, nil
+}
 
-	if err := conn.Recv(&msg); err != nil {
-		return nil, err
+func (c *Client) roundtripInto(conn Conn, query *Query, res *Message) error {
+	req := *query.Message
+	if !c.PreserveID {
+		req.ID = c.nextID()
+	}
+	if c.RequestAD {
+		req.AuthenticatedData = true
+	}
+
+	if c.Cookies == nil {
+		if err := c.send(conn, &req, res); err != nil {
+			return err
+		}
+	} else if err := c.sendCookie(conn, &req, res, query.RemoteAddr); err != nil {
+		return err
+	}
+	res.ID = query.ID
+
+	if !c.ADPolicy.trust(upstreamAddr(conn, query.RemoteAddr)) {
+		res.AuthenticatedData = false
+	}
+	return nil
+}
+
+func (c *Client) send(conn Conn, req, res *Message) error {
+	if err := conn.Send(req); err != nil {
+		return err
 	}
-	msg.ID = id
+	return conn.Recv(res)
+}
+
+// sendCookie sends req with the cookie for the server at addr, and records
+// the server cookie of the response.
+func (c *Client) sendCookie(conn Conn, req, res *Message, addr net.Addr) error {
+	additionals := req.Additionals
+	for i := 0; i < 2; i++ {
+		cookie, err := c.Cookies.cookie(addr, time.Now())
+		if err != nil {
+			return err
+		}
+		if req.Additionals, err = setCookie(additionals, cookie); err != nil {
+			return err
+		}
 
-	return &msg, nil
+		if err := c.send(conn, req, res); err != nil {
+			return err
+		}
+		if err := c.Cookies.update(addr, cookie, res); err != nil {
+			return err
+		}
+		if extendedRCode(res) != rcodeBadCookie {
+			break
+		}
+	}
+	return nil
 }
 
 const idMask = (1 << 16) - 1
@@ -148,10 +388,17 @@ type clientWriter struct {
 	addr net.Addr
 	conn Conn
 
-	roundtrip func(Conn, *Query) (*Message, error)
+	roundtrip func(context.Context, Conn, *Query) (*Message, error)
+
+	recur *RecurOptions
 }
 
-func (w *clientWriter) Recur(context.Context) (*Message, error) {
+func (w *clientWriter) setRecurOptions(opts RecurOptions) bool {
+	w.recur = &opts
+	return true
+}
+
+func (w *clientWriter) Recur(ctx context.Context) (*Message, error) {
 	qs := make([]Question, 0, len(w.req.Questions))
 	for _, q := range w.req.Questions {
 		if !questionMatched(q, w.msg) {
@@ -159,13 +406,16 @@ func (w *clientWriter) Recur(context.Context) (*Message, error) {
 		}
 	}
 	w.req.Questions = qs
+	if w.recur != nil {
+		w.recur.apply(w.req)
+	}
 
 	req := &Query{
 		Message:    w.req,
 		RemoteAddr: w.addr,
 	}
 
-	msg, err := w.roundtrip(w.conn, req)
+	msg, err := w.roundtrip(ctx, w.conn, req)
 	if err != nil {
 		w.err = err
 	}
@@ -184,6 +434,17 @@ func request(msg *Message) *Message {
 	return req
 }
 
+// copyMessage copies from into to, reusing the section slices of to.
+func copyMessage(to, from *Message) {
+	qs, ans, nss, ars := to.Questions, to.Answers, to.Authorities, to.Additionals
+
+	*to = *from
+	to.Questions = append(qs[:0], from.Questions...)
+	to.Answers = append(ans[:0], from.Answers...)
+	to.Authorities = append(nss[:0], from.Authorities...)
+	to.Additionals = append(ars[:0], from.Additionals...)
+}
+
 func questionMatched(q Question, msg *Message) bool {
 	mrs := [3][]Resource{
 		msg.Answers,
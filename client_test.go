@@ -2,6 +2,7 @@ package dns
 
 import (
 	"context"
+	"crypto/tls"
 	"net"
 	"reflect"
 	"sort"
@@ -140,3 +141,424 @@ func TestClientResolver(t *testing.T) {
 		t.Errorf("want A record %q, got %q", want, got)
 	}
 }
+
+func TestClientPreserveID(t *testing.T) {
+	t.Parallel()
+
+	idc := make(chan int, 1)
+	srv := mustServer(HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+		idc <- r.ID
+
+		w.Answer(r.Questions[0].Name, time.Minute, &A{A: net.IPv4(127, 0, 0, 1).To4()})
+	}))
+
+	addrUDP, err := net.ResolveUDPAddr("udp", srv.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &Client{
+		PreserveID: true,
+	}
+
+	query := &Query{
+		RemoteAddr: addrUDP,
+		Message: &Message{
+			ID: 0xBEEF,
+			Questions: []Question{
+				{Name: "test.local.", Type: TypeA},
+			},
+		},
+	}
+
+	msg, err := client.Do(context.Background(), query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := 0xBEEF, <-idc; want != got {
+		t.Errorf("want upstream query ID %#x, got %#x", want, got)
+	}
+	if want, got := 0xBEEF, msg.ID; want != got {
+		t.Errorf("want response ID %#x, got %#x", want, got)
+	}
+}
+
+func TestClientDoInto(t *testing.T) {
+	t.Parallel()
+
+	localhost := net.IPv4(127, 0, 0, 1).To4()
+
+	srv := mustServer(HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+		w.Answer(r.Questions[0].Name, time.Minute, &A{A: localhost})
+	}))
+
+	addrUDP, err := net.ResolveUDPAddr("udp", srv.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := &Query{
+		RemoteAddr: addrUDP,
+		Message: &Message{
+			ID: 0x42,
+			Questions: []Question{
+				{Name: "test.local.", Type: TypeA},
+			},
+		},
+	}
+
+	res := &Message{
+		Answers: make([]Resource, 0, 4),
+	}
+	answers := res.Answers[:1]
+
+	client := new(Client)
+	for i := 0; i < 2; i++ {
+		if err := client.DoInto(context.Background(), query, res); err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := 0x42, res.ID; want != got {
+			t.Errorf("want response ID %#x, got %#x", want, got)
+		}
+		if want, got := 1, len(res.Answers); want != got {
+			t.Fatalf("want %d answers, got %d", want, got)
+		}
+		if want, got := &answers[0], &res.Answers[0]; want != got {
+			t.Error("answers section was not reused")
+		}
+		if want, got := localhost, res.Answers[0].Record.(*A).A; !want.Equal(got) {
+			t.Errorf("want A record %q, got %q", want, got)
+		}
+	}
+
+	if want, got := "test.local.", query.Questions[0].Name; want != got {
+		t.Errorf("want query question %q, got %q", want, got)
+	}
+}
+
+func TestClientDoEach(t *testing.T) {
+	t.Parallel()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	srv := mustServer(HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+		switch r.Questions[0].Name {
+		case "slow.test.local.":
+			<-done
+		case "refused.test.local.":
+			w.Status(Refused)
+		default:
+			w.Answer(r.Questions[0].Name, time.Minute, &A{A: net.IPv4(127, 0, 0, 1).To4()})
+		}
+	}))
+
+	addrUDP, err := net.ResolveUDPAddr("udp", srv.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := &Query{
+		RemoteAddr: addrUDP,
+		Message: &Message{
+			Questions: []Question{
+				{Name: "slow.test.local.", Type: TypeA, Class: ClassIN},
+				{Name: "fast.test.local.", Type: TypeA, Class: ClassIN},
+				{Name: "refused.test.local.", Type: TypeA, Class: ClassIN},
+			},
+		},
+	}
+
+	var names []string
+	for res := range new(Client).DoEach(context.Background(), query, 200*time.Millisecond) {
+		names = append(names, res.Question.Name)
+
+		switch res.Question.Name {
+		case "slow.test.local.":
+			if res.Err == nil {
+				t.Error("want timeout error for slow question")
+			}
+		case "fast.test.local.":
+			if res.Err != nil {
+				t.Fatal(res.Err)
+			}
+			if want, got := 1, len(res.Message.Answers); want != got {
+				t.Errorf("want %d answers, got %d", want, got)
+			}
+		case "refused.test.local.":
+			if res.Err != nil {
+				t.Fatal(res.Err)
+			}
+			if want, got := Refused, res.Message.RCode; want != got {
+				t.Errorf("want rcode %d, got %d", want, got)
+			}
+		}
+	}
+
+	if want, got := 3, len(names); want != got {
+		t.Fatalf("want %d results, got %d", want, got)
+	}
+	if want, got := "slow.test.local.", names[2]; want != got {
+		t.Errorf("want last result for %q, got %q", want, got)
+	}
+}
+
+func TestClientADPolicy(t *testing.T) {
+	t.Parallel()
+
+	udpAddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53}
+	tlsAddr := OverTLSAddr{&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 853}}
+	quicAddr := OverQUICAddr{Addr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 853}}
+
+	tests := []struct {
+		name string
+
+		requestAD bool
+		policy    ADPolicy
+		addr      net.Addr
+		proxy     net.Addr
+
+		queryAD, responseAD bool
+	}{
+		{
+			name: "trust-all",
+
+			addr: udpAddr,
+
+			responseAD: true,
+		},
+		{
+			name: "request-ad",
+
+			requestAD: true,
+			addr:      udpAddr,
+
+			queryAD:    true,
+			responseAD: true,
+		},
+		{
+			name: "trust-none",
+
+			policy: ADTrustNone,
+			addr:   tlsAddr,
+		},
+		{
+			name: "trust-secure-udp",
+
+			policy: ADTrustSecure,
+			addr:   udpAddr,
+		},
+		{
+			name: "trust-secure-tls",
+
+			policy: ADTrustSecure,
+			addr:   tlsAddr,
+
+			responseAD: true,
+		},
+		{
+			name: "trust-secure-quic",
+
+			policy: ADTrustSecure,
+			addr:   quicAddr,
+
+			responseAD: true,
+		},
+		{
+			name: "trust-secure-proxied-quic",
+
+			policy: ADTrustSecure,
+			addr:   udpAddr,
+			proxy:  quicAddr,
+
+			responseAD: true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			conn := &adConn{}
+			client := &Client{
+				Transport: adDialer{conn},
+				RequestAD: test.requestAD,
+				ADPolicy:  test.policy,
+			}
+			if test.proxy != nil {
+				client.Transport = &Transport{
+					Proxy: func(context.Context, net.Addr) (net.Addr, error) {
+						return test.proxy, nil
+					},
+					DialQUIC: func(context.Context, OverQUICAddr, *tls.Config) (Conn, error) {
+						return conn, nil
+					},
+				}
+			}
+
+			query := &Query{
+				RemoteAddr: test.addr,
+				Message: &Message{
+					Questions: []Question{
+						{Name: "test.local.", Type: TypeA, Class: ClassIN},
+					},
+				},
+			}
+
+			msg, err := client.Do(context.Background(), query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want, got := test.queryAD, conn.queryAD; want != got {
+				t.Errorf("want query AD bit %t, got %t", want, got)
+			}
+			if want, got := test.responseAD, msg.AuthenticatedData; want != got {
+				t.Errorf("want response AD bit %t, got %t", want, got)
+			}
+			if query.AuthenticatedData {
+				t.Error("want original query unchanged")
+			}
+		})
+	}
+}
+
+type adDialer struct{ conn *adConn }
+
+func (d adDialer) DialAddr(_ context.Context, _ net.Addr) (Conn, error) {
+	return d.conn, nil
+}
+
+// adConn answers each query with a response that has the AD bit set.
+type adConn struct {
+	Conn
+
+	query   *Message
+	queryAD bool
+}
+
+func (c *adConn) Send(msg *Message) error {
+	c.query, c.queryAD = msg, msg.AuthenticatedData
+	return nil
+}
+
+func (c *adConn) Recv(msg *Message) error {
+	*msg = *response(c.query)
+	msg.AuthenticatedData = true
+	return nil
+}
+
+func TestClientRetryUpstream(t *testing.T) {
+	t.Parallel()
+
+	failing := mustServer(HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+		w.Status(ServFail)
+	}))
+	working := mustServer(HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+		w.Answer(r.Questions[0].Name, time.Minute, &A{A: net.IPv4(127, 0, 0, 1).To4()})
+	}))
+
+	var udpServers, tcpServers NameServers
+	for _, srv := range []*Server{failing, working} {
+		uaddr, err := net.ResolveUDPAddr("udp", srv.Addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		udpServers = append(udpServers, uaddr)
+
+		taddr, err := net.ResolveTCPAddr("tcp", srv.Addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tcpServers = append(tcpServers, taddr)
+	}
+
+	tests := []struct {
+		name string
+
+		nameservers NameServers
+		retries     int
+
+		rcode   RCode
+		answers int
+	}{
+		{
+			name: "no-retry",
+
+			nameservers: udpServers,
+
+			rcode: ServFail,
+		},
+		{
+			name: "retry",
+
+			nameservers: udpServers,
+			retries:     1,
+
+			rcode:   NoError,
+			answers: 1,
+		},
+		{
+			name: "retry-pipelined",
+
+			nameservers: tcpServers,
+			retries:     1,
+
+			rcode:   NoError,
+			answers: 1,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			client := &Client{
+				Transport: &Transport{
+					Proxy: test.nameservers.RoundRobin(),
+				},
+				RetryUpstream: test.retries,
+			}
+
+			query := &Query{
+				RemoteAddr: test.nameservers[0],
+				Message: &Message{
+					Questions: []Question{
+						{Name: "test.local.", Type: TypeA, Class: ClassIN},
+					},
+				},
+			}
+
+			msg, err := client.Do(context.Background(), query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, got := test.rcode, msg.RCode; want != got {
+				t.Errorf("want rcode %d, got %d", want, got)
+			}
+			if want, got := test.answers, len(msg.Answers); want != got {
+				t.Errorf("want %d answers, got %d", want, got)
+			}
+
+			if test.retries == 0 {
+				return
+			}
+
+			// the round robin proxy picks the failing server first again,
+			// or the pipeline to the working server is reused
+			var res Message
+			if err := client.DoInto(context.Background(), query, &res); err != nil {
+				t.Fatal(err)
+			}
+			if want, got := test.rcode, res.RCode; want != got {
+				t.Errorf("want DoInto rcode %d, got %d", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benburkert/dns"
+	"github.com/benburkert/dns/edns"
+)
+
+var opcodeNames = map[dns.OpCode]string{
+	dns.OpQuery:  "QUERY",
+	dns.OpNotify: "NOTIFY",
+	dns.OpUpdate: "UPDATE",
+}
+
+var rcodeNames = map[dns.RCode]string{
+	dns.NoError:  "NOERROR",
+	dns.FormErr:  "FORMERR",
+	dns.ServFail: "SERVFAIL",
+	dns.NXDomain: "NXDOMAIN",
+	dns.NotImp:   "NOTIMP",
+	dns.Refused:  "REFUSED",
+	dns.YXDomain: "YXDOMAIN",
+	dns.YXRRSet:  "YXRRSET",
+	dns.NXRRSet:  "NXRRSET",
+	dns.NotAuth:  "NOTAUTH",
+	dns.NotZone:  "NOTZONE",
+}
+
+// writeMessage writes msg in the dig presentation format.
+func writeMessage(w io.Writer, msg *dns.Message) {
+	opcode, ok := opcodeNames[msg.OpCode]
+	if !ok {
+		opcode = strconv.Itoa(int(msg.OpCode))
+	}
+	rcode, ok := rcodeNames[msg.RCode]
+	if !ok {
+		rcode = strconv.Itoa(int(msg.RCode))
+	}
+
+	var flags []string
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{"qr", msg.Response},
+		{"aa", msg.Authoritative},
+		{"tc", msg.Truncated},
+		{"rd", msg.RecursionDesired},
+		{"ra", msg.RecursionAvailable},
+		{"ad", msg.AuthenticatedData},
+		{"cd", msg.CheckingDisabled},
+	} {
+		if f.set {
+			flags = append(flags, f.name)
+		}
+	}
+
+	var additionals []dns.Resource
+	var opt *dns.Resource
+	for i, res := range msg.Additionals {
+		if res.Record.Type() == dns.TypeOPT && opt == nil {
+			opt = &msg.Additionals[i]
+			continue
+		}
+		additionals = append(additionals, res)
+	}
+
+	fmt.Fprintf(w, ";; ->>HEADER<<- opcode: %s, status: %s, id: %d\n", opcode, rcode, msg.ID)
+	fmt.Fprintf(w, ";; flags: %s; QUERY: %d, ANSWER: %d, AUTHORITY: %d, ADDITIONAL: %d\n",
+		strings.Join(flags, " "), len(msg.Questions), len(msg.Answers),
+		len(msg.Authorities), len(msg.Additionals))
+
+	if opt != nil {
+		writeOPT(w, *opt)
+	}
+
+	if len(msg.Questions) > 0 {
+		fmt.Fprintf(w, "\n;; QUESTION SECTION:\n")
+		for _, q := range msg.Questions {
+			fmt.Fprintf(w, ";%s\t\t%s\t%s\n", q.Name, q.Class, q.Type)
+		}
+	}
+
+	writeSection(w, "ANSWER", msg.Answers)
+	writeSection(w, "AUTHORITY", msg.Authorities)
+	writeSection(w, "ADDITIONAL", additionals)
+}
+
+// writeOPT writes the EDNS pseudo-section of an OPT record.
+func writeOPT(w io.Writer, res dns.Resource) {
+	ttl := uint32(res.TTL / time.Second)
+	version, flags := (ttl>>16)&0xff, ttl&0xffff
+
+	fmt.Fprintf(w, "\n;; OPT PSEUDOSECTION:\n")
+	fmt.Fprintf(w, "; EDNS: version: %d, flags:", version)
+	if flags&0x8000 != 0 {
+		fmt.Fprint(w, " do")
+	}
+	fmt.Fprintf(w, "; udp: %d\n", int(res.Class))
+
+	rec, ok := res.Record.(*dns.OPT)
+	if !ok {
+		return
+	}
+	for _, opt := range rec.Options {
+		switch opt.Code {
+		case edns.OptionCodeEDNSClientSubnet:
+			var subnet edns.ClientSubnet
+			if _, err := subnet.Unpack(opt.Data); err == nil {
+				fmt.Fprintf(w, "; CLIENT-SUBNET: %s/%d/%d\n", subnet.Address, subnet.SourcePrefix, subnet.ScopePrefix)
+				continue
+			}
+		case edns.OptionCodeNSID:
+			fmt.Fprintf(w, "; NSID: %x (%q)\n", opt.Data, opt.Data)
+			continue
+		}
+		fmt.Fprintf(w, "; OPT=%d: %x\n", opt.Code, opt.Data)
+	}
+}
+
+// writeSection writes the resources of a message section.
+func writeSection(w io.Writer, name string, resources []dns.Resource) {
+	if len(resources) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "\n;; %s SECTION:\n", name)
+	for _, res := range resources {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", res.Name, int(res.TTL/time.Second),
+			res.Class, res.Record.Type(), rdata(res.Record))
+	}
+}
+
+// writeShort writes only the RDATA of the answers.
+func writeShort(w io.Writer, msg *dns.Message) {
+	for _, res := range msg.Answers {
+		fmt.Fprintln(w, rdata(res.Record))
+	}
+}
+
+// rdata returns the presentation format RDATA of a record. Records without a
+// known presentation format use the generic format of RFC 3597.
+func rdata(rec dns.Record) string {
+	switch rec := rec.(type) {
+	case *dns.A:
+		return rec.A.String()
+	case *dns.AAAA:
+		return rec.AAAA.String()
+	case *dns.CNAME:
+		return rec.CNAME
+	case *dns.DNAME:
+		return rec.DNAME
+	case *dns.NS:
+		return rec.NS
+	case *dns.PTR:
+		return rec.PTR
+	case *dns.MX:
+		return fmt.Sprintf("%d %s", rec.Pref, rec.MX)
+	case *dns.SRV:
+		return fmt.Sprintf("%d %d %d %s", rec.Priority, rec.Weight, rec.Port, rec.Target)
+	case *dns.SOA:
+		return fmt.Sprintf("%s %s %d %d %d %d %d", rec.NS, rec.MBox, rec.Serial,
+			int(rec.Refresh/time.Second), int(rec.Retry/time.Second),
+			int(rec.Expire/time.Second), int(rec.MinTTL/time.Second))
+	case *dns.TXT:
+		strs := make([]string, len(rec.TXT))
+		for i, s := range rec.TXT {
+			strs[i] = strconv.Quote(s)
+		}
+		return strings.Join(strs, " ")
+	case *dns.CAA:
+		var flags int
+		if rec.IssuerCritical {
+			flags = 128
+		}
+		return fmt.Sprintf("%d %s %q", flags, rec.Tag, rec.Value)
+	case *dns.DS:
+		return fmt.Sprintf("%d %d %d %X", rec.KeyTag, rec.Algorithm, rec.DigestType, rec.Digest)
+	}
+
+	b, err := rec.Pack(nil, nameWriter{})
+	if err != nil {
+		return "; " + err.Error()
+	}
+	if len(b) == 0 {
+		return `\# 0`
+	}
+	return `\# ` + strconv.Itoa(len(b)) + " " + hex.EncodeToString(b)
+}
+
+// nameWriter is a dns.Compressor that writes uncompressed names.
+type nameWriter struct{}
+
+func (nameWriter) Length(names ...string) (int, error) {
+	var n int
+	for _, name := range names {
+		b, err := nameWriter{}.Pack(nil, name)
+		if err != nil {
+			return 0, err
+		}
+		n += len(b)
+	}
+	return n, nil
+}
+
+func (nameWriter) Pack(b []byte, name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			if len(label) == 0 || len(label) > 63 {
+				return nil, errLabel
+			}
+			b = append(append(b, byte(len(label))), label...)
+		}
+	}
+	return append(b, 0), nil
+}
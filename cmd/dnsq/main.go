@@ -0,0 +1,337 @@
+// Command dnsq is a dig-like DNS lookup tool built on the dns package.
+//
+// Usage:
+//
+//	dnsq [@server[:port]] [+options] name [type] [class]
+//
+// The server defaults to the first nameserver in /etc/resolv.conf. The
+// options are:
+//
+//	+tcp          send the query over TCP
+//	+tls          send the query over TLS (RFC 7858), to port 853
+//	+https        send the query over HTTPS (RFC 8484), to port 443
+//	+norecurse    clear the RD bit of the query
+//	+dnssec       set the EDNS DO bit of the query
+//	+bufsize=N    set the EDNS UDP payload size of the query
+//	+subnet=CIDR  add an EDNS Client Subnet option to the query
+//	+timeout=D    set the query timeout, such as "5s"
+//	+short        print only the RDATA of the answers
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benburkert/dns"
+	"github.com/benburkert/dns/edns"
+)
+
+const resolvConf = "/etc/resolv.conf"
+
+var (
+	errUsage   = errors.New("usage: dnsq [@server[:port]] [+options] name [type] [class]")
+	errOption  = errors.New("unknown option")
+	errNoReply = errors.New("no response from server")
+	errLabel   = errors.New("invalid label length")
+)
+
+func main() {
+	if err := run(context.Background(), os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "dnsq:", err)
+		os.Exit(1)
+	}
+}
+
+// options are the parsed command line arguments.
+type options struct {
+	server    string
+	transport string // "udp", "tcp", "tls", or "https"
+
+	name  string
+	typ   dns.Type
+	class dns.Class
+
+	norecurse bool
+	dnssec    bool
+	bufsize   int
+	subnet    *net.IPNet
+	timeout   time.Duration
+	short     bool
+}
+
+// run performs the lookup of args, and writes the response to stdout.
+func run(ctx context.Context, args []string, stdout io.Writer) error {
+	opts, err := parseArgs(args)
+	if err != nil {
+		return err
+	}
+	if opts.server == "" {
+		opts.server = defaultServer()
+	}
+
+	addr, err := opts.addr()
+	if err != nil {
+		return err
+	}
+
+	query, err := opts.query()
+	if err != nil {
+		return err
+	}
+	query.RemoteAddr = addr
+
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+
+	client := &dns.Client{
+		Transport: &dns.Transport{},
+	}
+
+	start := time.Now()
+	msg, err := client.Do(ctx, query)
+	if err != nil {
+		return err
+	}
+	if msg == nil {
+		return errNoReply
+	}
+	rtt := time.Since(start)
+
+	w := bufio.NewWriter(stdout)
+	if opts.short {
+		writeShort(w, msg)
+	} else {
+		writeMessage(w, msg)
+		fmt.Fprintf(w, "\n;; Query time: %d msec\n", rtt/time.Millisecond)
+		fmt.Fprintf(w, ";; SERVER: %s (%s)\n", addr, opts.transport)
+	}
+	return w.Flush()
+}
+
+// parseArgs parses the command line arguments, in any order.
+func parseArgs(args []string) (*options, error) {
+	opts := &options{
+		transport: "udp",
+		class:     dns.ClassIN,
+		timeout:   5 * time.Second,
+	}
+
+	var positional []string
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "@"):
+			opts.server = arg[1:]
+		case strings.HasPrefix(arg, "+"):
+			if err := opts.set(arg[1:]); err != nil {
+				return nil, err
+			}
+		default:
+			positional = append(positional, arg)
+		}
+	}
+
+	if len(positional) == 0 || len(positional) > 3 {
+		return nil, errUsage
+	}
+
+	opts.name = positional[0]
+	if !strings.HasSuffix(opts.name, ".") {
+		opts.name += "."
+	}
+
+	opts.typ = dns.TypeA
+	if len(positional) > 1 {
+		typ, err := dns.ParseType(positional[1])
+		if err != nil {
+			return nil, err
+		}
+		opts.typ = typ
+	}
+	if len(positional) > 2 {
+		class, err := dns.ParseClass(positional[2])
+		if err != nil {
+			return nil, err
+		}
+		opts.class = class
+	}
+	return opts, nil
+}
+
+// set sets the query option of a +option argument.
+func (o *options) set(opt string) error {
+	key, val := opt, ""
+	if i := strings.IndexByte(opt, '='); i >= 0 {
+		key, val = opt[:i], opt[i+1:]
+	}
+
+	var err error
+	switch key {
+	case "tcp", "tls", "https":
+		o.transport = key
+	case "norecurse":
+		o.norecurse = true
+	case "dnssec":
+		o.dnssec = true
+	case "bufsize":
+		o.bufsize, err = strconv.Atoi(val)
+		if err == nil && (o.bufsize < 512 || o.bufsize > 65535) {
+			err = errOption
+		}
+	case "subnet":
+		if !strings.Contains(val, "/") {
+			if strings.Contains(val, ":") {
+				val += "/128"
+			} else {
+				val += "/32"
+			}
+		}
+		_, o.subnet, err = net.ParseCIDR(val)
+	case "timeout":
+		o.timeout, err = time.ParseDuration(val)
+	case "short":
+		o.short = true
+	default:
+		err = errOption
+	}
+	if err != nil {
+		return fmt.Errorf("+%s: %v", opt, err)
+	}
+	return nil
+}
+
+// addr returns the address of the server for the transport.
+func (o *options) addr() (net.Addr, error) {
+	port := "53"
+	switch o.transport {
+	case "tls":
+		port = "853"
+	case "https":
+		port = "443"
+	}
+
+	host, hostport := o.server, o.server
+	if h, _, err := net.SplitHostPort(o.server); err == nil {
+		host = h
+	} else {
+		hostport = net.JoinHostPort(o.server, port)
+	}
+
+	switch o.transport {
+	case "udp":
+		return net.ResolveUDPAddr("udp", hostport)
+	}
+
+	taddr, err := net.ResolveTCPAddr("tcp", hostport)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o.transport {
+	case "tls":
+		return dns.OverTLSAddr{Addr: taddr}, nil
+	case "https":
+		return dns.OverHTTPSAddr{
+			Addr: taddr,
+			URL:  "https://" + urlHost(host, taddr.Port) + "/dns-query",
+		}, nil
+	}
+	return taddr, nil
+}
+
+// urlHost returns the host of a URL for the host and port.
+func urlHost(host string, port int) string {
+	if port == 443 {
+		if strings.Contains(host, ":") {
+			return "[" + host + "]"
+		}
+		return host
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// query returns the query message for the options.
+func (o *options) query() (*dns.Query, error) {
+	msg := &dns.Message{
+		RecursionDesired: !o.norecurse,
+		Questions: []dns.Question{
+			{Name: o.name, Type: o.typ, Class: o.class},
+		},
+	}
+
+	if o.dnssec || o.bufsize > 0 || o.subnet != nil {
+		opt, err := o.opt()
+		if err != nil {
+			return nil, err
+		}
+		msg.Additionals = append(msg.Additionals, opt)
+	}
+	return &dns.Query{Message: msg}, nil
+}
+
+// opt returns the EDNS OPT pseudo-record for the options.
+func (o *options) opt() (dns.Resource, error) {
+	bufsize := o.bufsize
+	if bufsize == 0 {
+		bufsize = 1232
+	}
+
+	var rec dns.OPT
+	if o.subnet != nil {
+		family, ip := edns.FamilyIPv6, o.subnet.IP
+		if ip4 := ip.To4(); ip4 != nil {
+			family, ip = edns.FamilyIPv4, ip4
+		}
+		prefix, _ := o.subnet.Mask.Size()
+
+		opt, err := edns.ClientSubnet{
+			Family:       family,
+			SourcePrefix: prefix,
+			Address:      ip,
+		}.Option()
+		if err != nil {
+			return dns.Resource{}, err
+		}
+		rec.Options = append(rec.Options, opt)
+	}
+
+	// The TTL of an OPT record holds the extended RCODE, version, and
+	// flags; the DO bit is the most significant bit of the flags.
+	var ttl time.Duration
+	if o.dnssec {
+		ttl = 0x8000 * time.Second
+	}
+
+	return dns.Resource{
+		Name:   ".",
+		Class:  dns.Class(bufsize),
+		TTL:    ttl,
+		Record: &rec,
+	}, nil
+}
+
+// defaultServer returns the first nameserver of the system resolver
+// configuration, or the loopback address.
+func defaultServer() string {
+	f, err := os.Open(resolvConf)
+	if err != nil {
+		return "127.0.0.1"
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return fields[1]
+		}
+	}
+	return "127.0.0.1"
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benburkert/dns"
+	"github.com/benburkert/dns/dnstest"
+	"github.com/benburkert/dns/edns"
+)
+
+var answers = map[dns.Question]*dns.Message{
+	{Name: "app.example.", Type: dns.TypeA, Class: dns.ClassIN}: {
+		Authoritative: true,
+		Answers: []dns.Resource{
+			{
+				Name:   "app.example.",
+				Class:  dns.ClassIN,
+				TTL:    time.Minute,
+				Record: &dns.A{A: net.IPv4(192, 0, 2, 1).To4()},
+			},
+		},
+	},
+	{Name: "app.example.", Type: dns.TypeMX, Class: dns.ClassIN}: {
+		Answers: []dns.Resource{
+			{
+				Name:   "app.example.",
+				Class:  dns.ClassIN,
+				TTL:    time.Hour,
+				Record: &dns.MX{Pref: 10, MX: "mail.app.example."},
+			},
+		},
+	},
+	{Name: "app.example.", Type: dns.TypeOPENPGPKEY, Class: dns.ClassIN}: {
+		Answers: []dns.Resource{
+			{
+				Name:   "app.example.",
+				Class:  dns.ClassIN,
+				TTL:    time.Hour,
+				Record: &dns.OPENPGPKEY{PublicKey: []byte{0xde, 0xad}},
+			},
+		},
+	},
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	srv := dnstest.NewServer(answers)
+	defer srv.Close()
+
+	tests := []struct {
+		name string
+
+		args []string
+
+		want []string
+	}{
+		{
+			name: "udp",
+
+			args: []string{"app.example"},
+
+			want: []string{
+				"status: NOERROR",
+				"flags: qr aa rd;",
+				";app.example.\t\tIN\tA",
+				"app.example.\t60\tIN\tA\t192.0.2.1",
+				"(udp)",
+			},
+		},
+		{
+			name: "tcp",
+
+			args: []string{"+tcp", "app.example.", "MX"},
+
+			want: []string{
+				"app.example.\t3600\tIN\tMX\t10 mail.app.example.",
+				"(tcp)",
+			},
+		},
+		{
+			name: "short",
+
+			args: []string{"+short", "app.example", "a"},
+
+			want: []string{"192.0.2.1\n"},
+		},
+		{
+			name: "generic",
+
+			args: []string{"+short", "app.example", "OPENPGPKEY"},
+
+			want: []string{`\# 2 dead`},
+		},
+		{
+			name: "nxdomain",
+
+			args: []string{"+norecurse", "missing.example", "TYPE28"},
+
+			want: []string{
+				"status: NXDOMAIN",
+				"flags: qr;",
+				";missing.example.\t\tIN\tAAAA",
+			},
+		},
+	}
+
+	// The subtests are not parallel, so that they finish before the server
+	// is closed.
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			var buf bytes.Buffer
+			args := append([]string{"@" + srv.Addr}, test.args...)
+			if err := run(ctx, args, &buf); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, want := range test.want {
+				if got := buf.String(); !strings.Contains(got, want) {
+					t.Errorf("want output containing %q, got:\n%s", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+
+		args []string
+
+		opts *options
+		err  bool
+	}{
+		{
+			name: "defaults",
+
+			args: []string{"example.com"},
+
+			opts: &options{
+				transport: "udp",
+				name:      "example.com.",
+				typ:       dns.TypeA,
+				class:     dns.ClassIN,
+				timeout:   5 * time.Second,
+			},
+		},
+		{
+			name: "options",
+
+			args: []string{"@192.0.2.53", "+tls", "+dnssec", "+bufsize=4096", "+subnet=198.51.100.0/24", "example.com.", "HTTPS", "CH"},
+
+			opts: &options{
+				server:    "192.0.2.53",
+				transport: "tls",
+				name:      "example.com.",
+				typ:       dns.TypeHTTPS,
+				class:     dns.ClassCH,
+				dnssec:    true,
+				bufsize:   4096,
+				subnet: &net.IPNet{
+					IP:   net.IPv4(198, 51, 100, 0).To4(),
+					Mask: net.CIDRMask(24, 32),
+				},
+				timeout: 5 * time.Second,
+			},
+		},
+		{
+			name: "no-name",
+
+			args: []string{"+tcp"},
+
+			err: true,
+		},
+		{
+			name: "unknown-option",
+
+			args: []string{"+bogus", "example.com"},
+
+			err: true,
+		},
+		{
+			name: "unknown-type",
+
+			args: []string{"example.com", "BOGUS"},
+
+			err: true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			opts, err := parseArgs(test.args)
+			if want, got := test.err, err != nil; want != got {
+				t.Fatalf("want error %t, got %v", want, err)
+			}
+			if want, got := test.opts, opts; !reflect.DeepEqual(want, got) {
+				t.Errorf("want options %+v, got %+v", want, got)
+			}
+		})
+	}
+}
+
+func TestQueryOPT(t *testing.T) {
+	t.Parallel()
+
+	opts, err := parseArgs([]string{"+dnssec", "+subnet=2001:db8::/48", "example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query, err := opts.query()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := 1, len(query.Additionals); want != got {
+		t.Fatalf("want %d additionals, got %d", want, got)
+	}
+
+	res := query.Additionals[0]
+	if want, got := dns.Class(1232), res.Class; want != got {
+		t.Errorf("want udp size %d, got %d", want, got)
+	}
+	if want, got := 0x8000*time.Second, res.TTL; want != got {
+		t.Errorf("want ttl %s, got %s", want, got)
+	}
+
+	var subnet edns.ClientSubnet
+	if _, err := subnet.Unpack(res.Record.(*dns.OPT).Options[0].Data); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 48, subnet.SourcePrefix; want != got {
+		t.Errorf("want source prefix %d, got %d", want, got)
+	}
+}
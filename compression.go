@@ -15,11 +15,99 @@ type Decompressor interface {
 	Unpack([]byte) (string, []byte, error)
 }
 
+// NoCompression is a Compressor that packs names without compression
+// pointers, for the names in the RDATA of record types that must not be
+// compressed (RFC 3597, section 4).
+var NoCompression Compressor = compressor{}
+
+// NewDecompressor returns a Decompressor for the names of the packed message
+// msg, including names compressed with pointers into msg.
+func NewDecompressor(msg []byte) Decompressor {
+	return decompressor(msg)
+}
+
+// NewCompressor returns a Compressor for the names of a message that starts at
+// offset base of buf, such as after a stream length prefix. The names of the
+// questions and resources already packed in buf[base:] are added to the
+// dictionary, so that names appended to buf are compressed with pointers to
+// them. It is used to append records to a shared prefix of a message, such as
+// the header and question of each message of a zone transfer.
+func NewCompressor(buf []byte, base int) (Compressor, error) {
+	if base < 0 || base > len(buf) {
+		return nil, errInvalidPtr
+	}
+
+	c := compressor{tbl: make(map[string]int), offset: base}
+	if len(buf) > base {
+		if err := c.seed(buf[base:]); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
 type compressor struct {
 	tbl    map[string]int
 	offset int
 }
 
+// seed adds the question and owner names of the packed message msg to the
+// dictionary.
+func (c compressor) seed(msg []byte) error {
+	if len(msg) < 12 {
+		return errBaseLen
+	}
+
+	qdcount := int(nbo.Uint16(msg[4:]))
+	rrcount := int(nbo.Uint16(msg[6:])) + int(nbo.Uint16(msg[8:])) + int(nbo.Uint16(msg[10:]))
+
+	off, err := 12, error(nil)
+	for i := 0; i < qdcount; i++ {
+		if off, err = c.seedName(msg, off); err != nil {
+			return err
+		}
+		if off += 4; off > len(msg) {
+			return errBaseLen
+		}
+	}
+	for i := 0; i < rrcount; i++ {
+		if off, err = c.seedName(msg, off); err != nil {
+			return err
+		}
+		if off+10 > len(msg) {
+			return errResourceLen
+		}
+		if off += 10 + int(nbo.Uint16(msg[off+8:])); off > len(msg) {
+			return errResourceLen
+		}
+	}
+	return nil
+}
+
+// seedName adds the suffixes of the name at offset off of msg that precede a
+// compression pointer, and returns the offset following the name.
+func (c compressor) seedName(msg []byte, off int) (int, error) {
+	name, rest, err := decompressor(msg).Unpack(msg[off:])
+	if err != nil {
+		return 0, err
+	}
+
+	for i, p := 0, off; msg[p] != 0 && msg[p]&0xC0 == 0; {
+		// stop at labels with escaped characters, which are longer in
+		// the name than in the message
+		n := int(msg[p]) + 1
+		if i+n > len(name) || name[i:i+n-1] != string(msg[p+1:p+n]) || name[i+n-1] != '.' {
+			break
+		}
+
+		if _, ok := c.tbl[name[i:]]; !ok {
+			c.tbl[name[i:]] = p
+		}
+		i, p = i+n, p+n
+	}
+	return len(msg) - len(rest), nil
+}
+
 func (c compressor) Length(names ...string) (int, error) {
 	var visited map[string]struct{}
 	if c.tbl != nil {
@@ -114,6 +202,131 @@ func (d decompressor) Unpack(b []byte) (string, []byte, error) {
 	return string(name), b, nil
 }
 
+// unpackName is like Unpack, but returns prev if the decoded name is equal,
+// to avoid allocating a new string.
+func (d decompressor) unpackName(b []byte, prev string) (string, []byte, error) {
+	var buf [maxNameLen + 1]byte
+
+	n, rest, err := d.read(&buf, b)
+	if err == errNameTooLong {
+		return d.Unpack(b)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	if string(buf[:n]) == prev {
+		return prev, rest, nil
+	}
+	return string(buf[:n]), rest, nil
+}
+
+// unpackName decodes a name with the message decompressor dec, returning prev
+// if the decoded name is equal.
+func unpackName(dec Decompressor, b []byte, prev string) (string, []byte, error) {
+	switch d := dec.(type) {
+	case decompressor:
+		return d.unpackName(b, prev)
+	case *nameBudget:
+		return d.unpackName(b, prev)
+	}
+	return dec.Unpack(b)
+}
+
+// nameBudget is a message decompressor that limits the total length of the
+// decoded names.
+type nameBudget struct {
+	decompressor
+
+	max, used int
+}
+
+func (d *nameBudget) Unpack(b []byte) (string, []byte, error) {
+	name, b, err := d.decompressor.Unpack(b)
+	if err != nil {
+		return "", nil, err
+	}
+	return name, b, d.spend(name)
+}
+
+func (d *nameBudget) unpackName(b []byte, prev string) (string, []byte, error) {
+	name, b, err := d.decompressor.unpackName(b, prev)
+	if err != nil {
+		return "", nil, err
+	}
+	return name, b, d.spend(name)
+}
+
+func (d *nameBudget) spend(name string) error {
+	if d.used += len(name); d.used > d.max {
+		return &LimitError{Limit: "name bytes", Value: d.used, Max: d.max}
+	}
+	return nil
+}
+
+// read decodes a name from b into buf without allocating. It returns the
+// length of the name in buf and the bytes following the name in b.
+func (d decompressor) read(buf *[maxNameLen + 1]byte, b []byte) (int, []byte, error) {
+	var (
+		n, ptrs int
+		rest    []byte
+	)
+
+	for {
+		if len(b) == 0 {
+			return 0, nil, errBaseLen
+		}
+
+		if b[0] == 0x00 {
+			if rest == nil {
+				rest = b[1:]
+			}
+			if n == 0 {
+				buf[0], n = '.', 1
+			}
+			return n, rest, nil
+		}
+
+		if len(b) < 2 {
+			return 0, nil, errBaseLen
+		}
+
+		if isPointer(b[0]) {
+			if d == nil {
+				return 0, nil, errBaseLen
+			}
+
+			idx := int(nbo.Uint16(b[:2]) & 0x3FFF)
+			if len(d) <= idx {
+				return 0, nil, errInvalidPtr
+			}
+			if ptrs++; ptrs > len(d)/2 {
+				return 0, nil, errPtrCycle
+			}
+
+			if rest == nil {
+				rest = b[2:]
+			}
+			b = d[idx:]
+			continue
+		}
+
+		lenl := int(b[0])
+		if len(b) < 1+lenl {
+			return 0, nil, errCalcLen
+		}
+		if n+lenl+1 > len(buf) {
+			return 0, nil, errNameTooLong
+		}
+
+		n += copy(buf[n:], b[1:1+lenl])
+		buf[n] = '.'
+		n++
+
+		b = b[1+lenl:]
+	}
+}
+
 func (d decompressor) unpack(name, b []byte, visited []int) ([]byte, []byte, error) {
 	lenb := len(b)
 	if lenb == 0 {
@@ -157,11 +370,7 @@ func (d decompressor) unpack(name, b []byte, visited []int) ([]byte, []byte, err
 
 func (d decompressor) deref(name []byte, ptr uint16, visited []int) ([]byte, error) {
 	idx := int(ptr & 0x3FFF)
-	if len(d) < idx {
-		return nil, errInvalidPtr
-	}
-
-	if isPointer(d[idx]) {
+	if len(d) <= idx {
 		return nil, errInvalidPtr
 	}
 
@@ -2,7 +2,9 @@ package dns
 
 import (
 	"bytes"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestCompressor(t *testing.T) {
@@ -91,6 +93,67 @@ func TestCompressor(t *testing.T) {
 	}
 }
 
+func TestNewCompressor(t *testing.T) {
+	t.Parallel()
+
+	prefix := &Message{
+		ID:        1,
+		Response:  true,
+		Questions: []Question{{Name: "www.example.com.", Type: TypeA, Class: ClassIN}},
+	}
+
+	// the message follows a stream length prefix
+	buf, err := prefix.Pack(make([]byte, 2), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	com, err := NewCompressor(buf, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	answer := Resource{
+		Name:   "www.example.com.",
+		Class:  ClassIN,
+		TTL:    time.Minute,
+		Record: &CNAME{CNAME: "web.example.com."},
+	}
+
+	off := len(buf)
+	if buf, err = answer.Pack(buf, com); err != nil {
+		t.Fatal(err)
+	}
+	nbo.PutUint16(buf[2+6:], 1) // ANCOUNT
+
+	raw := []byte{
+		0xC0, 0x0C, // NAME: pointer to www.example.com.
+		0x00, 0x05, // TYPE: CNAME
+		0x00, 0x01, // CLASS: IN
+		0x00, 0x00, 0x00, 0x3C, // TTL: 60
+		0x00, 0x06, // RDLENGTH: 6
+		0x03, 'w', 'e', 'b', 0xC0, 0x10, // RDATA: web, pointer to example.com.
+	}
+	if want, got := raw, buf[off:]; !bytes.Equal(want, got) {
+		t.Errorf("want appended resource %x, got %x", want, got)
+	}
+
+	msg := new(Message)
+	if _, err := msg.Unpack(buf[2:]); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := []Resource{answer}, msg.Answers; !reflect.DeepEqual(want, got) {
+		t.Errorf("want answers %+v, got %+v", want, got)
+	}
+
+	if _, err := NewCompressor(buf, len(buf)+1); err != errInvalidPtr {
+		t.Errorf("want error %v for base past buffer, got %v", errInvalidPtr, err)
+	}
+	if _, err := NewCompressor(buf[:8], 2); err != errBaseLen {
+		t.Errorf("want error %v for short message, got %v", errBaseLen, err)
+	}
+}
+
 func TestDecompressor(t *testing.T) {
 	tests := []struct {
 		name string
@@ -134,6 +197,47 @@ func TestDecompressor(t *testing.T) {
 
 			fqdn: "example.com.",
 		},
+		{
+			name: "pointer-to-pointer",
+
+			raw: []byte{
+				0x03, 'w', 'w', 'w',
+				0xC0, 0x00,
+			},
+			state: []byte{
+				0xC0, 0x02,
+				0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e',
+				0x03, 'c', 'o', 'm',
+				0x00,
+			},
+
+			fqdn: "www.example.com.",
+		},
+		{
+			name: "pointer-out-of-range",
+
+			raw: []byte{
+				0xC0, 0x02,
+			},
+			state: []byte{
+				0xFF, 0xFF,
+			},
+
+			err: errInvalidPtr,
+		},
+		{
+			name: "pointer-cycle",
+
+			raw: []byte{
+				0xC0, 0x00,
+			},
+			state: []byte{
+				0xC0, 0x02,
+				0xC0, 0x00,
+			},
+
+			err: errPtrCycle,
+		},
 	}
 
 	t.Parallel()
@@ -147,10 +251,10 @@ func TestDecompressor(t *testing.T) {
 			dec := decompressor(test.state)
 
 			fqdn, _, err := dec.Unpack(test.raw)
+			if want, got := test.err, err; want != got {
+				t.Fatalf("want err %v, got %v", want, got)
+			}
 			if err != nil {
-				if want, got := test.err, err; want != got {
-					t.Errorf("want err %q, got %q", want, got)
-				}
 				return
 			}
 
@@ -160,3 +264,77 @@ func TestDecompressor(t *testing.T) {
 		})
 	}
 }
+
+// names is a record type outside the package's record types, with a name
+// that may be compressed and a name that must not be.
+type names struct {
+	Compressed, Uncompressed string
+}
+
+func (names) Type() Type { return Type(65280) }
+
+func (n names) Length(com Compressor) (int, error) {
+	l, err := com.Length(n.Compressed)
+	if err != nil {
+		return 0, err
+	}
+	ul, err := NoCompression.Length(n.Uncompressed)
+	return l + ul, err
+}
+
+func (n names) Pack(b []byte, com Compressor) ([]byte, error) {
+	b, err := com.Pack(b, n.Compressed)
+	if err != nil {
+		return nil, err
+	}
+	return NoCompression.Pack(b, n.Uncompressed)
+}
+
+func (n *names) Unpack(b []byte, dec Decompressor) ([]byte, error) {
+	var err error
+	if n.Compressed, b, err = dec.Unpack(b); err != nil {
+		return nil, err
+	}
+	n.Uncompressed, b, err = dec.Unpack(b)
+	return b, err
+}
+
+func TestRecordPacker(t *testing.T) {
+	t.Parallel()
+
+	rec := &names{Compressed: "example.", Uncompressed: "example."}
+	msg := &Message{
+		Questions: []Question{{Name: "example.", Type: Type(65280), Class: ClassIN}},
+		Answers:   []Resource{{Name: "example.", Class: ClassIN, TTL: time.Minute, Record: rec}},
+	}
+
+	buf, err := msg.Pack(nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rdata := []byte{
+		0xC0, 0x0C, // compressed name
+		0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0x00, // uncompressed name
+	}
+	if want, got := rdata, buf[len(buf)-len(rdata):]; !bytes.Equal(want, got) {
+		t.Errorf("want RDATA %x, got %x", want, got)
+	}
+
+	got := &Message{Answers: []Resource{{Record: new(names)}}}
+	got.Answers = got.Answers[:0]
+	if _, err := got.UnpackInto(buf, UnpackOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := Record(rec), got.Answers[0].Record; !reflect.DeepEqual(want, got) {
+		t.Errorf("want record %+v, got %+v", want, got)
+	}
+
+	name, _, err := NewDecompressor(buf).Unpack(buf[len(buf)-len(rdata):])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "example.", name; want != got {
+		t.Errorf("want name %q, got %q", want, got)
+	}
+}
@@ -3,8 +3,44 @@ package dns
 import (
 	"io"
 	"net"
+	"strconv"
 )
 
+// rawConn is a Conn that retains the wire format of the last message read by
+// Recv.
+type rawConn interface {
+	Raw() []byte
+}
+
+// rawBytes returns the wire format of the last message read by Recv from
+// conn, if conn retains it.
+func rawBytes(conn Conn) ([]byte, bool) {
+	if rc, ok := conn.(rawConn); ok {
+		if raw := rc.Raw(); raw != nil {
+			return raw, true
+		}
+	}
+	return nil, false
+}
+
+// upstreamAddrConn is a Conn that knows the address of the DNS server it is
+// connected to, which may differ from the dialed address if it was modified
+// by a Proxy.
+type upstreamAddrConn interface {
+	Upstream() net.Addr
+}
+
+// upstreamAddr returns the address of the DNS server conn is connected to, or
+// addr if conn does not know it.
+func upstreamAddr(conn Conn, addr net.Addr) net.Addr {
+	if uc, ok := conn.(upstreamAddrConn); ok {
+		if upstream := uc.Upstream(); upstream != nil {
+			return upstream
+		}
+	}
+	return addr
+}
+
 // Conn is a network connection to a DNS resolver.
 type Conn interface {
 	net.Conn
@@ -22,13 +58,30 @@ type Conn interface {
 type PacketConn struct {
 	net.Conn
 
-	rbuf, wbuf []byte
+	// UnpackOptions control the decoding of received messages.
+	UnpackOptions UnpackOptions
+
+	// MaxMessageSize limits the length of received messages. A message with
+	// a longer length prefix is not read, and Recv returns a
+	// MessageSizeError. The stream is not usable after the error. If zero,
+	// messages up to 65535 bytes are read.
+	MaxMessageSize int
+
+	rbuf, wbuf, raw []byte
+
+	size int // UDP payload size advertised by the last message sent
 }
 
-// Recv reads a DNS message from the underlying connection.
+// Recv reads a DNS message from the underlying connection. Messages up to the
+// UDP payload size advertised by the OPT record of the last message sent are
+// read, or 512 bytes if there is none.
 func (c *PacketConn) Recv(msg *Message) error {
-	if len(c.rbuf) != maxPacketLen {
-		c.rbuf = make([]byte, maxPacketLen)
+	size := c.size
+	if size < maxPacketLen {
+		size = maxPacketLen
+	}
+	if len(c.rbuf) != size {
+		c.rbuf = make([]byte, size)
 	}
 
 	n, err := c.Read(c.rbuf)
@@ -36,10 +89,16 @@ func (c *PacketConn) Recv(msg *Message) error {
 		return err
 	}
 
-	_, err = msg.Unpack(c.rbuf[:n])
+	c.raw = c.rbuf[:n]
+
+	_, err = msg.UnpackWith(c.raw, c.UnpackOptions)
 	return err
 }
 
+// Raw returns the wire format of the last message read by Recv. The bytes are
+// only valid until the next call to Recv.
+func (c *PacketConn) Raw() []byte { return c.raw }
+
 // Send writes a DNS message to the underlying connection.
 func (c *PacketConn) Send(msg *Message) error {
 	if len(c.wbuf) != maxPacketLen {
@@ -54,6 +113,7 @@ func (c *PacketConn) Send(msg *Message) error {
 	if len(c.wbuf) > maxPacketLen {
 		return ErrOversizedMessage
 	}
+	c.size = udpSize(msg)
 
 	_, err = c.Write(c.wbuf)
 	return err
@@ -65,7 +125,16 @@ func (c *PacketConn) Send(msg *Message) error {
 type StreamConn struct {
 	net.Conn
 
-	rbuf, wbuf []byte
+	// UnpackOptions control the decoding of received messages.
+	UnpackOptions UnpackOptions
+
+	// MaxMessageSize limits the length of received messages. A message with
+	// a longer length prefix is not read, and Recv returns a
+	// MessageSizeError. The stream is not usable after the error. If zero,
+	// messages up to 65535 bytes are read.
+	MaxMessageSize int
+
+	rbuf, wbuf, raw []byte
 }
 
 // Recv reads a DNS message from the underlying connection.
@@ -79,6 +148,9 @@ func (c *StreamConn) Recv(msg *Message) error {
 	}
 
 	mlen := nbo.Uint16(c.rbuf[:2])
+	if c.MaxMessageSize > 0 && int(mlen) > c.MaxMessageSize {
+		return &MessageSizeError{Size: int(mlen), Max: c.MaxMessageSize}
+	}
 	if len(c.rbuf) < int(mlen) {
 		c.rbuf = make([]byte, mlen)
 	}
@@ -87,10 +159,26 @@ func (c *StreamConn) Recv(msg *Message) error {
 		return err
 	}
 
-	_, err := msg.Unpack(c.rbuf[:mlen])
+	c.raw = c.rbuf[:mlen]
+
+	_, err := msg.UnpackWith(c.raw, c.UnpackOptions)
 	return err
 }
 
+// A MessageSizeError is a message read from a stream connection with a length
+// prefix larger than the maximum message size.
+type MessageSizeError struct {
+	Size, Max int
+}
+
+func (e *MessageSizeError) Error() string {
+	return "message size " + strconv.Itoa(e.Size) + " exceeds maximum " + strconv.Itoa(e.Max)
+}
+
+// Raw returns the wire format of the last message read by Recv, without the
+// length prefix. The bytes are only valid until the next call to Recv.
+func (c *StreamConn) Raw() []byte { return c.raw }
+
 // Send writes a DNS message to the underlying connection.
 func (c *StreamConn) Send(msg *Message) error {
 	if len(c.wbuf) < 2 {
@@ -1,6 +1,7 @@
 package dns
 
 import (
+	"bytes"
 	"fmt"
 	"net"
 	"reflect"
@@ -165,6 +166,34 @@ func TestStreamConnRoundTrip(t *testing.T) {
 	}
 }
 
+func TestStreamConnMaxMessageSize(t *testing.T) {
+	t.Parallel()
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+
+	client := &StreamConn{
+		Conn:           c1,
+		MaxMessageSize: 512,
+	}
+
+	go func() {
+		defer c2.Close()
+
+		// Only the length prefix is written, the message is never read.
+		c2.Write([]byte{0xFF, 0xFF})
+	}()
+
+	err := client.Recv(new(Message))
+	serr, ok := err.(*MessageSizeError)
+	if !ok {
+		t.Fatalf("want MessageSizeError, got %v", err)
+	}
+	if want, got := (MessageSizeError{Size: 65535, Max: 512}), *serr; want != got {
+		t.Errorf("want error %+v, got %+v", want, got)
+	}
+}
+
 func testRoundTrip(client, server Conn, req, res *Message) error {
 	var (
 		g errgroup.Group
@@ -186,7 +215,7 @@ func testRoundTrip(client, server Conn, req, res *Message) error {
 			return fmt.Errorf("want response message %+v, got %+v", want, got)
 		}
 
-		return nil
+		return checkRaw(client, res)
 	})
 
 	g.Go(func() error {
@@ -200,9 +229,24 @@ func testRoundTrip(client, server Conn, req, res *Message) error {
 		if want, got := req, msg; !reflect.DeepEqual(want, got) {
 			return fmt.Errorf("want request message %+v, got %+v", want, got)
 		}
+		if err := checkRaw(server, req); err != nil {
+			return err
+		}
 
 		return server.Send(res)
 	})
 
 	return g.Wait()
 }
+
+func checkRaw(conn Conn, msg *Message) error {
+	want, err := msg.Pack(nil, true)
+	if err != nil {
+		return err
+	}
+
+	if got := conn.(interface{ Raw() []byte }).Raw(); !bytes.Equal(want, got) {
+		return fmt.Errorf("want raw message %x, got %x", want, got)
+	}
+	return nil
+}
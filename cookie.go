@@ -0,0 +1,234 @@
+package dns
+
+import (
+	"bytes"
+	"crypto/hmac"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/benburkert/dns/edns"
+)
+
+// rcodeBadCookie is the extended RCODE of a response to a query without a
+// valid server cookie (RFC 7873, section 8).
+const rcodeBadCookie = 23
+
+// Server cookie timestamps are valid for an hour, or five minutes in the
+// future to allow for clock skew (RFC 9018, section 4.3).
+const (
+	serverCookieLifetime = time.Hour
+	serverCookieSkew     = 5 * time.Minute
+)
+
+var errCookieMismatch = errors.New("response client cookie mismatch")
+
+// ServerCookies are the DNS Cookies (RFC 7873) of a Server. The server cookie
+// has the layout of RFC 9018: a version, timestamp, and 8 byte hash of the
+// client cookie, timestamp, and client IP address. The hash is an
+// HMAC-SHA256 keyed by the secret.
+type ServerCookies struct {
+	// Secret is the key of the server cookie hash. Servers of an anycast or
+	// load balanced service share the secret.
+	Secret []byte
+
+	// PreviousSecret is also accepted for server cookies, so that the
+	// secret can be rotated without invalidating the cookies of clients.
+	PreviousSecret []byte
+
+	// Enforce limits the responses to UDP queries without a valid server
+	// cookie. A query with only a client cookie is answered with a BADCOOKIE
+	// error and a new server cookie, and a query without a cookie is
+	// answered with an empty truncated response so that the client retries
+	// over TCP. Queries over stream connections are always answered.
+	Enforce bool
+}
+
+// check validates the cookie of the query r, and sets the cookie of the
+// response res. It reports whether the query should be answered by the
+// handler, or only with the cookie response.
+func (c *ServerCookies) check(r *Query, res *Message, packet bool, now time.Time) bool {
+	cookie, ok, err := findCookie(r.Message)
+	if err != nil {
+		res.RCode = FormErr
+		res.Additionals = nil
+		return false
+	}
+	if !ok {
+		if c.Enforce && packet {
+			res.Truncated = true
+			return false
+		}
+		return true
+	}
+
+	ip := addrIP(r.RemoteAddr)
+	valid := len(cookie.Server) > 0 &&
+		(c.valid(c.Secret, cookie, ip, now) || c.valid(c.PreviousSecret, cookie, ip, now))
+
+	resCookie := edns.Cookie{
+		Client: cookie.Client,
+		Server: serverCookie(c.Secret, cookie.Client, ip, now),
+	}
+	if res.Additionals, err = setCookie(res.Additionals, resCookie); err != nil {
+		res.RCode = ServFail
+		return false
+	}
+
+	if !valid && c.Enforce && packet {
+		setExtendedRCode(res, rcodeBadCookie)
+		return false
+	}
+	return true
+}
+
+// valid reports whether the server cookie was created with the secret and is
+// not expired.
+func (c *ServerCookies) valid(secret []byte, cookie edns.Cookie, ip net.IP, now time.Time) bool {
+	if secret == nil || len(cookie.Server) != 16 || cookie.Server[0] != 1 {
+		return false
+	}
+
+	ts := time.Unix(int64(nbo.Uint32(cookie.Server[4:8])), 0)
+	if now.Sub(ts) > serverCookieLifetime || ts.Sub(now) > serverCookieSkew {
+		return false
+	}
+	return hmac.Equal(cookie.Server[8:], cookieHash(secret, cookie.Client, cookie.Server[:8], ip))
+}
+
+// serverCookie returns a new server cookie for the client cookie and IP.
+func serverCookie(secret, client []byte, ip net.IP, now time.Time) []byte {
+	b := make([]byte, 8, 16)
+	b[0] = 1 // version
+	nbo.PutUint32(b[4:8], uint32(now.Unix()))
+
+	return append(b, cookieHash(secret, client, b, ip)...)
+}
+
+func cookieHash(secret, client, prefix []byte, ip net.IP) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write(client)
+	h.Write(prefix)
+	h.Write(ip.To16())
+	return h.Sum(nil)[:8]
+}
+
+// ClientCookies are the DNS Cookies (RFC 7873) of a Client. The client cookie
+// sent to each server is derived from a random secret, and the server cookie
+// received from each server is sent in later queries to the server.
+type ClientCookies struct {
+	// Rotate is the interval after which the secret is replaced and the
+	// server cookies are forgotten, so that queries are not linked over a
+	// long period. If zero, the secret is not replaced.
+	Rotate time.Duration
+
+	mu      sync.Mutex
+	secret  []byte
+	created time.Time
+	servers map[string][]byte
+}
+
+// cookie returns the cookie of a query sent to the server at addr.
+func (c *ClientCookies) cookie(addr net.Addr, now time.Time) (edns.Cookie, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.secret == nil || (c.Rotate > 0 && now.Sub(c.created) >= c.Rotate) {
+		secret := make([]byte, 16)
+		if _, err := cryptorand.Read(secret); err != nil {
+			return edns.Cookie{}, err
+		}
+		c.secret, c.created, c.servers = secret, now, make(map[string][]byte)
+	}
+
+	h := hmac.New(sha256.New, c.secret)
+	h.Write(addrIP(addr).To16())
+
+	key := addrKey(addr)
+	return edns.Cookie{
+		Client: h.Sum(nil)[:edns.ClientCookieLen],
+		Server: c.servers[key],
+	}, nil
+}
+
+// update records the server cookie of the response res to a query sent to
+// addr with the cookie. It returns an error if the response cookie does not
+// match the query.
+func (c *ClientCookies) update(addr net.Addr, cookie edns.Cookie, res *Message) error {
+	resCookie, ok, err := findCookie(res)
+	if err != nil || !ok {
+		return err
+	}
+	if !bytes.Equal(resCookie.Client, cookie.Client) {
+		return errCookieMismatch
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(resCookie.Server) > 0 && c.servers != nil {
+		c.servers[addrKey(addr)] = resCookie.Server
+	}
+	return nil
+}
+
+// findCookie returns the cookie of the OPT record of msg.
+func findCookie(msg *Message) (edns.Cookie, bool, error) {
+	o, ok := findOption(msg, edns.OptionCodeCookie)
+	if !ok {
+		return edns.Cookie{}, false, nil
+	}
+
+	var cookie edns.Cookie
+	if _, err := cookie.Unpack(o.Data); err != nil {
+		return edns.Cookie{}, false, err
+	}
+	return cookie, true, nil
+}
+
+// setCookie returns a copy of rrs with the cookie option of the OPT record
+// replaced by cookie. An OPT record is added if rrs has none.
+func setCookie(rrs []Resource, cookie edns.Cookie) ([]Resource, error) {
+	option, err := cookie.Option()
+	if err != nil {
+		return nil, err
+	}
+	return setOption(rrs, option), nil
+}
+
+// extendedRCode returns the RCODE of msg, extended by the upper bits in the
+// TTL of the OPT record (RFC 6891, section 6.1.3).
+func extendedRCode(msg *Message) int {
+	for _, res := range msg.Additionals {
+		if res.Record.Type() == TypeOPT {
+			ext := uint32(res.TTL/time.Second) >> 24
+			return int(ext)<<4 | int(msg.RCode)
+		}
+	}
+	return int(msg.RCode)
+}
+
+// setExtendedRCode sets the RCODE of msg, and the upper bits in the TTL of
+// its OPT record.
+func setExtendedRCode(msg *Message, rcode int) {
+	msg.RCode = RCode(rcode & 0xF)
+
+	for i, res := range msg.Additionals {
+		if res.Record.Type() == TypeOPT {
+			ttl := uint32(res.TTL/time.Second)&0xFFFFFF | uint32(rcode>>4)<<24
+			msg.Additionals[i].TTL = time.Duration(ttl) * time.Second
+			return
+		}
+	}
+}
+
+// addrKey identifies the server at addr.
+func addrKey(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.Network() + " " + addr.String()
+}
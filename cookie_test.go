@@ -0,0 +1,299 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/benburkert/dns/edns"
+)
+
+func TestServerCookies(t *testing.T) {
+	t.Parallel()
+
+	// The server cookies are bound to the client address, so the server
+	// only listens on the IPv4 loopback address.
+	_, port, err := net.SplitHostPort(mustUnusedAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &Server{
+		Addr:    net.JoinHostPort("127.0.0.1", port),
+		Handler: &answerHandler{answers},
+		Cookies: &ServerCookies{
+			Secret:         []byte("secret"),
+			PreviousSecret: []byte("previous"),
+			Enforce:        true,
+		},
+	}
+	mustStart(srv)
+
+	var (
+		ip     = net.IPv4(127, 0, 0, 1)
+		now    = time.Now()
+		client = []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07}
+	)
+
+	cookieOPT := func(server []byte) []Resource {
+		return []Resource{
+			{
+				Name:  ".",
+				Class: defaultUDPSize,
+				Record: &OPT{
+					Options: []edns.Option{
+						{
+							Code: edns.OptionCodeCookie,
+							Data: append(append([]byte{}, client...), server...),
+						},
+					},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name string
+
+		network     string
+		additionals []Resource
+
+		rcode     int
+		truncated bool
+		answered  bool
+		cookie    bool
+	}{
+		{
+			name: "udp-no-cookie",
+
+			network: "udp",
+
+			truncated: true,
+		},
+		{
+			name: "tcp-no-cookie",
+
+			network: "tcp",
+
+			answered: true,
+		},
+		{
+			name: "udp-client-cookie",
+
+			network:     "udp",
+			additionals: cookieOPT(nil),
+
+			rcode:  rcodeBadCookie,
+			cookie: true,
+		},
+		{
+			name: "tcp-client-cookie",
+
+			network:     "tcp",
+			additionals: cookieOPT(nil),
+
+			answered: true,
+			cookie:   true,
+		},
+		{
+			name: "udp-server-cookie",
+
+			network:     "udp",
+			additionals: cookieOPT(serverCookie([]byte("secret"), client, ip, now)),
+
+			answered: true,
+			cookie:   true,
+		},
+		{
+			name: "udp-previous-secret",
+
+			network:     "udp",
+			additionals: cookieOPT(serverCookie([]byte("previous"), client, ip, now)),
+
+			answered: true,
+			cookie:   true,
+		},
+		{
+			name: "udp-expired-server-cookie",
+
+			network:     "udp",
+			additionals: cookieOPT(serverCookie([]byte("secret"), client, ip, now.Add(-2*time.Hour))),
+
+			rcode:  rcodeBadCookie,
+			cookie: true,
+		},
+		{
+			name: "udp-invalid-server-cookie",
+
+			network:     "udp",
+			additionals: cookieOPT(serverCookie([]byte("bogus"), client, ip, now)),
+
+			rcode:  rcodeBadCookie,
+			cookie: true,
+		},
+		{
+			name: "malformed-cookie",
+
+			network:     "udp",
+			additionals: cookieOPT([]byte{0x01, 0x02}),
+
+			rcode: int(FormErr),
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			addr, err := resolveAddr(test.network, srv.Addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			query := &Query{
+				Message: &Message{
+					Questions:   []Question{questions["A"]},
+					Additionals: test.additionals,
+				},
+				RemoteAddr: addr,
+			}
+
+			msg, err := (&Client{Transport: &Transport{}}).Do(context.Background(), query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want, got := test.rcode, extendedRCode(msg); want != got {
+				t.Errorf("want rcode %d, got %d", want, got)
+			}
+			if want, got := test.truncated, msg.Truncated; want != got {
+				t.Errorf("want truncated %t, got %t", want, got)
+			}
+			if want, got := test.answered, len(msg.Answers) > 0; want != got {
+				t.Errorf("want answered %t, got %d answers", want, len(msg.Answers))
+			}
+
+			cookie, ok, err := findCookie(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, got := test.cookie, ok && len(cookie.Server) > 0; want != got {
+				t.Fatalf("want server cookie %t, got %+v", want, cookie)
+			}
+			if test.cookie && !bytes.Equal(client, cookie.Client) {
+				t.Errorf("want client cookie %x, got %x", client, cookie.Client)
+			}
+		})
+	}
+}
+
+func TestClientCookies(t *testing.T) {
+	t.Parallel()
+
+	srv := &Server{
+		Addr:    mustUnusedAddr(),
+		Handler: &answerHandler{answers},
+		Cookies: &ServerCookies{
+			Secret:  []byte("secret"),
+			Enforce: true,
+		},
+	}
+	mustStart(srv)
+
+	addr, err := net.ResolveUDPAddr("udp", srv.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cookies := new(ClientCookies)
+	client := &Client{
+		Transport: &Transport{},
+		Cookies:   cookies,
+	}
+
+	// The first query learns the server cookie from a BADCOOKIE response.
+	for i := 0; i < 2; i++ {
+		query := &Query{
+			Message: &Message{
+				Questions: []Question{questions["A"]},
+			},
+			RemoteAddr: addr,
+		}
+
+		msg, err := client.Do(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := NoError, msg.RCode; want != got {
+			t.Fatalf("want rcode %d, got %d", want, got)
+		}
+		if want, got := 1, len(msg.Answers); want != got {
+			t.Fatalf("want %d answers, got %d", want, got)
+		}
+		if query.Additionals != nil {
+			t.Errorf("want query additionals unchanged, got %+v", query.Additionals)
+		}
+	}
+
+	cookie, err := cookies.cookie(addr, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 16, len(cookie.Server); want != got {
+		t.Errorf("want %d byte server cookie, got %d", want, got)
+	}
+}
+
+func TestClientCookiesUpdate(t *testing.T) {
+	t.Parallel()
+
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53}
+
+	cookies := &ClientCookies{Rotate: time.Hour}
+	now := time.Now()
+
+	cookie, err := cookies.cookie(addr, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := []byte{0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17}
+
+	res := new(Message)
+	if res.Additionals, err = setCookie(nil, edns.Cookie{Client: make([]byte, 8), Server: server}); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := errCookieMismatch, cookies.update(addr, cookie, res); want != got {
+		t.Fatalf("want error %v, got %v", want, got)
+	}
+
+	if res.Additionals, err = setCookie(nil, edns.Cookie{Client: cookie.Client, Server: server}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cookies.update(addr, cookie, res); err != nil {
+		t.Fatal(err)
+	}
+
+	next, err := cookies.cookie(addr, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := server, next.Server; !bytes.Equal(want, got) {
+		t.Errorf("want server cookie %x, got %x", want, got)
+	}
+
+	rotated, err := cookies.cookie(addr, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(cookie.Client, rotated.Client) {
+		t.Errorf("want rotated client cookie, got %x", rotated.Client)
+	}
+	if rotated.Server != nil {
+		t.Errorf("want no server cookie after rotation, got %x", rotated.Server)
+	}
+}
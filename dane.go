@@ -0,0 +1,84 @@
+package dns
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var errEmailAddress = errors.New("invalid email address")
+
+// TLSAName returns the owner name of the TLSA records for the TLS service on
+// port of the host, such as "_443._tcp.example.com." (RFC 6698, section 3).
+func TLSAName(host, network string, port int) string {
+	return "_" + strconv.Itoa(port) + "._" + network + "." + host
+}
+
+// OPENPGPKEYName returns the owner name of the OPENPGPKEY records for the
+// email address, such as "<hash>._openpgpkey.example.com." (RFC 7929,
+// section 3).
+func OPENPGPKEYName(email string) (string, error) {
+	return emailName(email, "_openpgpkey.")
+}
+
+// SMIMEAName returns the owner name of the SMIMEA records for the email
+// address, such as "<hash>._smimecert.example.com." (RFC 8162, section 3).
+func SMIMEAName(email string) (string, error) {
+	return emailName(email, "_smimecert.")
+}
+
+// emailName returns the owner name for the email address below the
+// subdomain of its domain. The first label is the hex encoded SHA-256 hash
+// of the local-part, truncated to 28 octets.
+func emailName(email, subdomain string) (string, error) {
+	i := strings.LastIndexByte(email, '@')
+	if i <= 0 || i == len(email)-1 {
+		return "", errEmailAddress
+	}
+	local, domain := email[:i], email[i+1:]
+	if !strings.HasSuffix(domain, ".") {
+		domain += "."
+	}
+
+	sum := sha256.Sum256([]byte(local))
+	return hex.EncodeToString(sum[:28]) + "." + subdomain + domain, nil
+}
+
+// Match reports whether the certificate matches the certificate association
+// of t. It only compares the selected content of the certificate, the usage
+// of t must be checked by the caller when validating a certificate chain.
+func (t TLSA) Match(cert *x509.Certificate) bool {
+	var content []byte
+	switch t.Selector {
+	case TLSASelectorCert:
+		content = cert.Raw
+	case TLSASelectorSPKI:
+		content = cert.RawSubjectPublicKeyInfo
+	default:
+		return false
+	}
+
+	switch t.MatchingType {
+	case TLSAMatchingFull:
+		return bytes.Equal(content, t.Data)
+	case TLSAMatchingSHA256:
+		sum := sha256.Sum256(content)
+		return bytes.Equal(sum[:], t.Data)
+	case TLSAMatchingSHA512:
+		sum := sha512.Sum512(content)
+		return bytes.Equal(sum[:], t.Data)
+	default:
+		return false
+	}
+}
+
+// Match reports whether the certificate matches the certificate association
+// of s, as for a TLSA record.
+func (s SMIMEA) Match(cert *x509.Certificate) bool {
+	return TLSA(s).Match(cert)
+}
@@ -0,0 +1,159 @@
+package dns
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"testing"
+
+	"github.com/benburkert/dns/internal/must"
+)
+
+func TestTLSAName(t *testing.T) {
+	t.Parallel()
+
+	if want, got := "_443._tcp.example.com.", TLSAName("example.com.", "tcp", 443); want != got {
+		t.Errorf("want TLSA name %q, got %q", want, got)
+	}
+}
+
+func TestEmailNames(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+
+		fn    func(string) (string, error)
+		email string
+
+		owner string
+		err   error
+	}{
+		{
+			name: "openpgpkey",
+
+			fn:    OPENPGPKEYName,
+			email: "hugh@example.com",
+
+			owner: "c93f1e400f26708f98cb19d936620da35eec8f72e57f9eec01c1afd6._openpgpkey.example.com.",
+		},
+		{
+			name: "smimea",
+
+			fn:    SMIMEAName,
+			email: "hugh@example.com.",
+
+			owner: "c93f1e400f26708f98cb19d936620da35eec8f72e57f9eec01c1afd6._smimecert.example.com.",
+		},
+		{
+			name: "missing-local-part",
+
+			fn:    SMIMEAName,
+			email: "@example.com",
+
+			err: errEmailAddress,
+		},
+		{
+			name: "missing-domain",
+
+			fn:    OPENPGPKEYName,
+			email: "hugh",
+
+			err: errEmailAddress,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			owner, err := test.fn(test.email)
+			if want, got := test.err, err; want != got {
+				t.Fatalf("want error %v, got %v", want, got)
+			}
+			if want, got := test.owner, owner; want != got {
+				t.Errorf("want owner name %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestTLSAMatch(t *testing.T) {
+	t.Parallel()
+
+	ca := must.CACert("ca.dev", nil)
+
+	cert, err := x509.ParseCertificate(must.LeafCert("dns-server.dev", ca).TLS().Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := x509.ParseCertificate(ca.TLS().Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spki256 := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	cert512 := sha512.Sum512(cert.Raw)
+
+	tests := []struct {
+		name string
+
+		tlsa TLSA
+
+		match bool
+	}{
+		{
+			name: "full-cert",
+
+			tlsa: TLSA{Usage: TLSAUsageDANEEE, Selector: TLSASelectorCert, MatchingType: TLSAMatchingFull, Data: cert.Raw},
+
+			match: true,
+		},
+		{
+			name: "spki-sha256",
+
+			tlsa: TLSA{Usage: TLSAUsageDANEEE, Selector: TLSASelectorSPKI, MatchingType: TLSAMatchingSHA256, Data: spki256[:]},
+
+			match: true,
+		},
+		{
+			name: "cert-sha512",
+
+			tlsa: TLSA{Usage: TLSAUsageDANEEE, Selector: TLSASelectorCert, MatchingType: TLSAMatchingSHA512, Data: cert512[:]},
+
+			match: true,
+		},
+		{
+			name: "mismatched-selector",
+
+			tlsa: TLSA{Usage: TLSAUsageDANEEE, Selector: TLSASelectorCert, MatchingType: TLSAMatchingSHA256, Data: spki256[:]},
+		},
+		{
+			name: "other-cert",
+
+			tlsa: TLSA{Usage: TLSAUsageDANEEE, Selector: TLSASelectorCert, MatchingType: TLSAMatchingFull, Data: other.Raw},
+		},
+		{
+			name: "unknown-matching-type",
+
+			tlsa: TLSA{Usage: TLSAUsageDANEEE, Selector: TLSASelectorCert, MatchingType: 255, Data: cert.Raw},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			if want, got := test.match, test.tlsa.Match(cert); want != got {
+				t.Errorf("want match %t, got %t", want, got)
+			}
+			if want, got := test.match, SMIMEA(test.tlsa).Match(cert); want != got {
+				t.Errorf("want SMIMEA match %t, got %t", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package dns
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"sort"
+)
+
+// Digest returns a SHA-256 digest of the semantic content of m, for
+// deduplicating and comparing messages.
+//
+// The digest covers the header flags, including the AD and CD bits, the
+// status, the questions, and the resources of each section. It does not
+// depend on the message ID, the order of the entries within a section,
+// duplicate entries, the case of domain names, or the TTLs of resources. OPT
+// records are excluded, as they describe the transport of the message rather
+// than its content.
+func (m *Message) Digest() ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+
+	var flags uint16
+	if m.Response {
+		flags |= headerBitQR
+	}
+	flags |= uint16(m.OpCode&0xF) << 11
+	if m.Authoritative {
+		flags |= headerBitAA
+	}
+	if m.Truncated {
+		flags |= headerBitTC
+	}
+	if m.RecursionDesired {
+		flags |= headerBitRD
+	}
+	if m.RecursionAvailable {
+		flags |= headerBitRA
+	}
+	if m.AuthenticatedData {
+		flags |= headerBitAD
+	}
+	if m.CheckingDisabled {
+		flags |= headerBitCD
+	}
+
+	h := sha256.New()
+
+	var hdr [4]byte
+	nbo.PutUint16(hdr[:2], flags)
+	nbo.PutUint16(hdr[2:], uint16(m.RCode))
+	h.Write(hdr[:])
+
+	var entries [][]byte
+	for _, q := range m.Questions {
+		b, err := q.Pack(nil, canonicalCompressor{})
+		if err != nil {
+			return sum, err
+		}
+		entries = append(entries, b)
+	}
+	writeDigestSection(h, entries)
+
+	for _, section := range [][]Resource{m.Answers, m.Authorities, m.Additionals} {
+		entries = entries[:0]
+		for _, res := range section {
+			if res.Record.Type() == TypeOPT {
+				continue
+			}
+
+			res.TTL = 0
+			b, err := res.Pack(nil, canonicalCompressor{})
+			if err != nil {
+				return sum, err
+			}
+			entries = append(entries, b)
+		}
+		writeDigestSection(h, entries)
+	}
+
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+// writeDigestSection writes the sorted and deduplicated entries of a section
+// to w, prefixed by the entry count.
+func writeDigestSection(w io.Writer, entries [][]byte) {
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i], entries[j]) < 0
+	})
+
+	var uniq [][]byte
+	for i, b := range entries {
+		if i > 0 && bytes.Equal(entries[i-1], b) {
+			continue
+		}
+		uniq = append(uniq, b)
+	}
+
+	var buf [4]byte
+	nbo.PutUint32(buf[:], uint32(len(uniq)))
+	w.Write(buf[:])
+
+	for _, b := range uniq {
+		nbo.PutUint32(buf[:], uint32(len(b)))
+		w.Write(buf[:])
+		w.Write(b)
+	}
+}
@@ -0,0 +1,146 @@
+package dns
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/benburkert/dns/edns"
+)
+
+func TestMessageDigest(t *testing.T) {
+	t.Parallel()
+
+	base := func() *Message {
+		return &Message{
+			ID:                 1,
+			Response:           true,
+			RecursionDesired:   true,
+			RecursionAvailable: true,
+			Questions: []Question{
+				{Name: "example.com.", Type: TypeA, Class: ClassIN},
+			},
+			Answers: []Resource{
+				{Name: "example.com.", Class: ClassIN, TTL: time.Minute, Record: &A{A: net.IPv4(192, 0, 2, 1).To4()}},
+				{Name: "example.com.", Class: ClassIN, TTL: time.Minute, Record: &A{A: net.IPv4(192, 0, 2, 2).To4()}},
+			},
+			Authorities: []Resource{
+				{Name: "example.com.", Class: ClassIN, TTL: time.Hour, Record: &NS{NS: "ns.example.com."}},
+			},
+		}
+	}
+
+	want, err := base().Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	equal := []struct {
+		name   string
+		modify func(*Message)
+	}{
+		{
+			name:   "id",
+			modify: func(m *Message) { m.ID = 4242 },
+		},
+		{
+			name: "order",
+			modify: func(m *Message) {
+				m.Answers[0], m.Answers[1] = m.Answers[1], m.Answers[0]
+			},
+		},
+		{
+			name: "case",
+			modify: func(m *Message) {
+				m.Questions[0].Name = "EXAMPLE.com."
+				m.Authorities[0].Record = &NS{NS: "NS.Example.COM."}
+			},
+		},
+		{
+			name: "ttl",
+			modify: func(m *Message) {
+				m.Answers[0].TTL = time.Second
+			},
+		},
+		{
+			name: "duplicate",
+			modify: func(m *Message) {
+				m.Answers = append(m.Answers, m.Answers[0])
+			},
+		},
+		{
+			name: "opt",
+			modify: func(m *Message) {
+				m.Additionals = append(m.Additionals, Resource{
+					Name:   ".",
+					Class:  4096,
+					Record: &OPT{Options: []edns.Option{{Code: edns.OptionCodeCookie, Data: []byte{1, 2, 3, 4, 5, 6, 7, 8}}}},
+				})
+			},
+		},
+	}
+
+	for _, test := range equal {
+		msg := base()
+		test.modify(msg)
+
+		got, err := msg.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want != got {
+			t.Errorf("%s: want equal digest %x, got %x", test.name, want, got)
+		}
+	}
+
+	differ := []struct {
+		name   string
+		modify func(*Message)
+	}{
+		{
+			name:   "rcode",
+			modify: func(m *Message) { m.RCode = NXDomain },
+		},
+		{
+			name:   "flags",
+			modify: func(m *Message) { m.Authoritative = true },
+		},
+		{
+			name:   "authenticated-data",
+			modify: func(m *Message) { m.AuthenticatedData = true },
+		},
+		{
+			name:   "checking-disabled",
+			modify: func(m *Message) { m.CheckingDisabled = true },
+		},
+		{
+			name: "rdata",
+			modify: func(m *Message) {
+				m.Answers[1].Record = &A{A: net.IPv4(192, 0, 2, 3).To4()}
+			},
+		},
+		{
+			name: "section",
+			modify: func(m *Message) {
+				m.Additionals, m.Authorities = m.Authorities, nil
+			},
+		},
+		{
+			name:   "question",
+			modify: func(m *Message) { m.Questions[0].Type = TypeAAAA },
+		},
+	}
+
+	for _, test := range differ {
+		msg := base()
+		test.modify(msg)
+
+		got, err := msg.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want == got {
+			t.Errorf("%s: want different digest, got %x", test.name, got)
+		}
+	}
+}
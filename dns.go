@@ -2,6 +2,7 @@ package dns
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"net"
 )
@@ -24,6 +25,10 @@ var (
 
 	// ErrUnsupportedOp indicates the operation is not supported by callee.
 	ErrUnsupportedOp = errors.New("unsupported operation")
+
+	// ErrMissingCertificate is returned when serving TLS without a
+	// certificate configured in the TLS config.
+	ErrMissingCertificate = errors.New("missing TLS certificate")
 )
 
 // AddrDialer dials a net Addr.
@@ -37,6 +42,12 @@ type Query struct {
 
 	// RemoteAddr is the address of a DNS resolver.
 	RemoteAddr net.Addr
+
+	// Raw is the wire format of a query received by a Server, as read from
+	// the connection and before any modification by the server. It is used to
+	// verify message signatures such as TSIG and SIG(0). Raw is nil for
+	// queries that were not received from the network.
+	Raw []byte
 }
 
 // OverTLSAddr indicates the remote DNS service implements DNS-over-TLS as
@@ -50,6 +61,41 @@ func (a OverTLSAddr) Network() string {
 	return a.Addr.Network() + "-tls"
 }
 
+// OverHTTPSAddr indicates the remote DNS service implements DNS-over-HTTPS as
+// defined in RFC 8484. Queries are sent to the URL, over a connection to the
+// TCP address.
+type OverHTTPSAddr struct {
+	net.Addr
+
+	// URL is the URL of the DNS query endpoint, such as
+	// "https://dns.example/dns-query".
+	URL string
+
+	// TLSConfig optionally configures the TLS connection to the service. If
+	// nil, the TLSConfig of the Transport is used.
+	TLSConfig *tls.Config
+}
+
+// Network returns the address's network name with a "-https" suffix.
+func (a OverHTTPSAddr) Network() string {
+	return a.Addr.Network() + "-https"
+}
+
+// OverQUICAddr indicates the remote DNS service implements DNS-over-QUIC as
+// defined in RFC 9250.
+type OverQUICAddr struct {
+	net.Addr
+
+	// TLSConfig optionally configures the QUIC connection to the service. If
+	// nil, the TLSConfig of the Transport is used.
+	TLSConfig *tls.Config
+}
+
+// Network returns the address's network name with a "-quic" suffix.
+func (a OverQUICAddr) Network() string {
+	return a.Addr.Network() + "-quic"
+}
+
 // ProxyFunc modifies the address of a DNS server.
 type ProxyFunc func(context.Context, net.Addr) (net.Addr, error)
 
@@ -0,0 +1,476 @@
+package dns
+
+import (
+	"crypto/sha1"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+)
+
+var errNSEC3Hash = errors.New("unsupported NSEC3 hash algorithm")
+
+// DNSSEC algorithm numbers.
+//
+// Taken from https://www.iana.org/assignments/dns-sec-alg-numbers/dns-sec-alg-numbers.xhtml
+const (
+	AlgorithmRSASHA1         = 5  // [RFC3110]
+	AlgorithmRSASHA256       = 8  // [RFC5702]
+	AlgorithmRSASHA512       = 10 // [RFC5702]
+	AlgorithmECDSAP256SHA256 = 13 // [RFC6605]
+	AlgorithmECDSAP384SHA384 = 14 // [RFC6605]
+	AlgorithmED25519         = 15 // [RFC8080]
+	AlgorithmED448           = 16 // [RFC8080]
+)
+
+// DS digest types.
+//
+// Taken from https://www.iana.org/assignments/ds-rr-types/ds-rr-types.xhtml
+const (
+	DigestSHA1   = 1 // [RFC3658]
+	DigestSHA256 = 2 // [RFC4509]
+	DigestSHA384 = 4 // [RFC6605]
+)
+
+// DNSKEY flags.
+const (
+	DNSKEYFlagZone = 0x0100 // [RFC4034] Zone Key
+	DNSKEYFlagSEP  = 0x0001 // [RFC4034] Secure Entry Point
+)
+
+// DNSKEY is a DNS DNSKEY record.
+type DNSKEY struct {
+	Flags     int
+	Protocol  int
+	Algorithm int
+	PublicKey []byte
+}
+
+// Type returns the RR type identifier.
+func (DNSKEY) Type() Type { return TypeDNSKEY }
+
+// Length returns the encoded RDATA size.
+func (d DNSKEY) Length(_ Compressor) (int, error) {
+	return 4 + len(d.PublicKey), nil
+}
+
+// Pack encodes d as RDATA.
+func (d DNSKEY) Pack(b []byte, _ Compressor) ([]byte, error) {
+	var (
+		flags     = uint16(d.Flags)
+		protocol  = uint8(d.Protocol)
+		algorithm = uint8(d.Algorithm)
+	)
+
+	if int(flags) != d.Flags {
+		return nil, errFieldOverflow
+	}
+	if int(protocol) != d.Protocol {
+		return nil, errFieldOverflow
+	}
+	if int(algorithm) != d.Algorithm {
+		return nil, errFieldOverflow
+	}
+
+	buf := [4]byte{}
+	nbo.PutUint16(buf[:2], flags)
+	buf[2] = protocol
+	buf[3] = algorithm
+
+	return append(append(b, buf[:]...), d.PublicKey...), nil
+}
+
+// Unpack decodes d from RDATA in b.
+func (d *DNSKEY) Unpack(b []byte, _ Decompressor) ([]byte, error) {
+	if len(b) < 4 {
+		return nil, errResourceLen
+	}
+
+	d.Flags = int(nbo.Uint16(b[:2]))
+	d.Protocol = int(b[2])
+	d.Algorithm = int(b[3])
+	d.PublicKey = append(d.PublicKey[:0], b[4:]...)
+
+	return nil, nil
+}
+
+// KeyTag returns the key tag of d, as described in RFC 4034 appendix B. The
+// key tag of the obsolete RSA/MD5 algorithm is not supported.
+func (d DNSKEY) KeyTag() int {
+	rdata, err := d.Pack(nil, nil)
+	if err != nil {
+		return 0
+	}
+
+	var ac uint32
+	for i, v := range rdata {
+		if i&1 == 0 {
+			ac += uint32(v) << 8
+		} else {
+			ac += uint32(v)
+		}
+	}
+	ac += ac >> 16 & 0xFFFF
+	return int(ac & 0xFFFF)
+}
+
+// DS is a DNS DS record.
+type DS struct {
+	KeyTag     int
+	Algorithm  int
+	DigestType int
+	Digest     []byte
+}
+
+// Type returns the RR type identifier.
+func (DS) Type() Type { return TypeDS }
+
+// Length returns the encoded RDATA size.
+func (d DS) Length(_ Compressor) (int, error) {
+	return 4 + len(d.Digest), nil
+}
+
+// Pack encodes d as RDATA.
+func (d DS) Pack(b []byte, _ Compressor) ([]byte, error) {
+	var (
+		keyTag     = uint16(d.KeyTag)
+		algorithm  = uint8(d.Algorithm)
+		digestType = uint8(d.DigestType)
+	)
+
+	if int(keyTag) != d.KeyTag {
+		return nil, errFieldOverflow
+	}
+	if int(algorithm) != d.Algorithm {
+		return nil, errFieldOverflow
+	}
+	if int(digestType) != d.DigestType {
+		return nil, errFieldOverflow
+	}
+
+	buf := [4]byte{}
+	nbo.PutUint16(buf[:2], keyTag)
+	buf[2] = algorithm
+	buf[3] = digestType
+
+	return append(append(b, buf[:]...), d.Digest...), nil
+}
+
+// Unpack decodes d from RDATA in b.
+func (d *DS) Unpack(b []byte, _ Decompressor) ([]byte, error) {
+	if len(b) < 4 {
+		return nil, errResourceLen
+	}
+
+	d.KeyTag = int(nbo.Uint16(b[:2]))
+	d.Algorithm = int(b[2])
+	d.DigestType = int(b[3])
+	d.Digest = append(d.Digest[:0], b[4:]...)
+
+	return nil, nil
+}
+
+// RRSIG is a DNS RRSIG record.
+type RRSIG struct {
+	TypeCovered Type
+	Algorithm   int
+	Labels      int
+	OriginalTTL time.Duration
+	Expiration  time.Time
+	Inception   time.Time
+	KeyTag      int
+	SignerName  string // Not compressed as per RFC 4034.
+	Signature   []byte
+}
+
+// Type returns the RR type identifier.
+func (RRSIG) Type() Type { return TypeRRSIG }
+
+// Length returns the encoded RDATA size.
+func (r RRSIG) Length(_ Compressor) (int, error) {
+	n, err := compressor{}.Length(r.SignerName)
+	if err != nil {
+		return 0, err
+	}
+	return 18 + n + len(r.Signature), nil
+}
+
+// Pack encodes r as RDATA.
+func (r RRSIG) Pack(b []byte, _ Compressor) ([]byte, error) {
+	var (
+		algorithm = uint8(r.Algorithm)
+		labels    = uint8(r.Labels)
+		keyTag    = uint16(r.KeyTag)
+		ttl       = r.OriginalTTL / time.Second
+	)
+
+	if int(algorithm) != r.Algorithm {
+		return nil, errFieldOverflow
+	}
+	if int(labels) != r.Labels {
+		return nil, errFieldOverflow
+	}
+	if int(keyTag) != r.KeyTag {
+		return nil, errFieldOverflow
+	}
+	if ttl < 0 || ttl > 1<<32-1 {
+		return nil, errFieldOverflow
+	}
+
+	buf := [18]byte{}
+	nbo.PutUint16(buf[:2], uint16(r.TypeCovered))
+	buf[2] = algorithm
+	buf[3] = labels
+	nbo.PutUint32(buf[4:8], uint32(ttl))
+	nbo.PutUint32(buf[8:12], uint32(r.Expiration.Unix()))
+	nbo.PutUint32(buf[12:16], uint32(r.Inception.Unix()))
+	nbo.PutUint16(buf[16:], keyTag)
+
+	b, err := compressor{}.Pack(append(b, buf[:]...), r.SignerName)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, r.Signature...), nil
+}
+
+// Unpack decodes r from RDATA in b.
+func (r *RRSIG) Unpack(b []byte, dec Decompressor) ([]byte, error) {
+	if len(b) < 18 {
+		return nil, errResourceLen
+	}
+
+	r.TypeCovered = Type(nbo.Uint16(b[:2]))
+	r.Algorithm = int(b[2])
+	r.Labels = int(b[3])
+	r.OriginalTTL = time.Duration(nbo.Uint32(b[4:8])) * time.Second
+	r.Expiration = time.Unix(int64(nbo.Uint32(b[8:12])), 0)
+	r.Inception = time.Unix(int64(nbo.Uint32(b[12:16])), 0)
+	r.KeyTag = int(nbo.Uint16(b[16:18]))
+
+	var err error
+	if r.SignerName, b, err = dec.Unpack(b[18:]); err != nil {
+		return nil, err
+	}
+	r.Signature = append(r.Signature[:0], b...)
+
+	return nil, nil
+}
+
+// NSEC is a DNS NSEC record.
+type NSEC struct {
+	NextDomain string // Not compressed as per RFC 4034.
+	Types      TypeBitmap
+}
+
+// Type returns the RR type identifier.
+func (NSEC) Type() Type { return TypeNSEC }
+
+// Length returns the encoded RDATA size.
+func (n NSEC) Length(_ Compressor) (int, error) {
+	l, err := compressor{}.Length(n.NextDomain)
+	if err != nil {
+		return 0, err
+	}
+	return l + n.Types.Length(), nil
+}
+
+// Pack encodes n as RDATA.
+func (n NSEC) Pack(b []byte, _ Compressor) ([]byte, error) {
+	b, err := compressor{}.Pack(b, n.NextDomain)
+	if err != nil {
+		return nil, err
+	}
+	return n.Types.Pack(b)
+}
+
+// Unpack decodes n from RDATA in b.
+func (n *NSEC) Unpack(b []byte, dec Decompressor) ([]byte, error) {
+	var err error
+	if n.NextDomain, b, err = dec.Unpack(b); err != nil {
+		return nil, err
+	}
+	return n.Types.Unpack(b)
+}
+
+// NSEC3 hash algorithms.
+const (
+	NSEC3HashSHA1 = 1 // [RFC5155]
+)
+
+// NSEC3 flags.
+const (
+	NSEC3FlagOptOut = 0x01 // [RFC5155] Opt-Out
+)
+
+// NSEC3 is a DNS NSEC3 record.
+type NSEC3 struct {
+	HashAlgorithm int
+	Flags         int
+	Iterations    int
+	Salt          []byte
+	NextHashed    []byte // next hashed owner name, in binary form
+	Types         TypeBitmap
+}
+
+// Type returns the RR type identifier.
+func (NSEC3) Type() Type { return TypeNSEC3 }
+
+// Length returns the encoded RDATA size.
+func (n NSEC3) Length(_ Compressor) (int, error) {
+	return 6 + len(n.Salt) + len(n.NextHashed) + n.Types.Length(), nil
+}
+
+// Pack encodes n as RDATA.
+func (n NSEC3) Pack(b []byte, _ Compressor) ([]byte, error) {
+	b, err := packNSEC3Params(b, n.HashAlgorithm, n.Flags, n.Iterations, n.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(n.NextHashed) == 0 {
+		return nil, errZeroSegLen
+	}
+	if len(n.NextHashed) > 255 {
+		return nil, errSegTooLong
+	}
+	b = append(append(b, byte(len(n.NextHashed))), n.NextHashed...)
+
+	return n.Types.Pack(b)
+}
+
+// Unpack decodes n from RDATA in b.
+func (n *NSEC3) Unpack(b []byte, _ Decompressor) ([]byte, error) {
+	var err error
+	if b, err = unpackNSEC3Params(b, &n.HashAlgorithm, &n.Flags, &n.Iterations, &n.Salt); err != nil {
+		return nil, err
+	}
+
+	if len(b) < 1 || len(b) < 1+int(b[0]) {
+		return nil, errResourceLen
+	}
+	if b[0] == 0 {
+		return nil, errZeroSegLen
+	}
+	n.NextHashed = append(n.NextHashed[:0], b[1:1+int(b[0])]...)
+
+	return n.Types.Unpack(b[1+int(b[0]):])
+}
+
+// NextHashedOwnerName returns the next hashed owner name of n in the zone.
+func (n NSEC3) NextHashedOwnerName(zone string) string {
+	return nsec3Label(n.NextHashed) + "." + zone
+}
+
+// NSEC3PARAM is a DNS NSEC3PARAM record.
+type NSEC3PARAM struct {
+	HashAlgorithm int
+	Flags         int
+	Iterations    int
+	Salt          []byte
+}
+
+// Type returns the RR type identifier.
+func (NSEC3PARAM) Type() Type { return TypeNSEC3PARAM }
+
+// Length returns the encoded RDATA size.
+func (n NSEC3PARAM) Length(_ Compressor) (int, error) {
+	return 5 + len(n.Salt), nil
+}
+
+// Pack encodes n as RDATA.
+func (n NSEC3PARAM) Pack(b []byte, _ Compressor) ([]byte, error) {
+	return packNSEC3Params(b, n.HashAlgorithm, n.Flags, n.Iterations, n.Salt)
+}
+
+// Unpack decodes n from RDATA in b.
+func (n *NSEC3PARAM) Unpack(b []byte, _ Decompressor) ([]byte, error) {
+	b, err := unpackNSEC3Params(b, &n.HashAlgorithm, &n.Flags, &n.Iterations, &n.Salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > 0 {
+		return nil, errResTooLong
+	}
+	return nil, nil
+}
+
+// HashedOwnerName returns the hashed owner name of name in the zone, for the
+// NSEC3 parameters of n.
+func (n NSEC3PARAM) HashedOwnerName(name, zone string) (string, error) {
+	if n.HashAlgorithm != NSEC3HashSHA1 {
+		return "", errNSEC3Hash
+	}
+
+	hash, err := NSEC3Hash(name, n.Salt, n.Iterations)
+	if err != nil {
+		return "", err
+	}
+	return nsec3Label(hash) + "." + zone, nil
+}
+
+// NSEC3Hash returns the SHA-1 hash of the canonical form of name, with the
+// salt and additional iterations (RFC 5155, section 5).
+func NSEC3Hash(name string, salt []byte, iterations int) ([]byte, error) {
+	wire, err := compressor{}.Pack(nil, strings.ToLower(name))
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha1.New()
+	h.Write(wire)
+	h.Write(salt)
+	hash := h.Sum(nil)
+
+	for i := 0; i < iterations; i++ {
+		h.Reset()
+		h.Write(hash)
+		h.Write(salt)
+		hash = h.Sum(hash[:0])
+	}
+	return hash, nil
+}
+
+// nsec3Encoding is the base32 encoding with the extended hex alphabet of
+// hashed owner names (RFC 4648, section 7), in lower case and without
+// padding.
+var nsec3Encoding = base32.NewEncoding("0123456789abcdefghijklmnopqrstuv").WithPadding(base32.NoPadding)
+
+func nsec3Label(hash []byte) string {
+	return nsec3Encoding.EncodeToString(hash)
+}
+
+func packNSEC3Params(b []byte, hashAlgorithm, flags, iterations int, salt []byte) ([]byte, error) {
+	if int(uint8(hashAlgorithm)) != hashAlgorithm {
+		return nil, errFieldOverflow
+	}
+	if int(uint8(flags)) != flags {
+		return nil, errFieldOverflow
+	}
+	if int(uint16(iterations)) != iterations {
+		return nil, errFieldOverflow
+	}
+	if len(salt) > 255 {
+		return nil, errSegTooLong
+	}
+
+	buf := [5]byte{}
+	buf[0] = uint8(hashAlgorithm)
+	buf[1] = uint8(flags)
+	nbo.PutUint16(buf[2:4], uint16(iterations))
+	buf[4] = byte(len(salt))
+
+	return append(append(b, buf[:]...), salt...), nil
+}
+
+func unpackNSEC3Params(b []byte, hashAlgorithm, flags, iterations *int, salt *[]byte) ([]byte, error) {
+	if len(b) < 5 || len(b) < 5+int(b[4]) {
+		return nil, errResourceLen
+	}
+
+	*hashAlgorithm = int(b[0])
+	*flags = int(b[1])
+	*iterations = int(nbo.Uint16(b[2:4]))
+	*salt = append((*salt)[:0], b[5:5+int(b[4])]...)
+
+	return b[5+int(b[4]):], nil
+}
@@ -0,0 +1,213 @@
+package dns
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// dskey is the DNSKEY record of RFC 4034, section 5.4.
+const dskey = `dskey.example.com. 86400 IN DNSKEY 256 3 5 ( AQOeiiR0GOMYkDshWoSKz9Xz
+	fwJr1AYtsmx3TGkJaNXVbfi/ 2pHm822aJ5iI9BMzNXxeYCmZ DRD99WYwYqUSdjMmmAphXdvx
+	egXd/M5+X7OrzKBaMbCVdFLU Uh6DhweJBjEVv5f2wwjM9Xzc nOf+EPbtG9DMBmADjFDc2w/r
+	ljwvFw== ) ; key id = 60485`
+
+func TestDNSKEYKeyTag(t *testing.T) {
+	t.Parallel()
+
+	_, _, rec, err := ParseRecord(dskey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := 60485, rec.(*DNSKEY).KeyTag(); want != got {
+		t.Errorf("want key tag %d, got %d", want, got)
+	}
+}
+
+func TestDNSSECRecords(t *testing.T) {
+	t.Parallel()
+
+	_, _, key, err := ParseRecord(dskey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+
+		rec Record
+	}{
+		{
+			name: "DNSKEY",
+
+			rec: key,
+		},
+		{
+			name: "DS",
+
+			rec: &DS{
+				KeyTag:     60485,
+				Algorithm:  AlgorithmRSASHA1,
+				DigestType: DigestSHA1,
+				Digest: []byte{
+					0x2B, 0xB1, 0x83, 0xAF, 0x5F, 0x22, 0x58, 0x81, 0x79, 0xA5,
+					0x3B, 0x0A, 0x98, 0x63, 0x1F, 0xAD, 0x1A, 0x29, 0x21, 0x18,
+				},
+			},
+		},
+		{
+			name: "RRSIG",
+
+			rec: &RRSIG{
+				TypeCovered: TypeA,
+				Algorithm:   AlgorithmRSASHA1,
+				Labels:      3,
+				OriginalTTL: 24 * time.Hour,
+				Expiration:  time.Unix(1048354263, 0),
+				Inception:   time.Unix(1045762263, 0),
+				KeyTag:      2642,
+				SignerName:  "example.com.",
+				Signature:   []byte{0xDE, 0xAD, 0xBE, 0xEF},
+			},
+		},
+		{
+			name: "NSEC",
+
+			rec: &NSEC{
+				NextDomain: "host.example.com.",
+				Types:      TypeBitmap{TypeA, TypeMX, TypeRRSIG, TypeNSEC, 1234},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			msg := &Message{
+				Response: true,
+				Answers: []Resource{
+					{
+						Name:   "example.com.",
+						Class:  ClassIN,
+						TTL:    time.Minute,
+						Record: test.rec,
+					},
+				},
+			}
+
+			raw, err := msg.Pack(nil, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res := new(Message)
+			if _, err := res.Unpack(raw); err != nil {
+				t.Fatal(err)
+			}
+
+			if want, got := test.rec, res.Answers[0].Record; !reflect.DeepEqual(want, got) {
+				t.Errorf("want record %+v, got %+v", want, got)
+			}
+		})
+	}
+}
+
+func TestInvalidNSEC(t *testing.T) {
+	t.Parallel()
+
+	raw := []byte{
+		0x00,       // NEXT DOMAIN=.
+		0x00, 0x00, // WINDOW=0,LENGTH=0
+	}
+
+	_, err := new(NSEC).Unpack(raw, decompressor(raw))
+	if want, got := errInvalidBitmap, err; want != got {
+		t.Errorf("want unpack error %q, got %q", want, got)
+	}
+}
+
+func TestNSEC3HashedOwnerName(t *testing.T) {
+	t.Parallel()
+
+	// RFC 5155, appendix A
+	param := NSEC3PARAM{
+		HashAlgorithm: NSEC3HashSHA1,
+		Iterations:    12,
+		Salt:          []byte{0xAA, 0xBB, 0xCC, 0xDD},
+	}
+
+	tests := []struct {
+		name, hashed string
+	}{
+		{"example.", "0p9mhaveqvm6t7vbl5lop2u3t2rp3tom.example."},
+		{"a.example.", "35mthgpgcu1qg68fab165klnsnk3dpvl.example."},
+		{"ai.example.", "gjeqe526plbf1g8mklp59enfd789njgi.example."},
+		{"NS1.EXAMPLE.", "2t7b4g4vsa5smi47k61mv5bv1a22bojr.example."},
+	}
+
+	for _, test := range tests {
+		got, err := param.HashedOwnerName(test.name, "example.")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := test.hashed; want != got {
+			t.Errorf("want hashed owner name of %q %q, got %q", test.name, want, got)
+		}
+	}
+
+	param.HashAlgorithm = 2
+	if _, err := param.HashedOwnerName("example.", "example."); err != errNSEC3Hash {
+		t.Errorf("want error %q, got %v", errNSEC3Hash, err)
+	}
+}
+
+func TestNSEC3Records(t *testing.T) {
+	t.Parallel()
+
+	const input = "0p9mhaveqvm6t7vbl5lop2u3t2rp3tom.example. 3600 IN NSEC3 1 1 12 aabbccdd 2t7b4g4vsa5smi47k61mv5bv1a22bojr NS SOA MX RRSIG DNSKEY NSEC3PARAM"
+
+	_, _, rec, err := ParseRecord(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nsec3 := rec.(*NSEC3)
+	if want, got := "2t7b4g4vsa5smi47k61mv5bv1a22bojr.example.", nsec3.NextHashedOwnerName("example."); want != got {
+		t.Errorf("want next hashed owner name %q, got %q", want, got)
+	}
+	if want, got := NSEC3FlagOptOut, nsec3.Flags; want != got {
+		t.Errorf("want flags %d, got %d", want, got)
+	}
+
+	_, _, param, err := ParseRecord("example. 3600 IN NSEC3PARAM 1 0 0 -")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rec := range []Record{nsec3, param} {
+		msg := &Message{
+			Response: true,
+			Answers: []Resource{
+				{Name: "example.", Class: ClassIN, TTL: time.Hour, Record: rec},
+			},
+		}
+
+		raw, err := msg.Pack(nil, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res := new(Message)
+		if _, err := res.Unpack(raw); err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := rec, res.Answers[0].Record; !reflect.DeepEqual(want, got) {
+			t.Errorf("want record %+v, got %+v", want, got)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package dnstest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/benburkert/dns"
+)
+
+var errNoQuestions = errors.New("no questions in query mix")
+
+// Load is a load generator that sends queries to a DNS server, or to a
+// handler over a Transport, for benchmarks and soak tests.
+type Load struct {
+	// Client sends the queries. If nil, a zero Client is used.
+	Client *dns.Client
+
+	// Addr is the address of the DNS server the queries are sent to.
+	Addr net.Addr
+
+	// Mix is the questions of the queries. The question of each query is
+	// picked at random, with a probability proportional to its weight.
+	Mix []WeightedQuestion
+
+	// QPS is the rate of queries sent per second. If zero, queries are sent
+	// as fast as they are answered.
+	QPS float64
+
+	// Concurrency is the maximum number of queries in flight. If zero, one
+	// query is sent at a time.
+	Concurrency int
+
+	// Timeout limits the duration of each query. If zero, queries are only
+	// limited by the context of Run.
+	Timeout time.Duration
+}
+
+// WeightedQuestion is a question of a query mix.
+type WeightedQuestion struct {
+	dns.Question
+
+	// Weight is the relative frequency of the question. A weight of zero
+	// is treated as one.
+	Weight int
+}
+
+// Run sends n queries and reports the results. If n is zero, queries are sent
+// until ctx is done. If ctx is done before n queries are sent, the report of
+// the sent queries is returned with the context error.
+func (l *Load) Run(ctx context.Context, n int) (*LoadReport, error) {
+	if len(l.Mix) == 0 {
+		return nil, errNoQuestions
+	}
+
+	workers := l.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	qc := make(chan dns.Question)
+	go l.produce(ctx, n, qc)
+
+	var (
+		wg      sync.WaitGroup
+		reports = make([]LoadReport, workers)
+	)
+
+	start := time.Now()
+	for i := range reports {
+		wg.Add(1)
+		go func(report *LoadReport) {
+			defer wg.Done()
+
+			for q := range qc {
+				l.send(ctx, q, report)
+			}
+		}(&reports[i])
+	}
+	wg.Wait()
+
+	report := &LoadReport{
+		Elapsed: time.Since(start),
+		RCodes:  make(map[dns.RCode]int),
+	}
+	for _, r := range reports {
+		report.Queries += r.Queries
+		report.Errors += r.Errors
+		for rcode, count := range r.RCodes {
+			report.RCodes[rcode] += count
+		}
+		report.latencies = append(report.latencies, r.latencies...)
+	}
+	sort.Slice(report.latencies, func(i, j int) bool {
+		return report.latencies[i] < report.latencies[j]
+	})
+
+	if n > 0 && report.Queries < n {
+		return report, ctx.Err()
+	}
+	return report, nil
+}
+
+// produce sends the questions of n queries on qc at the rate of the load, and
+// closes qc when done.
+func (l *Load) produce(ctx context.Context, n int, qc chan<- dns.Question) {
+	defer close(qc)
+
+	var tick <-chan time.Time
+	if l.QPS > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / l.QPS))
+		defer ticker.Stop()
+
+		tick = ticker.C
+	}
+
+	var total int
+	for _, q := range l.Mix {
+		total += weight(q)
+	}
+
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for i := 0; n <= 0 || i < n; i++ {
+		if tick != nil && i > 0 {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case qc <- l.pick(rnd.Intn(total)):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// pick returns the question of the mix at the cumulative weight w.
+func (l *Load) pick(w int) dns.Question {
+	for _, q := range l.Mix {
+		if w -= weight(q); w < 0 {
+			return q.Question
+		}
+	}
+	return l.Mix[len(l.Mix)-1].Question
+}
+
+func weight(q WeightedQuestion) int {
+	if q.Weight <= 0 {
+		return 1
+	}
+	return q.Weight
+}
+
+// send sends a query for the question, and records the result in report.
+func (l *Load) send(ctx context.Context, q dns.Question, report *LoadReport) {
+	client := l.Client
+	if client == nil {
+		client = new(dns.Client)
+	}
+
+	if l.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	msg, err := client.Do(ctx, &dns.Query{
+		RemoteAddr: l.Addr,
+		Message: &dns.Message{
+			RecursionDesired: true,
+			Questions:        []dns.Question{q},
+		},
+	})
+
+	report.Queries++
+	if err != nil || msg == nil {
+		report.Errors++
+		return
+	}
+
+	if report.RCodes == nil {
+		report.RCodes = make(map[dns.RCode]int)
+	}
+	report.RCodes[msg.RCode]++
+	report.latencies = append(report.latencies, time.Since(start))
+}
+
+// LoadReport is the result of a Load run.
+type LoadReport struct {
+	// Queries is the number of queries sent.
+	Queries int
+
+	// Errors is the number of queries that failed without a response, such
+	// as queries that timed out.
+	Errors int
+
+	// RCodes is the number of responses of each RCODE.
+	RCodes map[dns.RCode]int
+
+	// Elapsed is the duration of the run.
+	Elapsed time.Duration
+
+	latencies []time.Duration // sorted latencies of the responses
+}
+
+// QPS returns the rate of queries sent per second.
+func (r *LoadReport) QPS() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Queries) / r.Elapsed.Seconds()
+}
+
+// Percentile returns the latency of the responses at percentile p, between 0
+// and 100. Failed queries are not included.
+func (r *LoadReport) Percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+
+	i := int(p / 100 * float64(len(r.latencies)))
+	switch {
+	case i < 0:
+		i = 0
+	case i >= len(r.latencies):
+		i = len(r.latencies) - 1
+	}
+	return r.latencies[i]
+}
+
+func (r *LoadReport) String() string {
+	return fmt.Sprintf("%d queries (%.1f qps), %d errors, latency p50=%s p90=%s p99=%s max=%s",
+		r.Queries, r.QPS(), r.Errors, r.Percentile(50), r.Percentile(90), r.Percentile(99), r.Percentile(100))
+}
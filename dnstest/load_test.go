@@ -0,0 +1,132 @@
+package dnstest
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/benburkert/dns"
+)
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	srv := NewServer(answers)
+	defer srv.Close()
+
+	addr, err := net.ResolveUDPAddr("udp", srv.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	load := &Load{
+		Addr: addr,
+		Mix: []WeightedQuestion{
+			{Question: questionA, Weight: 3},
+			{Question: dns.Question{Name: "none.example.", Type: dns.TypeA, Class: dns.ClassIN}},
+		},
+		Concurrency: 4,
+		Timeout:     time.Second,
+	}
+
+	report, err := load.Run(context.Background(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := 100, report.Queries; want != got {
+		t.Errorf("want %d queries, got %d", want, got)
+	}
+	if want, got := 0, report.Errors; want != got {
+		t.Errorf("want %d errors, got %d", want, got)
+	}
+	if want, got := 100, report.RCodes[dns.NoError]+report.RCodes[dns.NXDomain]; want != got {
+		t.Errorf("want %d NOERROR and NXDOMAIN responses, got %d", want, got)
+	}
+	if report.RCodes[dns.NoError] == 0 || report.RCodes[dns.NXDomain] == 0 {
+		t.Errorf("want responses of both questions, got %v", report.RCodes)
+	}
+	if want, got := 100, srv.Queries(); want != got {
+		t.Errorf("want %d queries answered, got %d", want, got)
+	}
+
+	if p50, p99 := report.Percentile(50), report.Percentile(99); p50 <= 0 || p50 > p99 {
+		t.Errorf("want 0 < p50 <= p99, got p50=%s p99=%s", p50, p99)
+	}
+}
+
+func TestLoadQPS(t *testing.T) {
+	t.Parallel()
+
+	tport := &Transport{Handler: NewUnstartedServer(answers)}
+	defer tport.Close()
+
+	load := &Load{
+		Client: &dns.Client{Transport: tport},
+		Addr:   &net.UDPAddr{IP: net.IPv4(192, 0, 2, 53), Port: 53},
+		Mix:    []WeightedQuestion{{Question: questionA}},
+		QPS:    100,
+	}
+
+	report, err := load.Run(context.Background(), 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := 11, report.Queries; want != got {
+		t.Errorf("want %d queries, got %d", want, got)
+	}
+	if want, got := 100*time.Millisecond, report.Elapsed; got < want {
+		t.Errorf("want run of at least %s, got %s", want, got)
+	}
+}
+
+func TestLoadContext(t *testing.T) {
+	t.Parallel()
+
+	tport := &Transport{Handler: NewUnstartedServer(answers)}
+	defer tport.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	load := &Load{
+		Client: &dns.Client{Transport: tport},
+		Addr:   &net.UDPAddr{IP: net.IPv4(192, 0, 2, 53), Port: 53},
+		Mix:    []WeightedQuestion{{Question: questionA}},
+		QPS:    100,
+	}
+
+	report, err := load.Run(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Queries == 0 {
+		t.Error("want queries sent until the context is done")
+	}
+
+	if _, err := load.Run(ctx, 10); err != context.DeadlineExceeded {
+		t.Errorf("want error %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func BenchmarkLoadTransport(b *testing.B) {
+	tport := &Transport{Handler: NewUnstartedServer(answers)}
+	defer tport.Close()
+
+	load := &Load{
+		Client:      &dns.Client{Transport: tport},
+		Addr:        &net.UDPAddr{IP: net.IPv4(192, 0, 2, 53), Port: 53},
+		Mix:         []WeightedQuestion{{Question: questionA}},
+		Concurrency: 8,
+	}
+
+	b.ResetTimer()
+
+	report, err := load.Run(context.Background(), b.N)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Log(report)
+}
@@ -0,0 +1,175 @@
+package dnstest
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/benburkert/dns"
+)
+
+// Server is a DNS server for tests that answers queries with scripted
+// responses, listening for UDP and TCP queries on a loopback address.
+type Server struct {
+	// Addr is the address of the UDP and TCP listeners, of the form
+	// "127.0.0.1:port". It is set by Start.
+	Addr string
+
+	// Answers are the scripted responses to questions. The status, AA and RA
+	// bits, and sections of a response are written to the reply. Questions
+	// without a response are answered with a "Non-Existent Domain" message.
+	Answers map[dns.Question]*dns.Message
+
+	// Latency delays each response.
+	Latency time.Duration
+
+	// Loss is the probability, between 0 and 1, that a UDP query is dropped
+	// without a response. TCP queries are never dropped.
+	Loss float64
+
+	queries int64
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewServer starts and returns a new Server of the answers. The caller
+// should call Close when finished, to shut it down.
+func NewServer(answers map[dns.Question]*dns.Message) *Server {
+	s := NewUnstartedServer(answers)
+	s.Start()
+	return s
+}
+
+// NewUnstartedServer returns a new Server of the answers but doesn't start
+// it. After changing its configuration, the caller should call Start.
+func NewUnstartedServer(answers map[dns.Question]*dns.Message) *Server {
+	return &Server{Answers: answers}
+}
+
+// Start starts a server from NewUnstartedServer. It panics if the listeners
+// cannot be created.
+func (s *Server) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel != nil {
+		panic("dnstest: Server already started")
+	}
+
+	ln, conn := listen()
+	s.Addr = ln.Addr().String()
+
+	var ctx context.Context
+	ctx, s.cancel = context.WithCancel(context.Background())
+
+	srv := &dns.Server{Handler: s}
+
+	s.wg.Add(2)
+	go func() {
+		defer s.wg.Done()
+		srv.Serve(ctx, ln)
+	}()
+	go func() {
+		defer s.wg.Done()
+		srv.ServePacket(ctx, &lossyConn{PacketConn: conn, loss: s.Loss})
+	}()
+}
+
+// Close shuts down the server, and waits for in-flight queries to be
+// answered.
+func (s *Server) Close() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	s.wg.Wait()
+}
+
+// Queries returns the number of queries answered by the server. Dropped UDP
+// queries are not counted.
+func (s *Server) Queries() int {
+	return int(atomic.LoadInt64(&s.queries))
+}
+
+// ServeDNS answers a query with the scripted response to its first question,
+// or a "Format Error" if the query has no questions. The server is also a
+// handler, for use with a Transport.
+func (s *Server) ServeDNS(ctx context.Context, w dns.MessageWriter, r *dns.Query) {
+	atomic.AddInt64(&s.queries, 1)
+
+	if s.Latency > 0 {
+		timer := time.NewTimer(s.Latency)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+
+	if len(r.Questions) == 0 {
+		w.Status(dns.FormErr)
+		return
+	}
+
+	msg, ok := s.Answers[r.Questions[0]]
+	if !ok {
+		w.Status(dns.NXDomain)
+		return
+	}
+
+	w.Status(msg.RCode)
+	w.Authoritative(msg.Authoritative)
+	w.Recursion(msg.RecursionAvailable)
+
+	for _, res := range msg.Answers {
+		w.Answer(res.Name, res.TTL, res.Record)
+	}
+	for _, res := range msg.Authorities {
+		w.Authority(res.Name, res.TTL, res.Record)
+	}
+	for _, res := range msg.Additionals {
+		w.Additional(res.Name, res.TTL, res.Record)
+	}
+}
+
+// listen returns TCP and UDP listeners on the same loopback port.
+func listen() (net.Listener, net.PacketConn) {
+	for {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			panic("dnstest: failed to listen: " + err.Error())
+		}
+
+		conn, err := net.ListenPacket("udp", ln.Addr().String())
+		if err != nil {
+			ln.Close()
+			continue
+		}
+		return ln, conn
+	}
+}
+
+// lossyConn is a net.PacketConn that drops received packets with a
+// probability of loss.
+type lossyConn struct {
+	net.PacketConn
+
+	loss float64
+}
+
+func (c *lossyConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(b)
+		if err != nil || c.loss <= 0 || rand.Float64() >= c.loss {
+			return n, addr, err
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package dnstest
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/benburkert/dns"
+)
+
+var (
+	questionA = dns.Question{Name: "app.example.", Type: dns.TypeA, Class: dns.ClassIN}
+
+	answers = map[dns.Question]*dns.Message{
+		questionA: {
+			Authoritative: true,
+			Answers: []dns.Resource{
+				{
+					Name:   "app.example.",
+					Class:  dns.ClassIN,
+					TTL:    time.Minute,
+					Record: &dns.A{A: net.IPv4(192, 0, 2, 1).To4()},
+				},
+			},
+		},
+	}
+)
+
+func TestServer(t *testing.T) {
+	t.Parallel()
+
+	srv := NewServer(answers)
+	defer srv.Close()
+
+	tests := []struct {
+		name string
+
+		network  string
+		question dns.Question
+
+		rcode   dns.RCode
+		answers []dns.Resource
+	}{
+		{
+			name: "udp",
+
+			network:  "udp",
+			question: questionA,
+
+			answers: answers[questionA].Answers,
+		},
+		{
+			name: "tcp",
+
+			network:  "tcp",
+			question: questionA,
+
+			answers: answers[questionA].Answers,
+		},
+		{
+			name: "unscripted",
+
+			network:  "udp",
+			question: dns.Question{Name: "none.example.", Type: dns.TypeA, Class: dns.ClassIN},
+
+			rcode: dns.NXDomain,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg := query(t, srv, test.network, test.question)
+			if want, got := test.rcode, msg.RCode; want != got {
+				t.Errorf("want rcode %d, got %d", want, got)
+			}
+			if want, got := test.answers, msg.Answers; !reflect.DeepEqual(want, got) {
+				t.Errorf("want answers %+v, got %+v", want, got)
+			}
+		})
+	}
+}
+
+func TestServerNoQuestions(t *testing.T) {
+	t.Parallel()
+
+	srv := NewUnstartedServer(answers)
+
+	tport := &Transport{Handler: dns.HandlerFunc(dns.Refuse)}
+	defer tport.Close()
+
+	client := &dns.Client{
+		Transport: tport,
+		Resolver:  srv,
+	}
+
+	msg, err := client.Do(context.Background(), &dns.Query{
+		RemoteAddr: &net.UDPAddr{IP: net.IPv4(192, 0, 2, 53), Port: 53},
+		Message:    new(dns.Message),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := dns.FormErr, msg.RCode; want != got {
+		t.Errorf("want rcode %d, got %d", want, got)
+	}
+}
+
+func TestServerLatency(t *testing.T) {
+	t.Parallel()
+
+	srv := NewUnstartedServer(answers)
+	srv.Latency = 50 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	start := time.Now()
+	query(t, srv, "udp", questionA)
+
+	if elapsed := time.Since(start); elapsed < srv.Latency {
+		t.Errorf("want response after %s, got %s", srv.Latency, elapsed)
+	}
+}
+
+func TestServerLoss(t *testing.T) {
+	t.Parallel()
+
+	srv := NewUnstartedServer(answers)
+	srv.Loss = 1
+	srv.Start()
+	defer srv.Close()
+
+	addr, err := net.ResolveUDPAddr("udp", srv.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err = new(dns.Client).Do(ctx, &dns.Query{
+		RemoteAddr: addr,
+		Message:    &dns.Message{Questions: []dns.Question{questionA}},
+	})
+	if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+		t.Errorf("want timeout error, got %v", err)
+	}
+
+	// TCP queries are not dropped
+	query(t, srv, "tcp", questionA)
+
+	if want, got := 1, srv.Queries(); want != got {
+		t.Errorf("want %d queries answered, got %d", want, got)
+	}
+}
+
+func query(t *testing.T, srv *Server, network string, q dns.Question) *dns.Message {
+	t.Helper()
+
+	var (
+		addr net.Addr
+		err  error
+	)
+	if network == "tcp" {
+		addr, err = net.ResolveTCPAddr(network, srv.Addr)
+	} else {
+		addr, err = net.ResolveUDPAddr(network, srv.Addr)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := new(dns.Client).Do(context.Background(), &dns.Query{
+		RemoteAddr: addr,
+		Message:    &dns.Message{Questions: []dns.Question{q}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
@@ -0,0 +1,124 @@
+// Package dnstest provides utilities for DNS testing.
+package dnstest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/benburkert/dns"
+)
+
+var errClosed = errors.New("transport closed")
+
+// Transport is a dns.AddrDialer that connects clients directly to Handler
+// in-process, without sockets. Queries and responses are exchanged in wire
+// format over an in-memory stream connection to a dns.Server, so the
+// handler sees the same messages it would over the network.
+type Transport struct {
+	// Handler answers the queries sent over the transport.
+	Handler dns.Handler
+
+	// RemoteAddr is the client address of the queries passed to Handler. If
+	// nil, a loopback address is used.
+	RemoteAddr net.Addr
+
+	once   sync.Once
+	ln     *pipeListener
+	cancel context.CancelFunc
+}
+
+// DialAddr returns a Conn to the handler. The addr is the remote address of
+// the Conn, and the local address of the queries passed to the handler.
+func (t *Transport) DialAddr(ctx context.Context, addr net.Addr) (dns.Conn, error) {
+	t.once.Do(t.start)
+
+	client, server := net.Pipe()
+
+	raddr := t.RemoteAddr
+	if raddr == nil {
+		raddr = &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+	}
+
+	if err := t.ln.push(ctx, &pipeConn{Conn: server, local: addr, remote: raddr}); err != nil {
+		client.Close()
+		server.Close()
+		return nil, err
+	}
+
+	return &dns.StreamConn{
+		Conn: &pipeConn{Conn: client, local: raddr, remote: addr},
+	}, nil
+}
+
+// Close stops serving the handler. Conns dialed after Close fail.
+func (t *Transport) Close() error {
+	t.once.Do(t.start)
+
+	t.cancel()
+	return t.ln.Close()
+}
+
+func (t *Transport) start() {
+	var ctx context.Context
+	ctx, t.cancel = context.WithCancel(context.Background())
+
+	t.ln = &pipeListener{
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+
+	srv := &dns.Server{Handler: t.Handler}
+	go srv.Serve(ctx, t.ln)
+}
+
+// pipeConn is a net.Conn with the addresses of the transport.
+type pipeConn struct {
+	net.Conn
+
+	local, remote net.Addr
+}
+
+func (c *pipeConn) LocalAddr() net.Addr  { return c.local }
+func (c *pipeConn) RemoteAddr() net.Addr { return c.remote }
+
+// pipeListener is a net.Listener of in-memory connections.
+type pipeListener struct {
+	conns chan net.Conn
+
+	once sync.Once
+	done chan struct{}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, errClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr { return pipeAddr{} }
+
+func (l *pipeListener) push(ctx context.Context, conn net.Conn) error {
+	select {
+	case l.conns <- conn:
+		return nil
+	case <-l.done:
+		return errClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
@@ -0,0 +1,79 @@
+package dnstest
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benburkert/dns"
+)
+
+func TestTransport(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu    sync.Mutex
+		addrs []net.Addr
+	)
+
+	tport := &Transport{
+		Handler: dns.HandlerFunc(func(ctx context.Context, w dns.MessageWriter, r *dns.Query) {
+			mu.Lock()
+			addrs = append(addrs, r.RemoteAddr)
+			mu.Unlock()
+
+			w.Answer(r.Questions[0].Name, time.Minute, &dns.A{A: net.IPv4(192, 0, 2, 1).To4()})
+		}),
+	}
+	defer tport.Close()
+
+	client := &dns.Client{Transport: tport}
+	raddr := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 53), Port: 53}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			msg, err := client.Do(context.Background(), &dns.Query{
+				RemoteAddr: raddr,
+				Message: &dns.Message{
+					Questions: []dns.Question{
+						{Name: "app.example.", Type: dns.TypeA, Class: dns.ClassIN},
+					},
+				},
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if want, got := 1, len(msg.Answers); want != got {
+				t.Errorf("want %d answers, got %d", want, got)
+				return
+			}
+			if want, got := net.IPv4(192, 0, 2, 1), msg.Answers[0].Record.(*dns.A).A; !want.Equal(got) {
+				t.Errorf("want A record %s, got %s", want, got)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if want, got := 10, len(addrs); want != got {
+		t.Fatalf("want %d queries handled, got %d", want, got)
+	}
+	for _, addr := range addrs {
+		if want, got := "127.0.0.1:0", addr.String(); want != got {
+			t.Errorf("want query remote address %s, got %s", want, got)
+		}
+	}
+
+	tport.Close()
+
+	if _, err := tport.DialAddr(context.Background(), raddr); err == nil {
+		t.Error("want dial error after close")
+	}
+}
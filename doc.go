@@ -44,9 +44,9 @@ A handler answers queries for a server or a local resolver for a client:
 		Origin: "localhost.",
 		TTL:    5 * time.Minute,
 		RRs: dns.RRSet{
-			"alpha": []dns.Record{
-				&dns.A{net.IPv4(127, 0, 0, 42).To4()},
-				&dns.AAAA{net.ParseIP("::42")},
+			"alpha": {
+				dns.TypeA:    {&dns.A{A: net.IPv4(127, 0, 0, 42).To4()}},
+				dns.TypeAAAA: {&dns.AAAA{AAAA: net.ParseIP("::42")}},
 			},
 		},
 	}
@@ -0,0 +1,231 @@
+package dns
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// dumpWidth is the number of bytes on each line of a dump.
+const dumpWidth = 8
+
+// Dump writes an annotated hex dump of the wire format message b to w, for
+// debugging the packing and compression of messages. Each line holds the
+// offset and bytes of a field: the header fields, the labels of a name and
+// the target of a compression pointer, and the fixed fields and RDATA of a
+// resource. The names in the RDATA of CNAME, DNAME, MX, NS, and PTR records
+// are annotated like owner names. If b is malformed, the fields up to the error are written and
+// the error is returned.
+func Dump(w io.Writer, b []byte) error {
+	d := &dumper{w: w, msg: b}
+	return d.dump()
+}
+
+type dumper struct {
+	w   io.Writer
+	msg []byte
+	off int
+	err error
+}
+
+func (d *dumper) dump() error {
+	if len(d.msg) < 12 {
+		d.line(len(d.msg), "truncated header")
+		return errBaseLen
+	}
+
+	flags := nbo.Uint16(d.msg[2:])
+
+	d.line(2, fmt.Sprintf("ID: %d", nbo.Uint16(d.msg)))
+	d.line(2, "flags: "+dumpFlags(flags))
+
+	var counts [4]int
+	for i, name := range []string{"QDCOUNT", "ANCOUNT", "NSCOUNT", "ARCOUNT"} {
+		counts[i] = int(nbo.Uint16(d.msg[d.off:]))
+		d.line(2, fmt.Sprintf("%s: %d", name, counts[i]))
+	}
+
+	d.section("QUESTION", counts[0], d.question)
+	d.section("ANSWER", counts[1], d.resource)
+	d.section("AUTHORITY", counts[2], d.resource)
+	d.section("ADDITIONAL", counts[3], d.resource)
+
+	if d.err == nil && d.off < len(d.msg) {
+		d.line(len(d.msg)-d.off, "trailing bytes")
+	}
+	return d.err
+}
+
+func (d *dumper) section(name string, count int, entry func()) {
+	if d.err != nil || count == 0 {
+		return
+	}
+
+	fmt.Fprintf(d.w, ";; %s SECTION\n", name)
+	for i := 0; i < count && d.err == nil; i++ {
+		entry()
+	}
+}
+
+func (d *dumper) question() {
+	d.name()
+	d.uint16("type", func(v int) string { return Type(v).String() })
+	d.uint16("class", func(v int) string { return Class(v).String() })
+}
+
+func (d *dumper) resource() {
+	d.name()
+	typ := Type(d.uint16("type", func(v int) string { return Type(v).String() }))
+	if typ == TypeOPT {
+		d.uint16("udp payload size", nil)
+	} else {
+		d.uint16("class", func(v int) string { return Class(v).String() })
+	}
+	if !d.need(4) {
+		return
+	}
+	d.line(4, fmt.Sprintf("TTL: %d", nbo.Uint32(d.msg[d.off:])))
+
+	rdlen := d.uint16("rdlength", nil)
+	if d.err != nil || rdlen == 0 {
+		return
+	}
+	if !d.need(rdlen) {
+		return
+	}
+
+	// The names of these records may be compressed.
+	end := d.off + rdlen
+	switch typ {
+	case TypeMX:
+		d.uint16("preference", nil)
+		fallthrough
+	case TypeCNAME, TypeNS, TypePTR, TypeDNAME:
+		d.name()
+	}
+
+	switch {
+	case d.err != nil:
+	case d.off > end:
+		d.err = errResourceLen
+	case d.off < end:
+		d.line(end-d.off, "rdata")
+	}
+}
+
+// name writes the labels of the name at the current offset.
+func (d *dumper) name() {
+	for d.need(1) {
+		n := int(d.msg[d.off])
+		switch {
+		case n == 0:
+			d.line(1, "root")
+			return
+		case n&0xC0 == 0xC0:
+			if !d.need(2) {
+				return
+			}
+			target, _, err := decompressor(d.msg).Unpack(d.msg[d.off:])
+			ptr := int(nbo.Uint16(d.msg[d.off:]) & 0x3FFF)
+			if err != nil {
+				d.line(2, fmt.Sprintf("pointer to 0x%04x (invalid)", ptr))
+				d.err = errInvalidPtr
+				return
+			}
+			d.line(2, fmt.Sprintf("pointer to 0x%04x (%s)", ptr, target))
+			return
+		case n&0xC0 != 0:
+			d.line(1, "reserved label type")
+			d.err = errReserved
+			return
+		}
+
+		if !d.need(1 + n) {
+			return
+		}
+		d.line(1+n, fmt.Sprintf("label %q", d.msg[d.off+1:d.off+1+n]))
+	}
+}
+
+// uint16 writes a 16 bit field and returns its value. The value is
+// annotated by the optional mnemonic func.
+func (d *dumper) uint16(field string, mnemonic func(int) string) int {
+	if !d.need(2) {
+		return 0
+	}
+
+	v := int(nbo.Uint16(d.msg[d.off:]))
+	note := fmt.Sprintf("%s: %d", field, v)
+	if mnemonic != nil {
+		note = fmt.Sprintf("%s: %s", field, mnemonic(v))
+	}
+	d.line(2, note)
+	return v
+}
+
+// need reports whether n more bytes are available, or writes the remaining
+// bytes and records an error.
+func (d *dumper) need(n int) bool {
+	if d.err != nil {
+		return false
+	}
+	if d.off+n <= len(d.msg) {
+		return true
+	}
+
+	if d.off < len(d.msg) {
+		d.line(len(d.msg)-d.off, "truncated")
+	}
+	d.err = errResourceLen
+	return false
+}
+
+// line writes the next n bytes of the message, wrapped at dumpWidth bytes
+// per line, with the note on the first line.
+func (d *dumper) line(n int, note string) {
+	b := d.msg[d.off : d.off+n]
+	for {
+		chunk := b
+		if len(chunk) > dumpWidth {
+			chunk = chunk[:dumpWidth]
+		}
+
+		hex := make([]string, len(chunk))
+		for i, c := range chunk {
+			hex[i] = fmt.Sprintf("%02x", c)
+		}
+
+		line := fmt.Sprintf("%04x  %-*s  %s", d.off, 3*dumpWidth-1, strings.Join(hex, " "), note)
+		fmt.Fprintln(d.w, strings.TrimRight(line, " "))
+
+		d.off += len(chunk)
+		b = b[len(chunk):]
+		note = ""
+		if len(b) == 0 {
+			return
+		}
+	}
+}
+
+// dumpFlags returns the opcode, rcode, and set bits of the header flags.
+func dumpFlags(flags uint16) string {
+	var bits []string
+	for _, f := range []struct {
+		name string
+		bit  uint16
+	}{
+		{"qr", headerBitQR},
+		{"aa", headerBitAA},
+		{"tc", headerBitTC},
+		{"rd", headerBitRD},
+		{"ra", headerBitRA},
+		{"ad", headerBitAD},
+		{"cd", headerBitCD},
+	} {
+		if flags&f.bit != 0 {
+			bits = append(bits, f.name)
+		}
+	}
+
+	return fmt.Sprintf("opcode=%d rcode=%d %s", (flags>>11)&0xF, flags&0xF, strings.Join(bits, " "))
+}
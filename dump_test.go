@@ -0,0 +1,133 @@
+package dns
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDump(t *testing.T) {
+	t.Parallel()
+
+	msg := &Message{
+		ID:                 0x1234,
+		Response:           true,
+		RecursionDesired:   true,
+		RecursionAvailable: true,
+		Questions: []Question{
+			{Name: "www.example.com.", Type: TypeA, Class: ClassIN},
+		},
+		Answers: []Resource{
+			{
+				Name:   "www.example.com.",
+				Class:  ClassIN,
+				TTL:    time.Minute,
+				Record: &CNAME{CNAME: "web.example.com."},
+			},
+			{
+				Name:   "web.example.com.",
+				Class:  ClassIN,
+				TTL:    time.Minute,
+				Record: &A{A: net.IPv4(192, 0, 2, 1).To4()},
+			},
+		},
+	}
+
+	b, err := msg.Pack(nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+
+		b []byte
+
+		dump string
+		err  error
+	}{
+		{
+			name: "compressed",
+
+			b: b,
+
+			dump: `0000  12 34                    ID: 4660
+0002  81 80                    flags: opcode=0 rcode=0 qr rd ra
+0004  00 01                    QDCOUNT: 1
+0006  00 02                    ANCOUNT: 2
+0008  00 00                    NSCOUNT: 0
+000a  00 00                    ARCOUNT: 0
+;; QUESTION SECTION
+000c  03 77 77 77              label "www"
+0010  07 65 78 61 6d 70 6c 65  label "example"
+0018  03 63 6f 6d              label "com"
+001c  00                       root
+001d  00 01                    type: A
+001f  00 01                    class: IN
+;; ANSWER SECTION
+0021  c0 0c                    pointer to 0x000c (www.example.com.)
+0023  00 05                    type: CNAME
+0025  00 01                    class: IN
+0027  00 00 00 3c              TTL: 60
+002b  00 06                    rdlength: 6
+002d  03 77 65 62              label "web"
+0031  c0 10                    pointer to 0x0010 (example.com.)
+0033  c0 2d                    pointer to 0x002d (web.example.com.)
+0035  00 01                    type: A
+0037  00 01                    class: IN
+0039  00 00 00 3c              TTL: 60
+003d  00 04                    rdlength: 4
+003f  c0 00 02 01              rdata
+`,
+		},
+		{
+			name: "truncated",
+
+			b: b[:0x29],
+
+			dump: `0021  c0 0c                    pointer to 0x000c (www.example.com.)
+0023  00 05                    type: CNAME
+0025  00 01                    class: IN
+0027  00 00                    truncated
+`,
+			err: errResourceLen,
+		},
+		{
+			name: "invalid-pointer",
+
+			b: append(append([]byte(nil), b[:0x21]...), 0xc0, 0xff),
+
+			dump: `;; ANSWER SECTION
+0021  c0 ff                    pointer to 0x00ff (invalid)
+`,
+			err: errInvalidPtr,
+		},
+		{
+			name: "trailing",
+
+			b: append(append([]byte(nil), b...), 0xff, 0xff),
+
+			dump: `003f  c0 00 02 01              rdata
+0043  ff ff                    trailing bytes
+`,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			if want, got := test.err, Dump(&buf, test.b); want != got {
+				t.Errorf("want error %v, got %v", want, got)
+			}
+			if want, got := test.dump, buf.String(); !strings.HasSuffix(got, want) {
+				t.Errorf("want dump ending with:\n%s\ngot:\n%s", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package edns
+
+import "errors"
+
+// Lengths of the client and server cookies of a DNS Cookie option.
+const (
+	ClientCookieLen    = 8
+	MinServerCookieLen = 8
+	MaxServerCookieLen = 32
+)
+
+var errCookieLen = errors.New("invalid cookie length")
+
+// Cookie is the data of a DNS Cookie (RFC7873) option. The server cookie is
+// empty in a query to a server without a known server cookie.
+type Cookie struct {
+	Client []byte
+	Server []byte
+}
+
+// Option returns c encoded as an EDNS0 option.
+func (c Cookie) Option() (Option, error) {
+	data, err := c.Pack(nil)
+	if err != nil {
+		return Option{}, err
+	}
+
+	return Option{
+		Code: OptionCodeCookie,
+		Data: data,
+	}, nil
+}
+
+// Pack encodes c as option data.
+func (c Cookie) Pack(b []byte) ([]byte, error) {
+	if !validCookie(len(c.Client), len(c.Server)) {
+		return nil, errCookieLen
+	}
+	return append(append(b, c.Client...), c.Server...), nil
+}
+
+// Unpack decodes c from option data in b.
+func (c *Cookie) Unpack(b []byte) ([]byte, error) {
+	if len(b) < ClientCookieLen || !validCookie(ClientCookieLen, len(b)-ClientCookieLen) {
+		return nil, errCookieLen
+	}
+
+	c.Client = append(c.Client[:0], b[:ClientCookieLen]...)
+	c.Server = nil
+	if len(b) > ClientCookieLen {
+		c.Server = append(c.Server, b[ClientCookieLen:]...)
+	}
+
+	return nil, nil
+}
+
+func validCookie(client, server int) bool {
+	if client != ClientCookieLen {
+		return false
+	}
+	return server == 0 || (server >= MinServerCookieLen && server <= MaxServerCookieLen)
+}
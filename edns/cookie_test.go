@@ -0,0 +1,109 @@
+package edns
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCookiePackUnpack(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+
+		cookie Cookie
+
+		raw []byte
+	}{
+		{
+			name: "client cookie",
+
+			cookie: Cookie{
+				Client: []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07},
+			},
+
+			raw: []byte{
+				0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, // CLIENT COOKIE
+			},
+		},
+		{
+			name: "client and server cookie",
+
+			cookie: Cookie{
+				Client: []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07},
+				Server: []byte{0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17},
+			},
+
+			raw: []byte{
+				0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, // CLIENT COOKIE
+				0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, // SERVER COOKIE
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			raw, err := test.cookie.Pack(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, got := test.raw, raw; !reflect.DeepEqual(want, got) {
+				t.Errorf("want raw cookie %x, got %x", want, got)
+			}
+
+			var cookie Cookie
+			if _, err := cookie.Unpack(raw); err != nil {
+				t.Fatal(err)
+			}
+			if want, got := test.cookie, cookie; !reflect.DeepEqual(want, got) {
+				t.Errorf("want cookie %+v, got %+v", want, got)
+			}
+		})
+	}
+}
+
+func TestInvalidCookie(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+
+		raw []byte
+	}{
+		{
+			name: "short client cookie",
+
+			raw: make([]byte, 7),
+		},
+		{
+			name: "short server cookie",
+
+			raw: make([]byte, ClientCookieLen+7),
+		},
+		{
+			name: "long server cookie",
+
+			raw: make([]byte, ClientCookieLen+MaxServerCookieLen+1),
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var cookie Cookie
+			if _, err := cookie.Unpack(test.raw); err != errCookieLen {
+				t.Errorf("want error %v, got %v", errCookieLen, err)
+			}
+			if _, err := (Cookie{Client: test.raw}).Pack(nil); err != errCookieLen {
+				t.Errorf("want pack error %v, got %v", errCookieLen, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+//go:build go1.18
+// +build go1.18
+
+package edns
+
+import (
+	"bytes"
+	"testing"
+)
+
+func FuzzOptionUnpack(f *testing.F) {
+	f.Add([]byte{0x00, 0x0A, 0x00, 0x08, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08})
+	f.Add([]byte{0x00, 0x08, 0x00, 0x07, 0x00, 0x01, 0x18, 0x00, 0xC0, 0x00, 0x02})
+	f.Add([]byte{0x00, 0x08, 0x00, 0x04, 0x00, 0x02, 0x00, 0x00})
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		var opt Option
+		rest, err := opt.Unpack(raw)
+		if err != nil {
+			return
+		}
+
+		buf, err := opt.Pack(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := raw[:len(raw)-len(rest)], buf; !bytes.Equal(want, got) {
+			t.Fatalf("want packed option %x, got %x", want, got)
+		}
+
+		if opt.Code != OptionCodeEDNSClientSubnet {
+			return
+		}
+
+		var subnet ClientSubnet
+		if _, err := subnet.Unpack(opt.Data); err != nil {
+			return
+		}
+		if _, err := subnet.Pack(nil); err != nil {
+			t.Fatalf("pack of unpacked client subnet %+v failed: %v", subnet, err)
+		}
+	})
+}
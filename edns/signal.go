@@ -0,0 +1,74 @@
+package edns
+
+import "errors"
+
+var errSignalLen = errors.New("invalid algorithm signal length")
+
+// DAU is the data of a DNSSEC Algorithm Understood (RFC6975) option: the
+// DNSSEC signing algorithm numbers supported by a validator.
+type DAU []uint8
+
+// Option returns a encoded as an EDNS0 option.
+func (a DAU) Option() (Option, error) { return signalOption(OptionCodeDAU, a) }
+
+// Pack encodes a as option data.
+func (a DAU) Pack(b []byte) ([]byte, error) { return packSignal(b, a) }
+
+// Unpack decodes a from option data in b.
+func (a *DAU) Unpack(b []byte) ([]byte, error) { return unpackSignal((*[]uint8)(a), b) }
+
+// DHU is the data of a DS Hash Understood (RFC6975) option: the DS hash
+// algorithm numbers supported by a validator.
+type DHU []uint8
+
+// Option returns h encoded as an EDNS0 option.
+func (h DHU) Option() (Option, error) { return signalOption(OptionCodeDHU, h) }
+
+// Pack encodes h as option data.
+func (h DHU) Pack(b []byte) ([]byte, error) { return packSignal(b, h) }
+
+// Unpack decodes h from option data in b.
+func (h *DHU) Unpack(b []byte) ([]byte, error) { return unpackSignal((*[]uint8)(h), b) }
+
+// N3U is the data of an NSEC3 Hash Understood (RFC6975) option: the NSEC3
+// hash algorithm numbers supported by a validator.
+type N3U []uint8
+
+// Option returns h encoded as an EDNS0 option.
+func (h N3U) Option() (Option, error) { return signalOption(OptionCodeN3U, h) }
+
+// Pack encodes h as option data.
+func (h N3U) Pack(b []byte) ([]byte, error) { return packSignal(b, h) }
+
+// Unpack decodes h from option data in b.
+func (h *N3U) Unpack(b []byte) ([]byte, error) { return unpackSignal((*[]uint8)(h), b) }
+
+func signalOption(code OptionCode, algs []uint8) (Option, error) {
+	data, err := packSignal(nil, algs)
+	if err != nil {
+		return Option{}, err
+	}
+
+	return Option{
+		Code: code,
+		Data: data,
+	}, nil
+}
+
+// packSignal encodes the algorithm list as option data, one octet per
+// algorithm. The list may not be empty.
+func packSignal(b []byte, algs []uint8) ([]byte, error) {
+	if len(algs) == 0 {
+		return nil, errSignalLen
+	}
+	return append(b, algs...), nil
+}
+
+func unpackSignal(algs *[]uint8, b []byte) ([]byte, error) {
+	if len(b) == 0 {
+		return nil, errSignalLen
+	}
+
+	*algs = append([]uint8(nil), b...)
+	return nil, nil
+}
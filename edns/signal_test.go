@@ -0,0 +1,96 @@
+package edns
+
+import (
+	"reflect"
+	"testing"
+)
+
+type signal interface {
+	Option() (Option, error)
+}
+
+func TestSignalOption(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+
+		signal signal
+
+		option Option
+	}{
+		{
+			name: "DAU",
+
+			signal: DAU{8, 13, 15},
+
+			option: Option{
+				Code: OptionCodeDAU,
+				Data: []byte{8, 13, 15},
+			},
+		},
+		{
+			name: "DHU",
+
+			signal: DHU{2},
+
+			option: Option{
+				Code: OptionCodeDHU,
+				Data: []byte{2},
+			},
+		},
+		{
+			name: "N3U",
+
+			signal: N3U{1},
+
+			option: Option{
+				Code: OptionCodeN3U,
+				Data: []byte{1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			opt, err := test.signal.Option()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, got := test.option, opt; !reflect.DeepEqual(want, got) {
+				t.Errorf("want option %+v, got %+v", want, got)
+			}
+		})
+	}
+}
+
+func TestSignalUnpack(t *testing.T) {
+	t.Parallel()
+
+	raw := []byte{8, 13, 15}
+
+	var dau DAU
+	if _, err := dau.Unpack(raw); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := (DAU{8, 13, 15}), dau; !reflect.DeepEqual(want, got) {
+		t.Errorf("want DAU %v, got %v", want, got)
+	}
+
+	raw[0] = 0
+	if want, got := uint8(8), dau[0]; want != got {
+		t.Errorf("want unpacked algorithm %d, got %d", want, got)
+	}
+
+	var n3u N3U
+	if _, err := n3u.Unpack(nil); err != errSignalLen {
+		t.Errorf("want error %v, got %v", errSignalLen, err)
+	}
+	if _, err := (DHU{}).Option(); err != errSignalLen {
+		t.Errorf("want error %v, got %v", errSignalLen, err)
+	}
+}
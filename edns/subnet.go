@@ -0,0 +1,131 @@
+package edns
+
+import (
+	"errors"
+	"net"
+)
+
+// Address families of the EDNS Client Subnet option.
+//
+// Taken from https://www.iana.org/assignments/address-family-numbers/address-family-numbers.xhtml
+const (
+	FamilyIPv4 uint16 = 1
+	FamilyIPv6 uint16 = 2
+)
+
+var (
+	errSubnetLen    = errors.New("insufficient data for client subnet")
+	errSubnetFamily = errors.New("unsupported client subnet family")
+	errSubnetPrefix = errors.New("client subnet prefix exceeds address length")
+	errSubnetAddr   = errors.New("client subnet address exceeds source prefix")
+)
+
+// ClientSubnet is the data of an EDNS Client Subnet (RFC7871) option.
+type ClientSubnet struct {
+	Family       uint16
+	SourcePrefix int
+	ScopePrefix  int
+	Address      net.IP
+}
+
+// Option returns s encoded as an EDNS0 option.
+func (s ClientSubnet) Option() (Option, error) {
+	data, err := s.Pack(nil)
+	if err != nil {
+		return Option{}, err
+	}
+
+	return Option{
+		Code: OptionCodeEDNSClientSubnet,
+		Data: data,
+	}, nil
+}
+
+// Network returns the network of s for a prefix length, with the address
+// masked to prefix bits.
+func (s ClientSubnet) Network(prefix int) *net.IPNet {
+	bits := familyBits(s.Family)
+	ip := s.ip()
+	if bits == 0 || ip == nil || prefix < 0 || prefix > bits {
+		return nil
+	}
+
+	mask := net.CIDRMask(prefix, bits)
+	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+}
+
+// Pack encodes s as option data.
+func (s ClientSubnet) Pack(b []byte) ([]byte, error) {
+	bits := familyBits(s.Family)
+	if bits == 0 {
+		return nil, errSubnetFamily
+	}
+	if s.SourcePrefix < 0 || s.SourcePrefix > bits || s.ScopePrefix < 0 || s.ScopePrefix > bits {
+		return nil, errSubnetPrefix
+	}
+
+	ip := s.ip()
+	if ip == nil {
+		return nil, errSubnetFamily
+	}
+	ip = ip.Mask(net.CIDRMask(s.SourcePrefix, bits))
+
+	buf := make([]byte, 4, 4+len(ip))
+	nbo.PutUint16(buf[:2], s.Family)
+	buf[2] = byte(s.SourcePrefix)
+	buf[3] = byte(s.ScopePrefix)
+	buf = append(buf, ip[:(s.SourcePrefix+7)/8]...)
+
+	return append(b, buf...), nil
+}
+
+// Unpack decodes s from option data in b.
+func (s *ClientSubnet) Unpack(b []byte) ([]byte, error) {
+	if len(b) < 4 {
+		return nil, errSubnetLen
+	}
+
+	s.Family = nbo.Uint16(b[:2])
+	s.SourcePrefix = int(b[2])
+	s.ScopePrefix = int(b[3])
+
+	bits := familyBits(s.Family)
+	if bits == 0 {
+		return nil, errSubnetFamily
+	}
+	if s.SourcePrefix > bits || s.ScopePrefix > bits {
+		return nil, errSubnetPrefix
+	}
+
+	n := len(b) - 4
+	if n > (s.SourcePrefix+7)/8 {
+		return nil, errSubnetAddr
+	}
+
+	s.Address = make(net.IP, bits/8)
+	copy(s.Address, b[4:])
+
+	return nil, nil
+}
+
+func (s ClientSubnet) ip() net.IP {
+	switch s.Family {
+	case FamilyIPv4:
+		return s.Address.To4()
+	case FamilyIPv6:
+		return s.Address.To16()
+	default:
+		return nil
+	}
+}
+
+func familyBits(family uint16) int {
+	switch family {
+	case FamilyIPv4:
+		return 8 * net.IPv4len
+	case FamilyIPv6:
+		return 8 * net.IPv6len
+	default:
+		return 0
+	}
+}
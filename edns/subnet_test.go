@@ -0,0 +1,186 @@
+package edns
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestClientSubnetPackUnpack(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+
+		subnet ClientSubnet
+
+		raw []byte
+	}{
+		{
+			name: "IPv4 /24",
+
+			subnet: ClientSubnet{
+				Family:       FamilyIPv4,
+				SourcePrefix: 24,
+				Address:      net.IPv4(192, 0, 2, 0).To4(),
+			},
+
+			raw: []byte{
+				0x00, 0x01, // FAMILY = 1
+				0x18,             // SOURCE PREFIX-LENGTH = 24
+				0x00,             // SCOPE PREFIX-LENGTH = 0
+				0xC0, 0x00, 0x02, // ADDRESS
+			},
+		},
+		{
+			name: "IPv4 /20 response",
+
+			subnet: ClientSubnet{
+				Family:       FamilyIPv4,
+				SourcePrefix: 20,
+				ScopePrefix:  16,
+				Address:      net.IPv4(198, 51, 96, 0).To4(),
+			},
+
+			raw: []byte{
+				0x00, 0x01, // FAMILY = 1
+				0x14,             // SOURCE PREFIX-LENGTH = 20
+				0x10,             // SCOPE PREFIX-LENGTH = 16
+				0xC6, 0x33, 0x60, // ADDRESS
+			},
+		},
+		{
+			name: "IPv6 /56",
+
+			subnet: ClientSubnet{
+				Family:       FamilyIPv6,
+				SourcePrefix: 56,
+				ScopePrefix:  48,
+				Address:      net.ParseIP("2001:db8:1:200::"),
+			},
+
+			raw: []byte{
+				0x00, 0x02, // FAMILY = 2
+				0x38,                                     // SOURCE PREFIX-LENGTH = 56
+				0x30,                                     // SCOPE PREFIX-LENGTH = 48
+				0x20, 0x01, 0x0D, 0xB8, 0x00, 0x01, 0x02, // ADDRESS
+			},
+		},
+		{
+			name: "IPv4 /0",
+
+			subnet: ClientSubnet{
+				Family:  FamilyIPv4,
+				Address: net.IPv4zero.To4(),
+			},
+
+			raw: []byte{
+				0x00, 0x01, // FAMILY = 1
+				0x00, // SOURCE PREFIX-LENGTH = 0
+				0x00, // SCOPE PREFIX-LENGTH = 0
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			raw, err := test.subnet.Pack(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want, got := test.raw, raw; !bytes.Equal(want, got) {
+				t.Errorf("want raw client subnet %x, got %x", want, got)
+			}
+
+			subnet := new(ClientSubnet)
+			if _, err := subnet.Unpack(raw); err != nil {
+				t.Fatal(err)
+			}
+
+			if want, got := test.subnet.Family, subnet.Family; want != got {
+				t.Errorf("want family %d, got %d", want, got)
+			}
+			if want, got := test.subnet.SourcePrefix, subnet.SourcePrefix; want != got {
+				t.Errorf("want source prefix %d, got %d", want, got)
+			}
+			if want, got := test.subnet.ScopePrefix, subnet.ScopePrefix; want != got {
+				t.Errorf("want scope prefix %d, got %d", want, got)
+			}
+			if want, got := test.subnet.Address, subnet.Address; !want.Equal(got) {
+				t.Errorf("want address %s, got %s", want, got)
+			}
+		})
+	}
+}
+
+func TestClientSubnetPackMasksAddress(t *testing.T) {
+	t.Parallel()
+
+	subnet := ClientSubnet{
+		Family:       FamilyIPv4,
+		SourcePrefix: 20,
+		Address:      net.IPv4(198, 51, 100, 7),
+	}
+
+	raw, err := subnet.Pack(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := []byte{0x00, 0x01, 0x14, 0x00, 0xC6, 0x33, 0x60}, raw; !bytes.Equal(want, got) {
+		t.Errorf("want raw client subnet %x, got %x", want, got)
+	}
+
+	if want, got := "198.51.96.0/20", subnet.Network(20).String(); want != got {
+		t.Errorf("want network %q, got %q", want, got)
+	}
+}
+
+func TestClientSubnetUnpackErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+
+		raw []byte
+		err error
+	}{
+		{
+			name: "short",
+			raw:  []byte{0x00, 0x01, 0x18},
+			err:  errSubnetLen,
+		},
+		{
+			name: "family",
+			raw:  []byte{0x00, 0x03, 0x00, 0x00},
+			err:  errSubnetFamily,
+		},
+		{
+			name: "prefix",
+			raw:  []byte{0x00, 0x01, 0x21, 0x00, 0x01, 0x02, 0x03, 0x04, 0x05},
+			err:  errSubnetPrefix,
+		},
+		{
+			name: "address",
+			raw:  []byte{0x00, 0x01, 0x08, 0x00, 0x0A, 0x00},
+			err:  errSubnetAddr,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := new(ClientSubnet).Unpack(test.raw); err != test.err {
+				t.Errorf("want error %q, got %v", test.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+//go:build go1.18
+// +build go1.18
+
+package dns
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func FuzzMessageUnpack(f *testing.F) {
+	f.Add([]byte{
+		0x00, 0x01, 0x81, 0x80, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00,
+		0x03, 'w', 'w', 'w', 0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0x00,
+		0x00, 0x01, 0x00, 0x01,
+		0xC0, 0x0C, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x00, 0x3C, 0x00, 0x04,
+		0x7F, 0x00, 0x00, 0x01,
+	})
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		msg := new(Message)
+		if _, err := msg.Unpack(raw); err != nil {
+			return
+		}
+
+		buf, err := msg.Pack(nil, true)
+		if err != nil {
+			return
+		}
+
+		res := new(Message)
+		if _, err := res.Unpack(buf); err != nil {
+			t.Fatalf("unpack of packed message %x failed: %v", buf, err)
+		}
+		if buf2, err := res.Pack(nil, true); err != nil || !bytes.Equal(buf, buf2) {
+			t.Fatalf("want repacked message %x, got %x (%v)", buf, buf2, err)
+		}
+	})
+}
+
+func FuzzNameUnpack(f *testing.F) {
+	f.Add([]byte{0x00})
+	f.Add([]byte{0x03, 'w', 'w', 'w', 0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0x00})
+	f.Add([]byte{0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0x00, 0x03, 'w', 'w', 'w', 0xC0, 0x00})
+	f.Add([]byte{0xC0, 0x00})
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		dec := decompressor(raw)
+
+		for off := 0; off < len(raw); off++ {
+			name, _, err := dec.Unpack(raw[off:])
+			if err != nil {
+				continue
+			}
+			if len(name) > maxNameLen {
+				t.Fatalf("unpacked name %q longer than %d bytes", name, maxNameLen)
+			}
+			if !strings.HasSuffix(name, ".") {
+				t.Fatalf("unpacked name %q not fully qualified", name)
+			}
+		}
+	})
+}
@@ -44,6 +44,95 @@ func Refuse(ctx context.Context, w MessageWriter, r *Query) {
 	w.Status(Refused)
 }
 
+// Chain is a Handler composed of a sequence of handlers. The first handler
+// serves the query, and each call to Recur by a handler in the chain invokes
+// the next handler. Recur from the last handler forwards the query upstream.
+//
+// A Chain allows local overrides, caching, and filtering handlers to be
+// combined into a single Client Resolver or Server Handler.
+type Chain []Handler
+
+// ServeDNS invokes the first handler of the chain.
+func (c Chain) ServeDNS(ctx context.Context, w MessageWriter, r *Query) {
+	if len(c) == 0 {
+		Recursor(ctx, w, r)
+		return
+	}
+
+	cw := chainWriter{
+		MessageWriter: w,
+
+		query: r,
+		next:  c[1:],
+	}
+
+	c[0].ServeDNS(ctx, cw, r)
+}
+
+type chainWriter struct {
+	MessageWriter
+
+	query *Query
+	next  Chain
+}
+
+func (w chainWriter) setCompression(policy CompressionPolicy) bool {
+	return SetCompression(w.MessageWriter, policy)
+}
+
+func (w chainWriter) setRecurOptions(opts RecurOptions) bool {
+	return SetRecurOptions(w.MessageWriter, opts)
+}
+
+func (w chainWriter) remaining() (int, bool) {
+	return Remaining(w.MessageWriter)
+}
+
+func (w chainWriter) Recur(ctx context.Context) (*Message, error) {
+	if len(w.next) == 0 {
+		return w.MessageWriter.Recur(ctx)
+	}
+
+	rw := &chainRecurWriter{
+		messageWriter: &messageWriter{
+			msg: response(w.query.Message),
+		},
+
+		parent: w.MessageWriter,
+		recur:  w.MessageWriter.Recur,
+	}
+
+	w.next.ServeDNS(ctx, rw, w.query)
+	if rw.err != nil {
+		return nil, rw.err
+	}
+	return rw.msg, nil
+}
+
+type chainRecurWriter struct {
+	*messageWriter
+
+	parent MessageWriter
+	recur  func(context.Context) (*Message, error)
+	err    error
+}
+
+// setCompression sets the compression policy of the response sent by the
+// writer of the chain, since the message of w is never packed.
+func (w *chainRecurWriter) setCompression(policy CompressionPolicy) bool {
+	return SetCompression(w.parent, policy)
+}
+
+func (w *chainRecurWriter) Recur(ctx context.Context) (*Message, error) {
+	msg, err := w.recur(ctx)
+	if err != nil {
+		w.err = err
+	}
+	return msg, err
+}
+
+func (w *chainRecurWriter) Reply(context.Context) error { return nil }
+
 // ResolveMux is a DNS query multiplexer. It matches a question type and name
 // suffix to a Handler.
 type ResolveMux struct {
@@ -57,13 +146,19 @@ type muxEntry struct {
 }
 
 // Handle registers the handler for the given question type and name suffix.
+// The suffix is matched case-insensitively.
 func (m *ResolveMux) Handle(typ Type, suffix string, h Handler) {
-	m.tbl = append(m.tbl, muxEntry{typ: typ, suffix: suffix, h: h})
+	m.tbl = append(m.tbl, muxEntry{typ: typ, suffix: strings.ToLower(suffix), h: h})
 }
 
 // ServeDNS dispatches the query to the handler(s) whose pattern most closely
 // matches each question.
 func (m *ResolveMux) ServeDNS(ctx context.Context, w MessageWriter, r *Query) {
+	if len(r.Questions) == 0 {
+		w.Status(FormErr)
+		return
+	}
+
 	var muxw *muxWriter
 	for _, q := range r.Questions {
 		h := m.lookup(q)
@@ -93,14 +188,14 @@ func (m *ResolveMux) ServeDNS(ctx context.Context, w MessageWriter, r *Query) {
 	if me, ok := <-muxw.recurc; ok {
 		writeMessage(w, me.msg)
 		msg, err := w.Recur(ctx)
-		muxw.recurc <- msgerr{msg, err}
+		muxw.recurc <- msgerr{msg: msg, err: err}
 	}
 
 	me := <-muxw.replyc
 	writeMessage(w, me.msg)
 
 	if err := w.Reply(ctx); err != nil {
-		muxw.replyc <- msgerr{nil, err}
+		muxw.replyc <- msgerr{err: err}
 	}
 }
 
@@ -131,7 +226,7 @@ func (m *ResolveMux) lookup(q Question) Handler {
 		if e.typ != q.Type && e.typ != TypeANY {
 			continue
 		}
-		if strings.HasSuffix(q.Name, e.suffix) {
+		if strings.HasSuffix(strings.ToLower(q.Name), e.suffix) {
 			return e.h
 		}
 	}
@@ -165,7 +260,7 @@ func (w muxWriter) Recur(ctx context.Context) (*Message, error) {
 			mergeRequests(msg, me.msg)
 		}
 	}
-	w.recurc <- msgerr{msg, nil}
+	w.recurc <- msgerr{msg: msg}
 
 	me := <-w.recurc
 	if nextOK {
@@ -193,7 +288,7 @@ func (w muxWriter) Reply(ctx context.Context) error {
 		mergeResponses(msg, me.msg)
 	}
 	close(w.recurc)
-	w.replyc <- msgerr{msg, nil}
+	w.replyc <- msgerr{msg: msg}
 
 	me := <-w.replyc
 	if w.next != nil {
@@ -141,6 +141,33 @@ func TestResolveMux(t *testing.T) {
 		}
 	})
 
+	t.Run("mixed case query", func(t *testing.T) {
+		t.Parallel()
+
+		query := &Query{
+			RemoteAddr: addr,
+			Message: &Message{
+				Questions: []Question{
+					{Name: "App.LocalHost.", Type: TypeA},
+				},
+			},
+		}
+
+		msg, err := client.Do(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := len(localhostZone.RRs["app"][TypeA]), len(msg.Answers); want != got {
+			t.Fatalf("want %d answers, got %d", want, got)
+		}
+		for _, answer := range msg.Answers {
+			if want, got := "App.LocalHost.", answer.Name; want != got {
+				t.Errorf("want answer name %q, got %q", want, got)
+			}
+		}
+	})
+
 	t.Run("forwarded questions query", func(t *testing.T) {
 		t.Parallel()
 
@@ -163,3 +190,139 @@ func TestResolveMux(t *testing.T) {
 		}
 	})
 }
+
+func TestChain(t *testing.T) {
+	t.Parallel()
+
+	localhost := net.IPv4(127, 0, 0, 1).To4()
+	goog := net.IPv4(8, 8, 8, 8).To4()
+
+	override := HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+		if r.Questions[0].Name == "override.local." {
+			w.Answer(r.Questions[0].Name, time.Minute, &A{A: localhost})
+			return
+		}
+
+		Recursor(ctx, w, r)
+	})
+
+	blocklist := HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+		if r.Questions[0].Name == "blocked.local." {
+			w.Status(NXDomain)
+			return
+		}
+
+		Recursor(ctx, w, r)
+	})
+
+	queryc := make(chan string, 1)
+	srv := mustServer(HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+		queryc <- r.Questions[0].Name
+
+		w.Answer(r.Questions[0].Name, time.Minute, &A{A: goog})
+	}))
+
+	addr, err := net.ResolveUDPAddr("udp", srv.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &Client{
+		Resolver: Chain{override, blocklist},
+	}
+
+	tests := []struct {
+		name string
+
+		rcode    RCode
+		answer   net.IP
+		upstream bool
+	}{
+		{name: "override.local.", answer: localhost},
+		{name: "blocked.local.", rcode: NXDomain},
+		{name: "test.local.", answer: goog, upstream: true},
+	}
+
+	for _, test := range tests {
+		query := &Query{
+			RemoteAddr: addr,
+			Message: &Message{
+				Questions: []Question{
+					{Name: test.name, Type: TypeA},
+				},
+			},
+		}
+
+		msg, err := client.Do(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := test.rcode, msg.RCode; want != got {
+			t.Errorf("%s: want rcode %d, got %d", test.name, want, got)
+		}
+		if test.answer != nil {
+			if want, got := 1, len(msg.Answers); want != got {
+				t.Fatalf("%s: want %d answers, got %d", test.name, want, got)
+			}
+			if want, got := test.answer, msg.Answers[0].Record.(*A).A.To4(); !want.Equal(got) {
+				t.Errorf("%s: want A record %q, got %q", test.name, want, got)
+			}
+		}
+		if test.upstream {
+			if want, got := test.name, <-queryc; want != got {
+				t.Errorf("want upstream query for %q, got %q", want, got)
+			}
+		}
+	}
+
+	select {
+	case name := <-queryc:
+		t.Errorf("unexpected upstream query for %q", name)
+	default:
+	}
+}
+
+func TestHandlerNoQuestions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		handler Handler
+	}{
+		{
+			name:    "cache",
+			handler: new(Cache),
+		},
+		{
+			name:    "zone",
+			handler: localhostZone,
+		},
+		{
+			name:    "resolve-mux",
+			handler: new(ResolveMux),
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			client := &Client{
+				Transport: nopDialer{},
+				Resolver:  test.handler,
+			}
+
+			msg, err := client.Do(context.Background(), &Query{Message: new(Message)})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want, got := FormErr, msg.RCode; want != got {
+				t.Errorf("want rcode %d, got %d", want, got)
+			}
+		})
+	}
+}
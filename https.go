@@ -0,0 +1,159 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+)
+
+// mimeDNSMessage is the media type of a DNS-over-HTTPS message (RFC 8484,
+// section 6).
+const mimeDNSMessage = "application/dns-message"
+
+var (
+	errHTTPSNoResponse = errors.New("no pending DNS-over-HTTPS response")
+	errHTTPSMediaType  = errors.New("unexpected DNS-over-HTTPS response media type")
+)
+
+// httpsKey identifies the HTTP client of a DNS-over-HTTPS service.
+type httpsKey struct {
+	addr, url string
+	cfg       *tls.Config
+}
+
+// dialHTTPS returns a Conn that sends each message to the DNS-over-HTTPS
+// service at raddr as a POST request. The HTTP client, and its connections,
+// are shared by all Conns for the service.
+func (t *Transport) dialHTTPS(addr net.Addr, raddr OverHTTPSAddr) Conn {
+	return &httpsConn{
+		client: t.httpsClient(addr, raddr),
+		addr:   raddr,
+	}
+}
+
+func (t *Transport) httpsClient(addr net.Addr, raddr OverHTTPSAddr) *http.Client {
+	cfg := t.TLSConfig
+	for _, a := range []net.Addr{addr, raddr} {
+		if acfg := t.addrTLSConfig(a); acfg != nil {
+			cfg = acfg
+		}
+	}
+
+	key := httpsKey{addr: raddr.Addr.String(), url: raddr.URL, cfg: cfg}
+
+	t.httpsmu.Lock()
+	defer t.httpsmu.Unlock()
+
+	if client, ok := t.https[key]; ok {
+		return client
+	}
+	if cfg != nil {
+		cfg = cfg.Clone()
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			// connect to the service address, regardless of the URL host
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				conn, _, err := t.dial(ctx, raddr.Addr)
+				return conn, err
+			},
+			TLSClientConfig:   cfg,
+			ForceAttemptHTTP2: true,
+			IdleConnTimeout:   90 * time.Second,
+		},
+	}
+
+	if t.https == nil {
+		t.https = make(map[httpsKey]*http.Client)
+	}
+	t.https[key] = client
+	return client
+}
+
+type httpsConn struct {
+	client *http.Client
+	addr   OverHTTPSAddr
+
+	deadline time.Time
+	res, raw []byte
+}
+
+func (c *httpsConn) Read([]byte) (int, error)  { return 0, ErrUnsupportedOp }
+func (c *httpsConn) Write([]byte) (int, error) { return 0, ErrUnsupportedOp }
+
+func (c *httpsConn) Close() error { return nil }
+
+func (c *httpsConn) LocalAddr() net.Addr  { return nil }
+func (c *httpsConn) RemoteAddr() net.Addr { return c.addr }
+
+func (c *httpsConn) SetDeadline(t time.Time) error {
+	c.deadline = t
+	return nil
+}
+
+func (c *httpsConn) SetReadDeadline(t time.Time) error  { return c.SetDeadline(t) }
+func (c *httpsConn) SetWriteDeadline(t time.Time) error { return c.SetDeadline(t) }
+
+// Send posts the message to the service, and reads the response for Recv.
+func (c *httpsConn) Send(msg *Message) error {
+	buf, err := msg.Pack(nil, true)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if !c.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, c.deadline)
+		defer cancel()
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.addr.URL, bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", mimeDNSMessage)
+	req.Header.Set("Accept", mimeDNSMessage)
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return errors.New("DNS-over-HTTPS response status: " + res.Status)
+	}
+	if res.Header.Get("Content-Type") != mimeDNSMessage {
+		return errHTTPSMediaType
+	}
+
+	if c.res, err = ioutil.ReadAll(io.LimitReader(res.Body, maxStreamLen)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Recv decodes the response to the last message sent.
+func (c *httpsConn) Recv(msg *Message) error {
+	if c.res == nil {
+		return errHTTPSNoResponse
+	}
+
+	res := c.res
+	c.res, c.raw = nil, res
+
+	_, err := msg.Unpack(res)
+	return err
+}
+
+// Raw returns the wire format of the last message read by Recv.
+func (c *httpsConn) Raw() []byte { return c.raw }
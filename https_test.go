@@ -0,0 +1,120 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestTransportOverHTTPS(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != mimeDNSMessage {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		req := new(Message)
+		if _, err := req.Unpack(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resolver := &Client{Transport: nopDialer{}, Resolver: &answerHandler{answers}}
+
+		res, err := resolver.Do(r.Context(), &Query{Message: req})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		buf, err := res.Pack(nil, true)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", mimeDNSMessage)
+		w.Write(buf)
+	}))
+	defer srv.Close()
+
+	cfg := &tls.Config{RootCAs: srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs}
+
+	addr := OverHTTPSAddr{
+		Addr:      srv.Listener.Addr(),
+		URL:       srv.URL + "/dns-query",
+		TLSConfig: cfg,
+	}
+
+	t.Run("transport", func(t *testing.T) {
+		testTransport(t, new(Transport), addr)
+	})
+
+	t.Run("client", func(t *testing.T) {
+		client := &Client{Transport: new(Transport)}
+
+		msg, err := client.Do(context.Background(), &Query{
+			Message:    transportTests[0].req,
+			RemoteAddr: addr,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := transportTests[0].res, msg; !reflect.DeepEqual(want, got) {
+			t.Errorf("want response %+v, got %+v", want, got)
+		}
+	})
+
+	t.Run("untrusted", func(t *testing.T) {
+		addr := addr
+		addr.TLSConfig = nil
+
+		conn, err := new(Transport).DialAddr(context.Background(), addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.Send(transportTests[0].req); err == nil {
+			t.Error("want certificate error")
+		}
+	})
+}
+
+func TestTransportOverQUIC(t *testing.T) {
+	t.Parallel()
+
+	addr := OverQUICAddr{
+		Addr:      &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 853},
+		TLSConfig: &tls.Config{ServerName: "dns.example"},
+	}
+
+	if _, err := new(Transport).DialAddr(context.Background(), addr); err != ErrUnsupportedNetwork {
+		t.Errorf("want error %v, got %v", ErrUnsupportedNetwork, err)
+	}
+
+	var dialed *tls.Config
+	tport := &Transport{
+		DialQUIC: func(_ context.Context, a OverQUICAddr, cfg *tls.Config) (Conn, error) {
+			dialed = cfg
+			return nil, nil
+		},
+	}
+	if _, err := tport.DialAddr(context.Background(), addr); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "dns.example", dialed.ServerName; want != got {
+		t.Errorf("want server name %q, got %q", want, got)
+	}
+}
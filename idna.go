@@ -0,0 +1,266 @@
+package dns
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// Punycode parameters (RFC 3492, section 5).
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 128
+
+	punyMaxInt = 1<<31 - 1
+)
+
+// acePrefix is the ASCII compatible encoding prefix of an internationalized
+// label (RFC 5890, section 2.3.2.1).
+const acePrefix = "xn--"
+
+var (
+	errPunyOverflow = errors.New("punycode overflow")
+	errPunyInvalid  = errors.New("invalid punycode")
+)
+
+// idnAlternate returns the alternate form of the internationalized domain
+// name: the punycode form of a Unicode name, or the Unicode form of a
+// punycode name. The boolean result is false if name is neither.
+//
+// Unicode labels are lower cased but otherwise not normalized, so names must
+// be in Unicode normalization form C to match their punycode forms.
+func idnAlternate(name string) (string, bool) {
+	if isASCII(name) {
+		if !strings.Contains(strings.ToLower(name), acePrefix) {
+			return "", false
+		}
+		return idnToUnicode(name)
+	}
+	return idnToASCII(name)
+}
+
+// idnToASCII returns the name with each non-ASCII label converted to its
+// punycode form.
+func idnToASCII(name string) (string, bool) {
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if isASCII(label) {
+			continue
+		}
+
+		enc, err := punyEncode(strings.ToLower(label))
+		if err != nil {
+			return "", false
+		}
+		labels[i] = acePrefix + enc
+	}
+	return strings.Join(labels, "."), true
+}
+
+// idnToUnicode returns the name with each punycode label converted to its
+// Unicode form.
+func idnToUnicode(name string) (string, bool) {
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if len(label) < len(acePrefix) || !strings.EqualFold(label[:len(acePrefix)], acePrefix) {
+			continue
+		}
+
+		dec, err := punyDecode(strings.ToLower(label[len(acePrefix):]))
+		if err != nil {
+			return "", false
+		}
+		labels[i] = dec
+	}
+	return strings.Join(labels, "."), true
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// punyEncode returns the punycode encoding of s, without the ACE prefix
+// (RFC 3492, section 6.3).
+func punyEncode(s string) (string, error) {
+	input := []rune(s)
+
+	var out []byte
+	for _, c := range input {
+		if c < utf8.RuneSelf {
+			out = append(out, byte(c))
+		}
+	}
+
+	b := len(out)
+	h := b
+	if b > 0 {
+		out = append(out, '-')
+	}
+
+	n, delta, bias := rune(punyInitialN), 0, punyInitialBias
+	for h < len(input) {
+		m := rune(punyMaxInt)
+		for _, c := range input {
+			if c >= n && c < m {
+				m = c
+			}
+		}
+
+		if int(m-n) > (punyMaxInt-delta)/(h+1) {
+			return "", errPunyOverflow
+		}
+		delta += int(m-n) * (h + 1)
+		n = m
+
+		for _, c := range input {
+			if c < n {
+				if delta++; delta > punyMaxInt-1 {
+					return "", errPunyOverflow
+				}
+			}
+			if c != n {
+				continue
+			}
+
+			q := delta
+			for k := punyBase; ; k += punyBase {
+				t := punyThreshold(k, bias)
+				if q < t {
+					break
+				}
+				out = append(out, punyDigit(t+(q-t)%(punyBase-t)))
+				q = (q - t) / (punyBase - t)
+			}
+			out = append(out, punyDigit(q))
+
+			bias = punyAdapt(delta, h+1, h == b)
+			delta = 0
+			h++
+		}
+
+		delta++
+		n++
+	}
+	return string(out), nil
+}
+
+// punyDecode returns the Unicode string of the punycode encoding s, without
+// the ACE prefix (RFC 3492, section 6.2).
+func punyDecode(s string) (string, error) {
+	var out []rune
+	pos := 0
+	if b := strings.LastIndexByte(s, '-'); b >= 0 {
+		for i := 0; i < b; i++ {
+			if s[i] >= utf8.RuneSelf {
+				return "", errPunyInvalid
+			}
+			out = append(out, rune(s[i]))
+		}
+		pos = b + 1
+	}
+
+	n, i, bias := rune(punyInitialN), 0, punyInitialBias
+	for pos < len(s) {
+		oldi, w := i, 1
+		for k := punyBase; ; k += punyBase {
+			if pos >= len(s) {
+				return "", errPunyInvalid
+			}
+			digit, ok := punyDigitValue(s[pos])
+			if !ok {
+				return "", errPunyInvalid
+			}
+			pos++
+
+			if digit > (punyMaxInt-i)/w {
+				return "", errPunyOverflow
+			}
+			i += digit * w
+
+			t := punyThreshold(k, bias)
+			if digit < t {
+				break
+			}
+			if w > punyMaxInt/(punyBase-t) {
+				return "", errPunyOverflow
+			}
+			w *= punyBase - t
+		}
+
+		l := len(out) + 1
+		bias = punyAdapt(i-oldi, l, oldi == 0)
+
+		if i/l > punyMaxInt-int(n) {
+			return "", errPunyOverflow
+		}
+		n += rune(i / l)
+		i %= l
+
+		if n > utf8.MaxRune || n < punyInitialN {
+			return "", errPunyInvalid
+		}
+
+		out = append(out, 0)
+		copy(out[i+1:], out[i:])
+		out[i] = n
+		i++
+	}
+	return string(out), nil
+}
+
+func punyThreshold(k, bias int) int {
+	switch {
+	case k <= bias:
+		return punyTMin
+	case k >= bias+punyTMax:
+		return punyTMax
+	default:
+		return k - bias
+	}
+}
+
+func punyAdapt(delta, numPoints int, first bool) int {
+	if first {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+
+	k := 0
+	for delta > ((punyBase-punyTMin)*punyTMax)/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
+
+func punyDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+func punyDigitValue(c byte) (int, bool) {
+	switch {
+	case c >= 'a' && c <= 'z':
+		return int(c - 'a'), true
+	case c >= 'A' && c <= 'Z':
+		return int(c - 'A'), true
+	case c >= '0' && c <= '9':
+		return int(c-'0') + 26, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,74 @@
+package dns
+
+import "testing"
+
+func TestPunycode(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		unicode, punycode string
+	}{
+		{"bücher", "bcher-kva"},
+		{"münchen", "mnchen-3ya"},
+		{"3年B組金八先生", "3B-ww4c5e180e575a65lsy2b"},
+		{"PorquénopuedensimplementehablarenEspañol", "PorqunopuedensimplementehablarenEspaol-fmd56a"},
+		{"ليهمابتكلموشعربي؟", "egbpdaj6bu4bxfgehfvwxn"},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.punycode, func(t *testing.T) {
+			t.Parallel()
+
+			enc, err := punyEncode(test.unicode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, got := test.punycode, enc; want != got {
+				t.Errorf("want punycode %q, got %q", want, got)
+			}
+
+			dec, err := punyDecode(test.punycode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, got := test.unicode, dec; want != got {
+				t.Errorf("want unicode %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestIDNAlternate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+
+		want string
+		ok   bool
+	}{
+		{name: "www.example.", ok: false},
+		{name: "www.bücher.example.", want: "www.xn--bcher-kva.example.", ok: true},
+		{name: "www.BÜCHER.example.", want: "www.xn--bcher-kva.example.", ok: true},
+		{name: "www.xn--bcher-kva.example.", want: "www.bücher.example.", ok: true},
+		{name: "xn--a!.example.", ok: false},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := idnAlternate(test.name)
+			if want, got := test.ok, ok; want != got {
+				t.Fatalf("want ok %t, got %t", want, got)
+			}
+			if want := test.want; want != got {
+				t.Errorf("want alternate name %q, got %q", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+var (
+	// MulticastDNSAddr is the IPv4 multicast DNS group address.
+	MulticastDNSAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+	// MulticastDNSAddr6 is the IPv6 multicast DNS group address.
+	MulticastDNSAddr6 = &net.UDPAddr{IP: net.ParseIP("ff02::fb"), Port: 5353}
+
+	errMulticastInterface = errors.New("IPv6 multicast DNS query requires an interface")
+)
+
+const (
+	defaultMulticastWindow = time.Second
+
+	classCacheFlush Class = 1 << 15
+)
+
+// MulticastResolver resolves queries with one-shot multicast DNS queries as
+// defined in RFC 6762, section 5.1.
+//
+// A MulticastResolver may be used per query as a RoundTripper, or as a handler
+// for the "local." domain:
+//
+//	mux := new(dns.ResolveMux)
+//	mux.Handle(dns.TypeANY, "local.", new(dns.MulticastResolver))
+//
+//	client := &dns.Client{
+//		Resolver: mux,
+//	}
+type MulticastResolver struct {
+	// Addr is the address queries are sent to. MulticastDNSAddr is used by
+	// default.
+	Addr *net.UDPAddr
+
+	// Interface is the name of the network interface IPv6 queries are sent
+	// on. It is required for a link-local IPv6 group such as
+	// MulticastDNSAddr6, unless the Addr has a zone.
+	Interface string
+
+	// Window is the duration to collect responses for. If zero, responses
+	// are collected for one second, or until the context deadline.
+	Window time.Duration
+}
+
+// Do sends the query to the multicast group, and merges the answers of all
+// responses received within the collection window. If no responses are
+// received, the response status is NXDomain. If the context deadline ends the
+// window, the responses received before the deadline are merged; the context
+// error is returned if the context is canceled or no responses were received.
+func (m *MulticastResolver) Do(ctx context.Context, query *Query) (*Message, error) {
+	addr := m.Addr
+	if addr == nil {
+		addr = MulticastDNSAddr
+	}
+
+	network := "udp4"
+	if addr.IP.To4() == nil {
+		network = "udp6"
+
+		// a link-local group is ambiguous without the interface
+		if addr.Zone == "" && (addr.IP.IsLinkLocalMulticast() || addr.IP.IsInterfaceLocalMulticast()) {
+			if m.Interface == "" {
+				return nil, errMulticastInterface
+			}
+
+			zaddr := *addr
+			zaddr.Zone = m.Interface
+			addr = &zaddr
+		}
+	}
+
+	conn, err := net.ListenPacket(network, ":0")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	buf, err := query.Message.Pack(nil, true)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.WriteTo(buf, addr); err != nil {
+		return nil, err
+	}
+
+	window := m.Window
+	if window == 0 {
+		window = defaultMulticastWindow
+	}
+
+	deadline, ctxDeadline := time.Now().Add(window), false
+	if t, ok := ctx.Deadline(); ok && t.Before(deadline) {
+		deadline, ctxDeadline = t, true
+	}
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	donec := make(chan struct{})
+	defer close(donec)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetReadDeadline(time.Now())
+		case <-donec:
+		}
+	}()
+
+	res := &Message{
+		ID:        query.ID,
+		Response:  true,
+		OpCode:    query.OpCode,
+		Questions: query.Questions,
+	}
+
+	var (
+		seen = make(map[string]struct{})
+
+		received bool
+	)
+
+	buf = make([]byte, 9000)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+				break
+			}
+			return nil, err
+		}
+
+		msg := new(Message)
+		if _, err := msg.Unpack(buf[:n]); err != nil || !msg.Response {
+			continue
+		}
+		received = true
+
+		res.Authoritative = res.Authoritative || msg.Authoritative
+		res.Answers = mergeMulticast(res.Answers, msg.Answers, seen)
+		res.Authorities = mergeMulticast(res.Authorities, msg.Authorities, seen)
+		res.Additionals = mergeMulticast(res.Additionals, msg.Additionals, seen)
+	}
+
+	// a context deadline ends the collection window, unless no responses
+	// were received
+	err = ctx.Err()
+	if err == nil && ctxDeadline {
+		err = context.DeadlineExceeded // the read deadline may expire first
+	}
+	if err == context.Canceled || (err != nil && !received) {
+		return nil, err
+	}
+
+	if !received {
+		res.RCode = NXDomain
+	}
+	return res, nil
+}
+
+// ServeDNS answers the query with the merged multicast responses.
+func (m *MulticastResolver) ServeDNS(ctx context.Context, w MessageWriter, r *Query) {
+	msg, err := m.Do(ctx, r)
+	if err != nil {
+		w.Status(ServFail)
+		return
+	}
+
+	writeMessage(w, msg)
+}
+
+// mergeMulticast appends the resources in from that are not in seen to to,
+// with the cache-flush bit cleared from the class.
+func mergeMulticast(to, from []Resource, seen map[string]struct{}) []Resource {
+	for _, res := range from {
+		res.Class &^= classCacheFlush
+
+		buf, err := res.Pack(nil, nil)
+		if err != nil {
+			continue
+		}
+		if _, ok := seen[string(buf)]; ok {
+			continue
+		}
+		seen[string(buf)] = struct{}{}
+
+		to = append(to, res)
+	}
+	return to
+}
@@ -0,0 +1,208 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestMulticastResolver(t *testing.T) {
+	t.Parallel()
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	responders := []Resource{
+		{
+			Name:   "printer.local.",
+			Class:  ClassIN | classCacheFlush,
+			TTL:    2 * time.Minute,
+			Record: &A{A: net.IPv4(192, 168, 1, 10).To4()},
+		},
+		{
+			Name:   "printer.local.",
+			Class:  ClassIN,
+			TTL:    2 * time.Minute,
+			Record: &A{A: net.IPv4(192, 168, 1, 11).To4()},
+		},
+		{
+			Name:   "printer.local.",
+			Class:  ClassIN,
+			TTL:    2 * time.Minute,
+			Record: &A{A: net.IPv4(192, 168, 1, 10).To4()},
+		},
+	}
+
+	go func() {
+		buf := make([]byte, maxPacketLen)
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		req := new(Message)
+		if _, err := req.Unpack(buf[:n]); err != nil {
+			return
+		}
+
+		for _, answer := range responders {
+			msg := response(req)
+			msg.Authoritative = true
+			msg.Answers = []Resource{answer}
+
+			buf, err := msg.Pack(nil, true)
+			if err != nil {
+				return
+			}
+			conn.WriteTo(buf, addr)
+		}
+	}()
+
+	mdns := &MulticastResolver{
+		Addr:   conn.LocalAddr().(*net.UDPAddr),
+		Window: 100 * time.Millisecond,
+	}
+
+	client := &Client{
+		Transport: nopDialer{},
+		Resolver:  mdns,
+	}
+
+	query := &Query{
+		Message: &Message{
+			Questions: []Question{
+				{Name: "printer.local.", Type: TypeA, Class: ClassIN},
+			},
+		},
+	}
+
+	msg, err := client.Do(context.Background(), query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := NoError, msg.RCode; want != got {
+		t.Errorf("want rcode %d, got %d", want, got)
+	}
+	if want, got := 2, len(msg.Answers); want != got {
+		t.Fatalf("want %d answers, got %d", want, got)
+	}
+	for i, ip := range []net.IP{net.IPv4(192, 168, 1, 10), net.IPv4(192, 168, 1, 11)} {
+		if want, got := ip, msg.Answers[i].Record.(*A).A; !want.Equal(got) {
+			t.Errorf("want A record %q, got %q", want, got)
+		}
+		if want, got := ClassIN, msg.Answers[i].Class; want != got {
+			t.Errorf("want answer class %d, got %d", want, got)
+		}
+	}
+
+	t.Run("no responses", func(t *testing.T) {
+		msg, err := mdns.Do(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := NXDomain, msg.RCode; want != got {
+			t.Errorf("want rcode %d, got %d", want, got)
+		}
+	})
+}
+
+func TestMulticastResolverDeadline(t *testing.T) {
+	t.Parallel()
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	go func() {
+		buf := make([]byte, maxPacketLen)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			req := new(Message)
+			if _, err := req.Unpack(buf[:n]); err != nil {
+				return
+			}
+			if req.Questions[0].Name != "printer.local." {
+				continue
+			}
+
+			msg := response(req)
+			msg.Answers = []Resource{
+				{Name: "printer.local.", Class: ClassIN, TTL: time.Minute, Record: &A{A: net.IPv4(192, 168, 1, 10).To4()}},
+			}
+
+			buf, err := msg.Pack(nil, true)
+			if err != nil {
+				return
+			}
+			conn.WriteTo(buf, addr)
+		}
+	}()
+
+	mdns := &MulticastResolver{
+		Addr:   conn.LocalAddr().(*net.UDPAddr),
+		Window: 10 * time.Second,
+	}
+
+	query := func(name string) *Query {
+		return &Query{
+			Message: &Message{
+				Questions: []Question{
+					{Name: name, Type: TypeA, Class: ClassIN},
+				},
+			},
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	msg, err := mdns.Do(ctx, query("printer.local."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 1, len(msg.Answers); want != got {
+		t.Errorf("want %d answers, got %d", want, got)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, err := mdns.Do(ctx, query("scanner.local.")); err != context.DeadlineExceeded {
+		t.Errorf("want error %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	if _, err := mdns.Do(ctx, query("printer.local.")); err != context.Canceled {
+		t.Errorf("want error %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestMulticastResolverInterface(t *testing.T) {
+	t.Parallel()
+
+	query := &Query{
+		Message: &Message{
+			Questions: []Question{
+				{Name: "printer.local.", Type: TypeAAAA, Class: ClassIN},
+			},
+		},
+	}
+
+	mdns := &MulticastResolver{Addr: MulticastDNSAddr6}
+	if _, err := mdns.Do(context.Background(), query); err != errMulticastInterface {
+		t.Errorf("want error %v, got %v", errMulticastInterface, err)
+	}
+}
@@ -7,7 +7,10 @@ package dns
 import (
 	"encoding/binary"
 	"errors"
+	"math"
 	"net"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/benburkert/dns/edns"
@@ -32,57 +35,118 @@ type RCode uint16
 // Taken from https://www.iana.org/assignments/dns-parameters/dns-parameters.xhtml
 const (
 	// Resource Record (RR) TYPEs
-	TypeA     Type = 1   // [RFC1035] a host address
-	TypeNS    Type = 2   // [RFC1035] an authoritative name server
-	TypeCNAME Type = 5   // [RFC1035] the canonical name for an alias
-	TypeSOA   Type = 6   // [RFC1035] marks the start of a zone of authority
-	TypeWKS   Type = 11  // [RFC1035] a well known service description
-	TypePTR   Type = 12  // [RFC1035] a domain name pointer
-	TypeHINFO Type = 13  // [RFC1035] host information
-	TypeMINFO Type = 14  // [RFC1035] mailbox or mail list information
-	TypeMX    Type = 15  // [RFC1035] mail exchange
-	TypeTXT   Type = 16  // [RFC1035] text strings
-	TypeAAAA  Type = 28  // [RFC3596] IP6 Address
-	TypeSRV   Type = 33  // [RFC2782] Server Selection
-	TypeDNAME Type = 39  // [RFC6672] DNAME
-	TypeOPT   Type = 41  // [RFC6891][RFC3225] OPT
-	TypeAXFR  Type = 252 // [RFC1035][RFC5936] transfer of an entire zone
-	TypeALL   Type = 255 // [RFC1035][RFC6895] A request for all records the server/cache has available
-	TypeCAA   Type = 257 // [RFC6844] Certification Authority Restriction
+	TypeA          Type = 1   // [RFC1035] a host address
+	TypeNS         Type = 2   // [RFC1035] an authoritative name server
+	TypeCNAME      Type = 5   // [RFC1035] the canonical name for an alias
+	TypeSOA        Type = 6   // [RFC1035] marks the start of a zone of authority
+	TypeWKS        Type = 11  // [RFC1035] a well known service description
+	TypePTR        Type = 12  // [RFC1035] a domain name pointer
+	TypeHINFO      Type = 13  // [RFC1035] host information
+	TypeMINFO      Type = 14  // [RFC1035] mailbox or mail list information
+	TypeMX         Type = 15  // [RFC1035] mail exchange
+	TypeTXT        Type = 16  // [RFC1035] text strings
+	TypeRP         Type = 17  // [RFC1183] for Responsible Person
+	TypeAFSDB      Type = 18  // [RFC1183][RFC5864] for AFS Data Base location
+	TypeAAAA       Type = 28  // [RFC3596] IP6 Address
+	TypeLOC        Type = 29  // [RFC1876] Location Information
+	TypeSRV        Type = 33  // [RFC2782] Server Selection
+	TypeNAPTR      Type = 35  // [RFC3403] Naming Authority Pointer
+	TypeCERT       Type = 37  // [RFC4398] CERT
+	TypeDNAME      Type = 39  // [RFC6672] DNAME
+	TypeOPT        Type = 41  // [RFC6891][RFC3225] OPT
+	TypeDS         Type = 43  // [RFC4034] Delegation Signer
+	TypeRRSIG      Type = 46  // [RFC4034] RRSIG
+	TypeNSEC       Type = 47  // [RFC4034] NSEC
+	TypeDNSKEY     Type = 48  // [RFC4034] DNSKEY
+	TypeNSEC3      Type = 50  // [RFC5155] NSEC3
+	TypeNSEC3PARAM Type = 51  // [RFC5155] NSEC3PARAM
+	TypeTLSA       Type = 52  // [RFC6698] TLSA
+	TypeSMIMEA     Type = 53  // [RFC8162] S/MIME cert association
+	TypeOPENPGPKEY Type = 61  // [RFC7929] OpenPGP Key
+	TypeZONEMD     Type = 63  // [RFC8976] Message Digest Over Zone Data
+	TypeSVCB       Type = 64  // [RFC9460] General-purpose service binding
+	TypeHTTPS      Type = 65  // [RFC9460] SVCB-compatible type for use with HTTP
+	TypeTSIG       Type = 250 // [RFC8945] Transaction Signature
+	TypeAXFR       Type = 252 // [RFC1035][RFC5936] transfer of an entire zone
+	TypeALL        Type = 255 // [RFC1035][RFC6895] A request for all records the server/cache has available
+	TypeURI        Type = 256 // [RFC7553] URI
+	TypeCAA        Type = 257 // [RFC6844] Certification Authority Restriction
+
+	TypeALIAS Type = 65401 // [] ALIAS pseudo-record, from the private use range
 
 	TypeANY Type = 0
 
 	// DNS CLASSes
-	ClassIN  Class = 1   // [RFC1035] Internet (IN)
-	ClassCH  Class = 3   // [] Chaos (CH)
-	ClassHS  Class = 4   // [] Hesiod (HS)
-	ClassANY Class = 255 // [RFC1035] QCLASS * (ANY)
+	ClassIN   Class = 1   // [RFC1035] Internet (IN)
+	ClassCH   Class = 3   // [] Chaos (CH)
+	ClassHS   Class = 4   // [] Hesiod (HS)
+	ClassNONE Class = 254 // [RFC2136] QCLASS NONE
+	ClassANY  Class = 255 // [RFC1035] QCLASS * (ANY)
+
+	// DNS OpCodes
+	OpQuery  OpCode = 0 // [RFC1035] Query
+	OpNotify OpCode = 4 // [RFC1996] Notify
+	OpUpdate OpCode = 5 // [RFC2136] Update
 
 	// DNS RCODEs
-	NoError  RCode = 0 // [RFC1035] No Error
-	FormErr  RCode = 1 // [RFC1035] Format Error
-	ServFail RCode = 2 // [RFC1035] Server Failure
-	NXDomain RCode = 3 // [RFC1035] Non-Existent Domain
-	NotImp   RCode = 4 // [RFC1035] Not Implemented
-	Refused  RCode = 5 // [RFC1035] Query Refused
+	NoError  RCode = 0  // [RFC1035] No Error
+	FormErr  RCode = 1  // [RFC1035] Format Error
+	ServFail RCode = 2  // [RFC1035] Server Failure
+	NXDomain RCode = 3  // [RFC1035] Non-Existent Domain
+	NotImp   RCode = 4  // [RFC1035] Not Implemented
+	Refused  RCode = 5  // [RFC1035] Query Refused
+	YXDomain RCode = 6  // [RFC2136] Name Exists when it should not
+	YXRRSet  RCode = 7  // [RFC2136] RR Set Exists when it should not
+	NXRRSet  RCode = 8  // [RFC2136] RR Set that should exist does not
+	NotAuth  RCode = 9  // [RFC2136][RFC8945] Server Not Authoritative for zone or Not Authorized
+	NotZone  RCode = 10 // [RFC2136] Name not contained in zone
 
 	maxPacketLen = 512
+
+	// maxStreamLen is the maximum length of a message sent over a stream
+	// connection, limited by the 2 byte length prefix.
+	maxStreamLen = 65535
+
+	// maxNameLen is the maximum length of a domain name in presentation
+	// format, a wire format name of 255 octets.
+	maxNameLen = 254
 )
 
 // NewRecordByType returns a new instance of a Record for a Type.
 var NewRecordByType = map[Type]func() Record{
-	TypeA:     func() Record { return new(A) },
-	TypeNS:    func() Record { return new(NS) },
-	TypeCNAME: func() Record { return new(CNAME) },
-	TypeSOA:   func() Record { return new(SOA) },
-	TypePTR:   func() Record { return new(PTR) },
-	TypeMX:    func() Record { return new(MX) },
-	TypeTXT:   func() Record { return new(TXT) },
-	TypeAAAA:  func() Record { return new(AAAA) },
-	TypeSRV:   func() Record { return new(SRV) },
-	TypeDNAME: func() Record { return new(DNAME) },
-	TypeOPT:   func() Record { return new(OPT) },
-	TypeCAA:   func() Record { return new(CAA) },
+	TypeA:          func() Record { return new(A) },
+	TypeNS:         func() Record { return new(NS) },
+	TypeCNAME:      func() Record { return new(CNAME) },
+	TypeSOA:        func() Record { return new(SOA) },
+	TypePTR:        func() Record { return new(PTR) },
+	TypeHINFO:      func() Record { return new(HINFO) },
+	TypeMX:         func() Record { return new(MX) },
+	TypeTXT:        func() Record { return new(TXT) },
+	TypeRP:         func() Record { return new(RP) },
+	TypeAFSDB:      func() Record { return new(AFSDB) },
+	TypeAAAA:       func() Record { return new(AAAA) },
+	TypeLOC:        func() Record { return new(LOC) },
+	TypeSRV:        func() Record { return new(SRV) },
+	TypeNAPTR:      func() Record { return new(NAPTR) },
+	TypeCERT:       func() Record { return new(CERT) },
+	TypeDNAME:      func() Record { return new(DNAME) },
+	TypeOPT:        func() Record { return new(OPT) },
+	TypeDS:         func() Record { return new(DS) },
+	TypeRRSIG:      func() Record { return new(RRSIG) },
+	TypeNSEC:       func() Record { return new(NSEC) },
+	TypeDNSKEY:     func() Record { return new(DNSKEY) },
+	TypeNSEC3:      func() Record { return new(NSEC3) },
+	TypeNSEC3PARAM: func() Record { return new(NSEC3PARAM) },
+	TypeTLSA:       func() Record { return new(TLSA) },
+	TypeSMIMEA:     func() Record { return new(SMIMEA) },
+	TypeURI:        func() Record { return new(URI) },
+	TypeCAA:        func() Record { return new(CAA) },
+	TypeOPENPGPKEY: func() Record { return new(OPENPGPKEY) },
+	TypeZONEMD:     func() Record { return new(ZONEMD) },
+	TypeSVCB:       func() Record { return new(SVCB) },
+	TypeHTTPS:      func() Record { return new(HTTPS) },
+	TypeTSIG:       func() Record { return new(TSIG) },
+	TypeALIAS:      func() Record { return new(ALIAS) },
 }
 
 var (
@@ -110,7 +174,11 @@ var (
 	errTooManyAuthorities = errors.New("too many Authorities to pack (>65535)")
 	errTooManyAdditionals = errors.New("too many Additionals to pack (>65535)")
 	errFieldOverflow      = errors.New("value too large for packed field")
-	errUnknownType        = errors.New("unknown resource type")
+	errTrailingBytes      = errors.New("extra bytes following message")
+	errInvalidClass       = errors.New("invalid resource class")
+	errNameTooLong        = errors.New("domain name too long")
+	errSVCParamOrder      = errors.New("SvcParams not in strictly increasing key order")
+	errCAATag             = errors.New("invalid CAA property tag")
 )
 
 // Message is a DNS message.
@@ -122,6 +190,8 @@ type Message struct {
 	Truncated          bool
 	RecursionDesired   bool
 	RecursionAvailable bool
+	AuthenticatedData  bool
+	CheckingDisabled   bool
 	RCode              RCode
 
 	Questions   []Question
@@ -164,53 +234,174 @@ func (m *Message) Pack(b []byte, compress bool) ([]byte, error) {
 	return b, nil
 }
 
+// UnpackOptions control the handling of malformed messages when decoding.
+// The zero value is the behavior of Message.Unpack.
+type UnpackOptions struct {
+	// Strict rejects messages with bytes following the last record, records
+	// with an unknown class, or owner names longer than 255 octets.
+	Strict bool
+
+	// Partial tolerates messages that end before the number of records in the
+	// header section counts, such as a truncated packet capture. The sections
+	// hold the records decoded before the end of the message.
+	Partial bool
+
+	// MaxMessageLen is the maximum length of a message in bytes. If zero,
+	// there is no limit.
+	MaxMessageLen int
+
+	// MaxSectionRecords is the maximum number of questions or records in each
+	// section of a message, as counted by the header. If zero, there is no
+	// limit.
+	MaxSectionRecords int
+
+	// MaxNameBytes is the maximum total length of the decompressed domain
+	// names of a message, including the names in record data. It bounds the
+	// memory a message of compression pointers can expand to. If zero, there
+	// is no limit.
+	MaxNameBytes int
+}
+
+// A LimitError is returned when decoding a message that exceeds a limit of
+// the UnpackOptions.
+type LimitError struct {
+	Limit string // "message length", "section records", or "name bytes"
+	Value int
+	Max   int
+}
+
+func (e *LimitError) Error() string {
+	return "dns: " + e.Limit + " " + strconv.Itoa(e.Value) + " exceeds limit " + strconv.Itoa(e.Max)
+}
+
 // Unpack decodes m from b. Unused bytes are returned.
+//
+// The section slices of m are reused if they have sufficient capacity for the
+// decoded records.
 func (m *Message) Unpack(b []byte) ([]byte, error) {
-	dec := decompressor(b)
+	return m.UnpackWith(b, UnpackOptions{})
+}
 
-	var err error
-	if b, err = m.unpackHeader(b); err != nil {
+// UnpackWith decodes m from b according to opts. Unused bytes are returned.
+//
+// The section slices of m are reused if they have sufficient capacity for the
+// decoded records.
+func (m *Message) UnpackWith(b []byte, opts UnpackOptions) ([]byte, error) {
+	return m.unpack(b, opts, false)
+}
+
+// UnpackInto is like UnpackWith, but the questions and records of m are also
+// reused. A record value in the sections of m is decoded in place if it is of
+// the same type as the record at the same position in b, and owner names are
+// reused if unchanged. A receive loop decoding a steady stream of similar
+// messages allocates little beyond the domain names within record data.
+//
+// Records previously decoded into m are overwritten, so they must not be
+// retained between calls.
+func (m *Message) UnpackInto(b []byte, opts UnpackOptions) ([]byte, error) {
+	return m.unpack(b, opts, true)
+}
+
+func (m *Message) unpack(b []byte, opts UnpackOptions, reuse bool) ([]byte, error) {
+	if opts.MaxMessageLen > 0 && len(b) > opts.MaxMessageLen {
+		return nil, &LimitError{Limit: "message length", Value: len(b), Max: opts.MaxMessageLen}
+	}
+
+	var dec Decompressor = decompressor(b) // converted once for record Unpack calls
+	if opts.MaxNameBytes > 0 {
+		dec = &nameBudget{decompressor: decompressor(b), max: opts.MaxNameBytes}
+	}
+
+	var (
+		counts [4]int
+		err    error
+	)
+	if b, counts, err = m.unpackHeader(b); err != nil {
 		return nil, err
 	}
+	if max := opts.MaxSectionRecords; max > 0 {
+		for _, n := range counts {
+			if n > max {
+				return nil, &LimitError{Limit: "section records", Value: n, Max: max}
+			}
+		}
+	}
 
-	for i := 0; i < cap(m.Questions); i++ {
+	for i := 0; i < counts[0]; i++ {
 		var q Question
-		if b, err = q.Unpack(b, dec); err != nil {
-			return nil, err
+		if reuse && i < cap(m.Questions) {
+			q.Name = m.Questions[:i+1][i].Name
 		}
-		m.Questions = append(m.Questions, q)
-	}
-	for i := 0; i < cap(m.Answers); i++ {
-		var r Resource
-		if b, err = r.Unpack(b, dec); err != nil {
-			return nil, err
+
+		if b, err = q.unpack(b, dec); err != nil {
+			return opts.unpackErr(err)
 		}
-		m.Answers = append(m.Answers, r)
-	}
-	for i := 0; i < cap(m.Authorities); i++ {
-		var r Resource
-		if b, err = r.Unpack(b, dec); err != nil {
+		if err = opts.check(q.Name, q.Type, q.Class); err != nil {
 			return nil, err
 		}
-		m.Authorities = append(m.Authorities, r)
+		m.Questions = append(m.Questions, q)
 	}
-	for i := 0; i < cap(m.Additionals); i++ {
-		var r Resource
-		if b, err = r.Unpack(b, dec); err != nil {
-			return nil, err
+
+	sections := []*[]Resource{&m.Answers, &m.Authorities, &m.Additionals}
+	for j, section := range sections {
+		for i := 0; i < counts[j+1]; i++ {
+			var r Resource
+			if reuse && i < cap(*section) {
+				r = (*section)[:i+1][i]
+			}
+
+			if b, err = r.unpack(b, dec); err != nil {
+				return opts.unpackErr(err)
+			}
+			if err = opts.check(r.Name, r.Record.Type(), r.Class); err != nil {
+				return nil, err
+			}
+			*section = append(*section, r)
 		}
-		m.Additionals = append(m.Additionals, r)
 	}
 
+	if opts.Strict && len(b) > 0 {
+		return nil, errTrailingBytes
+	}
 	return b, nil
 }
 
+// unpackErr returns the result of a section decoding error.
+func (o UnpackOptions) unpackErr(err error) ([]byte, error) {
+	if o.Partial && (err == errBaseLen || err == errCalcLen || err == errResourceLen) {
+		return nil, nil
+	}
+	return nil, err
+}
+
+// check validates the owner name and class of a decoded question or record.
+func (o UnpackOptions) check(name string, typ Type, class Class) error {
+	if !o.Strict {
+		return nil
+	}
+
+	if len(name) > maxNameLen {
+		return errNameTooLong
+	}
+
+	switch class {
+	case ClassIN, ClassCH, ClassHS, ClassNONE, ClassANY:
+		return nil
+	}
+	if typ == TypeOPT {
+		return nil // the class of an OPT record is the UDP payload size
+	}
+	return errInvalidClass
+}
+
 const (
 	headerBitQR = 1 << 15 // query/response (response=1)
 	headerBitAA = 1 << 10 // authoritative
 	headerBitTC = 1 << 9  // truncated
 	headerBitRD = 1 << 8  // recursion desired
 	headerBitRA = 1 << 7  // recursion available
+	headerBitAD = 1 << 5  // authenticated data
+	headerBitCD = 1 << 4  // checking disabled
 )
 
 func (m *Message) packHeader(b []byte) ([]byte, error) {
@@ -245,6 +436,12 @@ func (m *Message) packHeader(b []byte) ([]byte, error) {
 	if m.Authoritative {
 		bits |= headerBitAA
 	}
+	if m.AuthenticatedData {
+		bits |= headerBitAD
+	}
+	if m.CheckingDisabled {
+		bits |= headerBitCD
+	}
 
 	qdcount := uint16(len(m.Questions))
 	if int(qdcount) != len(m.Questions) {
@@ -276,45 +473,137 @@ func (m *Message) packHeader(b []byte) ([]byte, error) {
 	return append(b, buf[:]...), nil
 }
 
-func (m *Message) unpackHeader(b []byte) ([]byte, error) {
-	if len(b) < 12 {
-		return nil, errResourceLen
+func (m *Message) unpackHeader(b []byte) ([]byte, [4]int, error) {
+	h, err := UnpackHeader(b)
+	if err != nil {
+		return nil, [4]int{}, err
 	}
 
-	var (
-		id      = int(nbo.Uint16(b))
-		bits    = nbo.Uint16(b[2:])
-		qdcount = nbo.Uint16(b[4:])
-		ancount = nbo.Uint16(b[6:])
-		nscount = nbo.Uint16(b[8:])
-		arcount = nbo.Uint16(b[10:])
-	)
+	qs, ans, nss, ars := m.Questions, m.Answers, m.Authorities, m.Additionals
 
 	*m = Message{
-		ID:                 id,
+		ID:                 h.ID,
+		Response:           h.Response,
+		OpCode:             h.OpCode,
+		Authoritative:      h.Authoritative,
+		Truncated:          h.Truncated,
+		RecursionDesired:   h.RecursionDesired,
+		RecursionAvailable: h.RecursionAvailable,
+		AuthenticatedData:  h.AuthenticatedData,
+		CheckingDisabled:   h.CheckingDisabled,
+		RCode:              h.RCode,
+	}
+
+	// The section counts are not trusted to size the sections beyond the
+	// number of minimal questions and records that fit in the message.
+	b = b[12:]
+	qdcount := entries(h.QDCount, len(b)/minQuestionLen)
+	if m.Questions = qs[:0]; cap(qs) < qdcount {
+		m.Questions = make([]Question, 0, qdcount)
+	}
+	m.Answers = resources(ans, entries(h.ANCount, len(b)/minResourceLen))
+	m.Authorities = resources(nss, entries(h.NSCount, len(b)/minResourceLen))
+	m.Additionals = resources(ars, entries(h.ARCount, len(b)/minResourceLen))
+
+	return b, [4]int{h.QDCount, h.ANCount, h.NSCount, h.ARCount}, nil
+}
+
+const (
+	minQuestionLen = 5  // root name, type, and class
+	minResourceLen = 11 // root name, type, class, TTL, and RDATA length
+)
+
+// entries returns the lesser of the section count n and max.
+func entries(n, max int) int {
+	if n < max {
+		return n
+	}
+	return max
+}
+
+// Header is the fixed size header of a DNS message.
+type Header struct {
+	ID                 int
+	Response           bool
+	OpCode             OpCode
+	Authoritative      bool
+	Truncated          bool
+	RecursionDesired   bool
+	RecursionAvailable bool
+	AuthenticatedData  bool
+	CheckingDisabled   bool
+	RCode              RCode
+
+	// The number of entries in each section of the message.
+	QDCount, ANCount, NSCount, ARCount int
+}
+
+// UnpackHeader decodes the header of the message in b, without decoding the
+// sections of the message. It is cheaper than Unpack for classifying
+// messages, such as by a rate limiter or load balancer.
+func UnpackHeader(b []byte) (Header, error) {
+	if len(b) < 12 {
+		return Header{}, errResourceLen
+	}
+
+	bits := nbo.Uint16(b[2:])
+	return Header{
+		ID:                 int(nbo.Uint16(b)),
 		Response:           (bits & headerBitQR) > 0,
 		OpCode:             OpCode(bits>>11) & 0xF,
 		Authoritative:      (bits & headerBitAA) > 0,
 		Truncated:          (bits & headerBitTC) > 0,
 		RecursionDesired:   (bits & headerBitRD) > 0,
 		RecursionAvailable: (bits & headerBitRA) > 0,
+		AuthenticatedData:  (bits & headerBitAD) > 0,
+		CheckingDisabled:   (bits & headerBitCD) > 0,
 		RCode:              RCode(bits) & 0xF,
-	}
 
-	if qdcount > 0 {
-		m.Questions = make([]Question, 0, qdcount)
-	}
-	if ancount > 0 {
-		m.Answers = make([]Resource, 0, ancount)
-	}
-	if nscount > 0 {
-		m.Authorities = make([]Resource, 0, nscount)
+		QDCount: int(nbo.Uint16(b[4:])),
+		ANCount: int(nbo.Uint16(b[6:])),
+		NSCount: int(nbo.Uint16(b[8:])),
+		ARCount: int(nbo.Uint16(b[10:])),
+	}, nil
+}
+
+// resources returns rs truncated to zero length if it has capacity for n
+// resources, otherwise a new slice.
+func resources(rs []Resource, n int) []Resource {
+	if cap(rs) < n {
+		return make([]Resource, 0, n)
 	}
-	if arcount > 0 {
-		m.Additionals = make([]Resource, 0, arcount)
+	return rs[:0]
+}
+
+// A DurationError is returned when packing a duration field that is out of
+// range for its wire format value of seconds.
+type DurationError struct {
+	Field    string
+	Duration time.Duration
+}
+
+func (e *DurationError) Error() string {
+	return "dns: " + e.Field + " duration " + e.Duration.String() + " out of range"
+}
+
+// packSeconds returns the duration d as a wire format value of seconds in the
+// range 0 to max. Fractional seconds are truncated.
+func packSeconds(field string, d time.Duration, max uint32) (uint32, error) {
+	secs := d / time.Second
+	if secs < 0 || secs > time.Duration(max) {
+		return 0, &DurationError{Field: field, Duration: d}
 	}
+	return uint32(secs), nil
+}
 
-	return b[12:], nil
+// unpackSeconds decodes a TTL value of seconds from b. As defined in RFC 2181
+// section 8, a value with the most significant bit set is treated as zero.
+func unpackSeconds(b []byte) time.Duration {
+	secs := nbo.Uint32(b)
+	if secs > math.MaxInt32 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
 }
 
 // A Question is a DNS query.
@@ -351,7 +640,19 @@ func (q *Question) Unpack(b []byte, dec Decompressor) ([]byte, error) {
 	if q.Name, b, err = dec.Unpack(b); err != nil {
 		return nil, err
 	}
+	return q.unpackFields(b)
+}
+
+// unpack decodes q from b, reusing the current name of q if unchanged.
+func (q *Question) unpack(b []byte, dec Decompressor) ([]byte, error) {
+	var err error
+	if q.Name, b, err = unpackName(dec, b, q.Name); err != nil {
+		return nil, err
+	}
+	return q.unpackFields(b)
+}
 
+func (q *Question) unpackFields(b []byte) ([]byte, error) {
 	if len(b) < 4 {
 		return nil, errResourceLen
 	}
@@ -384,9 +685,9 @@ func (r Resource) Pack(b []byte, com Compressor) ([]byte, error) {
 
 	rtype := r.Record.Type()
 
-	ttl := uint32(r.TTL / time.Second)
-	if time.Duration(ttl) != r.TTL/time.Second {
-		return nil, errFieldOverflow
+	ttl, err := packSeconds("TTL", r.TTL, math.MaxInt32)
+	if err != nil {
+		return nil, err
 	}
 
 	rlen, err := r.Record.Length(com)
@@ -411,30 +712,57 @@ func (r Resource) Pack(b []byte, com Compressor) ([]byte, error) {
 
 // Unpack decodes r from b.
 func (r *Resource) Unpack(b []byte, dec Decompressor) ([]byte, error) {
+	if dec == nil {
+		dec = decompressor(nil)
+	}
+
 	var err error
 	if r.Name, b, err = dec.Unpack(b); err != nil {
 		return nil, err
 	}
+	return r.unpackFields(b, dec, nil)
+}
+
+// unpack decodes r from b, reusing the current name of r if unchanged, and
+// the current record of r if the type matches.
+func (r *Resource) unpack(b []byte, dec Decompressor) ([]byte, error) {
+	var err error
+	if r.Name, b, err = unpackName(dec, b, r.Name); err != nil {
+		return nil, err
+	}
+	return r.unpackFields(b, dec, r.Record)
+}
 
+// unpackFields decodes the fields of r following the owner name. The RDATA is
+// decoded into record if it is of the resource type.
+func (r *Resource) unpackFields(b []byte, dec Decompressor, record Record) ([]byte, error) {
 	if len(b) < 10 {
 		return nil, errResourceLen
 	}
 
 	rtype := Type(nbo.Uint16(b[:2]))
 	r.Class = Class(nbo.Uint16(b[2:4]))
-	r.TTL = time.Duration(nbo.Uint32(b[4:8])) * time.Second
+	r.TTL = unpackSeconds(b[4:8])
 
 	rdlen, b := int(nbo.Uint16(b[8:10])), b[10:]
 	if len(b) < rdlen {
 		return nil, errResourceLen
 	}
 
-	newfn, ok := NewRecordByType[rtype]
-	if !ok {
-		return nil, errUnknownType
+	if rdlen == 0 && (r.Class == ClassANY || r.Class == ClassNONE) && rtype != TypeOPT {
+		// UPDATE prerequisite or delete of a name or RRset, RFC 2136 section 2.4
+		r.Record = EmptyRecord{RRType: rtype}
+		return b, nil
+	}
+
+	if record == nil || record.Type() != rtype {
+		if newfn, ok := NewRecordByType[rtype]; ok {
+			record = newfn()
+		} else {
+			record = &RawRecord{RRType: rtype}
+		}
 	}
 
-	record := newfn()
 	buf, err := record.Unpack(b[:rdlen], dec)
 	if err != nil {
 		return nil, err
@@ -451,10 +779,48 @@ func (r *Resource) Unpack(b []byte, dec Decompressor) ([]byte, error) {
 type Record interface {
 	Type() Type
 	Length(Compressor) (int, error)
+
+	RecordPacker
+}
+
+// RecordPacker encodes and decodes the RDATA of a record. Record types outside
+// this package pack the domain names in their RDATA with the Compressor of
+// the message, or with NoCompression if the names must not be compressed, and
+// unpack them with the Decompressor of the message. Record types are
+// registered for decoding in NewRecordByType.
+type RecordPacker interface {
 	Pack([]byte, Compressor) ([]byte, error)
 	Unpack([]byte, Decompressor) ([]byte, error)
 }
 
+// RawRecord is a record of a type without a Record implementation in
+// NewRecordByType. The RDATA is opaque, and is packed as it was unpacked
+// (RFC 3597, section 4), so that messages with unknown types can be
+// forwarded and cached.
+type RawRecord struct {
+	RRType Type
+	Data   []byte
+}
+
+// Type returns the RR type identifier.
+func (r RawRecord) Type() Type { return r.RRType }
+
+// Length returns the encoded RDATA size.
+func (r RawRecord) Length(_ Compressor) (int, error) {
+	return len(r.Data), nil
+}
+
+// Pack encodes r as RDATA.
+func (r RawRecord) Pack(b []byte, _ Compressor) ([]byte, error) {
+	return append(b, r.Data...), nil
+}
+
+// Unpack decodes r from RDATA in b.
+func (r *RawRecord) Unpack(b []byte, _ Decompressor) ([]byte, error) {
+	r.Data = append(r.Data[:0], b...)
+	return nil, nil
+}
+
 // A A is a DNS A record.
 type A struct {
 	A net.IP
@@ -519,6 +885,109 @@ func (a *AAAA) Unpack(b []byte, _ Decompressor) ([]byte, error) {
 	return b[16:], nil
 }
 
+// LOC is a DNS LOC record, the geographical location of a host (RFC 1876).
+type LOC struct {
+	Latitude  float64 // degrees, north of the equator if positive
+	Longitude float64 // degrees, east of the prime meridian if positive
+	Altitude  float64 // meters, above the WGS 84 reference spheroid
+
+	// Size is the diameter in meters of a sphere enclosing the described
+	// entity. Size, HorizPre, and VertPre are encoded with a one digit
+	// precision, such as 10, 20, or 300 meters.
+	Size     float64
+	HorizPre float64 // meters, horizontal precision
+	VertPre  float64 // meters, vertical precision
+}
+
+const (
+	locEquator  = 1 << 31      // latitude and longitude of the equator and prime meridian
+	locBase     = 100000 * 100 // centimeters below the WGS 84 spheroid of altitude 0
+	locArcSecMs = 3600 * 1000  // thousandths of an arc second per degree
+)
+
+var errLOCVersion = errors.New("unsupported LOC version")
+
+// Type returns the RR type identifier.
+func (LOC) Type() Type { return TypeLOC }
+
+// Length returns the encoded RDATA size.
+func (LOC) Length(Compressor) (int, error) { return 16, nil }
+
+// Pack encodes l as RDATA.
+func (l LOC) Pack(b []byte, _ Compressor) ([]byte, error) {
+	if math.Abs(l.Latitude) > 90 || math.Abs(l.Longitude) > 180 {
+		return nil, errFieldOverflow
+	}
+
+	alt := math.Floor(l.Altitude*100+0.5) + locBase
+	if alt < 0 || alt > math.MaxUint32 {
+		return nil, errFieldOverflow
+	}
+
+	var buf [16]byte
+	for i, v := range []float64{l.Size, l.HorizPre, l.VertPre} {
+		var ok bool
+		if buf[1+i], ok = packLOCPrecision(v); !ok {
+			return nil, errFieldOverflow
+		}
+	}
+	nbo.PutUint32(buf[4:], uint32(int64(math.Floor(l.Latitude*locArcSecMs+0.5))+locEquator))
+	nbo.PutUint32(buf[8:], uint32(int64(math.Floor(l.Longitude*locArcSecMs+0.5))+locEquator))
+	nbo.PutUint32(buf[12:], uint32(alt))
+
+	return append(b, buf[:]...), nil
+}
+
+// Unpack decodes l from RDATA in b.
+func (l *LOC) Unpack(b []byte, _ Decompressor) ([]byte, error) {
+	if len(b) < 16 {
+		return nil, errResourceLen
+	}
+	if b[0] != 0 {
+		return nil, errLOCVersion
+	}
+
+	var ok [3]bool
+	l.Size, ok[0] = unpackLOCPrecision(b[1])
+	l.HorizPre, ok[1] = unpackLOCPrecision(b[2])
+	l.VertPre, ok[2] = unpackLOCPrecision(b[3])
+	if !ok[0] || !ok[1] || !ok[2] {
+		return nil, errFieldOverflow
+	}
+
+	l.Latitude = float64(int64(nbo.Uint32(b[4:]))-locEquator) / locArcSecMs
+	l.Longitude = float64(int64(nbo.Uint32(b[8:]))-locEquator) / locArcSecMs
+	l.Altitude = float64(int64(nbo.Uint32(b[12:]))-locBase) / 100
+
+	return b[16:], nil
+}
+
+// packLOCPrecision encodes a size or precision in meters as a centimeter
+// mantissa and power of ten exponent, rounded to one significant digit.
+func packLOCPrecision(meters float64) (byte, bool) {
+	if meters < 0 {
+		return 0, false
+	}
+
+	cm, exp := uint64(math.Floor(meters*100+0.5)), 0
+	for cm >= 10 {
+		cm, exp = (cm+5)/10, exp+1
+	}
+	if exp > 9 {
+		return 0, false
+	}
+	return byte(cm<<4 | uint64(exp)), true
+}
+
+// unpackLOCPrecision decodes a size or precision in meters.
+func unpackLOCPrecision(b byte) (float64, bool) {
+	mantissa, exp := b>>4, b&0xF
+	if mantissa > 9 || exp > 9 {
+		return 0, false
+	}
+	return float64(mantissa) * math.Pow10(int(exp)) / 100, true
+}
+
 // CNAME is a DNS CNAME record.
 type CNAME struct {
 	CNAME string
@@ -544,6 +1013,33 @@ func (c *CNAME) Unpack(b []byte, dec Decompressor) ([]byte, error) {
 	return b, err
 }
 
+// ALIAS is an ALIAS pseudo-record. It is served by a Zone as the A and AAAA
+// records of the target name, resolved at query time. Unlike a CNAME, an
+// ALIAS may be placed at the zone apex.
+type ALIAS struct {
+	ALIAS string
+}
+
+// Type returns the RR type identifier.
+func (ALIAS) Type() Type { return TypeALIAS }
+
+// Length returns the encoded RDATA size.
+func (a ALIAS) Length(com Compressor) (int, error) {
+	return com.Length(a.ALIAS)
+}
+
+// Pack encodes a as RDATA.
+func (a ALIAS) Pack(b []byte, com Compressor) ([]byte, error) {
+	return com.Pack(b, a.ALIAS)
+}
+
+// Unpack decodes a from RDATA in b.
+func (a *ALIAS) Unpack(b []byte, dec Decompressor) ([]byte, error) {
+	var err error
+	a.ALIAS, b, err = dec.Unpack(b)
+	return b, err
+}
+
 // SOA is a DNS SOA record.
 type SOA struct {
 	NS      string
@@ -577,35 +1073,33 @@ func (s SOA) Pack(b []byte, com Compressor) ([]byte, error) {
 		return nil, err
 	}
 
-	var (
-		serial  = uint32(s.Serial)
-		refresh = int32(s.Refresh / time.Second)
-		retry   = int32(s.Retry / time.Second)
-		expire  = int32(s.Expire / time.Second)
-		minimum = uint32(s.MinTTL / time.Second)
-	)
-
+	serial := uint32(s.Serial)
 	if int(serial) != s.Serial {
 		return nil, errFieldOverflow
 	}
-	if time.Duration(refresh) != s.Refresh/time.Second {
-		return nil, errFieldOverflow
+
+	refresh, err := packSeconds("SOA Refresh", s.Refresh, math.MaxUint32)
+	if err != nil {
+		return nil, err
 	}
-	if time.Duration(retry) != s.Retry/time.Second {
-		return nil, errFieldOverflow
+	retry, err := packSeconds("SOA Retry", s.Retry, math.MaxUint32)
+	if err != nil {
+		return nil, err
 	}
-	if time.Duration(expire) != s.Expire/time.Second {
-		return nil, errFieldOverflow
+	expire, err := packSeconds("SOA Expire", s.Expire, math.MaxUint32)
+	if err != nil {
+		return nil, err
 	}
-	if time.Duration(minimum) != s.MinTTL/time.Second {
-		return nil, errFieldOverflow
+	minimum, err := packSeconds("SOA MinTTL", s.MinTTL, math.MaxUint32)
+	if err != nil {
+		return nil, err
 	}
 
 	buf := [20]byte{}
 	nbo.PutUint32(buf[:4], serial)
-	nbo.PutUint32(buf[4:8], uint32(refresh))
-	nbo.PutUint32(buf[8:12], uint32(retry))
-	nbo.PutUint32(buf[12:16], uint32(expire))
+	nbo.PutUint32(buf[4:8], refresh)
+	nbo.PutUint32(buf[8:12], retry)
+	nbo.PutUint32(buf[12:16], expire)
 	nbo.PutUint32(buf[16:], minimum)
 
 	return append(b, buf[:]...), nil
@@ -627,9 +1121,9 @@ func (s *SOA) Unpack(b []byte, dec Decompressor) ([]byte, error) {
 
 	var (
 		serial  = nbo.Uint32(b[:4])
-		refresh = int32(nbo.Uint32(b[4:8]))
-		retry   = int32(nbo.Uint32(b[8:12]))
-		expire  = int32(nbo.Uint32(b[12:16]))
+		refresh = nbo.Uint32(b[4:8])
+		retry   = nbo.Uint32(b[8:12])
+		expire  = nbo.Uint32(b[12:16])
 		minimum = nbo.Uint32(b[16:20])
 	)
 
@@ -667,6 +1161,45 @@ func (p *PTR) Unpack(b []byte, dec Decompressor) ([]byte, error) {
 	return b, err
 }
 
+// HINFO is a DNS HINFO record, the CPU and operating system of a host. It is
+// also the minimal response to ANY queries (RFC 8482).
+type HINFO struct {
+	CPU string
+	OS  string
+}
+
+// Type returns the RR type identifier.
+func (HINFO) Type() Type { return TypeHINFO }
+
+// Length returns the encoded RDATA size.
+func (h HINFO) Length(_ Compressor) (int, error) {
+	return 2 + len(h.CPU) + len(h.OS), nil
+}
+
+// Pack encodes h as RDATA.
+func (h HINFO) Pack(b []byte, _ Compressor) ([]byte, error) {
+	for _, s := range []string{h.CPU, h.OS} {
+		if len(s) > 255 {
+			return nil, errSegTooLong
+		}
+		b = append(append(b, byte(len(s))), s...)
+	}
+	return b, nil
+}
+
+// Unpack decodes h from RDATA in b.
+func (h *HINFO) Unpack(b []byte, _ Decompressor) ([]byte, error) {
+	for _, s := range []*string{&h.CPU, &h.OS} {
+		if len(b) < 1 || len(b) < 1+int(b[0]) {
+			return nil, errResourceLen
+		}
+
+		*s = string(b[1 : 1+int(b[0])])
+		b = b[1+int(b[0]):]
+	}
+	return b, nil
+}
+
 // MX is a DNS MX record.
 type MX struct {
 	Pref int
@@ -736,7 +1269,9 @@ func (n *NS) Unpack(b []byte, dec Decompressor) ([]byte, error) {
 	return b, err
 }
 
-// TXT is a DNS TXT record.
+// TXT is a DNS TXT record. Each string is encoded as one or more
+// character-strings of at most 255 bytes, so strings longer than 255 bytes,
+// such as DKIM keys, are split into multiple character-strings.
 type TXT struct {
 	TXT []string
 }
@@ -746,28 +1281,54 @@ func (TXT) Type() Type { return TypeTXT }
 
 // Length returns the encoded RDATA size.
 func (t TXT) Length(_ Compressor) (int, error) {
+	if len(t.TXT) == 0 {
+		return 1, nil
+	}
+
 	var n int
 	for _, s := range t.TXT {
-		n += 1 + len(s)
+		n += len(s) + txtChunks(s)
 	}
 	return n, nil
 }
 
 // Pack encodes t as RDATA.
 func (t TXT) Pack(b []byte, _ Compressor) ([]byte, error) {
+	if len(t.TXT) == 0 {
+		return append(b, 0x00), nil
+	}
+
 	for _, s := range t.TXT {
-		if len(s) > 255 {
-			return nil, errSegTooLong
-		}
+		for i := txtChunks(s); i > 0; i-- {
+			n := len(s)
+			if n > 255 {
+				n = 255
+			}
 
-		b = append(append(b, byte(len(s))), []byte(s)...)
+			b = append(append(b, byte(n)), s[:n]...)
+			s = s[n:]
+		}
 	}
 	return b, nil
 }
 
+// Join returns the concatenation of the character-strings of t, such as a
+// SPF policy or DKIM key split across multiple character-strings.
+func (t TXT) Join() string {
+	return strings.Join(t.TXT, "")
+}
+
+// txtChunks returns the number of character-strings needed to encode s.
+func txtChunks(s string) int {
+	if len(s) == 0 {
+		return 1
+	}
+	return (len(s) + 254) / 255
+}
+
 // Unpack decodes t from RDATA in b.
 func (t *TXT) Unpack(b []byte, _ Decompressor) ([]byte, error) {
-	var txts []string
+	txts := t.TXT[:0]
 	for len(b) > 0 {
 		txtlen := int(b[0])
 		if len(b) < txtlen+1 {
@@ -782,22 +1343,100 @@ func (t *TXT) Unpack(b []byte, _ Decompressor) ([]byte, error) {
 	return nil, nil
 }
 
-// SRV is a DNS SRV record.
-type SRV struct {
-	Priority int
-	Weight   int
-	Port     int
-	Target   string // Not compressed as per RFC 2782.
+// RP is a DNS RP record.
+type RP struct {
+	MBox string // Not compressed as per RFC 3597.
+	TXT  string // Not compressed as per RFC 3597.
 }
 
 // Type returns the RR type identifier.
-func (SRV) Type() Type { return TypeSRV }
+func (RP) Type() Type { return TypeRP }
 
 // Length returns the encoded RDATA size.
-func (s SRV) Length(_ Compressor) (int, error) {
-	n, err := compressor{}.Length(s.Target)
-	if err != nil {
-		return 0, err
+func (r RP) Length(_ Compressor) (int, error) {
+	return compressor{}.Length(r.MBox, r.TXT)
+}
+
+// Pack encodes r as RDATA.
+func (r RP) Pack(b []byte, _ Compressor) ([]byte, error) {
+	var err error
+	if b, err = (compressor{}).Pack(b, r.MBox); err != nil {
+		return nil, err
+	}
+	return compressor{}.Pack(b, r.TXT)
+}
+
+// Unpack decodes r from RDATA in b.
+func (r *RP) Unpack(b []byte, dec Decompressor) ([]byte, error) {
+	var err error
+	if r.MBox, b, err = dec.Unpack(b); err != nil {
+		return nil, err
+	}
+
+	r.TXT, b, err = dec.Unpack(b)
+	return b, err
+}
+
+// AFSDB is a DNS AFSDB record.
+type AFSDB struct {
+	Subtype  int
+	Hostname string // Not compressed as per RFC 3597.
+}
+
+// Type returns the RR type identifier.
+func (AFSDB) Type() Type { return TypeAFSDB }
+
+// Length returns the encoded RDATA size.
+func (a AFSDB) Length(_ Compressor) (int, error) {
+	n, err := compressor{}.Length(a.Hostname)
+	if err != nil {
+		return 0, err
+	}
+	return n + 2, nil
+}
+
+// Pack encodes a as RDATA.
+func (a AFSDB) Pack(b []byte, _ Compressor) ([]byte, error) {
+	subtype := uint16(a.Subtype)
+	if int(subtype) != a.Subtype {
+		return nil, errFieldOverflow
+	}
+
+	buf := [2]byte{}
+	nbo.PutUint16(buf[:], subtype)
+
+	return compressor{}.Pack(append(b, buf[:]...), a.Hostname)
+}
+
+// Unpack decodes a from RDATA in b.
+func (a *AFSDB) Unpack(b []byte, dec Decompressor) ([]byte, error) {
+	if len(b) < 2 {
+		return nil, errResourceLen
+	}
+
+	a.Subtype = int(nbo.Uint16(b[:2]))
+
+	var err error
+	a.Hostname, b, err = dec.Unpack(b[2:])
+	return b, err
+}
+
+// SRV is a DNS SRV record.
+type SRV struct {
+	Priority int
+	Weight   int
+	Port     int
+	Target   string // Not compressed as per RFC 2782.
+}
+
+// Type returns the RR type identifier.
+func (SRV) Type() Type { return TypeSRV }
+
+// Length returns the encoded RDATA size.
+func (s SRV) Length(_ Compressor) (int, error) {
+	n, err := compressor{}.Length(s.Target)
+	if err != nil {
+		return 0, err
 	}
 	return n + 6, nil
 }
@@ -828,8 +1467,9 @@ func (s SRV) Pack(b []byte, _ Compressor) ([]byte, error) {
 	return compressor{}.Pack(append(b, buf[:]...), s.Target)
 }
 
-// Unpack decodes s from RDATA in b.
-func (s *SRV) Unpack(b []byte, _ Decompressor) ([]byte, error) {
+// Unpack decodes s from RDATA in b. A compressed target is decoded, as sent
+// by some servers despite RFC 2782.
+func (s *SRV) Unpack(b []byte, dec Decompressor) ([]byte, error) {
 	if len(b) < 6 {
 		return nil, errResourceLen
 	}
@@ -839,10 +1479,157 @@ func (s *SRV) Unpack(b []byte, _ Decompressor) ([]byte, error) {
 	s.Port = int(nbo.Uint16(b[4:6]))
 
 	var err error
-	s.Target, b, err = decompressor(nil).Unpack(b[6:])
+	s.Target, b, err = dec.Unpack(b[6:])
 	return b, err
 }
 
+// NAPTR is a DNS NAPTR record.
+type NAPTR struct {
+	Order       int
+	Preference  int
+	Flags       string
+	Service     string
+	Regexp      string
+	Replacement string // Not compressed as per RFC 3403.
+}
+
+// Type returns the RR type identifier.
+func (NAPTR) Type() Type { return TypeNAPTR }
+
+// Length returns the encoded RDATA size.
+func (n NAPTR) Length(_ Compressor) (int, error) {
+	l, err := compressor{}.Length(n.Replacement)
+	if err != nil {
+		return 0, err
+	}
+	return l + 7 + len(n.Flags) + len(n.Service) + len(n.Regexp), nil
+}
+
+// Pack encodes n as RDATA.
+func (n NAPTR) Pack(b []byte, _ Compressor) ([]byte, error) {
+	var (
+		order      = uint16(n.Order)
+		preference = uint16(n.Preference)
+	)
+
+	if int(order) != n.Order {
+		return nil, errFieldOverflow
+	}
+	if int(preference) != n.Preference {
+		return nil, errFieldOverflow
+	}
+
+	buf := [4]byte{}
+	nbo.PutUint16(buf[:2], order)
+	nbo.PutUint16(buf[2:], preference)
+	b = append(b, buf[:]...)
+
+	for _, s := range []string{n.Flags, n.Service, n.Regexp} {
+		if len(s) > 255 {
+			return nil, errSegTooLong
+		}
+		b = append(append(b, byte(len(s))), s...)
+	}
+
+	return compressor{}.Pack(b, n.Replacement)
+}
+
+// Unpack decodes n from RDATA in b.
+func (n *NAPTR) Unpack(b []byte, dec Decompressor) ([]byte, error) {
+	if len(b) < 4 {
+		return nil, errResourceLen
+	}
+
+	n.Order = int(nbo.Uint16(b[:2]))
+	n.Preference = int(nbo.Uint16(b[2:4]))
+	b = b[4:]
+
+	for _, s := range []*string{&n.Flags, &n.Service, &n.Regexp} {
+		if len(b) < 1 || len(b) < 1+int(b[0]) {
+			return nil, errResourceLen
+		}
+
+		*s = string(b[1 : 1+int(b[0])])
+		b = b[1+int(b[0]):]
+	}
+
+	var err error
+	n.Replacement, b, err = dec.Unpack(b)
+	return b, err
+}
+
+// CERT certificate types.
+//
+// Taken from https://www.iana.org/assignments/cert-rr-types/cert-rr-types.xhtml
+const (
+	CertPKIX    = 1   // [RFC4398] X.509 as per PKIX
+	CertSPKI    = 2   // [RFC4398] SPKI certificate
+	CertPGP     = 3   // [RFC4398] OpenPGP packet
+	CertIPKIX   = 4   // [RFC4398] The URL of an X.509 data object
+	CertISPKI   = 5   // [RFC4398] The URL of an SPKI certificate
+	CertIPGP    = 6   // [RFC4398] The fingerprint and URL of an OpenPGP packet
+	CertACPKIX  = 7   // [RFC4398] Attribute Certificate
+	CertIACPKIX = 8   // [RFC4398] The URL of an Attribute Certificate
+	CertURI     = 253 // [RFC4398] URI private
+	CertOID     = 254 // [RFC4398] OID private
+)
+
+// CERT is a DNS CERT record.
+type CERT struct {
+	CertType    int
+	KeyTag      int
+	Algorithm   int
+	Certificate []byte
+}
+
+// Type returns the RR type identifier.
+func (CERT) Type() Type { return TypeCERT }
+
+// Length returns the encoded RDATA size.
+func (c CERT) Length(_ Compressor) (int, error) {
+	return 5 + len(c.Certificate), nil
+}
+
+// Pack encodes c as RDATA.
+func (c CERT) Pack(b []byte, _ Compressor) ([]byte, error) {
+	var (
+		certType  = uint16(c.CertType)
+		keyTag    = uint16(c.KeyTag)
+		algorithm = uint8(c.Algorithm)
+	)
+
+	if int(certType) != c.CertType {
+		return nil, errFieldOverflow
+	}
+	if int(keyTag) != c.KeyTag {
+		return nil, errFieldOverflow
+	}
+	if int(algorithm) != c.Algorithm {
+		return nil, errFieldOverflow
+	}
+
+	buf := [5]byte{}
+	nbo.PutUint16(buf[:2], certType)
+	nbo.PutUint16(buf[2:4], keyTag)
+	buf[4] = algorithm
+
+	return append(append(b, buf[:]...), c.Certificate...), nil
+}
+
+// Unpack decodes c from RDATA in b.
+func (c *CERT) Unpack(b []byte, _ Decompressor) ([]byte, error) {
+	if len(b) < 5 {
+		return nil, errResourceLen
+	}
+
+	c.CertType = int(nbo.Uint16(b[:2]))
+	c.KeyTag = int(nbo.Uint16(b[2:4]))
+	c.Algorithm = int(b[4])
+	c.Certificate = append(c.Certificate[:0], b[5:]...)
+
+	return nil, nil
+}
+
 // DNAME is a DNS DNAME record.
 type DNAME struct {
 	DNAME string
@@ -868,6 +1655,97 @@ func (d *DNAME) Unpack(b []byte, dec Decompressor) ([]byte, error) {
 	return b, err
 }
 
+// TLSA certificate usages, selectors, and matching types.
+//
+// Taken from https://www.iana.org/assignments/dane-parameters/dane-parameters.xhtml
+const (
+	TLSAUsagePKIXTA = 0 // [RFC6698] CA constraint
+	TLSAUsagePKIXEE = 1 // [RFC6698] Service certificate constraint
+	TLSAUsageDANETA = 2 // [RFC6698] Trust anchor assertion
+	TLSAUsageDANEEE = 3 // [RFC6698] Domain-issued certificate
+
+	TLSASelectorCert = 0 // [RFC6698] Full certificate
+	TLSASelectorSPKI = 1 // [RFC6698] SubjectPublicKeyInfo
+
+	TLSAMatchingFull   = 0 // [RFC6698] Exact match on selected content
+	TLSAMatchingSHA256 = 1 // [RFC6698] SHA-256 hash of selected content
+	TLSAMatchingSHA512 = 2 // [RFC6698] SHA-512 hash of selected content
+)
+
+// TLSA is a DNS TLSA record, a TLS certificate association for DANE.
+type TLSA struct {
+	Usage        int
+	Selector     int
+	MatchingType int
+	Data         []byte // certificate association data
+}
+
+// Type returns the RR type identifier.
+func (TLSA) Type() Type { return TypeTLSA }
+
+// Length returns the encoded RDATA size.
+func (t TLSA) Length(_ Compressor) (int, error) {
+	return 3 + len(t.Data), nil
+}
+
+// Pack encodes t as RDATA.
+func (t TLSA) Pack(b []byte, _ Compressor) ([]byte, error) {
+	var (
+		usage        = uint8(t.Usage)
+		selector     = uint8(t.Selector)
+		matchingType = uint8(t.MatchingType)
+	)
+
+	if int(usage) != t.Usage {
+		return nil, errFieldOverflow
+	}
+	if int(selector) != t.Selector {
+		return nil, errFieldOverflow
+	}
+	if int(matchingType) != t.MatchingType {
+		return nil, errFieldOverflow
+	}
+
+	return append(append(b, usage, selector, matchingType), t.Data...), nil
+}
+
+// Unpack decodes t from RDATA in b.
+func (t *TLSA) Unpack(b []byte, _ Decompressor) ([]byte, error) {
+	if len(b) < 3 {
+		return nil, errResourceLen
+	}
+
+	t.Usage = int(b[0])
+	t.Selector = int(b[1])
+	t.MatchingType = int(b[2])
+	t.Data = append(t.Data[:0], b[3:]...)
+
+	return nil, nil
+}
+
+// SMIMEA is a DNS SMIMEA record, an S/MIME certificate association for the
+// email address of the owner name. It has the same fields and wire format as
+// a TLSA record.
+type SMIMEA TLSA
+
+// Type returns the RR type identifier.
+func (SMIMEA) Type() Type { return TypeSMIMEA }
+
+// Length returns the encoded RDATA size.
+func (s SMIMEA) Length(com Compressor) (int, error) {
+	return TLSA(s).Length(com)
+}
+
+// Pack encodes s as RDATA.
+func (s SMIMEA) Pack(b []byte, com Compressor) ([]byte, error) {
+	return TLSA(s).Pack(b, com)
+}
+
+// Unpack decodes s from RDATA in b.
+func (s *SMIMEA) Unpack(b []byte, dec Decompressor) ([]byte, error) {
+	return (*TLSA)(s).Unpack(b, dec)
+}
+
 // OPT is a DNS OPT record.
 type OPT struct {
 	Options []edns.Option
@@ -898,7 +1776,7 @@ func (o OPT) Pack(b []byte, _ Compressor) ([]byte, error) {
 
 // Unpack decodes o from RDATA in b.
 func (o *OPT) Unpack(b []byte, _ Decompressor) ([]byte, error) {
-	o.Options = nil
+	o.Options = o.Options[:0]
 
 	var err error
 	for len(b) > 0 {
@@ -911,14 +1789,71 @@ func (o *OPT) Unpack(b []byte, _ Decompressor) ([]byte, error) {
 	return b, nil
 }
 
-// type CAA is a DNS CAA record.
+// URI is a DNS URI record.
+type URI struct {
+	Priority int
+	Weight   int
+	Target   string
+}
+
+// Type returns the RR type identifier.
+func (URI) Type() Type { return TypeURI }
+
+// Length returns the encoded RDATA size.
+func (u URI) Length(_ Compressor) (int, error) {
+	return 4 + len(u.Target), nil
+}
+
+// Pack encodes u as RDATA.
+func (u URI) Pack(b []byte, _ Compressor) ([]byte, error) {
+	var (
+		priority = uint16(u.Priority)
+		weight   = uint16(u.Weight)
+	)
+
+	if int(priority) != u.Priority {
+		return nil, errFieldOverflow
+	}
+	if int(weight) != u.Weight {
+		return nil, errFieldOverflow
+	}
+	if len(u.Target) == 0 {
+		return nil, errZeroSegLen
+	}
+
+	buf := [4]byte{}
+	nbo.PutUint16(buf[:2], priority)
+	nbo.PutUint16(buf[2:], weight)
+
+	return append(append(b, buf[:]...), u.Target...), nil
+}
+
+// Unpack decodes u from RDATA in b.
+func (u *URI) Unpack(b []byte, _ Decompressor) ([]byte, error) {
+	if len(b) < 5 {
+		return nil, errResourceLen
+	}
+
+	u.Priority = int(nbo.Uint16(b[:2]))
+	u.Weight = int(nbo.Uint16(b[2:4]))
+	u.Target = string(b[4:])
+
+	return nil, nil
+}
+
+// CAA is a DNS CAA record (RFC 8659).
 type CAA struct {
+	// IssuerCritical is the critical flag: an issuer must not issue
+	// certificates if it does not understand the property tag.
 	IssuerCritical bool
 
-	Tag   string
-	Value string
+	Tag   string // property tag, such as "issue", "issuewild", or "iodef"
+	Value string // property value
 }
 
+// caaIssuerCritical is the issuer critical flag bit of the CAA flags.
+const caaIssuerCritical = 0x80
+
 // Type returns the RR type identifier.
 func (CAA) Type() Type { return TypeCAA }
 
@@ -932,7 +1867,7 @@ func (c CAA) Pack(b []byte, _ Compressor) ([]byte, error) {
 	buf := make([]byte, 2, 2+len(c.Tag)+len(c.Value))
 
 	if c.IssuerCritical {
-		buf[0] = 1
+		buf[0] = caaIssuerCritical
 	}
 
 	tagLength := len(c.Tag)
@@ -942,6 +1877,9 @@ func (c CAA) Pack(b []byte, _ Compressor) ([]byte, error) {
 	if tagLength > 255 {
 		return nil, errSegTooLong
 	}
+	if !validCAATag(c.Tag) {
+		return nil, errCAATag
+	}
 	buf[1] = byte(tagLength)
 
 	buf = append(buf, []byte(c.Tag)...)
@@ -956,9 +1894,7 @@ func (c *CAA) Unpack(b []byte, _ Decompressor) ([]byte, error) {
 		return nil, errResourceLen
 	}
 
-	if b[0]&0x01 > 0 {
-		c.IssuerCritical = true
-	}
+	c.IssuerCritical = b[0]&caaIssuerCritical != 0
 
 	tagLength := int(b[1])
 	if tagLength == 0 {
@@ -971,5 +1907,366 @@ func (c *CAA) Unpack(b []byte, _ Decompressor) ([]byte, error) {
 	c.Tag = string(b[2 : 2+tagLength])
 	c.Value = string(b[2+tagLength:])
 
+	if !validCAATag(c.Tag) {
+		return nil, errCAATag
+	}
+	return nil, nil
+}
+
+// validCAATag reports whether tag contains only US-ASCII letters and digits.
+func validCAATag(tag string) bool {
+	for i := 0; i < len(tag); i++ {
+		switch c := tag[i]; {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// OPENPGPKEY is a DNS OPENPGPKEY record.
+type OPENPGPKEY struct {
+	PublicKey []byte // OpenPGP Transferable Public Key, in binary format.
+}
+
+// Type returns the RR type identifier.
+func (OPENPGPKEY) Type() Type { return TypeOPENPGPKEY }
+
+// Length returns the encoded RDATA size.
+func (o OPENPGPKEY) Length(_ Compressor) (int, error) {
+	return len(o.PublicKey), nil
+}
+
+// Pack encodes o as RDATA.
+func (o OPENPGPKEY) Pack(b []byte, _ Compressor) ([]byte, error) {
+	return append(b, o.PublicKey...), nil
+}
+
+// Unpack decodes o from RDATA in b.
+func (o *OPENPGPKEY) Unpack(b []byte, _ Decompressor) ([]byte, error) {
+	o.PublicKey = append(o.PublicKey[:0], b...)
+	return nil, nil
+}
+
+// ZONEMD is a DNS ZONEMD record.
+type ZONEMD struct {
+	Serial int
+	Scheme int
+	Hash   int
+	Digest []byte
+}
+
+// Type returns the RR type identifier.
+func (ZONEMD) Type() Type { return TypeZONEMD }
+
+// Length returns the encoded RDATA size.
+func (z ZONEMD) Length(_ Compressor) (int, error) {
+	return 6 + len(z.Digest), nil
+}
+
+// Pack encodes z as RDATA.
+func (z ZONEMD) Pack(b []byte, _ Compressor) ([]byte, error) {
+	var (
+		serial = uint32(z.Serial)
+		scheme = uint8(z.Scheme)
+		hash   = uint8(z.Hash)
+	)
+
+	if int(serial) != z.Serial {
+		return nil, errFieldOverflow
+	}
+	if int(scheme) != z.Scheme {
+		return nil, errFieldOverflow
+	}
+	if int(hash) != z.Hash {
+		return nil, errFieldOverflow
+	}
+
+	buf := [6]byte{}
+	nbo.PutUint32(buf[:4], serial)
+	buf[4] = scheme
+	buf[5] = hash
+
+	return append(append(b, buf[:]...), z.Digest...), nil
+}
+
+// Unpack decodes z from RDATA in b.
+func (z *ZONEMD) Unpack(b []byte, _ Decompressor) ([]byte, error) {
+	if len(b) < 6 {
+		return nil, errResourceLen
+	}
+
+	z.Serial = int(nbo.Uint32(b[:4]))
+	z.Scheme = int(b[4])
+	z.Hash = int(b[5])
+	z.Digest = append(z.Digest[:0], b[6:]...)
+
+	return nil, nil
+}
+
+// SVCParamKey is a SVCB service parameter key.
+type SVCParamKey int
+
+// SVCB service parameter keys.
+//
+// Taken from https://www.iana.org/assignments/dns-svcb/dns-svcb.xhtml
+const (
+	SVCParamMandatory     SVCParamKey = 0 // [RFC9460] Mandatory keys in this RR
+	SVCParamALPN          SVCParamKey = 1 // [RFC9460] Additional supported protocols
+	SVCParamNoDefaultALPN SVCParamKey = 2 // [RFC9460] No support for default protocol
+	SVCParamPort          SVCParamKey = 3 // [RFC9460] Port for alternative endpoint
+	SVCParamIPv4Hint      SVCParamKey = 4 // [RFC9460] IPv4 address hints
+	SVCParamECH           SVCParamKey = 5 // [RFC9460] Encrypted ClientHello info
+	SVCParamIPv6Hint      SVCParamKey = 6 // [RFC9460] IPv6 address hints
+)
+
+// SVCParam is a SVCB service parameter in wire format.
+type SVCParam struct {
+	Key   SVCParamKey
+	Value []byte
+}
+
+// SVCB is a DNS SVCB record. A record with a Priority of 0 is in AliasMode,
+// otherwise it is in ServiceMode.
+type SVCB struct {
+	Priority int
+	Target   string // Not compressed as per RFC 9460.
+
+	Params []SVCParam // Sorted by key.
+}
+
+// Type returns the RR type identifier.
+func (SVCB) Type() Type { return TypeSVCB }
+
+// Length returns the encoded RDATA size.
+func (s SVCB) Length(_ Compressor) (int, error) {
+	n, err := compressor{}.Length(s.Target)
+	if err != nil {
+		return 0, err
+	}
+
+	n += 2
+	for _, param := range s.Params {
+		n += 4 + len(param.Value)
+	}
+	return n, nil
+}
+
+// Pack encodes s as RDATA.
+func (s SVCB) Pack(b []byte, _ Compressor) ([]byte, error) {
+	priority := uint16(s.Priority)
+	if int(priority) != s.Priority {
+		return nil, errFieldOverflow
+	}
+
+	buf := [4]byte{}
+	nbo.PutUint16(buf[:2], priority)
+
+	b, err := compressor{}.Pack(append(b, buf[:2]...), s.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, param := range s.Params {
+		var (
+			key    = uint16(param.Key)
+			length = uint16(len(param.Value))
+		)
+
+		if int(key) != int(param.Key) {
+			return nil, errFieldOverflow
+		}
+		if int(length) != len(param.Value) {
+			return nil, errFieldOverflow
+		}
+		if i > 0 && param.Key <= s.Params[i-1].Key {
+			return nil, errSVCParamOrder
+		}
+		if err := param.checkValue(); err != nil {
+			return nil, err
+		}
+
+		nbo.PutUint16(buf[:2], key)
+		nbo.PutUint16(buf[2:], length)
+
+		b = append(append(b, buf[:]...), param.Value...)
+	}
+	return b, nil
+}
+
+// Unpack decodes s from RDATA in b.
+func (s *SVCB) Unpack(b []byte, _ Decompressor) ([]byte, error) {
+	if len(b) < 2 {
+		return nil, errResourceLen
+	}
+
+	s.Priority = int(nbo.Uint16(b[:2]))
+
+	var err error
+	if s.Target, b, err = decompressor(nil).Unpack(b[2:]); err != nil {
+		return nil, err
+	}
+
+	s.Params = s.Params[:0]
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return nil, errResourceLen
+		}
+
+		key := SVCParamKey(nbo.Uint16(b[:2]))
+		length := int(nbo.Uint16(b[2:4]))
+		if len(b) < 4+length {
+			return nil, errResourceLen
+		}
+		if n := len(s.Params); n > 0 && key <= s.Params[n-1].Key {
+			return nil, errSVCParamOrder
+		}
+
+		param := SVCParam{
+			Key:   key,
+			Value: append([]byte(nil), b[4:4+length]...),
+		}
+		if err := param.checkValue(); err != nil {
+			return nil, err
+		}
+		s.Params = append(s.Params, param)
+
+		b = b[4+length:]
+	}
 	return nil, nil
 }
+
+// Param returns the value of the service parameter key.
+func (s SVCB) Param(key SVCParamKey) ([]byte, bool) {
+	for _, param := range s.Params {
+		if param.Key == key {
+			return param.Value, true
+		}
+	}
+	return nil, false
+}
+
+// HTTPS is a DNS HTTPS record.
+type HTTPS struct {
+	SVCB
+}
+
+// Type returns the RR type identifier.
+func (HTTPS) Type() Type { return TypeHTTPS }
+
+// TSIG is a DNS TSIG record.
+type TSIG struct {
+	Algorithm  string // Not compressed as per RFC 8945.
+	TimeSigned time.Time
+	Fudge      time.Duration
+	MAC        []byte
+	OriginalID int
+	Error      RCode
+	OtherData  []byte
+}
+
+// Type returns the RR type identifier.
+func (TSIG) Type() Type { return TypeTSIG }
+
+// Length returns the encoded RDATA size.
+func (t TSIG) Length(_ Compressor) (int, error) {
+	n, err := compressor{}.Length(t.Algorithm)
+	if err != nil {
+		return 0, err
+	}
+	return n + 16 + len(t.MAC) + len(t.OtherData), nil
+}
+
+// Pack encodes t as RDATA.
+func (t TSIG) Pack(b []byte, _ Compressor) ([]byte, error) {
+	b, err := compressor{}.Pack(b, t.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if b, err = t.packTimers(b); err != nil {
+		return nil, err
+	}
+
+	var (
+		maclen = uint16(len(t.MAC))
+		id     = uint16(t.OriginalID)
+		rcode  = uint16(t.Error)
+		olen   = uint16(len(t.OtherData))
+	)
+
+	if int(maclen) != len(t.MAC) {
+		return nil, errFieldOverflow
+	}
+	if int(id) != t.OriginalID {
+		return nil, errFieldOverflow
+	}
+	if RCode(rcode) != t.Error {
+		return nil, errFieldOverflow
+	}
+	if int(olen) != len(t.OtherData) {
+		return nil, errFieldOverflow
+	}
+
+	buf := [6]byte{}
+	nbo.PutUint16(buf[:2], maclen)
+	b = append(append(b, buf[:2]...), t.MAC...)
+
+	nbo.PutUint16(buf[:2], id)
+	nbo.PutUint16(buf[2:4], rcode)
+	nbo.PutUint16(buf[4:], olen)
+
+	return append(append(b, buf[:]...), t.OtherData...), nil
+}
+
+// packTimers encodes the time signed and fudge fields of t.
+func (t TSIG) packTimers(b []byte) ([]byte, error) {
+	secs := t.TimeSigned.Unix()
+	if secs < 0 || secs >= 1<<48 {
+		return nil, errFieldOverflow
+	}
+	fudge, err := packSeconds("Fudge", t.Fudge, math.MaxUint16)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := [8]byte{}
+	nbo.PutUint16(buf[:2], uint16(secs>>32))
+	nbo.PutUint32(buf[2:6], uint32(secs))
+	nbo.PutUint16(buf[6:], uint16(fudge))
+
+	return append(b, buf[:]...), nil
+}
+
+// Unpack decodes t from RDATA in b.
+func (t *TSIG) Unpack(b []byte, _ Decompressor) ([]byte, error) {
+	var err error
+	if t.Algorithm, b, err = decompressor(nil).Unpack(b); err != nil {
+		return nil, err
+	}
+	if len(b) < 10 {
+		return nil, errResourceLen
+	}
+
+	secs := int64(nbo.Uint16(b[:2]))<<32 | int64(nbo.Uint32(b[2:6]))
+	t.TimeSigned = time.Unix(secs, 0)
+	t.Fudge = time.Duration(nbo.Uint16(b[6:8])) * time.Second
+
+	maclen := int(nbo.Uint16(b[8:10]))
+	if b = b[10:]; len(b) < maclen+6 {
+		return nil, errResourceLen
+	}
+	t.MAC = append(t.MAC[:0], b[:maclen]...)
+	b = b[maclen:]
+
+	t.OriginalID = int(nbo.Uint16(b[:2]))
+	t.Error = RCode(nbo.Uint16(b[2:4]))
+
+	olen := int(nbo.Uint16(b[4:6]))
+	if b = b[6:]; len(b) < olen {
+		return nil, errResourceLen
+	}
+	t.OtherData = append(t.OtherData[:0], b[:olen]...)
+
+	return b[olen:], nil
+}
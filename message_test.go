@@ -3,6 +3,7 @@ package dns
 import (
 	"bytes"
 	"fmt"
+	"math"
 	"net"
 	"reflect"
 	"strings"
@@ -719,136 +720,1406 @@ func TestMessagePackUnpack(t *testing.T) {
 			},
 		},
 		{
-			name: "compressed response",
+			name: ". 60 IN CAA critical",
 
 			msg: Message{
+				ID:       0x109,
 				Response: true,
+				Questions: []Question{
+					{
+						Name:  ".",
+						Type:  TypeCAA,
+						Class: ClassIN,
+					},
+				},
 				Answers: []Resource{
 					{
-						Name:  "example.com.",
+						Name:  ".",
 						Class: ClassIN,
 						TTL:   60 * time.Second,
-						Record: &A{
-							A: net.IPv4(127, 0, 0, 1).To4(),
+						Record: &CAA{
+							IssuerCritical: true,
+							Tag:            "tbs",
+							Value:          "Unknown",
 						},
 					},
 				},
+			},
+
+			raw: []byte{
+				0x01, 0x09, // ID=0x0109
+				0x80, 0x00, // RD=1
+				0x00, 0x01, // QDCOUNT=1
+				0x00, 0x01, // ANCOUNT=1
+				0x00, 0x00, // NSCOUNT=0
+				0x00, 0x00, // ARCOUNT=0
+
+				0x00, 0x01, 0x01, 0x00, 0x01, // .      IN      CAA
+
+				// .    60      IN      128 tbs "Unknown"
+				0x00,
+				0x01, 0x01, 0x00, 0x01, // TYPE=CAA,CLASS=IN
+				0x00, 0x00, 0x00, 0x3C, // TTL=60
+				0x00, 0x0C,
+
+				0x80, 0x03,
+				't', 'b', 's',
+				'U', 'n', 'k', 'n', 'o', 'w', 'n',
+			},
+		},
+		{
+			name: ".	60	IN	ZONEMD",
+
+			msg: Message{
+				ID:       0x10A,
+				Response: true,
 				Questions: []Question{
 					{
-						Name:  "example.com.",
-						Type:  TypeA,
+						Name:  ".",
+						Type:  TypeZONEMD,
 						Class: ClassIN,
 					},
 				},
+				Answers: []Resource{
+					{
+						Name:  ".",
+						Class: ClassIN,
+						TTL:   60 * time.Second,
+						Record: &ZONEMD{
+							Serial: 2018031900,
+							Scheme: ZONEMDSchemeSimple,
+							Hash:   ZONEMDHashSHA384,
+							Digest: []byte{0xC6, 0x80, 0x90, 0xD9},
+						},
+					},
+				},
 			},
-			compress: true,
-			buf:      make([]byte, 2),
 
 			raw: []byte{
-				0x00, 0x00, // ID=0x0001
+				0x01, 0x0A, // ID=0x010A
 				0x80, 0x00, // QR=1
 				0x00, 0x01, // QDCOUNT=1
 				0x00, 0x01, // ANCOUNT=1
 				0x00, 0x00, // NSCOUNT=0
 				0x00, 0x00, // ARCOUNT=0
 
-				// example.com.	IN	A
-				0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e',
-				0x03, 'c', 'o', 'm',
+				0x00, 0x00, 0x3F, 0x00, 0x01, // .	IN	ZONEMD
+
+				// .	60	IN	ZONEMD	2018031900 1 1 c68090d9
 				0x00,
-				0x00, 0x01, 0x00, 0x01, // TYPE=A,CLASS=IN
+				0x00, 0x3F, 0x00, 0x01, // TYPE=ZONEMD,CLASS=IN
+				0x00, 0x00, 0x00, 0x3C, // TTL=60
+				0x00, 0x0A, // RDLENGTH=10
 
-				// example.com	60	IN A 127.0.0.1
-				0xC0, 0x0C,
-				0x00, 0x01, 0x00, 0x01, // TYPE=TXT,CLASS=IN
+				0x78, 0x48, 0xB9, 0x1C, // SERIAL=2018031900
+				0x01,                   // SCHEME=SIMPLE
+				0x01,                   // HASH=SHA384
+				0xC6, 0x80, 0x90, 0xD9, // DIGEST
+			},
+		},
+		{
+			name: ".	60	IN	HINFO",
+
+			msg: Message{
+				ID:       0x10C,
+				Response: true,
+				Questions: []Question{
+					{
+						Name:  ".",
+						Type:  TypeALL,
+						Class: ClassIN,
+					},
+				},
+				Answers: []Resource{
+					{
+						Name:  ".",
+						Class: ClassIN,
+						TTL:   60 * time.Second,
+						Record: &HINFO{
+							CPU: "RFC8482",
+						},
+					},
+				},
+			},
+
+			raw: []byte{
+				0x01, 0x0C, // ID=0x010C
+				0x80, 0x00, // RD=1
+				0x00, 0x01, // QDCOUNT=1
+				0x00, 0x01, // ANCOUNT=1
+				0x00, 0x00, // NSCOUNT=0
+				0x00, 0x00, // ARCOUNT=0
+
+				0x00, 0x00, 0xFF, 0x00, 0x01, // .	IN	ANY
+
+				0x00, 0x00, 0x0D, 0x00, 0x01, // TYPE=HINFO,CLASS=IN
 				0x00, 0x00, 0x00, 0x3C, // TTL=60
-				0x00, 0x04, // RDLENGTH=5
+				0x00, 0x09,
 
-				0x7F, 0x00, 0x00, 0x01, // 127.0.0.1
+				0x07, 'R', 'F', 'C', '8', '4', '8', '2', // CPU
+				0x00, // OS
 			},
 		},
 		{
-			name: ".	IN	AAAA + OPT",
+			name: ".	60	IN	RP",
 
 			msg: Message{
-				ID:               0x1001,
-				RecursionDesired: true,
+				ID:       0x10C,
+				Response: true,
 				Questions: []Question{
 					{
 						Name:  ".",
-						Type:  TypeAAAA,
+						Type:  TypeRP,
 						Class: ClassIN,
 					},
 				},
-				Additionals: []Resource{
+				Answers: []Resource{
 					{
 						Name:  ".",
-						Class: 1280,
-						TTL:   0,
-						Record: &OPT{
-							Options: []edns.Option{
-								edns.Option{
-									Code: edns.OptionCodeCookie,
-									Data: []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07},
-								},
-							},
+						Class: ClassIN,
+						TTL:   60 * time.Second,
+						Record: &RP{
+							MBox: "admin.",
+							TXT:  ".",
 						},
 					},
 				},
 			},
 
 			raw: []byte{
-				0x10, 0x01, // ID=0x1001
-				0x01, 0x00, // RD=1
+				0x01, 0x0C, // ID=0x010C
+				0x80, 0x00, // RD=1
 				0x00, 0x01, // QDCOUNT=1
-				0x00, 0x00, // ANCOUNT=0
+				0x00, 0x01, // ANCOUNT=1
 				0x00, 0x00, // NSCOUNT=0
-				0x00, 0x01, // ARCOUNT=1
+				0x00, 0x00, // ARCOUNT=0
 
-				0x00, 0x00, 0x1C, 0x00, 0x01, // .	IN	AAAA
-				0x00, 0x00, 0x29, // . OPT ...
-				0x05, 0x00, // CLASS=1280 (UDP MTU)
-				0x00, 0x00, 0x00, 0x00, // ex-rcode+flags
-				0x00, 0x0C, // RDLENGTH=12
+				0x00, 0x00, 0x11, 0x00, 0x01, // .	IN	RP
 
-				0x00, 0x0A, // OPTION-CODE = 10
-				0x00, 0x08, // OPTION-LENGTH = 8
-				0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, // Client Cookie (fixed size, 8 bytes)
+				0x00, 0x00, 0x11, 0x00, 0x01, // TYPE=RP,CLASS=IN
+				0x00, 0x00, 0x00, 0x3C, // TTL=60
+				0x00, 0x08,
+
+				0x05, 'a', 'd', 'm', 'i', 'n', 0x00,
+				0x00,
+			},
+		},
+		{
+			name: ".	60	IN	AFSDB",
+
+			msg: Message{
+				ID:       0x10D,
+				Response: true,
+				Questions: []Question{
+					{
+						Name:  ".",
+						Type:  TypeAFSDB,
+						Class: ClassIN,
+					},
+				},
+				Answers: []Resource{
+					{
+						Name:  ".",
+						Class: ClassIN,
+						TTL:   60 * time.Second,
+						Record: &AFSDB{
+							Subtype:  1,
+							Hostname: "afs.",
+						},
+					},
+				},
+			},
+
+			raw: []byte{
+				0x01, 0x0D, // ID=0x010D
+				0x80, 0x00, // RD=1
+				0x00, 0x01, // QDCOUNT=1
+				0x00, 0x01, // ANCOUNT=1
+				0x00, 0x00, // NSCOUNT=0
+				0x00, 0x00, // ARCOUNT=0
+
+				0x00, 0x00, 0x12, 0x00, 0x01, // .	IN	AFSDB
+
+				0x00, 0x00, 0x12, 0x00, 0x01, // TYPE=AFSDB,CLASS=IN
+				0x00, 0x00, 0x00, 0x3C, // TTL=60
+				0x00, 0x07,
+
+				0x00, 0x01,
+				0x03, 'a', 'f', 's',
+				0x00,
+			},
+		},
+		{
+			name: ".	60	IN	URI",
+
+			msg: Message{
+				ID:       0x10E,
+				Response: true,
+				Questions: []Question{
+					{
+						Name:  ".",
+						Type:  TypeURI,
+						Class: ClassIN,
+					},
+				},
+				Answers: []Resource{
+					{
+						Name:  ".",
+						Class: ClassIN,
+						TTL:   60 * time.Second,
+						Record: &URI{
+							Priority: 10,
+							Weight:   1,
+							Target:   "ftp://ftp1.example.com/public",
+						},
+					},
+				},
+			},
+
+			raw: []byte{
+				0x01, 0x0E, // ID=0x010E
+				0x80, 0x00, // RD=1
+				0x00, 0x01, // QDCOUNT=1
+				0x00, 0x01, // ANCOUNT=1
+				0x00, 0x00, // NSCOUNT=0
+				0x00, 0x00, // ARCOUNT=0
+
+				0x00, 0x01, 0x00, 0x00, 0x01, // .	IN	URI
+
+				0x00, 0x01, 0x00, 0x00, 0x01, // TYPE=URI,CLASS=IN
+				0x00, 0x00, 0x00, 0x3C, // TTL=60
+				0x00, 0x21,
+
+				0x00, 0x0A, // PRIORITY=10
+				0x00, 0x01, // WEIGHT=1
+				'f', 't', 'p', ':', '/', '/', 'f', 't', 'p', '1', '.',
+				'e', 'x', 'a', 'm', 'p', 'l', 'e', '.', 'c', 'o', 'm',
+				'/', 'p', 'u', 'b', 'l', 'i', 'c',
+			},
+		},
+		{
+			name: ".	60	IN	NAPTR",
+
+			msg: Message{
+				ID:       0x10F,
+				Response: true,
+				Questions: []Question{
+					{
+						Name:  ".",
+						Type:  TypeNAPTR,
+						Class: ClassIN,
+					},
+				},
+				Answers: []Resource{
+					{
+						Name:  ".",
+						Class: ClassIN,
+						TTL:   60 * time.Second,
+						Record: &NAPTR{
+							Order:       100,
+							Preference:  10,
+							Flags:       "u",
+							Service:     "E2U+sip",
+							Regexp:      "!^.*$!sip:info@example.com!",
+							Replacement: ".",
+						},
+					},
+				},
+			},
+
+			raw: []byte{
+				0x01, 0x0F, // ID=0x010F
+				0x80, 0x00, // RD=1
+				0x00, 0x01, // QDCOUNT=1
+				0x00, 0x01, // ANCOUNT=1
+				0x00, 0x00, // NSCOUNT=0
+				0x00, 0x00, // ARCOUNT=0
+
+				0x00, 0x00, 0x23, 0x00, 0x01, // .	IN	NAPTR
+
+				0x00, 0x00, 0x23, 0x00, 0x01, // TYPE=NAPTR,CLASS=IN
+				0x00, 0x00, 0x00, 0x3C, // TTL=60
+				0x00, 0x2B,
+
+				0x00, 0x64, // ORDER=100
+				0x00, 0x0A, // PREFERENCE=10
+				0x01, 'u', // FLAGS="u"
+				0x07, 'E', '2', 'U', '+', 's', 'i', 'p', // SERVICE="E2U+sip"
+				0x1B, // REGEXP
+				'!', '^', '.', '*', '$', '!', 's', 'i', 'p', ':', 'i', 'n', 'f', 'o', '@', 'e', 'x', 'a', 'm', 'p', 'l', 'e', '.', 'c', 'o', 'm', '!',
+				0x00, // REPLACEMENT=.
+			},
+		},
+		{
+			name: ".	60	IN	CERT",
+
+			msg: Message{
+				ID:       0x10F,
+				Response: true,
+				Questions: []Question{
+					{
+						Name:  ".",
+						Type:  TypeCERT,
+						Class: ClassIN,
+					},
+				},
+				Answers: []Resource{
+					{
+						Name:  ".",
+						Class: ClassIN,
+						TTL:   60 * time.Second,
+						Record: &CERT{
+							CertType:    CertPGP,
+							KeyTag:      0x1234,
+							Algorithm:   8,
+							Certificate: []byte{0xDE, 0xAD, 0xBE, 0xEF},
+						},
+					},
+				},
+			},
+
+			raw: []byte{
+				0x01, 0x0F, // ID=0x010F
+				0x80, 0x00, // RD=1
+				0x00, 0x01, // QDCOUNT=1
+				0x00, 0x01, // ANCOUNT=1
+				0x00, 0x00, // NSCOUNT=0
+				0x00, 0x00, // ARCOUNT=0
+
+				0x00, 0x00, 0x25, 0x00, 0x01, // .	IN	CERT
+
+				0x00, 0x00, 0x25, 0x00, 0x01, // TYPE=CERT,CLASS=IN
+				0x00, 0x00, 0x00, 0x3C, // TTL=60
+				0x00, 0x09,
+
+				0x00, 0x03, // TYPE=PGP
+				0x12, 0x34, // KEY TAG=0x1234
+				0x08,                   // ALGORITHM=RSASHA256
+				0xDE, 0xAD, 0xBE, 0xEF, // CERTIFICATE
 			},
 		},
+		{
+			name: ".	60	IN	LOC",
+
+			msg: Message{
+				ID:       0x10F,
+				Response: true,
+				Questions: []Question{
+					{
+						Name:  ".",
+						Type:  TypeLOC,
+						Class: ClassIN,
+					},
+				},
+				Answers: []Resource{
+					{
+						Name:  ".",
+						Class: ClassIN,
+						TTL:   60 * time.Second,
+						Record: &LOC{
+							Latitude:  42.5,
+							Longitude: -71.25,
+							Altitude:  -24,
+							Size:      1,
+							HorizPre:  10000,
+							VertPre:   10,
+						},
+					},
+				},
+			},
+
+			raw: []byte{
+				0x01, 0x0F, // ID=0x010F
+				0x80, 0x00, // RD=1
+				0x00, 0x01, // QDCOUNT=1
+				0x00, 0x01, // ANCOUNT=1
+				0x00, 0x00, // NSCOUNT=0
+				0x00, 0x00, // ARCOUNT=0
+
+				0x00, 0x00, 0x1D, 0x00, 0x01, // .	IN	LOC
+
+				0x00, 0x00, 0x1D, 0x00, 0x01, // TYPE=LOC,CLASS=IN
+				0x00, 0x00, 0x00, 0x3C, // TTL=60
+				0x00, 0x10,
+
+				0x00,                   // VERSION=0
+				0x12,                   // SIZE=1e2cm
+				0x16,                   // HORIZ PRE=1e6cm
+				0x13,                   // VERT PRE=1e3cm
+				0x89, 0x1E, 0x98, 0x40, // LATITUDE=42.5N
+				0x70, 0xB6, 0x1E, 0xE0, // LONGITUDE=71.25W
+				0x00, 0x98, 0x8D, 0x20, // ALTITUDE=-24m
+			},
+		},
+		{
+			name: ".	60	IN	TLSA",
+
+			msg: Message{
+				ID:       0x10F,
+				Response: true,
+				Questions: []Question{
+					{
+						Name:  ".",
+						Type:  TypeTLSA,
+						Class: ClassIN,
+					},
+				},
+				Answers: []Resource{
+					{
+						Name:  ".",
+						Class: ClassIN,
+						TTL:   60 * time.Second,
+						Record: &TLSA{
+							Usage:        TLSAUsageDANEEE,
+							Selector:     TLSASelectorSPKI,
+							MatchingType: TLSAMatchingSHA256,
+							Data:         []byte{0xDE, 0xAD, 0xBE, 0xEF},
+						},
+					},
+				},
+			},
+
+			raw: []byte{
+				0x01, 0x0F, // ID=0x010F
+				0x80, 0x00, // RD=1
+				0x00, 0x01, // QDCOUNT=1
+				0x00, 0x01, // ANCOUNT=1
+				0x00, 0x00, // NSCOUNT=0
+				0x00, 0x00, // ARCOUNT=0
+
+				0x00, 0x00, 0x34, 0x00, 0x01, // .	IN	TLSA
+
+				0x00, 0x00, 0x34, 0x00, 0x01, // TYPE=TLSA,CLASS=IN
+				0x00, 0x00, 0x00, 0x3C, // TTL=60
+				0x00, 0x07,
+
+				0x03,                   // USAGE=DANE-EE
+				0x01,                   // SELECTOR=SPKI
+				0x01,                   // MATCHING TYPE=SHA-256
+				0xDE, 0xAD, 0xBE, 0xEF, // CERTIFICATE ASSOCIATION DATA
+			},
+		},
+		{
+			name: ".	60	IN	TYPE65280",
+
+			msg: Message{
+				ID:       0x112,
+				Response: true,
+				Questions: []Question{
+					{
+						Name:  ".",
+						Type:  65280,
+						Class: ClassIN,
+					},
+				},
+				Answers: []Resource{
+					{
+						Name:  ".",
+						Class: ClassIN,
+						TTL:   60 * time.Second,
+						Record: &RawRecord{
+							RRType: 65280,
+							Data:   []byte{0xDE, 0xAD, 0xBE, 0xEF},
+						},
+					},
+				},
+			},
+
+			raw: []byte{
+				0x01, 0x12, // ID=0x0112
+				0x80, 0x00, // RD=1
+				0x00, 0x01, // QDCOUNT=1
+				0x00, 0x01, // ANCOUNT=1
+				0x00, 0x00, // NSCOUNT=0
+				0x00, 0x00, // ARCOUNT=0
+
+				0x00, 0xFF, 0x00, 0x00, 0x01, // .	IN	TYPE65280
+
+				0x00, 0xFF, 0x00, 0x00, 0x01, // TYPE=TYPE65280,CLASS=IN
+				0x00, 0x00, 0x00, 0x3C, // TTL=60
+				0x00, 0x04,
+
+				0xDE, 0xAD, 0xBE, 0xEF, // RDATA
+			},
+		},
+		{
+			name: ".	60	IN	SMIMEA",
+
+			msg: Message{
+				ID:       0x111,
+				Response: true,
+				Questions: []Question{
+					{
+						Name:  ".",
+						Type:  TypeSMIMEA,
+						Class: ClassIN,
+					},
+				},
+				Answers: []Resource{
+					{
+						Name:  ".",
+						Class: ClassIN,
+						TTL:   60 * time.Second,
+						Record: &SMIMEA{
+							Usage:        TLSAUsagePKIXTA,
+							Selector:     TLSASelectorCert,
+							MatchingType: TLSAMatchingSHA512,
+							Data:         []byte{0xDE, 0xAD, 0xBE, 0xEF},
+						},
+					},
+				},
+			},
+
+			raw: []byte{
+				0x01, 0x11, // ID=0x0111
+				0x80, 0x00, // RD=1
+				0x00, 0x01, // QDCOUNT=1
+				0x00, 0x01, // ANCOUNT=1
+				0x00, 0x00, // NSCOUNT=0
+				0x00, 0x00, // ARCOUNT=0
+
+				0x00, 0x00, 0x35, 0x00, 0x01, // .	IN	SMIMEA
+
+				0x00, 0x00, 0x35, 0x00, 0x01, // TYPE=SMIMEA,CLASS=IN
+				0x00, 0x00, 0x00, 0x3C, // TTL=60
+				0x00, 0x07,
+
+				0x00,                   // USAGE=PKIX-TA
+				0x00,                   // SELECTOR=Cert
+				0x02,                   // MATCHING TYPE=SHA-512
+				0xDE, 0xAD, 0xBE, 0xEF, // CERTIFICATE ASSOCIATION DATA
+			},
+		},
+		{
+			name: ".	60	IN	OPENPGPKEY",
+
+			msg: Message{
+				ID:       0x110,
+				Response: true,
+				Questions: []Question{
+					{
+						Name:  ".",
+						Type:  TypeOPENPGPKEY,
+						Class: ClassIN,
+					},
+				},
+				Answers: []Resource{
+					{
+						Name:  ".",
+						Class: ClassIN,
+						TTL:   60 * time.Second,
+						Record: &OPENPGPKEY{
+							PublicKey: []byte{0x99, 0x01, 0x0D, 0x04},
+						},
+					},
+				},
+			},
+
+			raw: []byte{
+				0x01, 0x10, // ID=0x0110
+				0x80, 0x00, // RD=1
+				0x00, 0x01, // QDCOUNT=1
+				0x00, 0x01, // ANCOUNT=1
+				0x00, 0x00, // NSCOUNT=0
+				0x00, 0x00, // ARCOUNT=0
+
+				0x00, 0x00, 0x3D, 0x00, 0x01, // .	IN	OPENPGPKEY
+
+				0x00, 0x00, 0x3D, 0x00, 0x01, // TYPE=OPENPGPKEY,CLASS=IN
+				0x00, 0x00, 0x00, 0x3C, // TTL=60
+				0x00, 0x04,
+
+				0x99, 0x01, 0x0D, 0x04, // PUBLIC KEY
+			},
+		},
+		{
+			name: "example.com.	300	IN	HTTPS",
+
+			msg: Message{
+				ID:       0x010B,
+				Response: true,
+				Questions: []Question{
+					{
+						Name:  "example.com.",
+						Type:  TypeHTTPS,
+						Class: ClassIN,
+					},
+				},
+				Answers: []Resource{
+					{
+						Name:  "example.com.",
+						Class: ClassIN,
+						TTL:   300 * time.Second,
+						Record: &HTTPS{
+							SVCB{
+								Priority: 1,
+								Target:   ".",
+								Params: []SVCParam{
+									{Key: SVCParamALPN, Value: []byte("\x02h2\x02h3")},
+									{Key: SVCParamPort, Value: []byte{0x20, 0xFB}},
+								},
+							},
+						},
+					},
+				},
+			},
+
+			raw: []byte{
+				0x01, 0x0B, // ID=0x010B
+				0x80, 0x00, // QR=1
+				0x00, 0x01, // QDCOUNT=1
+				0x00, 0x01, // ANCOUNT=1
+				0x00, 0x00, // NSCOUNT=0
+				0x00, 0x00, // ARCOUNT=0
+
+				0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0x03, 'c', 'o', 'm', 0x00,
+				0x00, 0x41, 0x00, 0x01, // example.com.	IN	HTTPS
+
+				// example.com.	300	IN	HTTPS	1 . alpn=h2,h3 port=8443
+				0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0x03, 'c', 'o', 'm', 0x00,
+				0x00, 0x41, 0x00, 0x01, // TYPE=HTTPS,CLASS=IN
+				0x00, 0x00, 0x01, 0x2C, // TTL=300
+				0x00, 0x13, // RDLENGTH=19
+
+				0x00, 0x01, // PRIORITY=1
+				0x00,                                                   // TARGET=.
+				0x00, 0x01, 0x00, 0x06, 0x02, 'h', '2', 0x02, 'h', '3', // alpn=h2,h3
+				0x00, 0x03, 0x00, 0x02, 0x20, 0xFB, // port=8443
+			},
+		},
+		{
+			name: "compressed response",
+
+			msg: Message{
+				Response: true,
+				Answers: []Resource{
+					{
+						Name:  "example.com.",
+						Class: ClassIN,
+						TTL:   60 * time.Second,
+						Record: &A{
+							A: net.IPv4(127, 0, 0, 1).To4(),
+						},
+					},
+				},
+				Questions: []Question{
+					{
+						Name:  "example.com.",
+						Type:  TypeA,
+						Class: ClassIN,
+					},
+				},
+			},
+			compress: true,
+			buf:      make([]byte, 2),
+
+			raw: []byte{
+				0x00, 0x00, // ID=0x0001
+				0x80, 0x00, // QR=1
+				0x00, 0x01, // QDCOUNT=1
+				0x00, 0x01, // ANCOUNT=1
+				0x00, 0x00, // NSCOUNT=0
+				0x00, 0x00, // ARCOUNT=0
+
+				// example.com.	IN	A
+				0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e',
+				0x03, 'c', 'o', 'm',
+				0x00,
+				0x00, 0x01, 0x00, 0x01, // TYPE=A,CLASS=IN
+
+				// example.com	60	IN A 127.0.0.1
+				0xC0, 0x0C,
+				0x00, 0x01, 0x00, 0x01, // TYPE=TXT,CLASS=IN
+				0x00, 0x00, 0x00, 0x3C, // TTL=60
+				0x00, 0x04, // RDLENGTH=5
+
+				0x7F, 0x00, 0x00, 0x01, // 127.0.0.1
+			},
+		},
+		{
+			name: ".	IN	AAAA + OPT",
+
+			msg: Message{
+				ID:               0x1001,
+				RecursionDesired: true,
+				Questions: []Question{
+					{
+						Name:  ".",
+						Type:  TypeAAAA,
+						Class: ClassIN,
+					},
+				},
+				Additionals: []Resource{
+					{
+						Name:  ".",
+						Class: 1280,
+						TTL:   0,
+						Record: &OPT{
+							Options: []edns.Option{
+								edns.Option{
+									Code: edns.OptionCodeCookie,
+									Data: []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07},
+								},
+							},
+						},
+					},
+				},
+			},
+
+			raw: []byte{
+				0x10, 0x01, // ID=0x1001
+				0x01, 0x00, // RD=1
+				0x00, 0x01, // QDCOUNT=1
+				0x00, 0x00, // ANCOUNT=0
+				0x00, 0x00, // NSCOUNT=0
+				0x00, 0x01, // ARCOUNT=1
+
+				0x00, 0x00, 0x1C, 0x00, 0x01, // .	IN	AAAA
+				0x00, 0x00, 0x29, // . OPT ...
+				0x05, 0x00, // CLASS=1280 (UDP MTU)
+				0x00, 0x00, 0x00, 0x00, // ex-rcode+flags
+				0x00, 0x0C, // RDLENGTH=12
+
+				0x00, 0x0A, // OPTION-CODE = 10
+				0x00, 0x08, // OPTION-LENGTH = 8
+				0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, // Client Cookie (fixed size, 8 bytes)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(string(test.name), func(t *testing.T) {
+			t.Parallel()
+
+			raw, err := test.msg.Pack(test.buf, test.compress)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want, got := append(test.buf, test.raw...), raw; !bytes.Equal(want, got) {
+				t.Errorf("want raw message %+v, got %+v", want, got)
+			}
+
+			msg := new(Message)
+			buf, err := msg.Unpack(raw[len(test.buf):])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(buf) > 0 {
+				t.Errorf("left-over data after unpack: %x", buf)
+			}
+
+			if want, got := test.msg, *msg; !reflect.DeepEqual(want, got) {
+				t.Errorf("want message %+v, got %+v", want, got)
+			}
+		})
+	}
+}
+
+func TestMessageUnpackWith(t *testing.T) {
+	t.Parallel()
+
+	pack := func(msg *Message) []byte {
+		buf, err := msg.Pack(nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return buf
+	}
+
+	answer := Resource{
+		Name:   "example.com.",
+		Class:  ClassIN,
+		TTL:    time.Minute,
+		Record: &A{A: net.IPv4(192, 0, 2, 1).To4()},
+	}
+
+	valid := pack(&Message{
+		Questions: []Question{{Name: "example.com.", Type: TypeA, Class: ClassIN}},
+		Answers:   []Resource{answer, answer},
+	})
+
+	badClass := pack(&Message{
+		Questions: []Question{{Name: "example.com.", Type: TypeA, Class: Class(42)}},
+	})
+
+	longName := pack(&Message{
+		Questions: []Question{{Name: strings.Repeat(strings.Repeat("a", 63)+".", 4), Type: TypeA, Class: ClassIN}},
+	})
+
+	tests := []struct {
+		name string
+
+		raw  []byte
+		opts UnpackOptions
+
+		err     error
+		answers int
+		rest    int
+	}{
+		{
+			name:    "valid",
+			raw:     valid,
+			opts:    UnpackOptions{Strict: true},
+			answers: 2,
+		},
+		{
+			name:    "trailing-bytes",
+			raw:     append(valid[:len(valid):len(valid)], 0xFF, 0xFF),
+			answers: 2,
+			rest:    2,
+		},
+		{
+			name: "trailing-bytes-strict",
+			raw:  append(valid[:len(valid):len(valid)], 0xFF, 0xFF),
+			opts: UnpackOptions{Strict: true},
+			err:  errTrailingBytes,
+		},
+		{
+			name: "truncated",
+			raw:  valid[:len(valid)-4],
+			err:  errResourceLen,
+		},
+		{
+			name:    "truncated-partial",
+			raw:     valid[:len(valid)-4],
+			opts:    UnpackOptions{Partial: true},
+			answers: 1,
+		},
+		{
+			name: "bad-class",
+			raw:  badClass,
+		},
+		{
+			name: "bad-class-strict",
+			raw:  badClass,
+			opts: UnpackOptions{Strict: true},
+			err:  errInvalidClass,
+		},
+		{
+			name: "long-name",
+			raw:  longName,
+		},
+		{
+			name: "long-name-strict",
+			raw:  longName,
+			opts: UnpackOptions{Strict: true},
+			err:  errNameTooLong,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			msg := new(Message)
+			buf, err := msg.UnpackWith(test.raw, test.opts)
+			if want, got := test.err, err; want != got {
+				t.Fatalf("want error %v, got %v", want, got)
+			}
+			if err != nil {
+				return
+			}
+
+			if want, got := test.answers, len(msg.Answers); want != got {
+				t.Errorf("want %d answers, got %d", want, got)
+			}
+			if want, got := test.rest, len(buf); want != got {
+				t.Errorf("want %d unused bytes, got %d", want, got)
+			}
+		})
+	}
+}
+
+func TestMessageUnpackLimits(t *testing.T) {
+	t.Parallel()
+
+	name := strings.Repeat(strings.Repeat("a", 63)+".", 3)
+	answers := make([]Resource, 10)
+	for i := range answers {
+		answers[i] = Resource{
+			Name:   name,
+			Class:  ClassIN,
+			TTL:    time.Minute,
+			Record: &CNAME{CNAME: name},
+		}
+	}
+
+	raw, err := (&Message{
+		Questions: []Question{{Name: name, Type: TypeCNAME, Class: ClassIN}},
+		Answers:   answers,
+	}).Pack(nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+
+		opts UnpackOptions
+
+		err error
+	}{
+		{
+			name: "unlimited",
+		},
+		{
+			name: "within-limits",
+
+			opts: UnpackOptions{
+				MaxMessageLen:     len(raw),
+				MaxSectionRecords: 10,
+				MaxNameBytes:      21 * len(name),
+			},
+		},
+		{
+			name: "message-length",
+
+			opts: UnpackOptions{MaxMessageLen: 256},
+
+			err: &LimitError{Limit: "message length", Value: len(raw), Max: 256},
+		},
+		{
+			name: "section-records",
+
+			opts: UnpackOptions{MaxSectionRecords: 8},
+
+			err: &LimitError{Limit: "section records", Value: 10, Max: 8},
+		},
+		{
+			name: "name-bytes",
+
+			opts: UnpackOptions{MaxNameBytes: 1000},
+
+			err: &LimitError{Limit: "name bytes", Value: 6 * len(name), Max: 1000},
+		},
+		{
+			name: "name-bytes-partial",
+
+			opts: UnpackOptions{Partial: true, MaxNameBytes: 1000},
+
+			err: &LimitError{Limit: "name bytes", Value: 6 * len(name), Max: 1000},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := new(Message).UnpackWith(raw, test.opts)
+			if want, got := test.err, err; !reflect.DeepEqual(want, got) {
+				t.Errorf("want error %v, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestMessageUnpackCounts(t *testing.T) {
+	t.Parallel()
+
+	// A header claiming the maximum number of records in each section,
+	// followed by a single question.
+	raw := []byte{
+		0x00, 0x00, 0x00, 0x00,
+		0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+		0x00, 0x00, 0x01, 0x00, 0x01,
+	}
+
+	msg := new(Message)
+	if _, err := msg.UnpackWith(raw, UnpackOptions{Partial: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := 1, len(msg.Questions); want != got {
+		t.Errorf("want %d questions, got %d", want, got)
+	}
+	if got := cap(msg.Questions) + cap(msg.Answers) + cap(msg.Authorities) + cap(msg.Additionals); got > 4 {
+		t.Errorf("want section capacity bounded by message length, got %d", got)
+	}
+}
+
+func TestMessageUnpackCompressedRDATA(t *testing.T) {
+	t.Parallel()
+
+	// response in the style of BIND, with compression pointers in the RDATA
+	// names of MX, SOA, SRV, CNAME & PTR records.
+	raw := []byte{
+		0xBE, 0xEF, // ID=0xBEEF
+		0x85, 0x80, // QR=1,AA=1,RD=1,RA=1
+		0x00, 0x01, // QDCOUNT=1
+		0x00, 0x02, // ANCOUNT=2
+		0x00, 0x01, // NSCOUNT=1
+		0x00, 0x04, // ARCOUNT=4
+
+		// example.com.	IN	MX
+		0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0x03, 'c', 'o', 'm', 0x00,
+		0x00, 0x0F, 0x00, 0x01,
+
+		// example.com.	3600	IN	MX	10 mail.example.com.
+		0xC0, 0x0C,
+		0x00, 0x0F, 0x00, 0x01, 0x00, 0x00, 0x0E, 0x10, 0x00, 0x09,
+		0x00, 0x0A, 0x04, 'm', 'a', 'i', 'l', 0xC0, 0x0C,
+
+		// example.com.	3600	IN	MX	20 mx2.mail.example.com.
+		0xC0, 0x0C,
+		0x00, 0x0F, 0x00, 0x01, 0x00, 0x00, 0x0E, 0x10, 0x00, 0x08,
+		0x00, 0x14, 0x03, 'm', 'x', '2', 0xC0, 0x2B,
+
+		// example.com.	3600	IN	SOA	ns1.example.com. hostmaster.example.com. ...
+		0xC0, 0x0C,
+		0x00, 0x06, 0x00, 0x01, 0x00, 0x00, 0x0E, 0x10, 0x00, 0x27,
+		0x03, 'n', 's', '1', 0xC0, 0x0C,
+		0x0A, 'h', 'o', 's', 't', 'm', 'a', 's', 't', 'e', 'r', 0xC0, 0x0C,
+		0x78, 0xA3, 0xF1, 0x75, // SERIAL=2024010101
+		0x00, 0x00, 0x1C, 0x20, // REFRESH=7200
+		0x00, 0x00, 0x0E, 0x10, // RETRY=3600
+		0x00, 0x12, 0x75, 0x00, // EXPIRE=1209600
+		0x00, 0x00, 0x01, 0x2C, // MINIMUM=300
+
+		// mail.example.com.	3600	IN	A	192.0.2.25
+		0xC0, 0x2B,
+		0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x0E, 0x10, 0x00, 0x04,
+		0xC0, 0x00, 0x02, 0x19,
+
+		// _sip._udp.example.com.	3600	IN	SRV	10 60 5060 ns1.example.com.
+		0x04, '_', 's', 'i', 'p', 0x04, '_', 'u', 'd', 'p', 0xC0, 0x0C,
+		0x00, 0x21, 0x00, 0x01, 0x00, 0x00, 0x0E, 0x10, 0x00, 0x08,
+		0x00, 0x0A, 0x00, 0x3C, 0x13, 0xC4, 0xC0, 0x52,
+
+		// www.example.com.	3600	IN	CNAME	mail.example.com.
+		0x03, 'w', 'w', 'w', 0xC0, 0x0C,
+		0x00, 0x05, 0x00, 0x01, 0x00, 0x00, 0x0E, 0x10, 0x00, 0x02,
+		0xC0, 0x2B,
+
+		// ptr.example.com.	3600	IN	PTR	ns1.example.com.
+		0x03, 'p', 't', 'r', 0xC0, 0x0C,
+		0x00, 0x0C, 0x00, 0x01, 0x00, 0x00, 0x0E, 0x10, 0x00, 0x02,
+		0xC0, 0x52,
+	}
+
+	rr := func(name string, rec Record) Resource {
+		return Resource{Name: name, Class: ClassIN, TTL: time.Hour, Record: rec}
+	}
+
+	want := Message{
+		ID:                 0xBEEF,
+		Response:           true,
+		Authoritative:      true,
+		RecursionDesired:   true,
+		RecursionAvailable: true,
+		Questions: []Question{
+			{Name: "example.com.", Type: TypeMX, Class: ClassIN},
+		},
+		Answers: []Resource{
+			rr("example.com.", &MX{Pref: 10, MX: "mail.example.com."}),
+			rr("example.com.", &MX{Pref: 20, MX: "mx2.mail.example.com."}),
+		},
+		Authorities: []Resource{
+			rr("example.com.", &SOA{
+				NS:      "ns1.example.com.",
+				MBox:    "hostmaster.example.com.",
+				Serial:  2024010101,
+				Refresh: 2 * time.Hour,
+				Retry:   time.Hour,
+				Expire:  14 * 24 * time.Hour,
+				MinTTL:  5 * time.Minute,
+			}),
+		},
+		Additionals: []Resource{
+			rr("mail.example.com.", &A{A: net.IP{192, 0, 2, 25}}),
+			rr("_sip._udp.example.com.", &SRV{Priority: 10, Weight: 60, Port: 5060, Target: "ns1.example.com."}),
+			rr("www.example.com.", &CNAME{CNAME: "mail.example.com."}),
+			rr("ptr.example.com.", &PTR{PTR: "ns1.example.com."}),
+		},
+	}
+
+	var got Message
+	buf, err := got.Unpack(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buf) > 0 {
+		t.Errorf("left-over data after unpack: %x", buf)
+	}
+
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want message %+v, got %+v", want, got)
+	}
+}
+
+func TestMessageUnpackInto(t *testing.T) {
+	msg := largeTestMsg()
+	first, err := msg.Pack(nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg = largeTestMsg()
+	msg.Answers[0].Record = &TXT{TXT: []string{"changed"}}
+	msg.Answers[1].Record = &A{A: net.IPv4(192, 0, 2, 1).To4()}
+	second, err := msg.Pack(nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got Message
+	if _, err := got.UnpackInto(first, UnpackOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	answers := append([]Resource(nil), got.Answers...)
+
+	if _, err := got.UnpackInto(second, UnpackOptions{Strict: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	var want Message
+	if _, err := want.Unpack(second); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want message %+v, got %+v", want, got)
+	}
+
+	if want, got := answers[1].Record, got.Answers[1].Record; want != got {
+		t.Errorf("want reused record %p, got %p", want, got)
+	}
+	if unwant, got := answers[0].Record, got.Answers[0].Record; unwant == got {
+		t.Errorf("want new record for changed type, got reused %p", got)
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := got.UnpackInto(second, UnpackOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if want := testing.AllocsPerRun(100, func() {
+		var msg Message
+		if _, err := msg.Unpack(second); err != nil {
+			t.Fatal(err)
+		}
+	}); allocs >= want {
+		t.Errorf("want fewer than %.0f allocs, got %.0f", want, allocs)
+	}
+}
+
+func TestUnpackHeader(t *testing.T) {
+	msg := largeTestMsg()
+	msg.ID = 0xbeef
+	msg.OpCode = OpNotify
+	msg.Truncated = true
+	msg.AuthenticatedData = true
+	msg.CheckingDisabled = true
+	msg.RCode = Refused
+
+	b, err := msg.Pack(nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := UnpackHeader(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Header{
+		ID:                 msg.ID,
+		Response:           msg.Response,
+		OpCode:             msg.OpCode,
+		Authoritative:      msg.Authoritative,
+		Truncated:          msg.Truncated,
+		RecursionDesired:   msg.RecursionDesired,
+		RecursionAvailable: msg.RecursionAvailable,
+		AuthenticatedData:  msg.AuthenticatedData,
+		CheckingDisabled:   msg.CheckingDisabled,
+		RCode:              msg.RCode,
+
+		QDCount: len(msg.Questions),
+		ANCount: len(msg.Answers),
+		NSCount: len(msg.Authorities),
+		ARCount: len(msg.Additionals),
+	}
+	if !reflect.DeepEqual(want, h) {
+		t.Errorf("want header %+v, got %+v", want, h)
+	}
+
+	if _, err := UnpackHeader(b[:11]); err != errResourceLen {
+		t.Errorf("want error %q, got %v", errResourceLen, err)
+	}
+
+	if allocs := testing.AllocsPerRun(100, func() { UnpackHeader(b) }); allocs > 0 {
+		t.Errorf("want no allocs, got %.0f", allocs)
+	}
+}
+
+func TestTXTCharacterStrings(t *testing.T) {
+	t.Parallel()
+
+	dkim := "v=DKIM1; k=rsa; p=" + strings.Repeat("A", 392)
+
+	tests := []struct {
+		name string
+
+		txt TXT
+
+		strings []string
+	}{
+		{
+			name:    "empty",
+			strings: []string{""},
+		},
+		{
+			name:    "multi-string",
+			txt:     TXT{TXT: []string{"v=spf1 ", "-all"}},
+			strings: []string{"v=spf1 ", "-all"},
+		},
+		{
+			name:    "long-string",
+			txt:     TXT{TXT: []string{dkim}},
+			strings: []string{dkim[:255], dkim[255:]},
+		},
+		{
+			name:    "exact-length",
+			txt:     TXT{TXT: []string{dkim[:255]}},
+			strings: []string{dkim[:255]},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			n, err := test.txt.Length(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			raw, err := test.txt.Pack(nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, got := n, len(raw); want != got {
+				t.Errorf("want packed length %d, got %d", want, got)
+			}
+
+			var txt TXT
+			if _, err := txt.Unpack(raw, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			if want, got := test.strings, txt.TXT; !reflect.DeepEqual(want, got) {
+				t.Errorf("want character-strings %q, got %q", want, got)
+			}
+			if want, got := test.txt.Join(), txt.Join(); want != got {
+				t.Errorf("want joined TXT %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestResourcePackDurations(t *testing.T) {
+	t.Parallel()
+
+	soa := func(refresh, minTTL time.Duration) *SOA {
+		return &SOA{
+			NS:      "ns.example.com.",
+			MBox:    "hostmaster.example.com.",
+			Refresh: refresh,
+			Retry:   time.Hour,
+			Expire:  24 * time.Hour,
+			MinTTL:  minTTL,
+		}
+	}
+
+	tests := []struct {
+		name string
+
+		res Resource
+
+		ttl uint32
+		err error
+	}{
+		{
+			name: "fractional-ttl",
+			res:  Resource{Name: ".", TTL: 1500 * time.Millisecond, Record: soa(time.Hour, time.Minute)},
+			ttl:  1,
+		},
+		{
+			name: "max-ttl",
+			res:  Resource{Name: ".", TTL: math.MaxInt32 * time.Second, Record: soa(time.Hour, time.Minute)},
+			ttl:  math.MaxInt32,
+		},
+		{
+			name: "negative-ttl",
+			res:  Resource{Name: ".", TTL: -time.Second, Record: soa(time.Hour, time.Minute)},
+			err:  &DurationError{Field: "TTL", Duration: -time.Second},
+		},
+		{
+			name: "overflow-ttl",
+			res:  Resource{Name: ".", TTL: (math.MaxInt32 + 1) * time.Second, Record: soa(time.Hour, time.Minute)},
+			err:  &DurationError{Field: "TTL", Duration: (math.MaxInt32 + 1) * time.Second},
+		},
+		{
+			name: "negative-soa-refresh",
+			res:  Resource{Name: ".", Record: soa(-time.Hour, time.Minute)},
+			err:  &DurationError{Field: "SOA Refresh", Duration: -time.Hour},
+		},
+		{
+			name: "overflow-soa-minttl",
+			res:  Resource{Name: ".", Record: soa(time.Hour, (math.MaxUint32+1)*time.Second)},
+			err:  &DurationError{Field: "SOA MinTTL", Duration: (math.MaxUint32 + 1) * time.Second},
+		},
 	}
 
 	for _, test := range tests {
 		test := test
 
-		t.Run(string(test.name), func(t *testing.T) {
+		t.Run(test.name, func(t *testing.T) {
 			t.Parallel()
 
-			raw, err := test.msg.Pack(test.buf, test.compress)
-			if err != nil {
-				t.Fatal(err)
-			}
-
-			if want, got := append(test.buf, test.raw...), raw; !bytes.Equal(want, got) {
-				t.Errorf("want raw message %+v, got %+v", want, got)
+			raw, err := test.res.Pack(nil, nil)
+			if want, got := test.err, err; !reflect.DeepEqual(want, got) {
+				t.Fatalf("want error %v, got %v", want, got)
 			}
-
-			msg := new(Message)
-			buf, err := msg.Unpack(raw[len(test.buf):])
 			if err != nil {
-				t.Fatal(err)
-			}
-			if len(buf) > 0 {
-				t.Errorf("left-over data after unpack: %x", buf)
+				return
 			}
 
-			if want, got := test.msg, *msg; !reflect.DeepEqual(want, got) {
-				t.Errorf("want message %+v, got %+v", want, got)
+			if want, got := test.ttl, nbo.Uint32(raw[5:9]); want != got {
+				t.Errorf("want packed TTL %d, got %d", want, got)
 			}
 		})
 	}
 }
 
+func TestResourceUnpackTTL(t *testing.T) {
+	t.Parallel()
+
+	raw := []byte{
+		0x00,                   // .
+		0x00, 0x01, 0x00, 0x01, // TYPE=A,CLASS=IN
+		0x80, 0x00, 0x00, 0x00, // TTL=2147483648
+		0x00, 0x04,
+		0x7F, 0x00, 0x00, 0x01,
+	}
+
+	var res Resource
+	if _, err := res.Unpack(raw, nil); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := time.Duration(0), res.TTL; want != got {
+		t.Errorf("want TTL %s, got %s", want, got)
+	}
+}
+
 func TestMessageCompress(t *testing.T) {
 	t.Parallel()
 
@@ -1051,6 +2322,50 @@ func BenchmarkMessageDecompress(b *testing.B) {
 	})
 }
 
+func BenchmarkUnpackHeader(b *testing.B) {
+	msg := largeTestMsg()
+	buf, err := msg.Pack(nil, true)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := UnpackHeader(buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMessageUnpackInto(b *testing.B) {
+	b.Run("small-message", func(b *testing.B) {
+		benchamarkMessageUnpackInto(b, smallTestMsg())
+	})
+
+	b.Run("large-message", func(b *testing.B) {
+		benchamarkMessageUnpackInto(b, largeTestMsg())
+	})
+}
+
+func benchamarkMessageUnpackInto(b *testing.B, msg Message) {
+	buf, err := msg.Pack(nil, true)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(len(buf)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := msg.UnpackInto(buf, UnpackOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func benchamarkMessageUnpack(b *testing.B, msg Message, compress bool) {
 	buf, err := msg.Pack(nil, compress)
 	if err != nil {
@@ -1229,6 +2544,243 @@ func largeTestMsg() Message {
 	}
 }
 
+func TestLOCPrecision(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		meters float64
+
+		packed byte
+		want   float64
+	}{
+		{meters: 0, packed: 0x00, want: 0},
+		{meters: 0.05, packed: 0x50, want: 0.05},
+		{meters: 1, packed: 0x12, want: 1},
+		{meters: 1.5, packed: 0x22, want: 2},
+		{meters: 9.5, packed: 0x13, want: 10},
+		{meters: 30, packed: 0x33, want: 30},
+		{meters: 10000, packed: 0x16, want: 10000},
+		{meters: 90000000, packed: 0x99, want: 90000000},
+	}
+
+	for _, test := range tests {
+		packed, ok := packLOCPrecision(test.meters)
+		if !ok {
+			t.Errorf("%g: want ok", test.meters)
+			continue
+		}
+		if want, got := test.packed, packed; want != got {
+			t.Errorf("%g: want packed %#02x, got %#02x", test.meters, want, got)
+		}
+
+		meters, ok := unpackLOCPrecision(packed)
+		if !ok {
+			t.Errorf("%g: want ok", test.meters)
+			continue
+		}
+		if want, got := test.want, meters; want != got {
+			t.Errorf("%g: want meters %g, got %g", test.meters, want, got)
+		}
+	}
+
+	for _, meters := range []float64{-1, 100000000} {
+		if _, ok := packLOCPrecision(meters); ok {
+			t.Errorf("%g: want not ok", meters)
+		}
+	}
+}
+
+func TestInvalidLOC(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+
+		rec   *LOC
+		rdata []byte
+
+		err error
+	}{
+		{
+			name: "latitude",
+
+			rec: &LOC{Latitude: 90.5},
+			err: errFieldOverflow,
+		},
+		{
+			name: "longitude",
+
+			rec: &LOC{Longitude: -181},
+			err: errFieldOverflow,
+		},
+		{
+			name: "altitude",
+
+			rec: &LOC{Altitude: -100001},
+			err: errFieldOverflow,
+		},
+		{
+			name: "size",
+
+			rec: &LOC{Size: -1},
+			err: errFieldOverflow,
+		},
+		{
+			name: "version",
+
+			rdata: []byte{0x01, 0x12, 0x16, 0x13, 0x80, 0x00, 0x00, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x98, 0x96, 0x80},
+			err:   errLOCVersion,
+		},
+		{
+			name: "precision",
+
+			rdata: []byte{0x00, 0xA0, 0x16, 0x13, 0x80, 0x00, 0x00, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x98, 0x96, 0x80},
+			err:   errFieldOverflow,
+		},
+		{
+			name: "short",
+
+			rdata: []byte{0x00, 0x12, 0x16, 0x13},
+			err:   errResourceLen,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var err error
+			if test.rec != nil {
+				_, err = test.rec.Pack(nil, nil)
+			} else {
+				_, err = new(LOC).Unpack(test.rdata, nil)
+			}
+			if want, got := test.err, err; want != got {
+				t.Errorf("want error %q, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestInvalidNAPTR(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+
+		rec NAPTR
+		raw []byte
+
+		err error
+	}{
+		{
+			name: "regexp too long",
+
+			rec: NAPTR{Regexp: strings.Repeat("a", 256), Replacement: "."},
+
+			err: errSegTooLong,
+		},
+		{
+			name: "order overflow",
+
+			rec: NAPTR{Order: 1 << 16, Replacement: "."},
+
+			err: errFieldOverflow,
+		},
+		{
+			name: "truncated service",
+
+			raw: []byte{
+				0x00, 0x64, // ORDER=100
+				0x00, 0x0A, // PREFERENCE=10
+				0x01, 'u', // FLAGS="u"
+				0x07, 'E', '2', 'U', // SERVICE (truncated)
+			},
+
+			err: errResourceLen,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			if test.raw != nil {
+				_, err := new(NAPTR).Unpack(test.raw, decompressor(test.raw))
+				if want, got := test.err, err; want != got {
+					t.Errorf("want unpack error %q, got %q", want, got)
+				}
+				return
+			}
+
+			_, err := test.rec.Pack(nil, compressor{})
+			if want, got := test.err, err; want != got {
+				t.Errorf("want pack error %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestInvalidHINFO(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+
+		rec HINFO
+		raw []byte
+
+		err error
+	}{
+		{
+			name: "cpu too long",
+
+			rec: HINFO{CPU: strings.Repeat("a", 256)},
+
+			err: errSegTooLong,
+		},
+		{
+			name: "missing os",
+
+			raw: []byte{0x03, 'x', '8', '6'},
+
+			err: errResourceLen,
+		},
+		{
+			name: "truncated cpu",
+
+			raw: []byte{0x03, 'x', '8'},
+
+			err: errResourceLen,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			if test.raw != nil {
+				_, err := new(HINFO).Unpack(test.raw, decompressor(test.raw))
+				if want, got := test.err, err; want != got {
+					t.Errorf("want unpack error %q, got %q", want, got)
+				}
+				return
+			}
+
+			_, err := test.rec.Pack(nil, compressor{})
+			if want, got := test.err, err; want != got {
+				t.Errorf("want pack error %q, got %q", want, got)
+			}
+		})
+	}
+}
+
 func TestInvalidCAA(t *testing.T) {
 	t.Parallel()
 
@@ -1317,6 +2869,54 @@ func TestInvalidCAA(t *testing.T) {
 
 			err: errSegTooLong,
 		},
+		{
+			name: "invalid tag",
+
+			msg: Message{
+				ID:       0x01,
+				Response: true,
+				Questions: []Question{
+					{
+						Name:  ".",
+						Type:  TypeCAA,
+						Class: ClassIN,
+					},
+				},
+				Answers: []Resource{
+					{
+						Name:  ".",
+						Class: ClassIN,
+						TTL:   60 * time.Second,
+						Record: &CAA{
+							Tag:   "is-sue",
+							Value: "ca.example.com",
+						},
+					},
+				},
+			},
+			raw: []byte{
+				0x00, 0x01, // ID=0x0001
+				0x80, 0x00, // RD=1
+				0x00, 0x01, // QDCOUNT=1
+				0x00, 0x01, // ANCOUNT=1
+				0x00, 0x00, // NSCOUNT=0
+				0x00, 0x00, // ARCOUNT=0
+
+				0x00, 0x01, 0x01, 0x00, 0x01, // .      IN      CAA
+
+				// .    60      IN      is-sue "ca.example.com"
+				0x00,
+				0x01, 0x01, 0x00, 0x01, // TYPE=CAA,CLASS=IN
+				0x00, 0x00, 0x00, 0x3C, // TTL=60
+				0x00, 0x16,
+
+				0x00, 0x06,
+				'i', 's', '-', 's', 'u', 'e',
+				'c', 'a', '.', 'e', 'x', 'a', 'm', 'p', 'l', 'e', '.', 'c', 'o', 'm',
+			},
+
+			err: errCAATag,
+		},
 	}
 
 	for _, test := range tests {
@@ -3,6 +3,8 @@ package dns
 import (
 	"context"
 	"time"
+
+	"github.com/benburkert/dns/edns"
 )
 
 // MessageWriter is used by a DNS handler to serve a DNS query.
@@ -32,8 +34,221 @@ type MessageWriter interface {
 	Reply(context.Context) error
 }
 
+// CompressionPolicy is the use of domain name compression when packing a
+// response.
+type CompressionPolicy int
+
+const (
+	// CompressAlways packs responses with compression.
+	CompressAlways CompressionPolicy = iota
+
+	// CompressNever packs responses without compression.
+	CompressNever
+
+	// CompressIfNeeded packs responses without compression, unless the
+	// uncompressed response exceeds the size limit of the transport. A
+	// compressed response that still exceeds the limit is truncated.
+	CompressIfNeeded
+)
+
+// SetCompression sets the compression policy of the response sent by w. It
+// reports whether the policy is supported by w.
+func SetCompression(w MessageWriter, policy CompressionPolicy) bool {
+	cw, ok := w.(compressionSetter)
+	if !ok {
+		return false
+	}
+	return cw.setCompression(policy)
+}
+
+type compressionSetter interface {
+	setCompression(CompressionPolicy) bool
+}
+
+// Remaining returns the number of bytes that can be added to the response sent
+// by w before it exceeds the size limit of the transport and is truncated. It
+// is negative if the response already exceeds the limit. It reports whether
+// the size limit is known by w.
+//
+// Handlers can use Remaining to trim optional records from the response
+// themselves. The response is packed to measure it, according to the
+// compression policy.
+func Remaining(w MessageWriter) (int, bool) {
+	rw, ok := w.(remainingSizer)
+	if !ok {
+		return 0, false
+	}
+	return rw.remaining()
+}
+
+type remainingSizer interface {
+	remaining() (int, bool)
+}
+
+// RecurOptions are the header flags and EDNS parameters of the query
+// forwarded upstream by the Recur method of a MessageWriter. They replace the
+// flags and OPT record of the original query.
+type RecurOptions struct {
+	RecursionDesired bool // RD bit
+	CheckingDisabled bool // CD bit
+
+	// DNSSECOK sets the DNSSEC OK (DO) bit of the EDNS header.
+	DNSSECOK bool
+
+	// UDPSize is the EDNS UDP payload size. If zero, the size of the
+	// original query is used, or 1232 bytes.
+	UDPSize int
+
+	// Options are the EDNS options of the forwarded query.
+	Options []edns.Option
+}
+
+// defaultUDPSize is the EDNS UDP payload size that avoids IP fragmentation
+// on most networks.
+const defaultUDPSize = 1232
+
+// udpSize returns the UDP payload size advertised by the OPT record of msg, or
+// 512 bytes if msg has no OPT record or advertises a smaller size (RFC 6891,
+// section 6.2.3).
+func udpSize(msg *Message) int {
+	for _, res := range msg.Additionals {
+		if res.Record.Type() == TypeOPT && int(res.Class) > maxPacketLen {
+			return int(res.Class)
+		}
+	}
+	return maxPacketLen
+}
+
+// ednsDO is the DNSSEC OK bit of the extended flags in the TTL of an OPT
+// record.
+const ednsDO = 1 << 15
+
+// dnssecOK reports whether the OPT record of msg has the DNSSEC OK bit set.
+func dnssecOK(msg *Message) bool {
+	for _, res := range msg.Additionals {
+		if res.Record.Type() == TypeOPT && int64(res.TTL/time.Second)&ednsDO != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// SetRecurOptions sets the flags and EDNS parameters of the queries forwarded
+// by calls to w.Recur. It reports whether the options are supported by w.
+//
+// The forwarded query includes an OPT record if DNSSECOK, UDPSize, or Options
+// is set, or if the query has end-to-end EDNS options, such as the client
+// subnet, which are kept unless Options has an option of the same code. The
+// hop-by-hop options and TSIG record of the query are not forwarded.
+func SetRecurOptions(w MessageWriter, opts RecurOptions) bool {
+	rw, ok := w.(recurOptionsSetter)
+	if !ok {
+		return false
+	}
+	return rw.setRecurOptions(opts)
+}
+
+type recurOptionsSetter interface {
+	setRecurOptions(RecurOptions) bool
+}
+
+// apply sets the flags and OPT record of the forwarded query msg. The
+// additional section of msg is replaced, not modified.
+func (o *RecurOptions) apply(msg *Message) {
+	msg.RecursionDesired = o.RecursionDesired
+	msg.CheckingDisabled = o.CheckingDisabled
+
+	udpSize := o.UDPSize
+
+	var additionals []Resource
+	var options []edns.Option
+	for _, res := range forwardAdditionals(msg.Additionals) {
+		if opt, ok := res.Record.(*OPT); ok {
+			if udpSize == 0 {
+				udpSize = int(res.Class)
+			}
+			options = opt.Options
+			continue
+		}
+		additionals = append(additionals, res)
+	}
+
+	// the end-to-end options of the query are kept, unless replaced by an
+	// option of the same code
+	var kept []edns.Option
+	for _, opt := range options {
+		if !hasOption(o.Options, opt.Code) {
+			kept = append(kept, opt)
+		}
+	}
+	options = append(kept, o.Options...)
+
+	if o.DNSSECOK || o.UDPSize > 0 || len(options) > 0 {
+		if udpSize < maxPacketLen {
+			udpSize = defaultUDPSize
+		}
+
+		var ttl time.Duration
+		if o.DNSSECOK {
+			ttl = ednsDO * time.Second
+		}
+
+		additionals = append(additionals, Resource{
+			Name:   ".",
+			Class:  Class(udpSize),
+			TTL:    ttl,
+			Record: &OPT{Options: options},
+		})
+	}
+	msg.Additionals = additionals
+}
+
+// hasOption reports whether options include an option of the code.
+func hasOption(options []edns.Option, code edns.OptionCode) bool {
+	for _, opt := range options {
+		if opt.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
 type messageWriter struct {
 	msg *Message
+
+	compress CompressionPolicy
+}
+
+func (w *messageWriter) setCompression(policy CompressionPolicy) bool {
+	w.compress = policy
+	return true
+}
+
+// pack appends the response message to b, according to the compression
+// policy and the size limit of the transport.
+func (w *messageWriter) pack(b []byte, limit int) ([]byte, error) {
+	switch w.compress {
+	case CompressNever:
+		return w.msg.Pack(b, false)
+	case CompressIfNeeded:
+		buf, err := w.msg.Pack(b, false)
+		if err != nil || len(buf)-len(b) <= limit {
+			return buf, err
+		}
+		return w.msg.Pack(b[:len(b):len(b)], true)
+	default:
+		return w.msg.Pack(b, true)
+	}
+}
+
+// remainingLen returns the number of bytes left in the packed response below
+// the size limit.
+func (w *messageWriter) remainingLen(limit int) (int, bool) {
+	buf, err := w.pack(nil, limit)
+	if err != nil {
+		return 0, false
+	}
+	return limit - len(buf), true
 }
 
 func (w *messageWriter) Authoritative(aa bool) { w.msg.Authoritative = aa }
@@ -0,0 +1,208 @@
+package dns
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/benburkert/dns/edns"
+)
+
+func TestMessageWriterCompression(t *testing.T) {
+	t.Parallel()
+
+	msg := &Message{
+		Response:  true,
+		Questions: []Question{{Name: "test.local.", Type: TypeA, Class: ClassIN}},
+	}
+	for i := 0; i < 4; i++ {
+		msg.Answers = append(msg.Answers, Resource{
+			Name:   "test.local.",
+			Class:  ClassIN,
+			TTL:    time.Minute,
+			Record: &A{A: net.IPv4(127, 0, 0, byte(i)).To4()},
+		})
+	}
+
+	compressed, err := msg.Pack(nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uncompressed, err := msg.Pack(nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+
+		policy CompressionPolicy
+		limit  int
+
+		want int
+	}{
+		{name: "always", policy: CompressAlways, limit: maxPacketLen, want: len(compressed)},
+		{name: "never", policy: CompressNever, limit: maxPacketLen, want: len(uncompressed)},
+		{name: "if-needed-fits", policy: CompressIfNeeded, limit: maxPacketLen, want: len(uncompressed)},
+		{name: "if-needed-exceeds", policy: CompressIfNeeded, limit: len(uncompressed) - 1, want: len(compressed)},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			mw := &messageWriter{msg: msg}
+			if !mw.setCompression(test.policy) {
+				t.Fatal("compression policy not supported")
+			}
+
+			buf, err := mw.pack([]byte{0xFF, 0xFF}, test.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want, got := test.want, len(buf)-2; want != got {
+				t.Errorf("want packed length %d, got %d", want, got)
+			}
+			if buf[0] != 0xFF || buf[1] != 0xFF {
+				t.Errorf("want prefix preserved, got %x", buf[:2])
+			}
+		})
+	}
+
+	if SetCompression(nopWriter{}, CompressNever) {
+		t.Error("want unsupported compression policy for custom writer")
+	}
+}
+
+func TestRecurOptions(t *testing.T) {
+	t.Parallel()
+
+	cookie := edns.Option{Code: edns.OptionCodeCookie, Data: []byte{1, 2, 3, 4, 5, 6, 7, 8}}
+	ecs := edns.Option{Code: edns.OptionCodeEDNSClientSubnet, Data: []byte{0, 1, 24, 0, 192, 0, 2}}
+	otherECS := edns.Option{Code: edns.OptionCodeEDNSClientSubnet, Data: []byte{0, 1, 24, 0, 198, 51, 100}}
+
+	sig := Resource{Name: ".", Class: ClassANY, Record: &TSIG{Algorithm: "hmac-sha256."}}
+	opt := Resource{Name: ".", Class: 4096, TTL: ednsDO * time.Second, Record: &OPT{Options: []edns.Option{cookie}}}
+
+	tests := []struct {
+		name string
+
+		opts        RecurOptions
+		additionals []Resource
+
+		want *Message
+	}{
+		{
+			name: "strip-edns",
+
+			opts:        RecurOptions{RecursionDesired: true},
+			additionals: []Resource{opt, sig},
+
+			want: &Message{
+				RecursionDesired: true,
+			},
+		},
+		{
+			name: "end-to-end",
+
+			opts: RecurOptions{RecursionDesired: true},
+			additionals: []Resource{
+				{Name: ".", Class: 4096, Record: &OPT{Options: []edns.Option{cookie, ecs}}},
+				sig,
+			},
+
+			want: &Message{
+				RecursionDesired: true,
+				Additionals: []Resource{
+					{Name: ".", Class: 4096, Record: &OPT{Options: []edns.Option{ecs}}},
+				},
+			},
+		},
+		{
+			name: "replace-option",
+
+			opts: RecurOptions{Options: []edns.Option{otherECS}},
+			additionals: []Resource{
+				{Name: ".", Class: 4096, Record: &OPT{Options: []edns.Option{ecs}}},
+			},
+
+			want: &Message{
+				Additionals: []Resource{
+					{Name: ".", Class: 4096, Record: &OPT{Options: []edns.Option{otherECS}}},
+				},
+			},
+		},
+		{
+			name: "dnssec",
+
+			opts: RecurOptions{CheckingDisabled: true, DNSSECOK: true},
+
+			want: &Message{
+				CheckingDisabled: true,
+				Additionals: []Resource{
+					{Name: ".", Class: defaultUDPSize, TTL: ednsDO * time.Second, Record: &OPT{}},
+				},
+			},
+		},
+		{
+			name: "inherit-udp-size",
+
+			opts:        RecurOptions{Options: []edns.Option{cookie}},
+			additionals: []Resource{opt},
+
+			want: &Message{
+				Additionals: []Resource{
+					{Name: ".", Class: 4096, Record: &OPT{Options: []edns.Option{cookie}}},
+				},
+			},
+		},
+		{
+			name: "udp-size",
+
+			opts:        RecurOptions{RecursionDesired: true, UDPSize: 1400},
+			additionals: []Resource{opt},
+
+			want: &Message{
+				RecursionDesired: true,
+				Additionals: []Resource{
+					{Name: ".", Class: 1400, Record: &OPT{}},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			additionals := append([]Resource(nil), test.additionals...)
+			msg := &Message{
+				RecursionDesired: true,
+				CheckingDisabled: true,
+				Additionals:      additionals,
+			}
+			test.opts.apply(msg)
+
+			if want, got := test.want, msg; !reflect.DeepEqual(want, got) {
+				t.Errorf("want message %+v, got %+v", want, got)
+			}
+			if want, got := test.additionals, additionals; !reflect.DeepEqual(want, got) {
+				t.Errorf("want original additionals %+v, got %+v", want, got)
+			}
+		})
+	}
+
+	if SetRecurOptions(nopWriter{}, RecurOptions{}) {
+		t.Error("want unsupported recur options for custom writer")
+	}
+}
+
+type nopWriter struct {
+	MessageWriter
+}
@@ -0,0 +1,175 @@
+package dns
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the default histogram bucket upper bounds.
+var DefaultBuckets = []time.Duration{
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+}
+
+// Metrics records server instrumentation.
+type Metrics interface {
+	// ObserveQuery records the duration to serve and reply to a query.
+	ObserveQuery(q Question, rcode RCode, d time.Duration)
+
+	// ObserveUpstream records the duration of a query forwarded upstream by
+	// the Recur method of a MessageWriter.
+	ObserveUpstream(q Question, rcode RCode, d time.Duration)
+}
+
+// A MetricKey identifies a histogram by question type and response code.
+type MetricKey struct {
+	Type  Type
+	RCode RCode
+}
+
+// QueryMetrics is an implementation of Metrics that collects latency
+// histograms by question type and response code.
+type QueryMetrics struct {
+	// Buckets are the histogram bucket upper bounds. DefaultBuckets is used
+	// if nil.
+	Buckets []time.Duration
+
+	mu        sync.Mutex
+	queries   map[MetricKey]*Histogram
+	upstreams map[MetricKey]*Histogram
+}
+
+// ObserveQuery records the duration to serve a query.
+func (m *QueryMetrics) ObserveQuery(q Question, rcode RCode, d time.Duration) {
+	m.histogram(&m.queries, MetricKey{Type: q.Type, RCode: rcode}).Observe(d)
+}
+
+// ObserveUpstream records the duration of an upstream query.
+func (m *QueryMetrics) ObserveUpstream(q Question, rcode RCode, d time.Duration) {
+	m.histogram(&m.upstreams, MetricKey{Type: q.Type, RCode: rcode}).Observe(d)
+}
+
+// Queries returns a snapshot of the query duration histograms.
+func (m *QueryMetrics) Queries() map[MetricKey]HistogramSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return snapshot(m.queries)
+}
+
+// Upstreams returns a snapshot of the upstream query duration histograms.
+func (m *QueryMetrics) Upstreams() map[MetricKey]HistogramSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return snapshot(m.upstreams)
+}
+
+func (m *QueryMetrics) histogram(tbl *map[MetricKey]*Histogram, key MetricKey) *Histogram {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if *tbl == nil {
+		*tbl = make(map[MetricKey]*Histogram)
+	}
+
+	h, ok := (*tbl)[key]
+	if !ok {
+		h = &Histogram{Buckets: m.Buckets}
+		(*tbl)[key] = h
+	}
+	return h
+}
+
+func snapshot(tbl map[MetricKey]*Histogram) map[MetricKey]HistogramSnapshot {
+	snap := make(map[MetricKey]HistogramSnapshot, len(tbl))
+	for key, h := range tbl {
+		snap[key] = h.Snapshot()
+	}
+	return snap
+}
+
+// Histogram is a cumulative histogram of durations.
+type Histogram struct {
+	// Buckets are the bucket upper bounds in increasing order.
+	// DefaultBuckets is used if nil.
+	Buckets []time.Duration
+
+	mu     sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    time.Duration
+}
+
+// HistogramSnapshot is the state of a Histogram at a point in time.
+type HistogramSnapshot struct {
+	// Buckets are the bucket upper bounds.
+	Buckets []time.Duration
+
+	// Counts are the cumulative number of observations less than or equal
+	// to the upper bound of each bucket.
+	Counts []uint64
+
+	// Count is the total number of observations.
+	Count uint64
+
+	// Sum is the sum of all observations.
+	Sum time.Duration
+}
+
+// Observe adds a duration to the histogram.
+func (h *Histogram) Observe(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	buckets := h.buckets()
+	if h.counts == nil {
+		h.counts = make([]uint64, len(buckets))
+	}
+
+	if i := sort.Search(len(buckets), func(i int) bool { return d <= buckets[i] }); i < len(buckets) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += d
+}
+
+// Snapshot returns the current state of the histogram.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	buckets := h.buckets()
+
+	snap := HistogramSnapshot{
+		Buckets: buckets,
+		Counts:  make([]uint64, len(buckets)),
+		Count:   h.count,
+		Sum:     h.sum,
+	}
+
+	var n uint64
+	for i := range h.counts {
+		n += h.counts[i]
+		snap.Counts[i] = n
+	}
+	return snap
+}
+
+func (h *Histogram) buckets() []time.Duration {
+	if h.Buckets == nil {
+		return DefaultBuckets
+	}
+	return h.Buckets
+}
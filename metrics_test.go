@@ -0,0 +1,102 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	t.Parallel()
+
+	h := &Histogram{
+		Buckets: []time.Duration{time.Millisecond, 10 * time.Millisecond, 100 * time.Millisecond},
+	}
+
+	for _, d := range []time.Duration{
+		500 * time.Microsecond,
+		time.Millisecond,
+		5 * time.Millisecond,
+		50 * time.Millisecond,
+		time.Second,
+	} {
+		h.Observe(d)
+	}
+
+	snap := h.Snapshot()
+	if want, got := []uint64{2, 3, 4}, snap.Counts; !reflect.DeepEqual(want, got) {
+		t.Errorf("want bucket counts %v, got %v", want, got)
+	}
+	if want, got := uint64(5), snap.Count; want != got {
+		t.Errorf("want count %d, got %d", want, got)
+	}
+	if want, got := 1056500*time.Microsecond, snap.Sum; want != got {
+		t.Errorf("want sum %s, got %s", want, got)
+	}
+}
+
+func TestServerMetrics(t *testing.T) {
+	t.Parallel()
+
+	metrics := new(QueryMetrics)
+
+	srv := &Server{
+		Addr: mustUnusedAddr(),
+		Handler: HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+			if r.Questions[0].Type == TypeAAAA {
+				w.Status(NXDomain)
+				return
+			}
+
+			Recursor(ctx, w, r)
+		}),
+		Forwarder: &Client{
+			Transport: nopDialer{},
+			Resolver: HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+				w.Answer(r.Questions[0].Name, time.Minute, &A{A: net.IPv4(127, 0, 0, 1).To4()})
+			}),
+		},
+		Metrics: metrics,
+	}
+	mustStart(srv)
+
+	addr, err := net.ResolveUDPAddr("udp", srv.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, typ := range []Type{TypeA, TypeA, TypeAAAA} {
+		query := &Query{
+			RemoteAddr: addr,
+			Message: &Message{
+				Questions: []Question{
+					{Name: "test.local.", Type: typ, Class: ClassIN},
+				},
+			},
+		}
+
+		if _, err := new(Client).Do(context.Background(), query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	time.Sleep(50 * time.Millisecond) // wait for metrics after reply
+
+	queries := metrics.Queries()
+	if want, got := uint64(2), queries[MetricKey{TypeA, NoError}].Count; want != got {
+		t.Errorf("want %d A queries, got %d", want, got)
+	}
+	if want, got := uint64(1), queries[MetricKey{TypeAAAA, NXDomain}].Count; want != got {
+		t.Errorf("want %d AAAA queries, got %d", want, got)
+	}
+
+	upstreams := metrics.Upstreams()
+	if want, got := 1, len(upstreams); want != got {
+		t.Errorf("want %d upstream histograms, got %d", want, got)
+	}
+	if want, got := uint64(2), upstreams[MetricKey{TypeA, NoError}].Count; want != got {
+		t.Errorf("want %d upstream A queries, got %d", want, got)
+	}
+}
@@ -0,0 +1,86 @@
+package dns
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// Normalize rewrites the resource sections of msg into a canonical form, for
+// caching, comparing, or signing messages. The owner names of the resources
+// are lowercased, and the resources of each section are sorted by owner
+// name, type, and RDATA in the canonical order of RFC 4034, section 6.
+// Duplicate records, which differ at most by TTL, are removed and the lowest
+// TTL is kept. The OPT and TSIG pseudo-records remain at the end of the
+// additional section, in their original order. The questions are unchanged.
+//
+// The section counts of a packed message always match the section lengths,
+// so they are fixed by removing the duplicates.
+func Normalize(msg *Message) error {
+	var err error
+	if msg.Answers, err = normalizeSection(msg.Answers); err != nil {
+		return err
+	}
+	if msg.Authorities, err = normalizeSection(msg.Authorities); err != nil {
+		return err
+	}
+
+	var additionals, pseudo []Resource
+	for _, res := range msg.Additionals {
+		switch res.Record.Type() {
+		case TypeOPT, TypeTSIG:
+			pseudo = append(pseudo, res)
+		default:
+			additionals = append(additionals, res)
+		}
+	}
+	if additionals, err = normalizeSection(additionals); err != nil {
+		return err
+	}
+	if len(additionals)+len(pseudo) > 0 {
+		msg.Additionals = append(additionals, pseudo...)
+	}
+	return nil
+}
+
+func normalizeSection(rrs []Resource) ([]Resource, error) {
+	if len(rrs) == 0 {
+		return rrs, nil
+	}
+
+	crrs := make([]canonicalRR, 0, len(rrs))
+	for _, res := range rrs {
+		res.Name = strings.ToLower(res.Name)
+
+		crr, err := newCanonicalRR(res)
+		if err != nil {
+			return nil, err
+		}
+		crrs = append(crrs, crr)
+	}
+
+	sort.SliceStable(crrs, func(i, j int) bool {
+		if c := compareCanonical(crrs[i], crrs[j]); c != 0 {
+			return c < 0
+		}
+		return crrs[i].res.Class < crrs[j].res.Class
+	})
+
+	uniq := make([]Resource, 0, len(crrs))
+	for i, crr := range crrs {
+		if i > 0 && sameRecord(crrs[i-1], crr) {
+			if last := &uniq[len(uniq)-1]; crr.res.TTL < last.TTL {
+				last.TTL = crr.res.TTL
+			}
+			continue
+		}
+		uniq = append(uniq, crr.res)
+	}
+	return uniq, nil
+}
+
+// sameRecord reports whether a and b are the same record, ignoring the TTL.
+func sameRecord(a, b canonicalRR) bool {
+	return a.name == b.name && a.typ == b.typ && a.res.Class == b.res.Class &&
+		bytes.Equal(a.rdata, b.rdata)
+}
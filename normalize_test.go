@@ -0,0 +1,81 @@
+package dns
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNormalize(t *testing.T) {
+	t.Parallel()
+
+	opt := Resource{Name: ".", Class: 1232, Record: &OPT{}}
+
+	msg := &Message{
+		Questions: []Question{
+			{Name: "Example.COM.", Type: TypeA, Class: ClassIN},
+		},
+		Answers: []Resource{
+			{Name: "b.Example.COM.", Class: ClassIN, TTL: time.Minute, Record: &A{A: net.IPv4(192, 0, 2, 1).To4()}},
+			{Name: "Example.COM.", Class: ClassIN, TTL: time.Minute, Record: &A{A: net.IPv4(192, 0, 2, 2).To4()}},
+			{Name: "example.com.", Class: ClassIN, TTL: time.Hour, Record: &A{A: net.IPv4(192, 0, 2, 1).To4()}},
+			{Name: "example.com.", Class: ClassIN, TTL: time.Second, Record: &A{A: net.IPv4(192, 0, 2, 2).To4()}},
+			{Name: "example.com.", Class: ClassIN, TTL: time.Minute, Record: &MX{Pref: 10, MX: "Mail.Example.COM."}},
+		},
+		Additionals: []Resource{
+			opt,
+			{Name: "mail.example.com.", Class: ClassIN, TTL: time.Minute, Record: &AAAA{AAAA: net.ParseIP("2001:db8::1")}},
+			{Name: "mail.example.com.", Class: ClassIN, TTL: time.Minute, Record: &A{A: net.IPv4(192, 0, 2, 3).To4()}},
+		},
+	}
+
+	if err := Normalize(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Message{
+		Questions: []Question{
+			{Name: "Example.COM.", Type: TypeA, Class: ClassIN},
+		},
+		Answers: []Resource{
+			{Name: "example.com.", Class: ClassIN, TTL: time.Hour, Record: &A{A: net.IPv4(192, 0, 2, 1).To4()}},
+			{Name: "example.com.", Class: ClassIN, TTL: time.Second, Record: &A{A: net.IPv4(192, 0, 2, 2).To4()}},
+			{Name: "example.com.", Class: ClassIN, TTL: time.Minute, Record: &MX{Pref: 10, MX: "Mail.Example.COM."}},
+			{Name: "b.example.com.", Class: ClassIN, TTL: time.Minute, Record: &A{A: net.IPv4(192, 0, 2, 1).To4()}},
+		},
+		Additionals: []Resource{
+			{Name: "mail.example.com.", Class: ClassIN, TTL: time.Minute, Record: &A{A: net.IPv4(192, 0, 2, 3).To4()}},
+			{Name: "mail.example.com.", Class: ClassIN, TTL: time.Minute, Record: &AAAA{AAAA: net.ParseIP("2001:db8::1")}},
+			opt,
+		},
+	}
+
+	if !reflect.DeepEqual(want, msg) {
+		t.Errorf("want normalized message %+v, got %+v", want, msg)
+	}
+
+	// a normalized message is unchanged by normalizing it again
+	again := *msg
+	again.Answers = append([]Resource(nil), msg.Answers...)
+	if err := Normalize(&again); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(msg, &again) {
+		t.Errorf("want normalize to be idempotent, got %+v", again)
+	}
+}
+
+func TestNormalizeInvalid(t *testing.T) {
+	t.Parallel()
+
+	msg := &Message{
+		Answers: []Resource{
+			{Name: "example.com.", Class: ClassIN, Record: &MX{MX: "invalid..example.com."}},
+		},
+	}
+
+	if err := Normalize(msg); err == nil {
+		t.Error("want error normalizing invalid record")
+	}
+}
@@ -0,0 +1,97 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"strings"
+)
+
+// NotifyHandler acknowledges NOTIFY messages (RFC 1996) for a set of zones,
+// and calls Refresh for each notified zone, such as to start a zone transfer
+// from the primary name server.
+type NotifyHandler struct {
+	// Zones are the names of the zones accepted. NOTIFY messages for other
+	// zones are answered with a "Not Authoritative" message.
+	Zones []string
+
+	// Primaries optionally restricts the addresses NOTIFY messages are
+	// accepted from. Messages from other addresses are answered with a
+	// "Query Refused" message.
+	Primaries []net.IP
+
+	// Refresh is called in a new goroutine for each accepted NOTIFY message.
+	// It is started before the acknowledgement is sent, so it may run before
+	// or concurrently with the reply to the primary. The soa is the new SOA
+	// record of the zone if included by the primary, or nil.
+	Refresh func(zone string, soa *SOA, from net.Addr)
+
+	// Handler serves queries that are not NOTIFY messages. If nil, they are
+	// answered with a "Not Implemented" message.
+	Handler Handler
+}
+
+// ServeDNS acknowledges a NOTIFY message, or passes other queries to
+// h.Handler.
+func (h *NotifyHandler) ServeDNS(ctx context.Context, w MessageWriter, r *Query) {
+	if r.OpCode != OpNotify {
+		if h.Handler == nil {
+			w.Status(NotImp)
+			return
+		}
+		h.Handler.ServeDNS(ctx, w, r)
+		return
+	}
+
+	if len(r.Questions) != 1 || r.Questions[0].Type != TypeSOA {
+		w.Status(FormErr)
+		return
+	}
+	if !h.primary(r.RemoteAddr) {
+		w.Status(Refused)
+		return
+	}
+
+	zone, ok := h.zone(r.Questions[0].Name)
+	if !ok {
+		w.Status(NotAuth)
+		return
+	}
+
+	w.Authoritative(true)
+
+	var soa *SOA
+	for _, res := range r.Answers {
+		if rec, ok := res.Record.(*SOA); ok && strings.EqualFold(res.Name, zone) {
+			soa = rec
+			break
+		}
+	}
+
+	if h.Refresh != nil {
+		go h.Refresh(zone, soa, r.RemoteAddr)
+	}
+}
+
+// zone returns the configured zone name matching name.
+func (h *NotifyHandler) zone(name string) (string, bool) {
+	for _, zone := range h.Zones {
+		if strings.EqualFold(zone, name) {
+			return zone, true
+		}
+	}
+	return "", false
+}
+
+func (h *NotifyHandler) primary(addr net.Addr) bool {
+	if len(h.Primaries) == 0 {
+		return true
+	}
+
+	ip := addrIP(addr)
+	for _, primary := range h.Primaries {
+		if primary.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNotifyHandler(t *testing.T) {
+	t.Parallel()
+
+	soa := &SOA{
+		NS:     "ns.example.",
+		MBox:   "hostmaster.example.",
+		Serial: 2024010101,
+	}
+
+	type refresh struct {
+		zone string
+		soa  *SOA
+	}
+
+	tests := []struct {
+		name string
+
+		primaries []net.IP
+		msg       *Message
+
+		rcode   RCode
+		refresh *refresh
+	}{
+		{
+			name: "accepted",
+
+			msg: &Message{
+				OpCode:    OpNotify,
+				Questions: []Question{{Name: "EXAMPLE.", Type: TypeSOA, Class: ClassIN}},
+				Answers: []Resource{
+					{Name: "example.", Class: ClassIN, TTL: time.Hour, Record: soa},
+				},
+			},
+
+			refresh: &refresh{zone: "example.", soa: soa},
+		},
+		{
+			name: "accepted-without-soa",
+
+			primaries: []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+			msg: &Message{
+				OpCode:    OpNotify,
+				Questions: []Question{{Name: "example.", Type: TypeSOA, Class: ClassIN}},
+			},
+
+			refresh: &refresh{zone: "example."},
+		},
+		{
+			name: "unknown-zone",
+
+			msg: &Message{
+				OpCode:    OpNotify,
+				Questions: []Question{{Name: "other.", Type: TypeSOA, Class: ClassIN}},
+			},
+
+			rcode: NotAuth,
+		},
+		{
+			name: "not-primary",
+
+			primaries: []net.IP{net.IPv4(192, 0, 2, 1)},
+			msg: &Message{
+				OpCode:    OpNotify,
+				Questions: []Question{{Name: "example.", Type: TypeSOA, Class: ClassIN}},
+			},
+
+			rcode: Refused,
+		},
+		{
+			name: "not-soa",
+
+			msg: &Message{
+				OpCode:    OpNotify,
+				Questions: []Question{{Name: "example.", Type: TypeA, Class: ClassIN}},
+			},
+
+			rcode: FormErr,
+		},
+		{
+			name: "query",
+
+			msg: &Message{
+				Questions: []Question{{Name: "example.", Type: TypeSOA, Class: ClassIN}},
+			},
+
+			rcode: NotImp,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			refreshc := make(chan refresh, 1)
+
+			srv := mustServer(&NotifyHandler{
+				Zones:     []string{"example."},
+				Primaries: test.primaries,
+				Refresh: func(zone string, soa *SOA, from net.Addr) {
+					refreshc <- refresh{zone: zone, soa: soa}
+				},
+			})
+
+			addr, err := net.ResolveUDPAddr("udp", srv.Addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			msg, err := new(Client).Do(context.Background(), &Query{
+				Message:    test.msg,
+				RemoteAddr: addr,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want, got := test.rcode, msg.RCode; want != got {
+				t.Errorf("want rcode %d, got %d", want, got)
+			}
+			if want, got := test.msg.OpCode, msg.OpCode; want != got {
+				t.Errorf("want opcode %d, got %d", want, got)
+			}
+
+			if test.refresh == nil {
+				select {
+				case r := <-refreshc:
+					t.Errorf("want no refresh, got %+v", r)
+				case <-time.After(50 * time.Millisecond):
+				}
+				return
+			}
+
+			if !msg.Authoritative {
+				t.Error("want authoritative acknowledgement")
+			}
+
+			select {
+			case r := <-refreshc:
+				if want, got := *test.refresh, r; !reflect.DeepEqual(want, got) {
+					t.Errorf("want refresh %+v, got %+v", want, got)
+				}
+			case <-time.After(time.Second):
+				t.Error("want refresh")
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package dns
+
+import "github.com/benburkert/dns/edns"
+
+// RequestNSID adds an empty NSID option (RFC 5001) to the OPT record of the
+// query msg, to request the name server identifier of the server. An OPT
+// record is added if msg has none.
+func RequestNSID(msg *Message) {
+	msg.Additionals = setOption(msg.Additionals, edns.Option{Code: edns.OptionCodeNSID})
+}
+
+// NSID returns the name server identifier in the NSID option (RFC 5001) of
+// the response msg. It reports whether msg has a non-empty identifier.
+func NSID(msg *Message) (string, bool) {
+	o, ok := findOption(msg, edns.OptionCodeNSID)
+	if !ok || len(o.Data) == 0 {
+		return "", false
+	}
+	return string(o.Data), true
+}
+
+// setNSID sets the NSID option of the response res to nsid, if the query
+// requested it.
+func setNSID(query, res *Message, nsid string) {
+	if _, ok := findOption(query, edns.OptionCodeNSID); ok {
+		res.Additionals = setOption(res.Additionals, edns.Option{Code: edns.OptionCodeNSID, Data: []byte(nsid)})
+	}
+}
+
+// findOption returns the first option of the code in the OPT record of msg.
+func findOption(msg *Message, code edns.OptionCode) (edns.Option, bool) {
+	for _, res := range msg.Additionals {
+		opt, ok := res.Record.(*OPT)
+		if !ok {
+			continue
+		}
+
+		for _, o := range opt.Options {
+			if o.Code == code {
+				return o, true
+			}
+		}
+	}
+	return edns.Option{}, false
+}
+
+// setOption returns a copy of rrs with the options of the first OPT record of
+// the same code replaced by option. An OPT record is added if rrs has none.
+func setOption(rrs []Resource, option edns.Option) []Resource {
+	out := make([]Resource, 0, len(rrs)+1)
+	found := false
+	for _, res := range rrs {
+		if opt, ok := res.Record.(*OPT); ok && !found {
+			options := make([]edns.Option, 0, len(opt.Options)+1)
+			for _, o := range opt.Options {
+				if o.Code != option.Code {
+					options = append(options, o)
+				}
+			}
+			res.Record, found = &OPT{Options: append(options, option)}, true
+		}
+		out = append(out, res)
+	}
+
+	if !found {
+		out = append(out, Resource{
+			Name:   ".",
+			Class:  defaultUDPSize,
+			Record: &OPT{Options: []edns.Option{option}},
+		})
+	}
+	return out
+}
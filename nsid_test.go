@@ -0,0 +1,120 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/benburkert/dns/edns"
+)
+
+func TestServerNSID(t *testing.T) {
+	t.Parallel()
+
+	srv := &Server{
+		Addr:    mustUnusedAddr(),
+		Handler: &answerHandler{answers},
+		NSID:    "ns1.example",
+	}
+	mustStart(srv)
+
+	anon := mustServer(&answerHandler{answers})
+
+	tests := []struct {
+		name string
+
+		srv     *Server
+		request bool
+
+		nsid string
+		ok   bool
+	}{
+		{
+			name: "requested",
+
+			srv:     srv,
+			request: true,
+
+			nsid: "ns1.example",
+			ok:   true,
+		},
+		{
+			name: "not-requested",
+
+			srv: srv,
+		},
+		{
+			name: "not-configured",
+
+			srv:     anon,
+			request: true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			addr, err := net.ResolveUDPAddr("udp", test.srv.Addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			query := &Query{
+				RemoteAddr: addr,
+				Message: &Message{
+					Questions: []Question{questions["A"]},
+				},
+			}
+			if test.request {
+				RequestNSID(query.Message)
+			}
+
+			msg, err := new(Client).Do(context.Background(), query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, got := 1, len(msg.Answers); want != got {
+				t.Errorf("want %d answers, got %d", want, got)
+			}
+
+			nsid, ok := NSID(msg)
+			if want, got := test.ok, ok; want != got {
+				t.Errorf("want NSID %t, got %t", want, got)
+			}
+			if want, got := test.nsid, nsid; want != got {
+				t.Errorf("want NSID %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestRequestNSID(t *testing.T) {
+	t.Parallel()
+
+	cookie := edns.Option{Code: edns.OptionCodeCookie, Data: []byte{1, 2, 3, 4, 5, 6, 7, 8}}
+
+	msg := &Message{
+		Additionals: []Resource{
+			{Name: ".", Class: 4096, Record: &OPT{Options: []edns.Option{cookie}}},
+		},
+	}
+	RequestNSID(msg)
+	RequestNSID(msg)
+
+	want := []Resource{
+		{
+			Name:  ".",
+			Class: 4096,
+			Record: &OPT{
+				Options: []edns.Option{cookie, {Code: edns.OptionCodeNSID}},
+			},
+		},
+	}
+	if got := msg.Additionals; !reflect.DeepEqual(want, got) {
+		t.Errorf("want additionals %+v, got %+v", want, got)
+	}
+}
@@ -0,0 +1,215 @@
+package dns
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+type packetMux struct {
+	net.PacketConn
+
+	mu       sync.Mutex
+	inflight map[packetMuxKey]pipelineTx
+	readerr  error
+}
+
+// packetMuxKey identifies a query by the DNS server address, the message ID,
+// and the question, so that a response is only delivered for the question
+// it answers.
+type packetMuxKey struct {
+	addr string
+	id   int
+	q    Question
+}
+
+func newPacketMuxKey(addr net.Addr, msg *Message) packetMuxKey {
+	return packetMuxKey{
+		addr: addr.String(),
+		id:   msg.ID,
+		q:    firstQuestion(msg),
+	}
+}
+
+func (p *packetMux) alive() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.readerr == nil
+}
+
+func (p *packetMux) conn(addr net.Addr) Conn {
+	return &packetMuxConn{
+		packetMux: p,
+		addr:      addr,
+		keys:      make(map[packetMuxKey]struct{}),
+		tx: pipelineTx{
+			msgerrc: make(chan msgerr),
+			abortc:  make(chan struct{}),
+		},
+	}
+}
+
+func (p *packetMux) run() {
+	var (
+		buf = make([]byte, maxStreamLen) // large enough for any EDNS payload size
+		err error
+	)
+
+	for {
+		var (
+			n    int
+			addr net.Addr
+		)
+		if n, addr, err = p.ReadFrom(buf); err != nil {
+			break
+		}
+
+		msg := new(Message)
+		if _, err := msg.Unpack(buf[:n]); err != nil {
+			continue
+		}
+
+		key := newPacketMuxKey(addr, msg)
+
+		p.mu.Lock()
+		tx, ok := p.inflight[key]
+		delete(p.inflight, key)
+		p.mu.Unlock()
+
+		if !ok {
+			continue
+		}
+
+		go tx.deliver(msgerr{msg: msg})
+	}
+
+	p.mu.Lock()
+	p.readerr = err
+	txs := make([]pipelineTx, 0, len(p.inflight))
+	for _, tx := range p.inflight {
+		txs = append(txs, tx)
+	}
+	p.mu.Unlock()
+
+	for _, tx := range txs {
+		go tx.deliver(msgerr{err: err})
+	}
+}
+
+type packetMuxConn struct {
+	*packetMux
+
+	addr net.Addr
+
+	aborto sync.Once
+	tx     pipelineTx
+	keys   map[packetMuxKey]struct{} // guarded by packetMux.mu
+
+	readDeadline time.Time
+}
+
+func (c *packetMuxConn) Read([]byte) (int, error)  { return 0, ErrUnsupportedOp }
+func (c *packetMuxConn) Write([]byte) (int, error) { return 0, ErrUnsupportedOp }
+
+func (c *packetMuxConn) RemoteAddr() net.Addr { return c.addr }
+
+func (c *packetMuxConn) Close() error {
+	c.aborto.Do(func() {
+		c.tx.abort()
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		// a key answered by the reader may have been registered again by
+		// another conn
+		for key := range c.keys {
+			if tx, ok := c.inflight[key]; ok && tx == c.tx {
+				delete(c.inflight, key)
+			}
+		}
+	})
+	return nil
+}
+
+func (c *packetMuxConn) Recv(msg *Message) error {
+	var timeoutc <-chan time.Time
+	if !c.readDeadline.IsZero() {
+		timer := time.NewTimer(time.Until(c.readDeadline))
+		defer timer.Stop()
+
+		timeoutc = timer.C
+	}
+
+	var me msgerr
+	select {
+	case me = <-c.tx.msgerrc:
+	case <-c.tx.abortc:
+		return io.ErrUnexpectedEOF
+	case <-timeoutc:
+		c.Close()
+		return timeoutError{}
+	}
+
+	if err := me.err; err != nil {
+		return err
+	}
+
+	*msg = *me.msg // shallow copy
+	return nil
+}
+
+func (c *packetMuxConn) Send(msg *Message) error {
+	buf, err := msg.Pack(nil, true)
+	if err != nil {
+		return err
+	}
+	if len(buf) > maxPacketLen {
+		return ErrOversizedMessage
+	}
+
+	if err := c.register(msg); err != nil {
+		return err
+	}
+
+	_, err = c.WriteTo(buf, c.addr)
+	return err
+}
+
+func (c *packetMuxConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *packetMuxConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline = t
+	return nil
+}
+
+func (c *packetMuxConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *packetMuxConn) register(msg *Message) error {
+	key := newPacketMuxKey(c.addr, msg)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.readerr != nil {
+		return c.readerr
+	}
+	if _, ok := c.inflight[key]; ok {
+		return ErrConflictingID
+	}
+
+	c.inflight[key] = c.tx
+	c.keys[key] = struct{}{}
+	return nil
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
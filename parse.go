@@ -0,0 +1,887 @@
+package dns
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errParseFields = errors.New("missing record fields")
+	errParseQuote  = errors.New("unterminated quoted string")
+	errParseEscape = errors.New("invalid escape sequence")
+	errParseTTL    = errors.New("invalid TTL")
+	errParseType   = errors.New("unsupported record type")
+	errParseClass  = errors.New("unsupported class")
+	errParseName   = errors.New("domain name not fully qualified")
+	errParseRDATA  = errors.New("invalid record data")
+)
+
+// typeNames are the presentation format mnemonics of the record types.
+var typeNames = map[string]Type{
+	"A":          TypeA,
+	"NS":         TypeNS,
+	"CNAME":      TypeCNAME,
+	"SOA":        TypeSOA,
+	"PTR":        TypePTR,
+	"HINFO":      TypeHINFO,
+	"MX":         TypeMX,
+	"TXT":        TypeTXT,
+	"RP":         TypeRP,
+	"AFSDB":      TypeAFSDB,
+	"AAAA":       TypeAAAA,
+	"LOC":        TypeLOC,
+	"SRV":        TypeSRV,
+	"NAPTR":      TypeNAPTR,
+	"CERT":       TypeCERT,
+	"DNAME":      TypeDNAME,
+	"TLSA":       TypeTLSA,
+	"SMIMEA":     TypeSMIMEA,
+	"OPT":        TypeOPT,
+	"DS":         TypeDS,
+	"RRSIG":      TypeRRSIG,
+	"NSEC":       TypeNSEC,
+	"DNSKEY":     TypeDNSKEY,
+	"NSEC3":      TypeNSEC3,
+	"NSEC3PARAM": TypeNSEC3PARAM,
+	"OPENPGPKEY": TypeOPENPGPKEY,
+	"ZONEMD":     TypeZONEMD,
+	"SVCB":       TypeSVCB,
+	"HTTPS":      TypeHTTPS,
+	"TSIG":       TypeTSIG,
+	"AXFR":       TypeAXFR,
+	"ANY":        TypeALL,
+	"URI":        TypeURI,
+	"CAA":        TypeCAA,
+	"ALIAS":      TypeALIAS,
+}
+
+// ParseType parses a record type mnemonic, such as "AAAA", or a generic type
+// of the form TYPENNN (RFC 3597, section 5).
+func ParseType(s string) (Type, error) {
+	s = strings.ToUpper(s)
+	if typ, ok := typeNames[s]; ok {
+		return typ, nil
+	}
+	if !strings.HasPrefix(s, "TYPE") {
+		return 0, errParseType
+	}
+
+	v, err := strconv.ParseUint(s[4:], 10, 16)
+	if err != nil {
+		return 0, errParseType
+	}
+	return Type(v), nil
+}
+
+// String returns the mnemonic of t, or the generic form TYPENNN.
+func (t Type) String() string {
+	for name, typ := range typeNames {
+		if typ == t {
+			return name
+		}
+	}
+	return "TYPE" + strconv.Itoa(int(t))
+}
+
+// ParseClass parses a class mnemonic, such as "IN", or a generic class of the
+// form CLASSNNN (RFC 3597, section 5).
+func ParseClass(s string) (Class, error) {
+	s = strings.ToUpper(s)
+	if class, ok := classNames[s]; ok {
+		return class, nil
+	}
+	if !strings.HasPrefix(s, "CLASS") {
+		return 0, errParseClass
+	}
+
+	v, err := strconv.ParseUint(s[5:], 10, 16)
+	if err != nil {
+		return 0, errParseClass
+	}
+	return Class(v), nil
+}
+
+// String returns the mnemonic of c, or the generic form CLASSNNN.
+func (c Class) String() string {
+	for name, class := range classNames {
+		if class == c {
+			return name
+		}
+	}
+	return "CLASS" + strconv.Itoa(int(c))
+}
+
+// classNames are the presentation format mnemonics of the classes.
+var classNames = map[string]Class{
+	"IN":   ClassIN,
+	"CH":   ClassCH,
+	"HS":   ClassHS,
+	"NONE": ClassNONE,
+	"ANY":  ClassANY,
+}
+
+// ParseRecord parses a resource record in presentation format (RFC 1035,
+// section 5.1), such as:
+//
+//	example.com. 300 IN MX 10 mail.example.com.
+//
+// The TTL and class are optional and may appear in either order. Domain names
+// must be fully qualified. The TTL may be a number of seconds, or a duration
+// with the units s, m, h, d, and w, such as "1h30m". The RDATA of any type may
+// be in the generic format of RFC 3597, section 5, such as:
+//
+//	example.com. 300 IN TYPE65280 \# 4 0A000001
+func ParseRecord(s string) (string, time.Duration, Record, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	if len(tokens) < 2 {
+		return "", 0, nil, errParseFields
+	}
+
+	name := tokens[0]
+	if !isFQDN(name) {
+		return "", 0, nil, errParseName
+	}
+	tokens = tokens[1:]
+
+	var (
+		ttl time.Duration
+
+		hasTTL, hasClass bool
+	)
+
+	for len(tokens) > 0 {
+		tok := strings.ToUpper(tokens[0])
+		if _, ok := classNames[tok]; ok && !hasClass {
+			hasClass = true
+		} else if tok != "" && tok[0] >= '0' && tok[0] <= '9' && !hasTTL {
+			if ttl, err = parseTTL(tok); err != nil {
+				return "", 0, nil, err
+			}
+			hasTTL = true
+		} else {
+			break
+		}
+		tokens = tokens[1:]
+	}
+	if len(tokens) == 0 {
+		return "", 0, nil, errParseFields
+	}
+
+	typ, err := ParseType(tokens[0])
+	if err != nil {
+		return "", 0, nil, err
+	}
+
+	rec, err := parseRDATA(typ, tokens[1:])
+	if err != nil {
+		return "", 0, nil, err
+	}
+	return name, ttl, rec, nil
+}
+
+// parseRDATA parses the presentation format fields of a record.
+func parseRDATA(typ Type, fields []string) (Record, error) {
+	if len(fields) > 0 && fields[0] == `\#` {
+		return parseGenericRDATA(typ, fields[1:])
+	}
+
+	p := &rdataParser{fields: fields}
+
+	var rec Record
+	switch typ {
+	case TypeA:
+		ip := net.ParseIP(p.next()).To4()
+		if ip == nil {
+			p.fail()
+		}
+		rec = &A{A: ip}
+	case TypeAAAA:
+		tok := p.next()
+		ip := net.ParseIP(tok)
+		if ip == nil || !strings.Contains(tok, ":") {
+			p.fail()
+		}
+		rec = &AAAA{AAAA: ip}
+	case TypeLOC:
+		rec = &LOC{
+			Latitude:  p.coord("N", "S"),
+			Longitude: p.coord("E", "W"),
+			Altitude:  p.distance(),
+			Size:      p.meters(1),
+			HorizPre:  p.meters(10000),
+			VertPre:   p.meters(10),
+		}
+	case TypeNS:
+		rec = &NS{NS: p.name()}
+	case TypeCNAME:
+		rec = &CNAME{CNAME: p.name()}
+	case TypePTR:
+		rec = &PTR{PTR: p.name()}
+	case TypeDNAME:
+		rec = &DNAME{DNAME: p.name()}
+	case TypeALIAS:
+		rec = &ALIAS{ALIAS: p.name()}
+	case TypeMX:
+		rec = &MX{Pref: p.uint(16), MX: p.name()}
+	case TypeSOA:
+		rec = &SOA{
+			NS:      p.name(),
+			MBox:    p.name(),
+			Serial:  p.uint(32),
+			Refresh: p.ttl(),
+			Retry:   p.ttl(),
+			Expire:  p.ttl(),
+			MinTTL:  p.ttl(),
+		}
+	case TypeTXT:
+		if len(fields) == 0 {
+			p.fail()
+		}
+		rec, p.fields = &TXT{TXT: append([]string(nil), fields...)}, nil
+	case TypeHINFO:
+		rec = &HINFO{CPU: p.next(), OS: p.next()}
+	case TypeRP:
+		rec = &RP{MBox: p.name(), TXT: p.name()}
+	case TypeAFSDB:
+		rec = &AFSDB{Subtype: p.uint(16), Hostname: p.name()}
+	case TypeSRV:
+		rec = &SRV{
+			Priority: p.uint(16),
+			Weight:   p.uint(16),
+			Port:     p.uint(16),
+			Target:   p.name(),
+		}
+	case TypeNAPTR:
+		rec = &NAPTR{
+			Order:       p.uint(16),
+			Preference:  p.uint(16),
+			Flags:       p.next(),
+			Service:     p.next(),
+			Regexp:      p.next(),
+			Replacement: p.name(),
+		}
+	case TypeURI:
+		rec = &URI{Priority: p.uint(16), Weight: p.uint(16), Target: p.next()}
+	case TypeCAA:
+		flags := p.uint(8)
+		rec = &CAA{
+			IssuerCritical: flags&caaIssuerCritical != 0,
+			Tag:            p.next(),
+			Value:          p.next(),
+		}
+	case TypeCERT:
+		rec = &CERT{
+			CertType:    p.uint(16),
+			KeyTag:      p.uint(16),
+			Algorithm:   p.uint(8),
+			Certificate: p.base64(),
+		}
+	case TypeTLSA:
+		rec = &TLSA{
+			Usage:        p.uint(8),
+			Selector:     p.uint(8),
+			MatchingType: p.uint(8),
+			Data:         p.hex(),
+		}
+	case TypeSMIMEA:
+		rec = &SMIMEA{
+			Usage:        p.uint(8),
+			Selector:     p.uint(8),
+			MatchingType: p.uint(8),
+			Data:         p.hex(),
+		}
+	case TypeDNSKEY:
+		rec = &DNSKEY{
+			Flags:     p.uint(16),
+			Protocol:  p.uint(8),
+			Algorithm: p.uint(8),
+			PublicKey: p.base64(),
+		}
+	case TypeDS:
+		rec = &DS{
+			KeyTag:     p.uint(16),
+			Algorithm:  p.uint(8),
+			DigestType: p.uint(8),
+			Digest:     p.hex(),
+		}
+	case TypeRRSIG:
+		rec = &RRSIG{
+			TypeCovered: p.typ(),
+			Algorithm:   p.uint(8),
+			Labels:      p.uint(8),
+			OriginalTTL: p.ttl(),
+			Expiration:  p.time(),
+			Inception:   p.time(),
+			KeyTag:      p.uint(16),
+			SignerName:  p.name(),
+			Signature:   p.base64(),
+		}
+	case TypeNSEC:
+		rec = &NSEC{NextDomain: p.name(), Types: p.types()}
+	case TypeNSEC3:
+		rec = &NSEC3{
+			HashAlgorithm: p.uint(8),
+			Flags:         p.uint(8),
+			Iterations:    p.uint(16),
+			Salt:          p.salt(),
+			NextHashed:    p.base32hex(),
+			Types:         p.types(),
+		}
+	case TypeNSEC3PARAM:
+		rec = &NSEC3PARAM{
+			HashAlgorithm: p.uint(8),
+			Flags:         p.uint(8),
+			Iterations:    p.uint(16),
+			Salt:          p.salt(),
+		}
+	case TypeOPENPGPKEY:
+		rec = &OPENPGPKEY{PublicKey: p.base64()}
+	case TypeZONEMD:
+		rec = &ZONEMD{
+			Serial: p.uint(32),
+			Scheme: p.uint(8),
+			Hash:   p.uint(8),
+			Digest: p.hex(),
+		}
+	case TypeSVCB, TypeHTTPS:
+		svcb := SVCB{
+			Priority: p.uint(16),
+			Target:   p.name(),
+		}
+		svcb.Params = p.svcParams()
+
+		if rec = &svcb; typ == TypeHTTPS {
+			rec = &HTTPS{SVCB: svcb}
+		}
+	default:
+		return nil, errParseType
+	}
+
+	if p.err == nil && len(p.fields) > 0 {
+		p.fail()
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	return rec, nil
+}
+
+// parseGenericRDATA parses the fields following the \# token of the generic
+// RDATA format: the RDATA length and the hex encoded RDATA (RFC 3597, section
+// 5). The RDATA of a known type is decoded into its Record implementation.
+func parseGenericRDATA(typ Type, fields []string) (Record, error) {
+	if len(fields) == 0 {
+		return nil, errParseFields
+	}
+
+	n, err := strconv.ParseUint(fields[0], 10, 16)
+	if err != nil {
+		return nil, errParseRDATA
+	}
+	data, err := hex.DecodeString(strings.Join(fields[1:], ""))
+	if err != nil || len(data) != int(n) {
+		return nil, errParseRDATA
+	}
+
+	newfn, ok := NewRecordByType[typ]
+	if !ok {
+		return &RawRecord{RRType: typ, Data: data}, nil
+	}
+
+	rec := newfn()
+	if buf, err := rec.Unpack(data, decompressor(data)); err != nil || len(buf) > 0 {
+		return nil, errParseRDATA
+	}
+	return rec, nil
+}
+
+// rdataParser consumes the presentation format fields of a record. The first
+// error encountered is recorded, and subsequent calls return zero values.
+type rdataParser struct {
+	fields []string
+	err    error
+}
+
+func (p *rdataParser) fail() {
+	if p.err == nil {
+		p.err = errParseRDATA
+	}
+}
+
+func (p *rdataParser) next() string {
+	if p.err != nil {
+		return ""
+	}
+	if len(p.fields) == 0 {
+		p.err = errParseFields
+		return ""
+	}
+
+	tok := p.fields[0]
+	p.fields = p.fields[1:]
+	return tok
+}
+
+func (p *rdataParser) name() string {
+	tok := p.next()
+	if p.err == nil && !isFQDN(tok) {
+		p.err = errParseName
+	}
+	return tok
+}
+
+func (p *rdataParser) uint(bits int) int {
+	tok := p.next()
+	if p.err != nil {
+		return 0
+	}
+
+	v, err := strconv.ParseUint(tok, 10, bits)
+	if err != nil {
+		p.fail()
+	}
+	return int(v)
+}
+
+func (p *rdataParser) ttl() time.Duration {
+	tok := p.next()
+	if p.err != nil {
+		return 0
+	}
+
+	d, err := parseTTL(tok)
+	if err != nil {
+		p.err = err
+	}
+	return d
+}
+
+// base64 consumes the remaining fields as a base64 encoded value.
+func (p *rdataParser) base64() []byte {
+	if p.err != nil {
+		return nil
+	}
+
+	b, err := base64.StdEncoding.DecodeString(strings.Join(p.fields, ""))
+	if err != nil || len(b) == 0 {
+		p.fail()
+	}
+	p.fields = nil
+	return b
+}
+
+// hex consumes the remaining fields as a hex encoded value.
+func (p *rdataParser) hex() []byte {
+	if p.err != nil {
+		return nil
+	}
+
+	b, err := hex.DecodeString(strings.Join(p.fields, ""))
+	if err != nil || len(b) == 0 {
+		p.fail()
+	}
+	p.fields = nil
+	return b
+}
+
+// salt parses a hex encoded NSEC3 salt, or "-" for an empty salt.
+func (p *rdataParser) salt() []byte {
+	tok := p.next()
+	if p.err != nil || tok == "-" {
+		return nil
+	}
+
+	b, err := hex.DecodeString(tok)
+	if err != nil || len(b) == 0 {
+		p.fail()
+	}
+	return b
+}
+
+// base32hex parses a hashed owner name in base32 with the extended hex
+// alphabet.
+func (p *rdataParser) base32hex() []byte {
+	tok := p.next()
+	if p.err != nil {
+		return nil
+	}
+
+	b, err := nsec3Encoding.DecodeString(strings.ToLower(tok))
+	if err != nil || len(b) == 0 {
+		p.fail()
+	}
+	return b
+}
+
+// coord parses a LOC latitude or longitude of degrees, optional minutes and
+// seconds, and a hemisphere of pos or neg.
+func (p *rdataParser) coord(pos, neg string) float64 {
+	var ms float64 // thousandths of an arc second
+	for unit := float64(locArcSecMs); p.err == nil; unit /= 60 {
+		tok := strings.ToUpper(p.next())
+		switch {
+		case p.err != nil:
+			return 0
+		case tok == pos && unit < locArcSecMs:
+			return ms / locArcSecMs
+		case tok == neg && unit < locArcSecMs:
+			return -ms / locArcSecMs
+		case unit < 1000:
+			p.fail()
+			return 0
+		}
+
+		f, err := strconv.ParseFloat(tok, 64)
+		if err != nil || f < 0 {
+			p.fail()
+		}
+		ms += math.Floor(f*unit + 0.5)
+	}
+	return 0
+}
+
+// distance parses a LOC distance in meters, with an optional "m" suffix.
+func (p *rdataParser) distance() float64 {
+	tok := p.next()
+	if p.err != nil {
+		return 0
+	}
+
+	v, err := strconv.ParseFloat(strings.TrimSuffix(tok, "m"), 64)
+	if err != nil {
+		p.fail()
+	}
+	return v
+}
+
+// meters parses an optional LOC distance, or returns def if there are no
+// fields remaining.
+func (p *rdataParser) meters(def float64) float64 {
+	if p.err != nil || len(p.fields) == 0 {
+		return def
+	}
+	return p.distance()
+}
+
+// typ parses a type mnemonic, or a generic type of the form TYPENNN.
+func (p *rdataParser) typ() Type {
+	tok := p.next()
+	if p.err != nil {
+		return 0
+	}
+
+	typ, err := ParseType(tok)
+	if err != nil {
+		p.fail()
+	}
+	return typ
+}
+
+// types consumes the remaining fields as a type bitmap.
+func (p *rdataParser) types() TypeBitmap {
+	var types TypeBitmap
+	for p.err == nil && len(p.fields) > 0 {
+		types = append(types, p.typ())
+	}
+	return types
+}
+
+// time parses a timestamp of the form YYYYMMDDHHmmSS in UTC, or a number of
+// seconds since the epoch (RFC 4034, section 3.2).
+func (p *rdataParser) time() time.Time {
+	tok := p.next()
+	if p.err != nil {
+		return time.Time{}
+	}
+
+	if len(tok) == 14 {
+		t, err := time.Parse("20060102150405", tok)
+		if err != nil {
+			p.fail()
+		}
+		return t
+	}
+
+	v, err := strconv.ParseUint(tok, 10, 32)
+	if err != nil {
+		p.fail()
+	}
+	return time.Unix(int64(v), 0)
+}
+
+// svcParamNames are the presentation format names of the SVCB parameter keys.
+var svcParamNames = map[string]SVCParamKey{
+	"mandatory":       SVCParamMandatory,
+	"alpn":            SVCParamALPN,
+	"no-default-alpn": SVCParamNoDefaultALPN,
+	"port":            SVCParamPort,
+	"ipv4hint":        SVCParamIPv4Hint,
+	"ech":             SVCParamECH,
+	"ipv6hint":        SVCParamIPv6Hint,
+}
+
+// svcParams consumes the remaining fields as SVCB parameters of the form
+// key=value, sorted by key.
+func (p *rdataParser) svcParams() []SVCParam {
+	var params []SVCParam
+	for p.err == nil && len(p.fields) > 0 {
+		tok := p.next()
+
+		name, value, hasValue := tok, "", false
+		if i := strings.IndexByte(tok, '='); i >= 0 {
+			name, value, hasValue = tok[:i], tok[i+1:], true
+		}
+
+		key, ok := parseSVCParamKey(name)
+		if !ok {
+			p.fail()
+			break
+		}
+
+		param, err := parseSVCParam(key, value, hasValue)
+		if err != nil {
+			p.fail()
+			break
+		}
+		params = append(params, param)
+	}
+
+	sort.Slice(params, func(i, j int) bool { return params[i].Key < params[j].Key })
+	for i := 1; i < len(params); i++ {
+		if params[i].Key == params[i-1].Key {
+			p.fail()
+		}
+	}
+	return params
+}
+
+// parseSVCParamKey parses a parameter key name, or a generic key of the form
+// keyNNNNN.
+func parseSVCParamKey(name string) (SVCParamKey, bool) {
+	name = strings.ToLower(name)
+	if key, ok := svcParamNames[name]; ok {
+		return key, true
+	}
+	if !strings.HasPrefix(name, "key") {
+		return 0, false
+	}
+
+	v, err := strconv.ParseUint(name[3:], 10, 16)
+	if err != nil {
+		return 0, false
+	}
+	return SVCParamKey(v), true
+}
+
+func parseSVCParam(key SVCParamKey, value string, hasValue bool) (SVCParam, error) {
+	if key == SVCParamNoDefaultALPN {
+		if hasValue {
+			return SVCParam{}, errParseRDATA
+		}
+		return NoDefaultALPNParam(), nil
+	}
+	if !hasValue || value == "" {
+		if key <= SVCParamIPv6Hint {
+			return SVCParam{}, errParseRDATA
+		}
+		return SVCParam{Key: key, Value: []byte{}}, nil
+	}
+
+	var param SVCParam
+	switch key {
+	case SVCParamMandatory:
+		var keys []SVCParamKey
+		for _, name := range strings.Split(value, ",") {
+			k, ok := parseSVCParamKey(name)
+			if !ok || k == SVCParamMandatory {
+				return SVCParam{}, errParseRDATA
+			}
+			keys = append(keys, k)
+		}
+		param = MandatoryParam(keys...)
+	case SVCParamALPN:
+		param = ALPNParam(strings.Split(value, ",")...)
+	case SVCParamPort:
+		port, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return SVCParam{}, errParseRDATA
+		}
+		param = PortParam(uint16(port))
+	case SVCParamIPv4Hint, SVCParamIPv6Hint:
+		var ips []net.IP
+		for _, s := range strings.Split(value, ",") {
+			ip := net.ParseIP(s)
+			if ip == nil || strings.Contains(s, ":") != (key == SVCParamIPv6Hint) {
+				return SVCParam{}, errParseRDATA
+			}
+			ips = append(ips, ip)
+		}
+		if key == SVCParamIPv4Hint {
+			param = IPv4HintParam(ips...)
+		} else {
+			param = IPv6HintParam(ips...)
+		}
+	case SVCParamECH:
+		b, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return SVCParam{}, errParseRDATA
+		}
+		param = ECHParam(b)
+	default:
+		param = SVCParam{Key: key, Value: []byte(value)}
+	}
+
+	if err := param.checkValue(); err != nil {
+		return SVCParam{}, errParseRDATA
+	}
+	return param, nil
+}
+
+// parseTTL parses a TTL of seconds, or of a BIND style duration such as
+// "1h30m".
+func parseTTL(s string) (time.Duration, error) {
+	if secs, err := strconv.ParseUint(s, 10, 31); err == nil {
+		return time.Duration(secs) * time.Second, nil
+	}
+
+	var (
+		ttl time.Duration
+		n   uint64
+		num bool
+	)
+
+	for _, c := range strings.ToLower(s) {
+		if c >= '0' && c <= '9' {
+			n, num = n*10+uint64(c-'0'), true
+			if n > 1<<31 {
+				return 0, errParseTTL
+			}
+			continue
+		}
+		if !num {
+			return 0, errParseTTL
+		}
+
+		var unit time.Duration
+		switch c {
+		case 's':
+			unit = time.Second
+		case 'm':
+			unit = time.Minute
+		case 'h':
+			unit = time.Hour
+		case 'd':
+			unit = 24 * time.Hour
+		case 'w':
+			unit = 7 * 24 * time.Hour
+		default:
+			return 0, errParseTTL
+		}
+
+		ttl += time.Duration(n) * unit
+		n, num = 0, false
+	}
+
+	if num || ttl <= 0 || ttl/time.Second > 1<<31-1 {
+		return 0, errParseTTL
+	}
+	return ttl, nil
+}
+
+// tokenize splits a presentation format line into fields. Quoted strings are
+// a single field, parentheses are ignored, and a semicolon outside of a quoted
+// string starts a comment.
+func tokenize(s string) ([]string, error) {
+	var (
+		tokens []string
+		tok    []byte
+
+		quoted, inTok bool
+	)
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case !quoted && !inTok && isGenericToken(s[i:]):
+			tokens = append(tokens, `\#`)
+			i++
+		case c == '\\':
+			b, n, err := unescape(s[i+1:])
+			if err != nil {
+				return nil, err
+			}
+			tok, inTok = append(tok, b), true
+			i += n
+		case c == '"':
+			if quoted {
+				tokens = append(tokens, string(tok))
+				tok, inTok = tok[:0], false
+			}
+			quoted = !quoted
+		case quoted:
+			tok = append(tok, c)
+		case c == ';':
+			i = len(s)
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '(' || c == ')':
+			if inTok {
+				tokens = append(tokens, string(tok))
+				tok, inTok = tok[:0], false
+			}
+		default:
+			tok, inTok = append(tok, c), true
+		}
+	}
+
+	if quoted {
+		return nil, errParseQuote
+	}
+	if inTok {
+		tokens = append(tokens, string(tok))
+	}
+	return tokens, nil
+}
+
+// isGenericToken reports whether s begins with the \# token of the generic
+// RDATA format, which is not an escaped character.
+func isGenericToken(s string) bool {
+	if !strings.HasPrefix(s, `\#`) {
+		return false
+	}
+	return len(s) == 2 || strings.IndexByte(" \t\n\r()", s[2]) >= 0
+}
+
+// unescape decodes the escape sequence following a backslash: either a
+// single character, or three decimal digits. It returns the decoded byte and
+// the number of characters consumed.
+func unescape(s string) (byte, int, error) {
+	if len(s) == 0 {
+		return 0, 0, errParseEscape
+	}
+	if s[0] < '0' || s[0] > '9' {
+		return s[0], 1, nil
+	}
+	if len(s) < 3 {
+		return 0, 0, errParseEscape
+	}
+
+	v, err := strconv.ParseUint(s[:3], 10, 8)
+	if err != nil {
+		return 0, 0, errParseEscape
+	}
+	return byte(v), 3, nil
+}
+
+func isFQDN(name string) bool {
+	return strings.HasSuffix(name, ".")
+}
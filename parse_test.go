@@ -0,0 +1,381 @@
+package dns
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRecord(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input string
+
+		name   string
+		ttl    time.Duration
+		record Record
+	}{
+		{
+			input:  "example.com. 300 IN MX 10 mail.example.com.",
+			name:   "example.com.",
+			ttl:    300 * time.Second,
+			record: &MX{Pref: 10, MX: "mail.example.com."},
+		},
+		{
+			input:  "example.com. IN 1h A 192.0.2.1",
+			name:   "example.com.",
+			ttl:    time.Hour,
+			record: &A{A: net.IPv4(192, 0, 2, 1).To4()},
+		},
+		{
+			input:  "example.com. aaaa 2001:db8::1 ; comment",
+			name:   "example.com.",
+			record: &AAAA{AAAA: net.ParseIP("2001:db8::1")},
+		},
+		{
+			input:  "www.example.com. 1d2h CNAME example.com.",
+			name:   "www.example.com.",
+			ttl:    26 * time.Hour,
+			record: &CNAME{CNAME: "example.com."},
+		},
+		{
+			input: "example.com. 3600 IN SOA ns.example.com. hostmaster.example.com. ( 2024010101 1h 15m 1w 300 )",
+			name:  "example.com.",
+			ttl:   time.Hour,
+			record: &SOA{
+				NS:      "ns.example.com.",
+				MBox:    "hostmaster.example.com.",
+				Serial:  2024010101,
+				Refresh: time.Hour,
+				Retry:   15 * time.Minute,
+				Expire:  7 * 24 * time.Hour,
+				MinTTL:  5 * time.Minute,
+			},
+		},
+		{
+			input:  `example.com. 60 IN TXT "v=spf1 -all" "semi;colon" "quote\"d" \065BC`,
+			name:   "example.com.",
+			ttl:    time.Minute,
+			record: &TXT{TXT: []string{"v=spf1 -all", "semi;colon", `quote"d`, "ABC"}},
+		},
+		{
+			input:  "_sip._tcp.example.com. 60 IN SRV 10 5 5060 sip.example.com.",
+			name:   "_sip._tcp.example.com.",
+			ttl:    time.Minute,
+			record: &SRV{Priority: 10, Weight: 5, Port: 5060, Target: "sip.example.com."},
+		},
+		{
+			input:  `example.com. 60 IN CAA 128 issue "ca.example.net"`,
+			name:   "example.com.",
+			ttl:    time.Minute,
+			record: &CAA{IssuerCritical: true, Tag: "issue", Value: "ca.example.net"},
+		},
+		{
+			input:  `_ftp._tcp.example.com. 60 IN URI 10 1 "ftp://ftp1.example.com/public"`,
+			name:   "_ftp._tcp.example.com.",
+			ttl:    time.Minute,
+			record: &URI{Priority: 10, Weight: 1, Target: "ftp://ftp1.example.com/public"},
+		},
+		{
+			input:  `example.com. 60 IN HINFO "Intel Xeon" Linux`,
+			name:   "example.com.",
+			ttl:    time.Minute,
+			record: &HINFO{CPU: "Intel Xeon", OS: "Linux"},
+		},
+		{
+			input:  "example.com. 60 IN RP mbox.example.com. txt.example.com.",
+			name:   "example.com.",
+			ttl:    time.Minute,
+			record: &RP{MBox: "mbox.example.com.", TXT: "txt.example.com."},
+		},
+		{
+			input:  "example.com. 60 IN AFSDB 1 afs.example.com.",
+			name:   "example.com.",
+			ttl:    time.Minute,
+			record: &AFSDB{Subtype: 1, Hostname: "afs.example.com."},
+		},
+		{
+			input:  `example.com. 60 IN NAPTR 100 10 "S" "SIP+D2U" "" _sip._udp.example.com.`,
+			name:   "example.com.",
+			ttl:    time.Minute,
+			record: &NAPTR{Order: 100, Preference: 10, Flags: "S", Service: "SIP+D2U", Replacement: "_sip._udp.example.com."},
+		},
+		{
+			input:  "example.com. 60 IN CERT 1 12345 8 AQID BAU=",
+			name:   "example.com.",
+			ttl:    time.Minute,
+			record: &CERT{CertType: 1, KeyTag: 12345, Algorithm: 8, Certificate: []byte{1, 2, 3, 4, 5}},
+		},
+		{
+			input:  "cambridge.example.com. 60 IN LOC 42 21 54 N 71 06 18 W -24m 30m",
+			name:   "cambridge.example.com.",
+			ttl:    time.Minute,
+			record: &LOC{Latitude: 42.365, Longitude: -71.105, Altitude: -24, Size: 30, HorizPre: 10000, VertPre: 10},
+		},
+		{
+			input:  "example.com. 60 IN LOC 52 S 0.5 E 10 1 1 1",
+			name:   "example.com.",
+			ttl:    time.Minute,
+			record: &LOC{Latitude: -52, Longitude: 0.5, Altitude: 10, Size: 1, HorizPre: 1, VertPre: 1},
+		},
+		{
+			input:  "_443._tcp.example.com. 60 IN TLSA 3 1 1 DEADBEEF",
+			name:   "_443._tcp.example.com.",
+			ttl:    time.Minute,
+			record: &TLSA{Usage: 3, Selector: 1, MatchingType: 1, Data: []byte{0xDE, 0xAD, 0xBE, 0xEF}},
+		},
+		{
+			input:  "c93f1e400f26708f98cb19d936620da35eec8f72e57f9eec01c1afd6._smimecert.example.com. 60 IN SMIMEA 0 0 2 DEADBEEF",
+			name:   "c93f1e400f26708f98cb19d936620da35eec8f72e57f9eec01c1afd6._smimecert.example.com.",
+			ttl:    time.Minute,
+			record: &SMIMEA{Usage: 0, Selector: 0, MatchingType: 2, Data: []byte{0xDE, 0xAD, 0xBE, 0xEF}},
+		},
+		{
+			input:  `example.com. 60 IN TYPE65280 \# 4 DEAD BEEF`,
+			name:   "example.com.",
+			ttl:    time.Minute,
+			record: &RawRecord{RRType: 65280, Data: []byte{0xDE, 0xAD, 0xBE, 0xEF}},
+		},
+		{
+			input:  `example.com. 60 IN TYPE65280 \# 0`,
+			name:   "example.com.",
+			ttl:    time.Minute,
+			record: &RawRecord{RRType: 65280, Data: []byte{}},
+		},
+		{
+			input:  `example.com. 60 IN A \# 4 C0000201`,
+			name:   "example.com.",
+			ttl:    time.Minute,
+			record: &A{A: net.IPv4(192, 0, 2, 1).To4()},
+		},
+		{
+			input:  "dskey.example.com. 86400 IN DS 60485 5 1 2BB183AF5F22588179A53B0A98631FAD1A292118",
+			name:   "dskey.example.com.",
+			ttl:    24 * time.Hour,
+			record: &DS{KeyTag: 60485, Algorithm: 5, DigestType: 1, Digest: []byte{0x2B, 0xB1, 0x83, 0xAF, 0x5F, 0x22, 0x58, 0x81, 0x79, 0xA5, 0x3B, 0x0A, 0x98, 0x63, 0x1F, 0xAD, 0x1A, 0x29, 0x21, 0x18}},
+		},
+		{
+			input: "host.example.com. 86400 IN RRSIG A 5 3 86400 20030322173103 20030220173103 2642 example.com. 3q2+7w==",
+			name:  "host.example.com.",
+			ttl:   24 * time.Hour,
+			record: &RRSIG{
+				TypeCovered: TypeA,
+				Algorithm:   5,
+				Labels:      3,
+				OriginalTTL: 24 * time.Hour,
+				Expiration:  time.Date(2003, 3, 22, 17, 31, 3, 0, time.UTC),
+				Inception:   time.Date(2003, 2, 20, 17, 31, 3, 0, time.UTC),
+				KeyTag:      2642,
+				SignerName:  "example.com.",
+				Signature:   []byte{0xDE, 0xAD, 0xBE, 0xEF},
+			},
+		},
+		{
+			input:  "alfa.example.com. 86400 IN NSEC host.example.com. A MX RRSIG NSEC TYPE1234",
+			name:   "alfa.example.com.",
+			ttl:    24 * time.Hour,
+			record: &NSEC{NextDomain: "host.example.com.", Types: TypeBitmap{TypeA, TypeMX, TypeRRSIG, TypeNSEC, 1234}},
+		},
+		{
+			input:  "example.com. 60 IN ZONEMD 2024010101 1 1 0102 0304",
+			name:   "example.com.",
+			ttl:    time.Minute,
+			record: &ZONEMD{Serial: 2024010101, Scheme: 1, Hash: 1, Digest: []byte{1, 2, 3, 4}},
+		},
+		{
+			input: `example.com. 300 IN HTTPS 1 . alpn="h2,h3" port=8443 ipv4hint=192.0.2.1,192.0.2.2 mandatory=port,alpn`,
+			name:  "example.com.",
+			ttl:   5 * time.Minute,
+			record: &HTTPS{SVCB{
+				Priority: 1,
+				Target:   ".",
+				Params: []SVCParam{
+					MandatoryParam(SVCParamALPN, SVCParamPort),
+					ALPNParam("h2", "h3"),
+					PortParam(8443),
+					IPv4HintParam(net.IPv4(192, 0, 2, 1), net.IPv4(192, 0, 2, 2)),
+				},
+			}},
+		},
+		{
+			input: "_dns.example.com. SVCB 1 dns.example.com. key65000=opaque ipv6hint=2001:db8::1 no-default-alpn ech=AQID",
+			name:  "_dns.example.com.",
+			record: &SVCB{
+				Priority: 1,
+				Target:   "dns.example.com.",
+				Params: []SVCParam{
+					NoDefaultALPNParam(),
+					ECHParam([]byte{1, 2, 3}),
+					IPv6HintParam(net.ParseIP("2001:db8::1")),
+					{Key: 65000, Value: []byte("opaque")},
+				},
+			},
+		},
+		{
+			input:  "example.com. HTTPS 0 svc.example.com.",
+			name:   "example.com.",
+			record: &HTTPS{SVCB{Target: "svc.example.com."}},
+		},
+		{
+			input:  "1.2.0.192.in-addr.arpa. PTR host.example.com.",
+			name:   "1.2.0.192.in-addr.arpa.",
+			record: &PTR{PTR: "host.example.com."},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.input, func(t *testing.T) {
+			t.Parallel()
+
+			name, ttl, record, err := ParseRecord(test.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want, got := test.name, name; want != got {
+				t.Errorf("want name %q, got %q", want, got)
+			}
+			if want, got := test.ttl, ttl; want != got {
+				t.Errorf("want ttl %s, got %s", want, got)
+			}
+			if want, got := test.record, record; !reflect.DeepEqual(want, got) {
+				t.Errorf("want record %+v, got %+v", want, got)
+			}
+		})
+	}
+}
+
+func TestParseRecordErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input string
+		err   error
+	}{
+		{input: "example.com.", err: errParseFields},
+		{input: "example.com. 300 IN", err: errParseFields},
+		{input: "example.com 300 IN A 192.0.2.1", err: errParseName},
+		{input: "example.com. 300 IN MX 10 mail", err: errParseName},
+		{input: "example.com. 300 IN BOGUS 1", err: errParseType},
+		{input: "example.com. 300 IN A 2001:db8::1", err: errParseRDATA},
+		{input: "example.com. 300 IN A 192.0.2.1 extra", err: errParseRDATA},
+		{input: "example.com. 300 IN MX 65536 mail.example.com.", err: errParseRDATA},
+		{input: "example.com. 300 IN MX 10", err: errParseFields},
+		{input: "example.com. 300 IN HINFO x86", err: errParseFields},
+		{input: "example.com. 300 IN LOC 42 21 54 N 71 06 18 W", err: errParseFields},
+		{input: "example.com. 300 IN LOC 42 21 54 1 N 71 W 0", err: errParseRDATA},
+		{input: "example.com. 300 IN LOC N 71 W 0", err: errParseRDATA},
+		{input: `example.com. 300 IN TYPE65280 \#`, err: errParseFields},
+		{input: `example.com. 300 IN TYPE65280 \# 3 DEADBEEF`, err: errParseRDATA},
+		{input: `example.com. 300 IN A \# 2 C000`, err: errParseRDATA},
+		{input: "example.com. 1x IN A 192.0.2.1", err: errParseTTL},
+		{input: `example.com. 300 IN TXT "open`, err: errParseQuote},
+		{input: `example.com. 300 IN TXT \06`, err: errParseEscape},
+		{input: "example.com. 300 IN HTTPS 1 . port=8443 port=443", err: errParseRDATA},
+		{input: "example.com. 300 IN HTTPS 1 . port=65536", err: errParseRDATA},
+		{input: "example.com. 300 IN HTTPS 1 . ipv4hint=2001:db8::1", err: errParseRDATA},
+		{input: "example.com. 300 IN HTTPS 1 . ipv6hint=192.0.2.1", err: errParseRDATA},
+		{input: "example.com. 300 IN HTTPS 1 . bogus=1", err: errParseRDATA},
+		{input: "example.com. 300 IN HTTPS 1 . alpn", err: errParseRDATA},
+		{input: "example.com. 300 IN HTTPS 1 . no-default-alpn=h2", err: errParseRDATA},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.input, func(t *testing.T) {
+			t.Parallel()
+
+			if _, _, _, err := ParseRecord(test.input); err != test.err {
+				t.Errorf("want error %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestParseType(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input string
+		typ   Type
+		str   string
+		err   error
+	}{
+		{input: "AAAA", typ: TypeAAAA, str: "AAAA"},
+		{input: "https", typ: TypeHTTPS, str: "HTTPS"},
+		{input: "ANY", typ: TypeALL, str: "ANY"},
+		{input: "TYPE28", typ: TypeAAAA, str: "AAAA"},
+		{input: "TYPE65280", typ: 65280, str: "TYPE65280"},
+		{input: "TYPE65536", err: errParseType},
+		{input: "BOGUS", err: errParseType},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.input, func(t *testing.T) {
+			t.Parallel()
+
+			typ, err := ParseType(test.input)
+			if want, got := test.err, err; want != got {
+				t.Fatalf("want error %v, got %v", want, got)
+			}
+			if err != nil {
+				return
+			}
+
+			if want, got := test.typ, typ; want != got {
+				t.Errorf("want type %d, got %d", want, got)
+			}
+			if want, got := test.str, typ.String(); want != got {
+				t.Errorf("want string %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestParseClass(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input string
+		class Class
+		str   string
+		err   error
+	}{
+		{input: "IN", class: ClassIN, str: "IN"},
+		{input: "ch", class: ClassCH, str: "CH"},
+		{input: "CLASS1", class: ClassIN, str: "IN"},
+		{input: "CLASS4096", class: 4096, str: "CLASS4096"},
+		{input: "CLASSX", err: errParseClass},
+		{input: "BOGUS", err: errParseClass},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.input, func(t *testing.T) {
+			t.Parallel()
+
+			class, err := ParseClass(test.input)
+			if want, got := test.err, err; want != got {
+				t.Fatalf("want error %v, got %v", want, got)
+			}
+			if err != nil {
+				return
+			}
+
+			if want, got := test.class, class; want != got {
+				t.Errorf("want class %d, got %d", want, got)
+			}
+			if want, got := test.str, class.String(); want != got {
+				t.Errorf("want string %q, got %q", want, got)
+			}
+		})
+	}
+}
@@ -1,19 +1,31 @@
 package dns
 
 import (
+	"errors"
 	"io"
+	"math/rand"
+	"net"
 	"sync"
 	"time"
 )
 
+var errProbeTimeout = errors.New("health probe timed out")
+
+// probeQuestion is the question of health probes, which any DNS server
+// answers with a referral, an answer, or an error status.
+var probeQuestion = Question{Name: ".", Type: TypeNS, Class: ClassIN}
+
 type pipeline struct {
 	Conn
 
+	upstream net.Addr // the DNS server address picked by the proxy
+
 	rmu, wmu sync.Mutex
 
 	mu       sync.Mutex
 	inflight map[int]pipelineTx
 	readerr  error
+	retired  bool // closed once no queries are in flight
 }
 
 func (p *pipeline) alive() bool {
@@ -47,13 +59,22 @@ func (p *pipeline) run() {
 		p.mu.Lock()
 		tx, ok := p.inflight[msg.ID]
 		delete(p.inflight, msg.ID)
+		done := p.retired && len(p.inflight) == 0
 		p.mu.Unlock()
 
-		if !ok {
-			continue
-		}
+		if ok {
+			// the raw bytes of the shared conn are only valid until the
+			// next Recv, so each transaction gets a copy
+			var raw []byte
+			if b, ok := rawBytes(p.Conn); ok {
+				raw = append([]byte(nil), b...)
+			}
 
-		go tx.deliver(msgerr{msg: &msg})
+			go tx.deliver(msgerr{msg: &msg, raw: raw})
+		}
+		if done {
+			p.Conn.Close()
+		}
 	}
 	p.rmu.Unlock()
 
@@ -70,12 +91,91 @@ func (p *pipeline) run() {
 	}
 }
 
+// probe sends a health probe query over the pipeline every interval while no
+// queries are in flight. The connection is closed if a probe is not answered
+// within the interval, which fails the pipeline.
+func (p *pipeline) probe(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !p.alive() {
+			return
+		}
+		if !p.idle() {
+			continue
+		}
+
+		switch err := p.ping(interval); err {
+		case nil, ErrConflictingID:
+		default:
+			p.Conn.Close()
+			return
+		}
+	}
+}
+
+// retire closes the connection of the pipeline once the queries in flight
+// are answered.
+func (p *pipeline) retire() {
+	p.mu.Lock()
+	p.retired = true
+	idle := len(p.inflight) == 0
+	p.mu.Unlock()
+
+	if idle {
+		p.Conn.Close()
+	}
+}
+
+func (p *pipeline) idle() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.inflight) == 0
+}
+
+// ping sends a probe query, and waits for the response until the timeout.
+func (p *pipeline) ping(timeout time.Duration) error {
+	conn := p.conn()
+	defer conn.Close()
+
+	msg := &Message{
+		ID:        rand.Intn(idMask + 1),
+		Questions: []Question{probeQuestion},
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	errc := make(chan error, 1)
+	go func() {
+		if err := conn.Send(msg); err != nil {
+			errc <- err
+			return
+		}
+		errc <- conn.Recv(new(Message))
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-timer.C:
+		return errProbeTimeout
+	}
+}
+
 type pipelineConn struct {
 	*pipeline
 
 	aborto sync.Once
 	tx     pipelineTx
 
+	rawmu sync.Mutex
+	raw   []byte
+
 	readDeadline, writeDeadline time.Time
 }
 
@@ -97,9 +197,22 @@ func (c *pipelineConn) Recv(msg *Message) error {
 	}
 
 	*msg = *me.msg // shallow copy
+
+	c.rawmu.Lock()
+	c.raw = me.raw
+	c.rawmu.Unlock()
 	return nil
 }
 
+// Raw returns the wire format of the last message read by Recv, if the
+// underlying connection retains it.
+func (c *pipelineConn) Raw() []byte {
+	c.rawmu.Lock()
+	defer c.rawmu.Unlock()
+
+	return c.raw
+}
+
 func (c *pipelineConn) Send(msg *Message) error {
 	if err := c.register(msg); err != nil {
 		return err
@@ -1,6 +1,7 @@
 package dns
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"net"
@@ -87,3 +88,86 @@ func TestPipeline(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestPipelineRaw(t *testing.T) {
+	t.Parallel()
+
+	srv := mustServer(&answerHandler{answers})
+
+	addr, err := net.ResolveTCPAddr("tcp", srv.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+
+		tport *Transport
+	}{
+		{
+			name: "pipeline",
+
+			tport: new(Transport),
+		},
+		{
+			name: "wrapped",
+
+			tport: &Transport{
+				UpstreamTrace: func(*Message, net.Addr, net.Addr) {},
+				Cache:         new(Cache),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var raws [][]byte
+			for i, q := range []Question{questions["A"], questions["AAAA"]} {
+				conn, err := test.tport.DialAddr(context.Background(), addr)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := conn.Send(&Message{ID: i + 1, Questions: []Question{q}}); err != nil {
+					t.Fatal(err)
+				}
+
+				msg := new(Message)
+				if err := conn.Recv(msg); err != nil {
+					t.Fatal(err)
+				}
+
+				raw, ok := rawBytes(conn)
+				if !ok {
+					t.Fatalf("want raw bytes of %T", conn)
+				}
+				if want, got := mustPack(t, msg), raw; !bytes.Equal(want, got) {
+					t.Errorf("want raw message %x, got %x", want, got)
+				}
+				raws = append(raws, raw)
+			}
+
+			// the raw bytes of a transaction are not overwritten by the
+			// next transaction of the pipeline
+			var msg Message
+			if _, err := msg.Unpack(raws[0]); err != nil {
+				t.Fatal(err)
+			}
+			if want, got := questions["A"], msg.Questions[0]; want != got {
+				t.Errorf("want question %+v, got %+v", want, got)
+			}
+		})
+	}
+}
+
+func mustPack(t *testing.T, msg *Message) []byte {
+	buf, err := msg.Pack(nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
@@ -0,0 +1,263 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+// alpnDoQ is the ALPN protocol of DNS-over-QUIC (RFC 9250, section 4.1.1).
+const alpnDoQ = "doq"
+
+var (
+	errQUICNoResponse = errors.New("no pending DNS-over-QUIC response")
+	errQUICMessageID  = errors.New("non-zero DNS-over-QUIC message ID")
+)
+
+// QUICConn is a DNS-over-QUIC connection. The standard library does not
+// implement QUIC, so connections are provided by a QUIC implementation, by the
+// Transport's DialQUICConn to clients, and by a QUICListener to servers.
+type QUICConn interface {
+	// OpenStream opens a bidirectional stream.
+	OpenStream(context.Context) (QUICStream, error)
+
+	// AcceptStream waits for and returns the next bidirectional stream
+	// opened by the peer.
+	AcceptStream(context.Context) (QUICStream, error)
+
+	// LocalAddr returns the local network address.
+	LocalAddr() net.Addr
+
+	// RemoteAddr returns the remote network address.
+	RemoteAddr() net.Addr
+
+	// Close closes the connection and its streams.
+	Close() error
+}
+
+// QUICListener is a listener for QUIC connections to a DNS-over-QUIC server,
+// provided by a QUIC implementation. The listener performs the TLS handshake
+// of each connection.
+type QUICListener interface {
+	// Accept waits for and returns the next connection.
+	Accept(context.Context) (QUICConn, error)
+
+	// Close closes the listener. Accepted connections are not closed.
+	Close() error
+
+	// Addr returns the listener's network address.
+	Addr() net.Addr
+}
+
+// QUICStream is a bidirectional QUIC stream. A DNS-over-QUIC stream carries
+// a single query and response.
+type QUICStream interface {
+	io.Reader
+	io.Writer
+
+	// Close closes the sending direction of the stream, marking the end of
+	// the message written to it with a STREAM FIN.
+	Close() error
+
+	// SetDeadline sets the read and write deadline of the stream.
+	SetDeadline(time.Time) error
+}
+
+// quicKey identifies the QUIC connection of a DNS-over-QUIC service.
+type quicKey struct {
+	addr, serverName string
+}
+
+// dialQUIC returns a Conn that sends each message on a new stream of the QUIC
+// connection to the DNS-over-QUIC service at raddr. The QUIC connection is
+// shared by the queries to the service.
+func (t *Transport) dialQUIC(ctx context.Context, addr net.Addr, raddr OverQUICAddr) (Conn, error) {
+	if t.DialQUIC == nil && t.DialQUICConn == nil {
+		return nil, ErrUnsupportedNetwork
+	}
+
+	cfg, err := t.tlsConfig(addr, raddr)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.NextProtos) == 0 {
+		cfg.NextProtos = []string{alpnDoQ}
+	}
+
+	if t.DialQUIC != nil {
+		return t.DialQUIC(ctx, raddr, cfg)
+	}
+
+	key := quicKey{addr: raddr.Addr.String(), serverName: cfg.ServerName}
+	qconn, err := t.quicConn(ctx, key, raddr, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &quicConn{
+		qconn: qconn,
+		addr:  raddr,
+		drop:  func() { t.dropQUICConn(key, qconn) },
+	}, nil
+}
+
+// quicConn returns the QUIC connection of key, dialing a new connection if
+// there is none.
+func (t *Transport) quicConn(ctx context.Context, key quicKey, raddr OverQUICAddr, cfg *tls.Config) (QUICConn, error) {
+	t.quicmu.Lock()
+	qconn, ok := t.quic[key]
+	t.quicmu.Unlock()
+	if ok {
+		return qconn, nil
+	}
+
+	qconn, err := t.DialQUICConn(ctx, raddr.Addr, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	t.quicmu.Lock()
+	defer t.quicmu.Unlock()
+
+	// keep the connection of a concurrent dial
+	if cur, ok := t.quic[key]; ok {
+		qconn.Close()
+		return cur, nil
+	}
+
+	if t.quic == nil {
+		t.quic = make(map[quicKey]QUICConn)
+	}
+	t.quic[key] = qconn
+	return qconn, nil
+}
+
+// dropQUICConn closes and forgets the QUIC connection of key, so that the
+// next query dials a new one.
+func (t *Transport) dropQUICConn(key quicKey, qconn QUICConn) {
+	t.quicmu.Lock()
+	if t.quic[key] == qconn {
+		delete(t.quic, key)
+	}
+	t.quicmu.Unlock()
+
+	qconn.Close()
+}
+
+type quicConn struct {
+	qconn QUICConn
+	addr  OverQUICAddr
+	drop  func()
+
+	deadline time.Time
+	stream   QUICStream
+	id       int
+	raw      []byte
+}
+
+func (c *quicConn) Read([]byte) (int, error)  { return 0, ErrUnsupportedOp }
+func (c *quicConn) Write([]byte) (int, error) { return 0, ErrUnsupportedOp }
+
+// Close closes the stream of the pending response, if any. The QUIC
+// connection remains open for other queries.
+func (c *quicConn) Close() error {
+	if c.stream == nil {
+		return nil
+	}
+
+	stream := c.stream
+	c.stream = nil
+	return stream.Close()
+}
+
+func (c *quicConn) LocalAddr() net.Addr  { return c.qconn.LocalAddr() }
+func (c *quicConn) RemoteAddr() net.Addr { return c.addr }
+
+func (c *quicConn) SetDeadline(t time.Time) error {
+	c.deadline = t
+	return nil
+}
+
+func (c *quicConn) SetReadDeadline(t time.Time) error  { return c.SetDeadline(t) }
+func (c *quicConn) SetWriteDeadline(t time.Time) error { return c.SetDeadline(t) }
+
+// Send writes the message on a new stream, with a message ID of zero (RFC
+// 9250, section 4.2.1), and closes the sending direction of the stream.
+func (c *quicConn) Send(msg *Message) error {
+	req := *msg
+	req.ID = 0
+
+	buf, err := req.Pack(make([]byte, 2, 2+maxPacketLen), true)
+	if err != nil {
+		return err
+	}
+	if len(buf)-2 > maxStreamLen {
+		return ErrOversizedMessage
+	}
+	nbo.PutUint16(buf[:2], uint16(len(buf)-2))
+
+	ctx := context.Background()
+	if !c.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, c.deadline)
+		defer cancel()
+	}
+
+	stream, err := c.qconn.OpenStream(ctx)
+	if err != nil {
+		c.drop()
+		return err
+	}
+	if !c.deadline.IsZero() {
+		if err := stream.SetDeadline(c.deadline); err != nil {
+			stream.Close()
+			return err
+		}
+	}
+
+	if _, err := stream.Write(buf); err != nil {
+		stream.Close()
+		return err
+	}
+	if err := stream.Close(); err != nil {
+		return err
+	}
+
+	c.stream, c.id = stream, msg.ID
+	return nil
+}
+
+// Recv reads the response to the last message sent from its stream. The ID
+// of the response is set to the ID of the message sent.
+func (c *quicConn) Recv(msg *Message) error {
+	if c.stream == nil {
+		return errQUICNoResponse
+	}
+
+	stream := c.stream
+	c.stream = nil
+
+	var hdr [2]byte
+	if _, err := io.ReadFull(stream, hdr[:]); err != nil {
+		return err
+	}
+
+	buf := make([]byte, nbo.Uint16(hdr[:]))
+	if _, err := io.ReadFull(stream, buf); err != nil {
+		return err
+	}
+
+	c.raw = buf
+	if _, err := msg.Unpack(buf); err != nil {
+		return err
+	}
+	msg.ID = c.id
+	return nil
+}
+
+// Raw returns the wire format of the last message read by Recv, with the
+// message ID of zero sent by the service.
+func (c *quicConn) Raw() []byte { return c.raw }
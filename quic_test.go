@@ -0,0 +1,377 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTransportDialQUICConn(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu     sync.Mutex
+		dials  []*tls.Config
+		conns  []*pipeQUICConn
+		served []int
+	)
+
+	tport := &Transport{
+		DialQUICConn: func(_ context.Context, addr net.Addr, cfg *tls.Config) (QUICConn, error) {
+			client, server := pipeQUIC(&net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 4853}, addr)
+			go serveQUICPipe(server, func(id int) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				served = append(served, id)
+			})
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			dials = append(dials, cfg)
+			conns = append(conns, client)
+			return client, nil
+		},
+	}
+
+	client := &Client{Transport: tport}
+
+	addr := OverQUICAddr{
+		Addr: &net.UDPAddr{IP: net.IPv4(192, 0, 2, 53), Port: 853},
+	}
+
+	query := func(id int) (*Message, error) {
+		return client.Do(context.Background(), &Query{
+			RemoteAddr: addr,
+			Message: &Message{
+				ID:        id,
+				Questions: []Question{questions["A"]},
+			},
+		})
+	}
+
+	for _, id := range []int{0x1234, 0x5678} {
+		msg, err := query(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := id, msg.ID; want != got {
+			t.Errorf("want response ID %#x, got %#x", want, got)
+		}
+		if want, got := 1, len(msg.Answers); want != got {
+			t.Fatalf("want %d answers, got %d", want, got)
+		}
+	}
+
+	mu.Lock()
+	if want, got := 1, len(dials); want != got {
+		t.Fatalf("want %d QUIC connections dialed, got %d", want, got)
+	}
+	if want, got := []string{"doq"}, dials[0].NextProtos; !reflect.DeepEqual(want, got) {
+		t.Errorf("want ALPN protocols %q, got %q", want, got)
+	}
+	if want, got := "192.0.2.53", dials[0].ServerName; want != got {
+		t.Errorf("want server name %q, got %q", want, got)
+	}
+	if want, got := []int{0, 0}, served; !reflect.DeepEqual(want, got) {
+		t.Errorf("want query IDs %v, got %v", want, got)
+	}
+	conns[0].Close()
+	mu.Unlock()
+
+	if _, err := query(1); err != errPipeClosed {
+		t.Errorf("want error %v, got %v", errPipeClosed, err)
+	}
+	if _, err := query(2); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if want, got := 2, len(dials); want != got {
+		t.Errorf("want %d QUIC connections dialed, got %d", want, got)
+	}
+}
+
+var errPipeClosed = errors.New("pipe closed")
+
+// pipeQUICConn is one end of an in-memory QUIC connection. Streams opened by
+// one end are accepted by the other end.
+type pipeQUICConn struct {
+	local, remote net.Addr
+
+	open   chan<- *pipeStream
+	accept <-chan *pipeStream
+
+	once   *sync.Once
+	closed chan struct{}
+}
+
+func pipeQUIC(client, server net.Addr) (*pipeQUICConn, *pipeQUICConn) {
+	c2s, s2c := make(chan *pipeStream), make(chan *pipeStream)
+	once, closed := new(sync.Once), make(chan struct{})
+
+	c := &pipeQUICConn{
+		local:  client,
+		remote: server,
+		open:   c2s,
+		accept: s2c,
+		once:   once,
+		closed: closed,
+	}
+	s := &pipeQUICConn{
+		local:  server,
+		remote: client,
+		open:   s2c,
+		accept: c2s,
+		once:   once,
+		closed: closed,
+	}
+	return c, s
+}
+
+func (c *pipeQUICConn) OpenStream(ctx context.Context) (QUICStream, error) {
+	local, remote := pipeStreams()
+
+	select {
+	case c.open <- remote:
+		return local, nil
+	case <-c.closed:
+		return nil, errPipeClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *pipeQUICConn) AcceptStream(ctx context.Context) (QUICStream, error) {
+	select {
+	case stream := <-c.accept:
+		return stream, nil
+	case <-c.closed:
+		return nil, errPipeClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *pipeQUICConn) LocalAddr() net.Addr  { return c.local }
+func (c *pipeQUICConn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *pipeQUICConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+// pipeStream is one end of an in-memory bidirectional stream.
+type pipeStream struct {
+	*io.PipeReader
+	w *io.PipeWriter
+}
+
+func pipeStreams() (*pipeStream, *pipeStream) {
+	r1, w1 := io.Pipe()
+	r2, w2 := io.Pipe()
+
+	return &pipeStream{PipeReader: r2, w: w1}, &pipeStream{PipeReader: r1, w: w2}
+}
+
+func (s *pipeStream) Write(b []byte) (int, error) { return s.w.Write(b) }
+func (s *pipeStream) Close() error                { return s.w.Close() }
+
+func (s *pipeStream) SetDeadline(time.Time) error { return nil }
+
+// serveQUICPipe answers the queries of the streams accepted by conn with the
+// answers of the test questions, and calls fn with the ID of each query.
+func serveQUICPipe(conn *pipeQUICConn, fn func(id int)) {
+	for {
+		stream, err := conn.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer stream.Close()
+
+			buf, err := ioutil.ReadAll(stream)
+			if err != nil || len(buf) < 2 || int(nbo.Uint16(buf)) != len(buf)-2 {
+				return
+			}
+
+			msg := new(Message)
+			if _, err := msg.Unpack(buf[2:]); err != nil {
+				return
+			}
+			fn(msg.ID)
+
+			msg.Response = true
+			for _, q := range msg.Questions {
+				if answer, ok := answers[q]; ok {
+					msg.Answers = append(msg.Answers, Resource{Name: q.Name, Class: q.Class, TTL: time.Minute, Record: answer})
+				}
+			}
+
+			res, err := msg.Pack(make([]byte, 2), true)
+			if err != nil {
+				return
+			}
+			nbo.PutUint16(res, uint16(len(res)-2))
+			stream.Write(res)
+		}()
+	}
+}
+
+func TestServerQUIC(t *testing.T) {
+	t.Parallel()
+
+	malformed := make(chan error, 1)
+
+	srv := &Server{
+		Handler: &answerHandler{answers},
+		MalformedQuery: func(_ []byte, _ net.Addr, err error) {
+			malformed <- err
+		},
+	}
+
+	ln := newPipeQUICListener(&net.UDPAddr{IP: net.IPv4(192, 0, 2, 53), Port: 853})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ServeQUIC(ctx, ln) }()
+
+	dial := func() *pipeQUICConn {
+		client, server := pipeQUIC(&net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 4853}, ln.Addr())
+		ln.conns <- server
+		return client
+	}
+
+	var dials int
+	client := &Client{
+		Transport: &Transport{
+			DialQUICConn: func(context.Context, net.Addr, *tls.Config) (QUICConn, error) {
+				dials++
+				return dial(), nil
+			},
+		},
+	}
+
+	for _, id := range []int{0x1234, 0x5678} {
+		msg, err := client.Do(context.Background(), &Query{
+			RemoteAddr: OverQUICAddr{Addr: ln.Addr()},
+			Message: &Message{
+				ID:        id,
+				Questions: []Question{questions["A"]},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := id, msg.ID; want != got {
+			t.Errorf("want response ID %#x, got %#x", want, got)
+		}
+		if want, got := 1, len(msg.Answers); want != got {
+			t.Errorf("want %d answers, got %d", want, got)
+		}
+	}
+	if want, got := 1, dials; want != got {
+		t.Errorf("want %d QUIC connections dialed, got %d", want, got)
+	}
+
+	// a query with a non-zero message ID is not answered
+	stream, err := dial().OpenStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := (&Message{ID: 7, Questions: []Question{questions["A"]}}).Pack(make([]byte, 2), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nbo.PutUint16(buf, uint16(len(buf)-2))
+	if _, err := stream.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	stream.Close()
+
+	if res, err := ioutil.ReadAll(stream); err != nil {
+		t.Fatal(err)
+	} else if len(res) > 0 {
+		t.Errorf("want no response, got %x", res)
+	}
+	if want, got := errQUICMessageID, <-malformed; want != got {
+		t.Errorf("want malformed query error %v, got %v", want, got)
+	}
+
+	cancel()
+	if want, got := context.Canceled, <-errc; want != got {
+		t.Errorf("want error %v, got %v", want, got)
+	}
+}
+
+func TestServerQUICTLSConfig(t *testing.T) {
+	t.Parallel()
+
+	if _, err := new(Server).QUICTLSConfig(); err != ErrMissingCertificate {
+		t.Errorf("want error %v, got %v", ErrMissingCertificate, err)
+	}
+
+	srv := &Server{
+		TLSConfig: &tls.Config{
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return nil, nil },
+		},
+	}
+
+	config, err := srv.QUICTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := []string{"doq"}, config.NextProtos; !reflect.DeepEqual(want, got) {
+		t.Errorf("want ALPN protocols %q, got %q", want, got)
+	}
+	if srv.TLSConfig.NextProtos != nil {
+		t.Error("want server TLS config unchanged")
+	}
+}
+
+// pipeQUICListener is a QUIC listener of in-memory connections.
+type pipeQUICListener struct {
+	addr  net.Addr
+	conns chan *pipeQUICConn
+
+	once   sync.Once
+	closed chan struct{}
+}
+
+func newPipeQUICListener(addr net.Addr) *pipeQUICListener {
+	return &pipeQUICListener{
+		addr:   addr,
+		conns:  make(chan *pipeQUICConn),
+		closed: make(chan struct{}),
+	}
+}
+
+func (l *pipeQUICListener) Accept(ctx context.Context) (QUICConn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, errPipeClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l *pipeQUICListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *pipeQUICListener) Addr() net.Addr { return l.addr }
@@ -0,0 +1,128 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"strings"
+)
+
+var privateNets = mustParseCIDRs(
+	"0.0.0.0/8",      // [RFC1122] "this" network
+	"10.0.0.0/8",     // [RFC1918] private-use
+	"100.64.0.0/10",  // [RFC6598] shared address space
+	"127.0.0.0/8",    // [RFC1122] loopback
+	"169.254.0.0/16", // [RFC3927] link local
+	"172.16.0.0/12",  // [RFC1918] private-use
+	"192.168.0.0/16", // [RFC1918] private-use
+	"::/128",         // [RFC4291] unspecified address
+	"::1/128",        // [RFC4291] loopback address
+	"fc00::/7",       // [RFC4193] unique-local
+	"fe80::/10",      // [RFC4291] link-local unicast
+)
+
+// RebindFilter is a handler that protects downstream clients from DNS
+// rebinding attacks. It forwards queries upstream, and removes A and AAAA
+// records with private, loopback, or link-local addresses from the answer and
+// additional sections of the response.
+type RebindFilter struct {
+	// Allow is a list of domain names that are permitted to resolve to
+	// private addresses. A query is allowed if each question name is equal
+	// to or a subdomain of an Allow domain.
+	Allow []string
+}
+
+// ServeDNS forwards the query upstream and writes the filtered response.
+func (f *RebindFilter) ServeDNS(ctx context.Context, w MessageWriter, r *Query) {
+	msg, err := w.Recur(ctx)
+	if err != nil {
+		w.Status(ServFail)
+		return
+	}
+
+	if !f.allowed(r.Questions) {
+		msg.Answers = filterPrivate(msg.Answers)
+		msg.Additionals = filterPrivate(msg.Additionals)
+	}
+
+	writeMessage(w, msg)
+}
+
+func (f *RebindFilter) allowed(qs []Question) bool {
+	if len(qs) == 0 {
+		return false
+	}
+
+	for _, q := range qs {
+		var ok bool
+		for _, domain := range f.Allow {
+			if ok = isSubdomain(q.Name, domain); ok {
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func filterPrivate(rs []Resource) []Resource {
+	var filtered []Resource
+	for _, res := range rs {
+		var ip net.IP
+		switch rec := res.Record.(type) {
+		case *A:
+			ip = rec.A
+		case *AAAA:
+			ip = rec.AAAA
+		}
+
+		if ip != nil && isPrivateIP(ip) {
+			continue
+		}
+		filtered = append(filtered, res)
+	}
+	return filtered
+}
+
+func isPrivateIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	for _, ipnet := range privateNets {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSubdomain reports whether name is equal to or a subdomain of domain. The
+// comparison is case-insensitive.
+func isSubdomain(name, domain string) bool {
+	name, domain = strings.ToLower(name), strings.ToLower(domain)
+
+	switch {
+	case domain == "." || domain == "":
+		return true
+	case !strings.HasSuffix(name, domain):
+		return false
+	case len(name) == len(domain):
+		return true
+	default:
+		return name[len(name)-len(domain)-1] == '.'
+	}
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	ipnets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		ipnets = append(ipnets, ipnet)
+	}
+	return ipnets
+}
@@ -0,0 +1,69 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRebindFilter(t *testing.T) {
+	t.Parallel()
+
+	srv := mustServer(HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+		name := r.Questions[0].Name
+
+		w.Answer(name, time.Minute, &A{A: net.IPv4(93, 184, 216, 34).To4()})
+		w.Answer(name, time.Minute, &A{A: net.IPv4(192, 168, 0, 1).To4()})
+		w.Answer(name, time.Minute, &A{A: net.IPv4(127, 0, 0, 1).To4()})
+		w.Answer(name, time.Minute, &AAAA{AAAA: net.ParseIP("fe80::1")})
+		w.Answer(name, time.Minute, &AAAA{AAAA: net.ParseIP("::ffff:10.0.0.1")})
+		w.Answer(name, time.Minute, &AAAA{AAAA: net.ParseIP("2001:db8::1")})
+	}))
+
+	addr, err := net.ResolveUDPAddr("udp", srv.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &Client{
+		Resolver: &RebindFilter{
+			Allow: []string{"home.arpa."},
+		},
+	}
+
+	tests := []struct {
+		name string
+
+		answers int
+	}{
+		{name: "rebind.example.com.", answers: 2},
+		{name: "printer.home.arpa.", answers: 6},
+		{name: "printer.HOME.arpa.", answers: 6},
+		{name: "nothome.arpa.", answers: 2},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			query := &Query{
+				RemoteAddr: addr,
+				Message: &Message{
+					Questions: []Question{
+						{Name: test.name, Type: TypeA},
+					},
+				},
+			}
+
+			msg, err := client.Do(context.Background(), query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want, got := test.answers, len(msg.Answers); want != got {
+				t.Errorf("want %d answers, got %d", want, got)
+			}
+		})
+	}
+}
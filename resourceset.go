@@ -0,0 +1,88 @@
+package dns
+
+import "strings"
+
+// A ResourceSet is an RRset of a message section: the resources with the same
+// owner name, class, and type.
+type ResourceSet struct {
+	Name  string
+	Class Class
+	Type  Type
+
+	Resources []Resource
+}
+
+// Records returns the records of the RRset.
+func (s ResourceSet) Records() []Record {
+	recs := make([]Record, len(s.Resources))
+	for i, res := range s.Resources {
+		recs[i] = res.Record
+	}
+	return recs
+}
+
+// ResourceSets groups the resources into RRsets, in the order of the first
+// resource of each RRset. Owner names are compared case-insensitively, and the
+// name of an RRset is the name of its first resource.
+func ResourceSets(rrs []Resource) []ResourceSet {
+	var sets []ResourceSet
+	for _, res := range rrs {
+		if i := indexResourceSet(sets, res.Name, res.Class, res.Record.Type()); i >= 0 {
+			sets[i].Resources = append(sets[i].Resources, res)
+			continue
+		}
+
+		sets = append(sets, ResourceSet{
+			Name:      res.Name,
+			Class:     res.Class,
+			Type:      res.Record.Type(),
+			Resources: []Resource{res},
+		})
+	}
+	return sets
+}
+
+// LookupResourceSet returns the RRset of the resources with the owner name,
+// class, and type. The returned bool is false if there are no matching
+// resources.
+func LookupResourceSet(rrs []Resource, name string, class Class, typ Type) (ResourceSet, bool) {
+	set := ResourceSet{
+		Name:  name,
+		Class: class,
+		Type:  typ,
+	}
+	for _, res := range rrs {
+		if matchResource(res, name, class, typ) {
+			set.Resources = append(set.Resources, res)
+		}
+	}
+	return set, len(set.Resources) > 0
+}
+
+// AnswerSets returns the RRsets of the answer section.
+func (m *Message) AnswerSets() []ResourceSet { return ResourceSets(m.Answers) }
+
+// AuthoritySets returns the RRsets of the authority section.
+func (m *Message) AuthoritySets() []ResourceSet { return ResourceSets(m.Authorities) }
+
+// AdditionalSets returns the RRsets of the additional section.
+func (m *Message) AdditionalSets() []ResourceSet { return ResourceSets(m.Additionals) }
+
+// LookupAnswer returns the RRset of the answer section with the owner name,
+// class, and type.
+func (m *Message) LookupAnswer(name string, class Class, typ Type) (ResourceSet, bool) {
+	return LookupResourceSet(m.Answers, name, class, typ)
+}
+
+func indexResourceSet(sets []ResourceSet, name string, class Class, typ Type) int {
+	for i, set := range sets {
+		if set.Class == class && set.Type == typ && strings.EqualFold(set.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func matchResource(res Resource, name string, class Class, typ Type) bool {
+	return res.Class == class && res.Record.Type() == typ && strings.EqualFold(res.Name, name)
+}
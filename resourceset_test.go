@@ -0,0 +1,50 @@
+package dns
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestResourceSets(t *testing.T) {
+	t.Parallel()
+
+	var (
+		a1  = Resource{Name: "example.com.", Class: ClassIN, TTL: time.Minute, Record: &A{A: net.IPv4(192, 0, 2, 1).To4()}}
+		a2  = Resource{Name: "EXAMPLE.com.", Class: ClassIN, TTL: time.Minute, Record: &A{A: net.IPv4(192, 0, 2, 2).To4()}}
+		mx  = Resource{Name: "example.com.", Class: ClassIN, TTL: time.Hour, Record: &MX{Pref: 10, MX: "mail.example.com."}}
+		www = Resource{Name: "www.example.com.", Class: ClassIN, TTL: time.Minute, Record: &A{A: net.IPv4(192, 0, 2, 1).To4()}}
+		ch  = Resource{Name: "example.com.", Class: ClassCH, TTL: time.Minute, Record: &A{A: net.IPv4(192, 0, 2, 3).To4()}}
+	)
+
+	msg := &Message{
+		Answers: []Resource{a1, mx, www, a2, ch},
+	}
+
+	want := []ResourceSet{
+		{Name: "example.com.", Class: ClassIN, Type: TypeA, Resources: []Resource{a1, a2}},
+		{Name: "example.com.", Class: ClassIN, Type: TypeMX, Resources: []Resource{mx}},
+		{Name: "www.example.com.", Class: ClassIN, Type: TypeA, Resources: []Resource{www}},
+		{Name: "example.com.", Class: ClassCH, Type: TypeA, Resources: []Resource{ch}},
+	}
+	if got := msg.AnswerSets(); !reflect.DeepEqual(want, got) {
+		t.Errorf("want rrsets %+v, got %+v", want, got)
+	}
+
+	if sets := msg.AuthoritySets(); len(sets) != 0 {
+		t.Errorf("want no authority rrsets, got %+v", sets)
+	}
+
+	set, ok := msg.LookupAnswer("Example.COM.", ClassIN, TypeA)
+	if !ok {
+		t.Fatal("want A rrset found")
+	}
+	if want, got := []Record{a1.Record, a2.Record}, set.Records(); !reflect.DeepEqual(want, got) {
+		t.Errorf("want records %+v, got %+v", want, got)
+	}
+
+	if _, ok := msg.LookupAnswer("example.com.", ClassIN, TypeAAAA); ok {
+		t.Error("want AAAA rrset not found")
+	}
+}
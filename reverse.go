@@ -0,0 +1,172 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// maxReverseBits is the maximum number of host bits of a network passed to
+// ReverseZoneCIDR.
+const maxReverseBits = 16
+
+var (
+	errReverseIP   = errors.New("invalid IP address for reverse name")
+	errReverseSize = errors.New("network too large for reverse zone")
+)
+
+// ReverseName returns the in-addr.arpa. or ip6.arpa. domain name of the IP
+// address.
+func ReverseName(ip net.IP) (string, error) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return strconv.Itoa(int(ip4[3])) + "." + strconv.Itoa(int(ip4[2])) + "." +
+			strconv.Itoa(int(ip4[1])) + "." + strconv.Itoa(int(ip4[0])) + ".in-addr.arpa.", nil
+	}
+
+	ip6 := ip.To16()
+	if ip6 == nil {
+		return "", errReverseIP
+	}
+
+	const hex = "0123456789abcdef"
+
+	buf := make([]byte, 0, 4*net.IPv6len+len("ip6.arpa."))
+	for i := net.IPv6len - 1; i >= 0; i-- {
+		buf = append(buf, hex[ip6[i]&0xF], '.', hex[ip6[i]>>4], '.')
+	}
+	return string(append(buf, "ip6.arpa."...)), nil
+}
+
+// ReverseOrigin returns the origin of the reverse zone for the network. The
+// prefix length is rounded down to an octet boundary for IPv4 networks, and a
+// nibble boundary for IPv6 networks.
+func ReverseOrigin(ipnet *net.IPNet) (string, error) {
+	name, err := ReverseName(ipnet.IP)
+	if err != nil {
+		return "", err
+	}
+
+	ones, bits := ipnet.Mask.Size()
+
+	// each label of a reverse name is an octet (IPv4) or a nibble (IPv6)
+	labels, size := 4, 8
+	if bits == 8*net.IPv6len {
+		labels, size = 32, 4
+	}
+
+	for i := 0; i < labels-ones/size; i++ {
+		name = name[strings.IndexByte(name, '.')+1:]
+	}
+	return name, nil
+}
+
+// ReverseZone returns a reverse zone with origin containing PTR records for
+// the A and AAAA records of the forward zone. Addresses outside of the origin
+// are skipped. The TTL, SOA, and NS records of the forward zone are copied to
+// the reverse zone.
+func ReverseZone(ctx context.Context, origin string, zone *Zone) (*Zone, error) {
+	rz := &Zone{
+		Origin: origin,
+		TTL:    zone.TTL,
+		SOA:    zone.SOA,
+		NS:     zone.NS,
+		RRs:    make(RRSet),
+	}
+
+	err := zone.store().Walk(ctx, func(dn string, typ Type, recs []Record) error {
+		for _, rec := range recs {
+			var ip net.IP
+			switch rec := rec.(type) {
+			case *A:
+				ip = rec.A
+			case *AAAA:
+				ip = rec.AAAA
+			default:
+				continue
+			}
+
+			if err := rz.addPTR(ip, zone.fqdn(dn)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rz, nil
+}
+
+// ReverseZoneCIDR returns a reverse zone containing a PTR record for each
+// address of the network. The domain name of each PTR record is the template
+// with "{ip}" replaced by the address, with the dots or colons of the address
+// replaced by dashes.
+func ReverseZoneCIDR(ipnet *net.IPNet, template string) (*Zone, error) {
+	ones, bits := ipnet.Mask.Size()
+	if bits == 0 {
+		return nil, errReverseIP
+	}
+	if bits-ones > maxReverseBits {
+		return nil, errReverseSize
+	}
+
+	origin, err := ReverseOrigin(ipnet)
+	if err != nil {
+		return nil, err
+	}
+
+	rz := &Zone{
+		Origin: origin,
+		RRs:    make(RRSet),
+	}
+
+	ip := ipnet.IP.Mask(ipnet.Mask)
+	for ipnet.Contains(ip) {
+		host := strings.Map(func(r rune) rune {
+			if r == '.' || r == ':' {
+				return '-'
+			}
+			return r
+		}, ip.String())
+
+		if err := rz.addPTR(ip, strings.Replace(template, "{ip}", host, -1)); err != nil {
+			return nil, err
+		}
+
+		if ip = nextIP(ip); ip == nil {
+			break
+		}
+	}
+	return rz, nil
+}
+
+// addPTR adds a PTR record for ip to the reverse zone, if the reverse name of
+// ip is within the zone.
+func (z *Zone) addPTR(ip net.IP, ptr string) error {
+	name, err := ReverseName(ip)
+	if err != nil {
+		return err
+	}
+
+	dn, ok := z.relative(name)
+	if !ok {
+		return nil
+	}
+	z.RRs.Add(dn, &PTR{PTR: ptr})
+	return nil
+}
+
+// nextIP returns the address following ip, or nil if ip is the last address.
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+
+	for i := len(next) - 1; i >= 0; i-- {
+		if next[i]++; next[i] != 0 {
+			return next
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReverseName(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		ip   net.IP
+		name string
+	}{
+		{
+			ip:   net.IPv4(192, 0, 2, 1),
+			name: "1.2.0.192.in-addr.arpa.",
+		},
+		{
+			ip:   net.ParseIP("2001:db8::567:89ab"),
+			name: "b.a.9.8.7.6.5.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.",
+		},
+	}
+
+	for _, test := range tests {
+		name, err := ReverseName(test.ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := test.name, name; want != got {
+			t.Errorf("want reverse name %q, got %q", want, got)
+		}
+	}
+
+	if _, err := ReverseName(net.IP{1, 2, 3}); err != errReverseIP {
+		t.Errorf("want error %q, got %v", errReverseIP, err)
+	}
+}
+
+func TestReverseOrigin(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		cidr   string
+		origin string
+	}{
+		{cidr: "10.0.0.0/8", origin: "10.in-addr.arpa."},
+		{cidr: "192.0.2.0/24", origin: "2.0.192.in-addr.arpa."},
+		{cidr: "192.0.2.64/26", origin: "2.0.192.in-addr.arpa."},
+		{cidr: "2001:db8::/32", origin: "8.b.d.0.1.0.0.2.ip6.arpa."},
+		{cidr: "2001:db8::/34", origin: "8.b.d.0.1.0.0.2.ip6.arpa."},
+	}
+
+	for _, test := range tests {
+		_, ipnet, err := net.ParseCIDR(test.cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		origin, err := ReverseOrigin(ipnet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := test.origin, origin; want != got {
+			t.Errorf("%s: want origin %q, got %q", test.cidr, want, got)
+		}
+	}
+}
+
+func TestReverseZone(t *testing.T) {
+	t.Parallel()
+
+	forward := &Zone{
+		Origin: "localhost.",
+		TTL:    time.Hour,
+		RRs: RRSet{
+			"app": {
+				TypeA:    {&A{A: net.IPv4(10, 42, 0, 1).To4()}},
+				TypeAAAA: {&AAAA{AAAA: net.ParseIP("dead:beef::1")}},
+			},
+			"": {
+				TypeA: {&A{A: net.IPv4(10, 42, 0, 2).To4()}},
+			},
+			"outside": {
+				TypeA: {&A{A: net.IPv4(192, 0, 2, 1).To4()}},
+			},
+		},
+	}
+
+	rz, err := ReverseZone(context.Background(), "42.10.in-addr.arpa.", forward)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := RRSet{
+		"1.0": {TypePTR: {&PTR{PTR: "app.localhost."}}},
+		"2.0": {TypePTR: {&PTR{PTR: "localhost."}}},
+	}
+	if got := rz.RRs; !reflect.DeepEqual(want, got) {
+		t.Errorf("want reverse records %+v, got %+v", want, got)
+	}
+	if want, got := forward.TTL, rz.TTL; want != got {
+		t.Errorf("want TTL %s, got %s", want, got)
+	}
+
+	client := &Client{
+		Transport: nopDialer{},
+		Resolver:  rz,
+	}
+
+	msg, err := client.Do(context.Background(), &Query{
+		Message: &Message{
+			Questions: []Question{{Name: "1.0.42.10.in-addr.arpa.", Type: TypePTR, Class: ClassIN}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 1, len(msg.Answers); want != got {
+		t.Fatalf("want %d answers, got %d", want, got)
+	}
+	if want, got := "app.localhost.", msg.Answers[0].Record.(*PTR).PTR; want != got {
+		t.Errorf("want PTR %q, got %q", want, got)
+	}
+}
+
+func TestReverseZoneCIDR(t *testing.T) {
+	t.Parallel()
+
+	_, ipnet, err := net.ParseCIDR("192.0.2.64/30")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rz, err := ReverseZoneCIDR(ipnet, "host-{ip}.example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "2.0.192.in-addr.arpa.", rz.Origin; want != got {
+		t.Errorf("want origin %q, got %q", want, got)
+	}
+
+	want := RRSet{
+		"64": {TypePTR: {&PTR{PTR: "host-192-0-2-64.example.com."}}},
+		"65": {TypePTR: {&PTR{PTR: "host-192-0-2-65.example.com."}}},
+		"66": {TypePTR: {&PTR{PTR: "host-192-0-2-66.example.com."}}},
+		"67": {TypePTR: {&PTR{PTR: "host-192-0-2-67.example.com."}}},
+	}
+	if got := rz.RRs; !reflect.DeepEqual(want, got) {
+		t.Errorf("want reverse records %+v, got %+v", want, got)
+	}
+
+	_, ipnet, err = net.ParseCIDR("2001:db8::/64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReverseZoneCIDR(ipnet, "{ip}.example.com."); err != errReverseSize {
+		t.Errorf("want error %q, got %v", errReverseSize, err)
+	}
+
+	_, ipnet, err = net.ParseCIDR("2001:db8::ff00/127")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rz, err = ReverseZoneCIDR(ipnet, "{ip}.example.com."); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 2, len(rz.RRs); want != got {
+		t.Errorf("want %d reverse names, got %d", want, got)
+	}
+	if _, ok := rz.RRs["1"]; !ok {
+		t.Errorf("want reverse name %q in %+v", "1", rz.RRs)
+	}
+}
@@ -4,10 +4,14 @@ import (
 	"bufio"
 	"context"
 	"crypto/tls"
+	"errors"
 	"io"
 	"log"
 	"net"
 	"sync"
+	"time"
+
+	"github.com/benburkert/dns/edns"
 )
 
 // A Server defines parameters for running a DNS server. The zero value for
@@ -15,18 +19,143 @@ import (
 type Server struct {
 	Addr      string      // TCP and UDP address to listen on, ":domain" if empty
 	Handler   Handler     // handler to invoke
-	TLSConfig *tls.Config // optional TLS config, used by ListenAndServeTLS
+	TLSConfig *tls.Config // TLS config, required by ListenAndServeTLS and ServeTLS
 
-	// Forwarder relays a recursive query. If nil, recursive queries are
-	// answered with a "Query Refused" message.
+	// Forwarder relays a recursive query. Only the questions without a record
+	// in the response written so far are forwarded. The hop-by-hop records
+	// of the query are not forwarded: TSIG records are removed, and the OPT
+	// record keeps only end-to-end options, such as the client subnet. If
+	// nil, recursive queries are answered with a "Query Refused" message.
 	Forwarder RoundTripper
 
 	// ErrorLog specifies an optional logger for errors accepting connections,
 	// reading data, and unpacking messages.
 	// If nil, logging is done via the log package's standard logger.
 	ErrorLog *log.Logger
+
+	// Metrics optionally records query and upstream durations.
+	Metrics Metrics
+
+	// MultiQuestion is the handling of queries with more than one question.
+	// Queries without a question are always answered with a "Format Error"
+	// message.
+	MultiQuestion MultiQuestionPolicy
+
+	// UnpackOptions control the decoding of queries. Queries with bytes
+	// following the message are always rejected.
+	UnpackOptions UnpackOptions
+
+	// Compression is the use of domain name compression in responses.
+	// Handlers may override the policy for a response with SetCompression.
+	Compression CompressionPolicy
+
+	// SuppressDuplicates answers a query that duplicates a query still being
+	// handled, such as a client retransmit, with the response to the original
+	// query instead of invoking the handler again. Queries are duplicates if
+	// they are received on the same connection from the same client address,
+	// with the same ID and first question.
+	SuppressDuplicates bool
+
+	// PacketQueryTimeout is the maximum duration of the context passed to the
+	// handler of a query received over a packet connection. If zero,
+	// DefaultPacketQueryTimeout is used. If negative, there is no timeout.
+	PacketQueryTimeout time.Duration
+
+	// StreamQueryTimeout is the maximum duration of the context passed to the
+	// handler of a query received over a stream or TLS connection. If zero,
+	// DefaultStreamQueryTimeout is used. If negative, there is no timeout.
+	StreamQueryTimeout time.Duration
+
+	// WriteTimeout is the maximum duration of writing a response to a stream
+	// connection. A connection that times out is closed. If zero, there is no
+	// timeout.
+	WriteTimeout time.Duration
+
+	// MalformedQuery is optionally called with the raw bytes and source
+	// address of each query that fails to unpack, for capturing junk or
+	// attack traffic. The raw bytes are not retained by the server. Malformed
+	// stream framing is reported with a *FramingError.
+	MalformedQuery func(raw []byte, addr net.Addr, err error)
+
+	// Cookies optionally enables DNS Cookies (RFC 7873). Responses to
+	// queries with a client cookie include a new server cookie.
+	Cookies *ServerCookies
+
+	// NSID is the name server identifier (RFC 5001) of the server, such as
+	// the host name of an instance of an anycast service. It is sent in
+	// responses to queries with an NSID option.
+	NSID string
+
+	// FinalizeResponse is optionally called with each response after the
+	// handler has written all sections, and before the response is packed.
+	// It may modify res, such as to pad the response or append a TSIG or
+	// RRSIG record, and is responsible for deciding which responses to
+	// change. If it returns an error, a "Server Failure" message is sent
+	// instead of res.
+	FinalizeResponse func(ctx context.Context, res *Message, r *Query) error
+
+	inflightMu sync.Mutex
+	inflight   map[inflightKey]*inflightQuery
+}
+
+const (
+	// DefaultPacketQueryTimeout is the default query handler timeout for
+	// packet connections. Stub resolvers typically retransmit a UDP query
+	// within a few seconds, so a late response is rarely used.
+	DefaultPacketQueryTimeout = 5 * time.Second
+
+	// DefaultStreamQueryTimeout is the default query handler timeout for
+	// stream and TLS connections.
+	DefaultStreamQueryTimeout = 30 * time.Second
+)
+
+// inflightKey identifies duplicate queries.
+type inflightKey struct {
+	network, local, remote string
+
+	id int
+	q  Question
+}
+
+// inflightQuery is a query being handled, and the duplicate queries waiting
+// for its response.
+type inflightQuery struct {
+	waiters []inflightWaiter
+}
+
+type inflightWaiter struct {
+	w  MessageWriter
+	mw *messageWriter
+}
+
+// A FramingError is a malformed length prefixed message read from a stream
+// connection. The connection is closed after a framing error.
+type FramingError struct {
+	Err error
+}
+
+func (e *FramingError) Error() string {
+	return "malformed stream framing: " + e.Err.Error()
 }
 
+var errZeroLength = errors.New("zero length message")
+
+// MultiQuestionPolicy is the handling of queries with more than one question.
+type MultiQuestionPolicy int
+
+const (
+	// MultiQuestionAll passes all questions of a query to the handler.
+	MultiQuestionAll MultiQuestionPolicy = iota
+
+	// MultiQuestionFirst passes only the first question of a query to the
+	// handler, other questions are dropped from the query and response.
+	MultiQuestionFirst
+
+	// MultiQuestionRefuse answers queries with more than one question with a
+	// "Query Refused" message.
+	MultiQuestionRefuse
+)
+
 // ListenAndServe listens on both the TCP and UDP network address s.Addr and
 // then calls Serve or ServePacket to handle queries on incoming connections.
 // If srv.Addr is blank, ":domain" is used. ListenAndServe always returns a
@@ -61,9 +190,37 @@ func (s *Server) ListenAndServe(ctx context.Context) error {
 //
 // ListenAndServeTLS always returns a non-nil error.
 func (s *Server) ListenAndServeTLS(ctx context.Context) error {
+	config, err := s.tlsConfig()
+	if err != nil {
+		return err
+	}
+
+	return s.listenAndServeTLS(ctx, config)
+}
+
+// ListenAndServeTLSFiles is like ListenAndServeTLS, but the server certificate
+// and matching private key are loaded from the PEM encoded certFile and
+// keyFile. The certificate is used in addition to any configured by
+// s.TLSConfig.
+func (s *Server) ListenAndServeTLSFiles(ctx context.Context, certFile, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+
+	config := s.TLSConfig.Clone()
+	if config == nil {
+		config = new(tls.Config)
+	}
+	config.Certificates = append(config.Certificates, cert)
+
+	return s.listenAndServeTLS(ctx, config)
+}
+
+func (s *Server) listenAndServeTLS(ctx context.Context, config *tls.Config) error {
 	addr := s.Addr
 	if addr == "" {
-		addr = ":domain"
+		addr = ":853"
 	}
 
 	ln, err := net.Listen("tcp", addr)
@@ -71,7 +228,7 @@ func (s *Server) ListenAndServeTLS(ctx context.Context) error {
 		return err
 	}
 
-	return s.ServeTLS(ctx, ln)
+	return s.serveTLS(ctx, ln, config)
 }
 
 // Serve accepts incoming connections on the Listener ln, creating a new
@@ -80,17 +237,37 @@ func (s *Server) ListenAndServeTLS(ctx context.Context) error {
 //
 // See RFC 1035, section 4.2.2 "TCP usage" for transport encoding of messages.
 //
+// When ctx is done, Serve stops accepting connections and reading queries,
+// waits for in-flight queries to be answered, closes the connections and ln,
+// and returns the context error. In-flight queries are handled as described
+// for ServePacket. If accepting a connection fails for another reason, Serve
+// closes ln and returns the error without waiting for the accepted
+// connections, which are served until ctx is done or the client closes them.
+//
 // Serve always returns a non-nil error.
 func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	var wg sync.WaitGroup
 	defer ln.Close()
 
+	stop := afterDone(ctx, func() { ln.Close() })
+	defer stop()
+
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
+			if ctx.Err() != nil {
+				wg.Wait()
+				return ctx.Err()
+			}
 			return err
 		}
 
-		go s.serveStream(ctx, conn)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			s.serveStream(ctx, conn)
+		}()
 	}
 }
 
@@ -100,41 +277,66 @@ func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
 //
 // See RFC 1035, section 4.2.1 "UDP usage" for transport encoding of messages.
 //
+// When ctx is done, ServePacket stops reading queries, waits for in-flight
+// queries to be answered, closes conn, and returns the context error. The
+// handler context of a query is not canceled by ctx, only by the query
+// timeout, so in-flight queries can still be forwarded.
+//
 // ServePacket always returns a non-nil error.
 func (s *Server) ServePacket(ctx context.Context, conn net.PacketConn) error {
+	var wg sync.WaitGroup
 	defer conn.Close()
+	defer wg.Wait()
+
+	stop := afterDone(ctx, func() { conn.SetReadDeadline(aLongTimeAgo) })
+	defer stop()
 
 	for {
 		buf := make([]byte, maxPacketLen)
 		n, addr, err := conn.ReadFrom(buf)
 		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 			return err
 		}
 
+		raw := buf[:n:n]
+
 		req := &Query{
 			Message:    new(Message),
 			RemoteAddr: addr,
+			Raw:        raw,
 		}
-
-		if buf, err = req.Message.Unpack(buf[:n]); err != nil {
-			s.logf("dns unpack: %s", err.Error())
+		if buf, err = req.Message.UnpackWith(raw, s.UnpackOptions); err != nil {
+			s.malformed(raw, addr, err)
 			continue
 		}
 		if len(buf) != 0 {
-			s.logf("dns unpack: malformed packet, extra message bytes")
+			s.malformed(raw, addr, errTrailingBytes)
 			continue
 		}
+		if len(req.Questions) > 1 && s.MultiQuestion == MultiQuestionFirst {
+			req.Questions = req.Questions[:1]
+		}
 
 		pw := &packetWriter{
 			messageWriter: &messageWriter{
-				msg: response(req.Message),
+				msg:      response(req.Message),
+				compress: s.Compression,
 			},
 
 			addr: addr,
 			conn: conn,
+			size: udpSize(req.Message),
 		}
 
-		go s.handle(ctx, pw, req)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			s.serveQuery(ctx, pw, pw.messageWriter, req, conn.LocalAddr(), s.PacketQueryTimeout, DefaultPacketQueryTimeout)
+		}()
 	}
 }
 
@@ -145,20 +347,62 @@ func (s *Server) ServePacket(ctx context.Context, conn net.PacketConn) error {
 //
 // See RFC 7858, section 3.3 for transport encoding of messages.
 //
+// The TLS config must provide a certificate with Certificates,
+// GetCertificate (such as for ACME integrations), or GetConfigForClient,
+// otherwise ErrMissingCertificate is returned.
+//
+// When ctx is done, ServeTLS stops as described for Serve.
+//
 // ServeTLS always returns a non-nil error.
 func (s *Server) ServeTLS(ctx context.Context, ln net.Listener) error {
-	ln = tls.NewListener(ln, s.TLSConfig.Clone())
+	config, err := s.tlsConfig()
+	if err != nil {
+		ln.Close()
+		return err
+	}
+
+	return s.serveTLS(ctx, ln, config)
+}
+
+// tlsConfig returns a copy of the server TLS config, or ErrMissingCertificate
+// if the config provides no certificate.
+func (s *Server) tlsConfig() (*tls.Config, error) {
+	config := s.TLSConfig
+	if config == nil {
+		return nil, ErrMissingCertificate
+	}
+	if len(config.Certificates) == 0 && config.GetCertificate == nil && config.GetConfigForClient == nil {
+		return nil, ErrMissingCertificate
+	}
+	return config.Clone(), nil
+}
+
+func (s *Server) serveTLS(ctx context.Context, ln net.Listener, config *tls.Config) error {
+	ln = tls.NewListener(ln, config)
+
+	var wg sync.WaitGroup
 	defer ln.Close()
 
+	stop := afterDone(ctx, func() { ln.Close() })
+	defer stop()
+
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
+			if ctx.Err() != nil {
+				wg.Wait()
+				return ctx.Err()
+			}
 			return err
 		}
 
+		wg.Add(1)
 		go func(conn net.Conn) {
+			defer wg.Done()
+
 			if err := conn.(*tls.Conn).Handshake(); err != nil {
 				s.logf("dns handshake: %s", err.Error())
+				conn.Close()
 				return
 			}
 
@@ -167,70 +411,384 @@ func (s *Server) ServeTLS(ctx context.Context, ln net.Listener) error {
 	}
 }
 
+// ServeQUIC accepts DNS-over-QUIC connections from the QUIC listener ln, and
+// reads a query from each stream of a connection, creating a new service
+// goroutine for each. The service goroutines call s.Handler to reply, and
+// write the response on the stream of the query.
+//
+// See RFC 9250, section 4.2 for the stream encoding of messages. Queries with
+// a message ID other than zero are not answered. The TLS config of the QUIC
+// listener should include the "doq" protocol from QUICTLSConfig.
+//
+// When ctx is done, ServeQUIC stops accepting connections and streams, waits
+// for in-flight queries to be answered, closes the connections and ln, and
+// returns the context error. Other accept errors are returned as described
+// for Serve.
+//
+// ServeQUIC always returns a non-nil error.
+func (s *Server) ServeQUIC(ctx context.Context, ln QUICListener) error {
+	var wg sync.WaitGroup
+	defer ln.Close()
+
+	stop := afterDone(ctx, func() { ln.Close() })
+	defer stop()
+
+	for {
+		conn, err := ln.Accept(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				wg.Wait()
+				return ctx.Err()
+			}
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			s.serveQUICConn(ctx, conn)
+		}()
+	}
+}
+
+// QUICTLSConfig returns a copy of the server TLS config for a QUIC listener,
+// with the "doq" ALPN protocol if the config has none, or
+// ErrMissingCertificate if the config provides no certificate.
+func (s *Server) QUICTLSConfig() (*tls.Config, error) {
+	config, err := s.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = []string{alpnDoQ}
+	}
+	return config, nil
+}
+
+// serveQUICConn reads queries from the streams of conn until the connection
+// is closed by the client or ctx is done, then waits for in-flight queries to
+// be answered and closes conn.
+func (s *Server) serveQUICConn(ctx context.Context, conn QUICConn) {
+	var wg sync.WaitGroup
+
+	defer conn.Close()
+	defer wg.Wait()
+
+	for {
+		stream, err := conn.AcceptStream(ctx)
+		if err != nil {
+			return
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			s.serveQUICStream(ctx, conn, stream)
+		}()
+	}
+}
+
+// serveQUICStream reads the query of stream, and handles it. The stream is
+// closed after the response is written, or if the query is malformed.
+func (s *Server) serveQUICStream(ctx context.Context, conn QUICConn, stream QUICStream) {
+	var lbuf [2]byte
+	if n, err := io.ReadFull(stream, lbuf[:]); err != nil {
+		if ctx.Err() == nil {
+			s.readErr(lbuf[:n], conn.RemoteAddr(), err)
+		}
+		stream.Close()
+		return
+	}
+
+	mlen := int(nbo.Uint16(lbuf[:]))
+	if mlen == 0 {
+		s.malformed(lbuf[:], conn.RemoteAddr(), &FramingError{Err: errZeroLength})
+		stream.Close()
+		return
+	}
+
+	raw := make([]byte, mlen)
+	if n, err := io.ReadFull(stream, raw); err != nil {
+		if ctx.Err() == nil {
+			s.readErr(raw[:n], conn.RemoteAddr(), err)
+		}
+		stream.Close()
+		return
+	}
+
+	req := &Query{
+		Message:    new(Message),
+		RemoteAddr: conn.RemoteAddr(),
+		Raw:        raw,
+	}
+
+	buf, err := req.Message.UnpackWith(raw, s.UnpackOptions)
+	switch {
+	case err != nil:
+	case len(buf) != 0:
+		err = errTrailingBytes
+	case req.ID != 0:
+		err = errQUICMessageID // RFC 9250, section 4.2.1
+	}
+	if err != nil {
+		s.malformed(raw, conn.RemoteAddr(), err)
+		stream.Close()
+		return
+	}
+
+	if len(req.Questions) > 1 && s.MultiQuestion == MultiQuestionFirst {
+		req.Questions = req.Questions[:1]
+	}
+
+	qw := quicWriter{
+		messageWriter: &messageWriter{
+			msg:      response(req.Message),
+			compress: s.Compression,
+		},
+
+		stream:  stream,
+		timeout: s.WriteTimeout,
+	}
+
+	s.serveQuery(ctx, qw, qw.messageWriter, req, conn.LocalAddr(), s.StreamQueryTimeout, DefaultStreamQueryTimeout)
+}
+
+// serveStream reads queries from conn until the connection is closed by the
+// client or ctx is done, then waits for in-flight queries to be answered and
+// closes conn.
 func (s *Server) serveStream(ctx context.Context, conn net.Conn) {
 	var (
 		rbuf = bufio.NewReader(conn)
 
 		lbuf [2]byte
 		mu   sync.Mutex
+		wg   sync.WaitGroup
 	)
 
+	defer conn.Close()
+	defer wg.Wait()
+
+	stop := afterDone(ctx, func() { conn.SetReadDeadline(aLongTimeAgo) })
+	defer stop()
+
 	for {
-		if _, err := rbuf.Read(lbuf[:]); err != nil {
-			if err != io.EOF {
-				s.logf("dns read: %s", err.Error())
+		if n, err := io.ReadFull(rbuf, lbuf[:]); err != nil {
+			if err != io.EOF && ctx.Err() == nil {
+				s.readErr(lbuf[:n], conn.RemoteAddr(), err)
 			}
 			return
 		}
 
-		buf := make([]byte, int(nbo.Uint16(lbuf[:])))
-		if _, err := io.ReadFull(rbuf, buf); err != nil {
-			s.logf("dns read: %s", err.Error())
+		mlen := int(nbo.Uint16(lbuf[:]))
+		if mlen == 0 {
+			s.malformed(lbuf[:], conn.RemoteAddr(), &FramingError{Err: errZeroLength})
+			return
+		}
+
+		buf := make([]byte, mlen)
+		if n, err := io.ReadFull(rbuf, buf); err != nil {
+			if ctx.Err() == nil {
+				s.readErr(buf[:n], conn.RemoteAddr(), err)
+			}
 			return
 		}
 
+		raw := buf
+
 		req := &Query{
 			Message:    new(Message),
 			RemoteAddr: conn.RemoteAddr(),
+			Raw:        raw,
 		}
 
 		var err error
-		if buf, err = req.Message.Unpack(buf); err != nil {
-			s.logf("dns unpack: %s", err.Error())
+		if buf, err = req.Message.UnpackWith(raw, s.UnpackOptions); err != nil {
+			s.malformed(raw, conn.RemoteAddr(), err)
 			continue
 		}
 		if len(buf) != 0 {
-			s.logf("dns unpack: malformed packet, extra message bytes")
+			s.malformed(raw, conn.RemoteAddr(), errTrailingBytes)
 			continue
 		}
+		if len(req.Questions) > 1 && s.MultiQuestion == MultiQuestionFirst {
+			req.Questions = req.Questions[:1]
+		}
 
 		sw := streamWriter{
 			messageWriter: &messageWriter{
-				msg: response(req.Message),
+				msg:      response(req.Message),
+				compress: s.Compression,
 			},
 
-			mu:   &mu,
-			conn: conn,
+			mu:      &mu,
+			conn:    conn,
+			timeout: s.WriteTimeout,
 		}
 
-		go s.handle(ctx, sw, req)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			s.serveQuery(ctx, sw, sw.messageWriter, req, conn.LocalAddr(), s.StreamQueryTimeout, DefaultStreamQueryTimeout)
+		}()
 	}
 }
 
-func (s *Server) handle(ctx context.Context, w MessageWriter, r *Query) {
+// aLongTimeAgo is a non-zero time in the past, used as a deadline to unblock
+// pending reads.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// afterDone calls fn in a new goroutine when ctx is done, unless the returned
+// stop function is called first.
+func afterDone(ctx context.Context, fn func()) (stop func()) {
+	stopc := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			fn()
+		case <-stopc:
+		}
+	}()
+
+	return func() { close(stopc) }
+}
+
+// serveQuery handles the query r received on the connection with the local
+// address. If duplicate suppression is enabled and a duplicate of r is being
+// handled, w is instead sent the response to the duplicate. The handler
+// context is bounded by timeout, or by def if timeout is zero. It is not
+// canceled when ctx is done, so in-flight queries are answered while the
+// server drains.
+func (s *Server) serveQuery(ctx context.Context, w MessageWriter, mw *messageWriter, r *Query, local net.Addr, timeout, def time.Duration) {
+	ctx = detachedContext{ctx}
+
+	if timeout == 0 {
+		timeout = def
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if !s.SuppressDuplicates || r.RemoteAddr == nil || local == nil {
+		s.handle(ctx, w, mw, r)
+		return
+	}
+
+	key := inflightKey{
+		network: r.RemoteAddr.Network(),
+		local:   local.String(),
+		remote:  r.RemoteAddr.String(),
+		id:      r.ID,
+		q:       firstQuestion(r.Message),
+	}
+
+	s.inflightMu.Lock()
+	if iq, ok := s.inflight[key]; ok {
+		iq.waiters = append(iq.waiters, inflightWaiter{w: w, mw: mw})
+		s.inflightMu.Unlock()
+		return
+	}
+	if s.inflight == nil {
+		s.inflight = make(map[inflightKey]*inflightQuery)
+	}
+	iq := new(inflightQuery)
+	s.inflight[key] = iq
+	s.inflightMu.Unlock()
+
+	s.handle(ctx, w, mw, r)
+
+	s.inflightMu.Lock()
+	delete(s.inflight, key)
+	waiters := iq.waiters
+	s.inflightMu.Unlock()
+
+	for _, waiter := range waiters {
+		waiter.mw.msg = mw.msg
+		if err := waiter.w.Reply(ctx); err != nil {
+			s.logf("dns: %s", err.Error())
+		}
+	}
+}
+
+// detachedContext is a context with the values of its parent, that is not
+// canceled when the parent is.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
+
+func (s *Server) handle(ctx context.Context, w MessageWriter, mw *messageWriter, r *Query) {
+	start := time.Now()
+
 	sw := &serverWriter{
 		MessageWriter: w,
+		res:           mw,
 		forwarder:     s.Forwarder,
+		metrics:       s.Metrics,
 		query:         r,
+		finalize:      s.FinalizeResponse,
+	}
+
+	if s.NSID != "" {
+		setNSID(r.Message, mw.msg, s.NSID)
 	}
 
-	s.Handler.ServeDNS(ctx, sw, r)
+	switch {
+	case len(r.Questions) == 0:
+		sw.Status(FormErr)
+	case len(r.Questions) > 1 && s.MultiQuestion == MultiQuestionRefuse:
+		sw.Status(Refused)
+	case s.Cookies != nil && !s.Cookies.check(r, mw.msg, isPacketWriter(w), time.Now()):
+		sw.rcode = mw.msg.RCode
+	default:
+		s.Handler.ServeDNS(ctx, sw, r)
+	}
 
 	if !sw.replied {
 		if err := sw.Reply(ctx); err != nil {
 			s.logf("dns: %s", err.Error())
 		}
 	}
+
+	if s.Metrics != nil {
+		s.Metrics.ObserveQuery(firstQuestion(r.Message), sw.rcode, time.Since(start))
+	}
+}
+
+// readErr reports an error reading a message from a stream connection. A
+// connection closed mid-message is reported as a framing error.
+func (s *Server) readErr(partial []byte, addr net.Addr, err error) {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		s.malformed(partial, addr, &FramingError{Err: io.ErrUnexpectedEOF})
+		return
+	}
+	s.logf("dns read: %s", err.Error())
+}
+
+// malformed reports a query that failed to unpack.
+func (s *Server) malformed(raw []byte, addr net.Addr, err error) {
+	switch err.(type) {
+	case *FramingError:
+		s.logf("dns read: %s", err.Error())
+	default:
+		if err == errTrailingBytes {
+			s.logf("dns unpack: malformed packet, extra message bytes")
+		} else {
+			s.logf("dns unpack: %s", err.Error())
+		}
+	}
+
+	if s.MalformedQuery != nil {
+		s.MalformedQuery(raw, addr, err)
+	}
 }
 
 func (s *Server) logf(format string, args ...interface{}) {
@@ -247,19 +805,30 @@ type packetWriter struct {
 
 	addr net.Addr
 	conn net.PacketConn
+	size int // UDP payload size of the requester
+}
+
+// isPacketWriter reports whether w writes to a packet connection.
+func isPacketWriter(w MessageWriter) bool {
+	_, ok := w.(*packetWriter)
+	return ok
 }
 
 func (w packetWriter) Recur(ctx context.Context) (*Message, error) {
 	return nil, ErrUnsupportedOp
 }
 
+func (w packetWriter) remaining() (int, bool) {
+	return w.remainingLen(w.size)
+}
+
 func (w packetWriter) Reply(ctx context.Context) error {
-	buf, err := w.msg.Pack(nil, true)
+	buf, err := w.pack(nil, w.size)
 	if err != nil {
 		return err
 	}
 
-	if len(buf) > maxPacketLen {
+	if len(buf) > w.size {
 		return w.truncate(buf)
 	}
 
@@ -269,7 +838,7 @@ func (w packetWriter) Reply(ctx context.Context) error {
 
 func (w packetWriter) truncate(buf []byte) error {
 	var err error
-	if buf, err = truncate(buf, maxPacketLen); err != nil {
+	if buf, err = truncate(buf, w.size); err != nil {
 		return err
 	}
 
@@ -282,16 +851,21 @@ func (w packetWriter) truncate(buf []byte) error {
 type streamWriter struct {
 	*messageWriter
 
-	mu   *sync.Mutex
-	conn net.Conn
+	mu      *sync.Mutex
+	conn    net.Conn
+	timeout time.Duration
 }
 
 func (w streamWriter) Recur(ctx context.Context) (*Message, error) {
 	return nil, ErrUnsupportedOp
 }
 
+func (w streamWriter) remaining() (int, bool) {
+	return w.remainingLen(maxStreamLen)
+}
+
 func (w streamWriter) Reply(ctx context.Context) error {
-	buf, err := w.msg.Pack(make([]byte, 2), true)
+	buf, err := w.pack(make([]byte, 2), maxStreamLen)
 	if err != nil {
 		return err
 	}
@@ -305,42 +879,185 @@ func (w streamWriter) Reply(ctx context.Context) error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	_, err = w.conn.Write(buf)
+	if w.timeout > 0 {
+		if err := w.conn.SetWriteDeadline(time.Now().Add(w.timeout)); err != nil {
+			return err
+		}
+	}
+
+	if _, err = w.conn.Write(buf); err != nil && w.timeout > 0 {
+		// a partially written response corrupts the stream framing, and a
+		// peer that stopped reading stalls the other responses
+		w.conn.Close()
+	}
+	return err
+}
+
+type quicWriter struct {
+	*messageWriter
+
+	stream  QUICStream
+	timeout time.Duration
+}
+
+func (w quicWriter) Recur(ctx context.Context) (*Message, error) {
+	return nil, ErrUnsupportedOp
+}
+
+func (w quicWriter) remaining() (int, bool) {
+	return w.remainingLen(maxStreamLen)
+}
+
+// Reply writes the response on the stream of the query, and closes the
+// stream.
+func (w quicWriter) Reply(ctx context.Context) error {
+	defer w.stream.Close()
+
+	buf, err := w.pack(make([]byte, 2), maxStreamLen)
+	if err != nil {
+		return err
+	}
+
+	blen := uint16(len(buf) - 2)
+	if int(blen) != len(buf)-2 {
+		return ErrOversizedMessage
+	}
+	nbo.PutUint16(buf[:2], blen)
+
+	if w.timeout > 0 {
+		if err := w.stream.SetDeadline(time.Now().Add(w.timeout)); err != nil {
+			return err
+		}
+	}
+
+	_, err = w.stream.Write(buf)
 	return err
 }
 
 type serverWriter struct {
 	MessageWriter
 
+	res       *messageWriter
 	forwarder RoundTripper
+	metrics   Metrics
 	query     *Query
+	recur     *RecurOptions
+	finalize  func(context.Context, *Message, *Query) error
 
+	rcode   RCode
 	replied bool
 }
 
-func (w serverWriter) Recur(ctx context.Context) (*Message, error) {
+func (w *serverWriter) Status(rcode RCode) {
+	w.rcode = rcode
+
+	w.MessageWriter.Status(rcode)
+}
+
+func (w *serverWriter) setCompression(policy CompressionPolicy) bool {
+	return SetCompression(w.MessageWriter, policy)
+}
+
+func (w *serverWriter) remaining() (int, bool) {
+	return Remaining(w.MessageWriter)
+}
+
+func (w *serverWriter) setRecurOptions(opts RecurOptions) bool {
+	w.recur = &opts
+	return true
+}
+
+func (w *serverWriter) Recur(ctx context.Context) (*Message, error) {
 	query := &Query{
 		Message:    request(w.query.Message),
 		RemoteAddr: w.query.RemoteAddr,
 	}
+	query.Additionals = forwardAdditionals(w.query.Additionals)
+	if w.recur != nil {
+		w.recur.apply(query.Message)
+	}
 
 	qs := make([]Question, 0, len(w.query.Questions))
 	for _, q := range w.query.Questions {
-		if !questionMatched(q, query.Message) {
+		if !questionMatched(q, w.res.msg) {
 			qs = append(qs, q)
 		}
 	}
 	query.Questions = qs
 
-	return w.forward(ctx, query)
+	if w.metrics == nil {
+		return w.forward(ctx, query)
+	}
+
+	start := time.Now()
+	msg, err := w.forward(ctx, query)
+
+	rcode := ServFail
+	if err == nil {
+		rcode = msg.RCode
+	}
+	w.metrics.ObserveUpstream(firstQuestion(w.query.Message), rcode, time.Since(start))
+
+	return msg, err
+}
+
+// endToEndOption reports whether the EDNS option of a query is forwarded
+// upstream. Other options, such as COOKIE, NSID, and padding, apply to a
+// single hop.
+func endToEndOption(code edns.OptionCode) bool {
+	return code == edns.OptionCodeEDNSClientSubnet
 }
 
-func (w serverWriter) Reply(ctx context.Context) error {
+// forwardAdditionals returns the additional section of a query forwarded
+// upstream. TSIG records are removed, and the OPT record is replaced by one
+// with only the end-to-end options.
+func forwardAdditionals(additionals []Resource) []Resource {
+	var fwd []Resource
+	for _, res := range additionals {
+		switch rec := res.Record.(type) {
+		case *TSIG:
+			continue
+		case *OPT:
+			var opts []edns.Option
+			for _, o := range rec.Options {
+				if endToEndOption(o.Code) {
+					opts = append(opts, o)
+				}
+			}
+			res.Record = &OPT{Options: opts}
+		}
+		fwd = append(fwd, res)
+	}
+	return fwd
+}
+
+func (w *serverWriter) Reply(ctx context.Context) error {
 	w.replied = true
 
+	if w.finalize != nil {
+		if err := w.finalize(ctx, w.res.msg, w.query); err != nil {
+			w.res.msg = response(w.query.Message)
+			w.Status(ServFail)
+
+			if rerr := w.MessageWriter.Reply(ctx); rerr != nil {
+				return rerr
+			}
+			return err
+		}
+	}
+
 	return w.MessageWriter.Reply(ctx)
 }
 
+// firstQuestion returns the first question of msg, or the zero Question if
+// msg has no questions.
+func firstQuestion(msg *Message) Question {
+	if len(msg.Questions) == 0 {
+		return Question{}
+	}
+	return msg.Questions[0]
+}
+
 func response(msg *Message) *Message {
 	res := new(Message)
 	*res = *msg // shallow copy
@@ -355,7 +1072,7 @@ var refuser = &Client{
 	Resolver:  HandlerFunc(Refuse),
 }
 
-func (w serverWriter) forward(ctx context.Context, query *Query) (*Message, error) {
+func (w *serverWriter) forward(ctx context.Context, query *Query) (*Message, error) {
 	if w.forwarder != nil {
 		return w.forwarder.Do(ctx, query)
 	}
@@ -2,11 +2,24 @@ package dns
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
 	"net"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/benburkert/dns/edns"
+	"github.com/benburkert/dns/internal/must"
 )
 
 func TestServerListenAndServe(t *testing.T) {
@@ -183,6 +196,1607 @@ func TestServerForward(t *testing.T) {
 			t.Errorf("want A record %q, got %q", want, got)
 		}
 	})
+
+	t.Run("test unanswered questions forwarded", func(t *testing.T) {
+		t.Parallel()
+
+		localhost := net.IPv4(127, 0, 0, 1).To4()
+
+		var (
+			mu        sync.Mutex
+			forwarded []Question
+		)
+
+		srv := &Server{
+			Addr: mustUnusedAddr(),
+			Handler: HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+				w.Answer("a.test.", time.Minute, &A{A: localhost})
+				Recursor(ctx, w, r)
+			}),
+			Forwarder: &Client{
+				Transport: nopDialer{},
+				Resolver: HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+					mu.Lock()
+					forwarded = append(forwarded, r.Questions...)
+					mu.Unlock()
+
+					for _, q := range r.Questions {
+						w.Answer(q.Name, time.Minute, &A{A: localhost})
+					}
+				}),
+			},
+		}
+		mustStart(srv)
+
+		addrUDP, err := net.ResolveUDPAddr("udp", srv.Addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		query := &Query{
+			RemoteAddr: addrUDP,
+			Message: &Message{
+				Questions: []Question{
+					{Name: "a.test.", Type: TypeA, Class: ClassIN},
+					{Name: "b.test.", Type: TypeA, Class: ClassIN},
+				},
+			},
+		}
+
+		msg, err := new(Client).Do(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if want, got := []Question{{Name: "b.test.", Type: TypeA, Class: ClassIN}}, forwarded; !reflect.DeepEqual(want, got) {
+			t.Errorf("want forwarded questions %+v, got %+v", want, got)
+		}
+
+		var names []string
+		for _, res := range msg.Answers {
+			names = append(names, res.Name)
+		}
+		if want, got := []string{"a.test.", "b.test."}, names; !reflect.DeepEqual(want, got) {
+			t.Errorf("want answers %v, got %v", want, got)
+		}
+	})
+}
+
+func TestServerRecurOptions(t *testing.T) {
+	t.Parallel()
+
+	forwarded := make(chan *Message, 1)
+
+	srv := &Server{
+		Addr: mustUnusedAddr(),
+		Handler: Chain{
+			HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+				if !SetRecurOptions(w, RecurOptions{CheckingDisabled: true, DNSSECOK: true}) {
+					t.Error("want recur options supported by server writer")
+				}
+				Recursor(ctx, w, r)
+			}),
+		},
+		Forwarder: &Client{
+			Transport: nopDialer{},
+			Resolver: HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+				forwarded <- r.Message
+				w.Answer(r.Questions[0].Name, time.Minute, &A{A: net.IPv4(127, 0, 0, 1).To4()})
+			}),
+		},
+	}
+	mustStart(srv)
+
+	addrUDP, err := net.ResolveUDPAddr("udp", srv.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := &Query{
+		RemoteAddr: addrUDP,
+		Message: &Message{
+			RecursionDesired: true,
+			Questions: []Question{
+				{Name: "test.local.", Type: TypeA, Class: ClassIN},
+			},
+		},
+	}
+
+	if _, err := new(Client).Do(context.Background(), query); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := <-forwarded
+	if msg.RecursionDesired {
+		t.Error("want RD bit cleared in forwarded query")
+	}
+	if !msg.CheckingDisabled {
+		t.Error("want CD bit set in forwarded query")
+	}
+	if want, got := 1, len(msg.Additionals); want != got {
+		t.Fatalf("want %d additionals, got %d", want, got)
+	}
+	if want, got := ednsDO*time.Second, msg.Additionals[0].TTL; want != got {
+		t.Errorf("want OPT ttl %s, got %s", want, got)
+	}
+}
+
+func TestServerForwardAdditionals(t *testing.T) {
+	t.Parallel()
+
+	forwarded := make(chan *Message, 1)
+
+	srv := &Server{
+		Addr:    mustUnusedAddr(),
+		Handler: HandlerFunc(Recursor),
+		Forwarder: &Client{
+			Transport: nopDialer{},
+			Resolver: HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+				forwarded <- r.Message
+				w.Answer(r.Questions[0].Name, time.Minute, &A{A: net.IPv4(127, 0, 0, 1).To4()})
+			}),
+		},
+	}
+	mustStart(srv)
+
+	addrUDP, err := net.ResolveUDPAddr("udp", srv.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecs := edns.Option{Code: edns.OptionCodeEDNSClientSubnet, Data: []byte{0, 1, 24, 0, 192, 0, 2}}
+
+	query := &Query{
+		RemoteAddr: addrUDP,
+		Message: &Message{
+			Questions: []Question{
+				{Name: "test.local.", Type: TypeA, Class: ClassIN},
+			},
+			Additionals: []Resource{
+				{
+					Name:  ".",
+					Class: 4096,
+					TTL:   ednsDO * time.Second,
+					Record: &OPT{Options: []edns.Option{
+						{Code: edns.OptionCodeCookie, Data: []byte{1, 2, 3, 4, 5, 6, 7, 8}},
+						{Code: edns.OptionCodeNSID},
+						ecs,
+					}},
+				},
+			},
+		},
+	}
+
+	key := &TSIGKey{Name: "client.key.", Secret: []byte("secret")}
+	if _, err := key.Sign(query.Message); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := new(Client).Do(context.Background(), query); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := <-forwarded
+	if want, got := 1, len(msg.Additionals); want != got {
+		t.Fatalf("want %d additionals, got %d", want, got)
+	}
+
+	res := msg.Additionals[0]
+	if want, got := Class(4096), res.Class; want != got {
+		t.Errorf("want OPT class %d, got %d", want, got)
+	}
+	if want, got := ednsDO*time.Second, res.TTL; want != got {
+		t.Errorf("want OPT ttl %s, got %s", want, got)
+	}
+	if want, got := []edns.Option{ecs}, res.Record.(*OPT).Options; !reflect.DeepEqual(want, got) {
+		t.Errorf("want forwarded options %+v, got %+v", want, got)
+	}
+}
+
+func TestServerRemaining(t *testing.T) {
+	t.Parallel()
+
+	// A compressed A record answer for the question name is 16 bytes.
+	const answerLen = 16
+
+	handler := HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+		for i := 0; i < 100; i++ {
+			n, ok := Remaining(w)
+			if !ok {
+				t.Error("want remaining size supported by server writer")
+				return
+			}
+			if n < answerLen {
+				return
+			}
+
+			w.Answer(r.Questions[0].Name, time.Minute, &A{A: net.IPv4(127, 0, 0, byte(i)).To4()})
+		}
+	})
+
+	srv := &Server{
+		Addr:    mustUnusedAddr(),
+		Handler: Chain{handler},
+	}
+	mustStart(srv)
+
+	tests := []struct {
+		name string
+
+		network string
+
+		answers int
+	}{
+		{
+			name: "udp",
+
+			network: "udp",
+
+			answers: (maxPacketLen - 12 - 16) / answerLen,
+		},
+		{
+			name: "tcp",
+
+			network: "tcp",
+
+			answers: 100,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			addr, err := resolveAddr(test.network, srv.Addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			query := &Query{
+				RemoteAddr: addr,
+				Message: &Message{
+					Questions: []Question{{Name: "test.local.", Type: TypeA, Class: ClassIN}},
+				},
+			}
+
+			msg, err := new(Client).Do(context.Background(), query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if msg.Truncated {
+				t.Error("want response not truncated")
+			}
+			if want, got := test.answers, len(msg.Answers); want != got {
+				t.Errorf("want %d answers, got %d", want, got)
+			}
+		})
+	}
+
+	if _, ok := Remaining(nopWriter{}); ok {
+		t.Error("want unsupported remaining size for custom writer")
+	}
+}
+
+func TestServerUDPSize(t *testing.T) {
+	t.Parallel()
+
+	srv := mustServer(HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+		for i := 0; i < 100; i++ {
+			w.Answer(r.Questions[0].Name, time.Minute, &A{A: net.IPv4(127, 0, 0, byte(i)).To4()})
+		}
+	}))
+
+	addr, err := net.ResolveUDPAddr("udp", srv.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+
+		udpSize int
+
+		truncated bool
+	}{
+		{
+			name: "no-edns",
+
+			truncated: true,
+		},
+		{
+			name: "small-payload",
+
+			udpSize: 1232,
+
+			truncated: true,
+		},
+		{
+			name: "large-payload",
+
+			udpSize: 4096,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			query := &Message{
+				ID:        1,
+				Questions: []Question{{Name: "test.local.", Type: TypeA, Class: ClassIN}},
+			}
+			if test.udpSize > 0 {
+				query.Additionals = []Resource{
+					{Name: ".", Class: Class(test.udpSize), Record: new(OPT)},
+				}
+			}
+
+			conn, err := new(Transport).DialAddr(context.Background(), addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			pconn, ok := conn.(*PacketConn)
+			if !ok {
+				t.Fatalf("want *PacketConn, got %T", conn)
+			}
+			if err := pconn.Send(query); err != nil {
+				t.Fatal(err)
+			}
+
+			msg := new(Message)
+			if err := pconn.Recv(msg); err != nil {
+				t.Fatal(err)
+			}
+
+			if want, got := test.truncated, msg.Truncated; want != got {
+				t.Errorf("want truncated %t, got %t", want, got)
+			}
+			if !test.truncated {
+				if want, got := 100, len(msg.Answers); want != got {
+					t.Errorf("want %d answers, got %d", want, got)
+				}
+			}
+
+			// a truncated reply is filled to within the size of an A
+			// record of the payload size
+			size := test.udpSize
+			if size < maxPacketLen {
+				size = maxPacketLen
+			}
+			if n := len(pconn.Raw()); n > size || (test.truncated && n <= size-16) {
+				t.Errorf("want reply of at most %d bytes, got %d", size, n)
+			}
+
+			var opt bool
+			for _, res := range msg.Additionals {
+				opt = opt || res.Record.Type() == TypeOPT
+			}
+			if want, got := test.udpSize > 0, opt; want != got {
+				t.Errorf("want OPT record %t, got %t", want, got)
+			}
+		})
+	}
+}
+
+func TestServerFinalizeResponse(t *testing.T) {
+	t.Parallel()
+
+	key := &TSIGKey{Name: "key.test.local.", Secret: []byte("secret")}
+
+	srv := &Server{
+		Addr: mustUnusedAddr(),
+		Handler: HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+			w.Answer(r.Questions[0].Name, time.Minute, &A{A: net.IPv4(127, 0, 0, 1).To4()})
+		}),
+		FinalizeResponse: func(ctx context.Context, res *Message, r *Query) error {
+			if r.Questions[0].Name == "fail.test.local." {
+				return errors.New("finalize failed")
+			}
+			if want, got := 1, len(res.Answers); want != got {
+				t.Errorf("want %d answers before finalize, got %d", want, got)
+			}
+			_, err := key.Sign(res)
+			return err
+		},
+		ErrorLog: log.New(ioutil.Discard, "", 0),
+	}
+	mustStart(srv)
+
+	tests := []struct {
+		name string
+
+		qname string
+
+		rcode  RCode
+		signed bool
+	}{
+		{
+			name: "signed",
+
+			qname: "test.local.",
+
+			rcode:  NoError,
+			signed: true,
+		},
+		{
+			name: "error",
+
+			qname: "fail.test.local.",
+
+			rcode: ServFail,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			conn, err := net.Dial("udp", srv.Addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			req, err := (&Message{
+				ID:        1,
+				Questions: []Question{{Name: test.qname, Type: TypeA, Class: ClassIN}},
+			}).Pack(nil, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := conn.Write(req); err != nil {
+				t.Fatal(err)
+			}
+
+			buf := make([]byte, maxPacketLen)
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			n, err := conn.Read(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var msg Message
+			if _, err := msg.Unpack(buf[:n]); err != nil {
+				t.Fatal(err)
+			}
+			if want, got := test.rcode, msg.RCode; want != got {
+				t.Errorf("want rcode %d, got %d", want, got)
+			}
+
+			err = key.Verify(buf[:n], nil)
+			if want, got := test.signed, err == nil; want != got {
+				t.Errorf("want signed response %t, got error %v", want, err)
+			}
+		})
+	}
+}
+
+func TestServerQuestionCount(t *testing.T) {
+	t.Parallel()
+
+	handler := HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+		for _, q := range r.Questions {
+			w.Answer(q.Name, time.Minute, &A{A: net.IPv4(127, 0, 0, 1).To4()})
+		}
+	})
+
+	questions := []Question{
+		{Name: "a.test.", Type: TypeA, Class: ClassIN},
+		{Name: "b.test.", Type: TypeA, Class: ClassIN},
+	}
+
+	tests := []struct {
+		name string
+
+		policy    MultiQuestionPolicy
+		questions []Question
+
+		rcode   RCode
+		answers int
+	}{
+		{
+			name:  "no-questions",
+			rcode: FormErr,
+		},
+		{
+			name:      "multi-question-all",
+			policy:    MultiQuestionAll,
+			questions: questions,
+			answers:   2,
+		},
+		{
+			name:      "multi-question-first",
+			policy:    MultiQuestionFirst,
+			questions: questions,
+			answers:   1,
+		},
+		{
+			name:      "multi-question-refuse",
+			policy:    MultiQuestionRefuse,
+			questions: questions,
+			rcode:     Refused,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			srv := &Server{
+				Addr:          mustUnusedAddr(),
+				Handler:       handler,
+				MultiQuestion: test.policy,
+			}
+			mustStart(srv)
+
+			addr, err := net.ResolveUDPAddr("udp", srv.Addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			query := &Query{
+				RemoteAddr: addr,
+				Message: &Message{
+					Questions: test.questions,
+				},
+			}
+
+			msg, err := new(Client).Do(context.Background(), query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want, got := test.rcode, msg.RCode; want != got {
+				t.Errorf("want rcode %d, got %d", want, got)
+			}
+			if want, got := test.answers, len(msg.Answers); want != got {
+				t.Errorf("want %d answers, got %d", want, got)
+			}
+		})
+	}
+}
+
+func TestServerMalformedQuery(t *testing.T) {
+	t.Parallel()
+
+	type malformed struct {
+		raw  []byte
+		addr net.Addr
+		err  error
+	}
+	malformedc := make(chan malformed, 2)
+
+	srv := &Server{
+		Addr:     mustUnusedAddr(),
+		Handler:  HandlerFunc(Refuse),
+		ErrorLog: log.New(ioutil.Discard, "", 0),
+		MalformedQuery: func(raw []byte, addr net.Addr, err error) {
+			malformedc <- malformed{raw: append([]byte(nil), raw...), addr: addr, err: err}
+		},
+	}
+	mustStart(srv)
+
+	junk := []byte{0x12, 0x34, 0x01, 0x00, 0x00, 0x01}
+
+	for _, network := range []string{"udp", "tcp"} {
+		conn, err := net.Dial(network, srv.Addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		msg := junk
+		if network == "tcp" {
+			msg = append([]byte{0x00, byte(len(junk))}, junk...)
+		}
+		if _, err := conn.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case m := <-malformedc:
+			if want, got := junk, m.raw; !reflect.DeepEqual(want, got) {
+				t.Errorf("%s: want raw bytes %x, got %x", network, want, got)
+			}
+			if want, got := conn.LocalAddr().String(), m.addr.String(); want != got {
+				t.Errorf("%s: want source address %q, got %q", network, want, got)
+			}
+			if m.err == nil {
+				t.Errorf("%s: want unpack error, got nil", network)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: malformed query hook not called", network)
+		}
+	}
+}
+
+func TestServerContextCancel(t *testing.T) {
+	t.Parallel()
+
+	var (
+		startc   = make(chan struct{}, 2)
+		releasec = make(chan struct{})
+	)
+
+	srv := &Server{
+		Handler: HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+			startc <- struct{}{}
+			<-releasec
+
+			w.Answer("test.local.", time.Minute, &A{A: net.IPv4(127, 0, 0, 1).To4()})
+		}),
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pconn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errc := make(chan error, 2)
+	go func() { errc <- srv.Serve(ctx, ln) }()
+	go func() { errc <- srv.ServePacket(ctx, pconn) }()
+
+	type result struct {
+		msg *Message
+		err error
+	}
+	resc := make(chan result, 2)
+
+	query := &Message{
+		Questions: []Question{{Name: "test.local.", Type: TypeA, Class: ClassIN}},
+	}
+
+	for _, addr := range []net.Addr{ln.Addr(), pconn.LocalAddr()} {
+		addr := addr
+		go func() {
+			msg, err := new(Client).Do(context.Background(), &Query{
+				RemoteAddr: addr,
+				Message:    query,
+			})
+			resc <- result{msg, err}
+		}()
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-startc:
+		case <-time.After(time.Second):
+			t.Fatal("handler not started")
+		}
+	}
+
+	cancel()
+
+	select {
+	case err := <-errc:
+		t.Fatalf("serve returned with in-flight queries: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(releasec)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errc:
+			if want, got := context.Canceled, err; want != got {
+				t.Errorf("want serve error %q, got %v", want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("serve did not return after cancel")
+		}
+
+		res := <-resc
+		if res.err != nil {
+			t.Fatal(res.err)
+		}
+		if want, got := 1, len(res.msg.Answers); want != got {
+			t.Errorf("want %d answers, got %d", want, got)
+		}
+	}
+
+	if _, err := net.Dial("tcp", ln.Addr().String()); err == nil {
+		t.Error("want listener closed after cancel")
+	}
+}
+
+func TestServerDrainForward(t *testing.T) {
+	t.Parallel()
+
+	for _, network := range []string{"udp", "tcp"} {
+		network := network
+
+		t.Run(network, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				startc   = make(chan struct{}, 1)
+				releasec = make(chan struct{})
+			)
+
+			srv := &Server{
+				Handler: HandlerFunc(Recursor),
+				Forwarder: &Client{
+					Transport: nopDialer{},
+					Resolver: HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+						startc <- struct{}{}
+						<-releasec
+
+						if ctx.Err() != nil {
+							w.Status(ServFail)
+							return
+						}
+						w.Answer("test.local.", time.Minute, &A{A: net.IPv4(127, 0, 0, 1).To4()})
+					}),
+				},
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var addr net.Addr
+			errc := make(chan error, 1)
+			if network == "tcp" {
+				ln, err := net.Listen("tcp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatal(err)
+				}
+				addr = ln.Addr()
+				go func() { errc <- srv.Serve(ctx, ln) }()
+			} else {
+				conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatal(err)
+				}
+				addr = conn.LocalAddr()
+				go func() { errc <- srv.ServePacket(ctx, conn) }()
+			}
+
+			type result struct {
+				msg *Message
+				err error
+			}
+			resc := make(chan result, 1)
+			go func() {
+				msg, err := new(Client).Do(context.Background(), &Query{
+					RemoteAddr: addr,
+					Message: &Message{
+						Questions: []Question{{Name: "test.local.", Type: TypeA, Class: ClassIN}},
+					},
+				})
+				resc <- result{msg, err}
+			}()
+
+			select {
+			case <-startc:
+			case <-time.After(time.Second):
+				t.Fatal("query not forwarded")
+			}
+
+			cancel()
+			close(releasec)
+
+			res := <-resc
+			if res.err != nil {
+				t.Fatal(res.err)
+			}
+			if want, got := NoError, res.msg.RCode; want != got {
+				t.Errorf("want rcode %d, got %d", want, got)
+			}
+			if want, got := 1, len(res.msg.Answers); want != got {
+				t.Errorf("want %d answers, got %d", want, got)
+			}
+
+			if want, got := context.Canceled, <-errc; want != got {
+				t.Errorf("want serve error %q, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestServerAcceptError(t *testing.T) {
+	t.Parallel()
+
+	srv := &Server{Handler: &answerHandler{answers}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t.Run("tcp", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		errc := make(chan error, 1)
+		go func() { errc <- srv.Serve(ctx, &failListener{Listener: ln}) }()
+
+		// the open connection is served until ctx is done
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		select {
+		case err := <-errc:
+			if want, got := errFailAccept, err; want != got {
+				t.Errorf("want serve error %q, got %v", want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("serve did not return after accept error")
+		}
+	})
+
+	t.Run("quic", func(t *testing.T) {
+		ln := newPipeQUICListener(&net.UDPAddr{IP: net.IPv4(192, 0, 2, 53), Port: 853})
+
+		errc := make(chan error, 1)
+		go func() { errc <- srv.ServeQUIC(ctx, ln) }()
+
+		client, server := pipeQUIC(&net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 4853}, ln.Addr())
+		defer client.Close()
+		ln.conns <- server
+		ln.Close()
+
+		select {
+		case err := <-errc:
+			if want, got := errPipeClosed, err; want != got {
+				t.Errorf("want serve error %q, got %v", want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("serve did not return after accept error")
+		}
+	})
+}
+
+var errFailAccept = errors.New("accept failed")
+
+// failListener is a Listener that fails to accept after the first connection.
+type failListener struct {
+	net.Listener
+
+	accepted bool
+}
+
+func (l *failListener) Accept() (net.Conn, error) {
+	if l.accepted {
+		return nil, errFailAccept
+	}
+	l.accepted = true
+
+	return l.Listener.Accept()
+}
+
+func TestServerTLSConfig(t *testing.T) {
+	t.Parallel()
+
+	ca := must.CACert("ca.dev", nil)
+	leaf := must.LeafCert("dns-server.dev", ca)
+
+	handler := HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+		w.Answer("test.local.", time.Minute, &A{A: net.IPv4(127, 0, 0, 1).To4()})
+	})
+
+	client := &Client{
+		Transport: &Transport{
+			TLSConfig: &tls.Config{
+				ServerName: "dns-server.dev",
+				RootCAs:    must.CertPool(ca.TLS()),
+			},
+		},
+	}
+
+	query := func(t *testing.T, addr net.Addr) {
+		msg, err := client.Do(context.Background(), &Query{
+			RemoteAddr: OverTLSAddr{addr},
+			Message: &Message{
+				Questions: []Question{{Name: "test.local.", Type: TypeA, Class: ClassIN}},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := 1, len(msg.Answers); want != got {
+			t.Errorf("want %d answers, got %d", want, got)
+		}
+	}
+
+	t.Run("missing", func(t *testing.T) {
+		t.Parallel()
+
+		for _, config := range []*tls.Config{nil, new(tls.Config)} {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			srv := &Server{Handler: handler, TLSConfig: config}
+			if want, got := ErrMissingCertificate, srv.ServeTLS(context.Background(), ln); want != got {
+				t.Errorf("want error %q, got %v", want, got)
+			}
+			if want, got := ErrMissingCertificate, srv.ListenAndServeTLS(context.Background()); want != got {
+				t.Errorf("want error %q, got %v", want, got)
+			}
+		}
+	})
+
+	t.Run("get-certificate", func(t *testing.T) {
+		t.Parallel()
+
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		srv := &Server{
+			Handler: handler,
+			TLSConfig: &tls.Config{
+				GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+					return leaf.TLS(), nil
+				},
+			},
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		go srv.ServeTLS(ctx, ln)
+
+		query(t, ln.Addr())
+	})
+
+	t.Run("files", func(t *testing.T) {
+		t.Parallel()
+
+		dir, err := ioutil.TempDir("", "dns-tls")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+		if err := ioutil.WriteFile(certFile, []byte(leaf.CertPEM()), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(keyFile, []byte(leaf.KeyPEM()), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		srv := &Server{
+			Addr:    mustUnusedAddr(),
+			Handler: handler,
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		errc := make(chan error, 1)
+		go func() { errc <- srv.ListenAndServeTLSFiles(ctx, certFile, keyFile) }()
+
+		addr, err := net.ResolveTCPAddr("tcp", srv.Addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; ; i++ {
+			conn, err := net.Dial("tcp", srv.Addr)
+			if err == nil {
+				conn.Close()
+				break
+			}
+			if i == 100 {
+				t.Fatal(err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		query(t, addr)
+
+		cancel()
+		if want, got := context.Canceled, <-errc; want != got {
+			t.Errorf("want error %q, got %v", want, got)
+		}
+	})
+}
+
+func TestServerStreamFraming(t *testing.T) {
+	t.Parallel()
+
+	req, err := (&Message{
+		ID:        1,
+		Questions: []Question{{Name: "test.local.", Type: TypeA, Class: ClassIN}},
+	}).Pack(nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := []byte{byte(len(req) >> 8), byte(len(req))}
+
+	tests := []struct {
+		name string
+
+		writes [][]byte
+
+		err     error
+		replies int
+	}{
+		{
+			name:    "split-prefix",
+			writes:  [][]byte{prefix[:1], append(prefix[1:], req...)},
+			replies: 1,
+		},
+		{
+			name:    "split-body",
+			writes:  [][]byte{append(prefix, req[:5]...), req[5:]},
+			replies: 1,
+		},
+		{
+			name:   "short-prefix",
+			writes: [][]byte{prefix[:1]},
+			err:    io.ErrUnexpectedEOF,
+		},
+		{
+			name:   "zero-length",
+			writes: [][]byte{{0x00, 0x00}, append(prefix, req...)},
+			err:    errZeroLength,
+		},
+		{
+			name:   "short-body",
+			writes: [][]byte{append(prefix, req[:5]...)},
+			err:    io.ErrUnexpectedEOF,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			errc := make(chan error, 1)
+			srv := &Server{
+				Handler:  HandlerFunc(Refuse),
+				ErrorLog: log.New(ioutil.Discard, "", 0),
+				MalformedQuery: func(raw []byte, addr net.Addr, err error) {
+					errc <- err
+				},
+			}
+
+			client, server := net.Pipe()
+			done := make(chan struct{})
+			go func() {
+				srv.serveStream(context.Background(), server)
+				close(done)
+			}()
+
+			go func() {
+				for _, b := range test.writes {
+					if _, err := client.Write(b); err != nil {
+						return
+					}
+					time.Sleep(time.Millisecond)
+				}
+				if test.replies == 0 {
+					client.Close()
+				}
+			}()
+
+			for i := 0; i < test.replies; i++ {
+				var msg Message
+				if err := (&StreamConn{Conn: client}).Recv(&msg); err != nil {
+					t.Fatal(err)
+				}
+				if want, got := Refused, msg.RCode; want != got {
+					t.Errorf("want rcode %d, got %d", want, got)
+				}
+			}
+
+			if test.err == nil {
+				client.Close()
+				<-done
+				return
+			}
+
+			select {
+			case err := <-errc:
+				ferr, ok := err.(*FramingError)
+				if !ok {
+					t.Fatalf("want *FramingError, got %v", err)
+				}
+				if want, got := test.err, ferr.Err; want != got {
+					t.Errorf("want framing error %q, got %q", want, got)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("framing error not reported")
+			}
+
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("connection not closed after framing error")
+			}
+		})
+	}
+}
+
+func TestServerStreamFuzz(t *testing.T) {
+	t.Parallel()
+
+	srv := &Server{
+		Handler:  HandlerFunc(Refuse),
+		ErrorLog: log.New(ioutil.Discard, "", 0),
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		data := make([]byte, rnd.Intn(64))
+		rnd.Read(data)
+
+		if len(data) > 2 && rnd.Intn(2) == 0 {
+			// bias toward plausible length prefixes
+			data[0], data[1] = 0, byte(rnd.Intn(len(data)))
+		}
+
+		client, server := net.Pipe()
+		done := make(chan struct{})
+		go func() {
+			srv.serveStream(context.Background(), server)
+			close(done)
+		}()
+		go io.Copy(ioutil.Discard, client)
+
+		client.Write(data)
+		client.Close()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("stream %x: connection not closed", data)
+		}
+	}
+}
+
+func TestServerWriteTimeout(t *testing.T) {
+	t.Parallel()
+
+	srv := &Server{
+		Handler:      HandlerFunc(Refuse),
+		ErrorLog:     log.New(ioutil.Discard, "", 0),
+		WriteTimeout: 20 * time.Millisecond,
+	}
+
+	req, err := (&Message{
+		ID:        1,
+		Questions: []Question{{Name: "test.local.", Type: TypeA, Class: ClassIN}},
+	}).Pack(nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, server := net.Pipe()
+	defer client.Close()
+
+	done := make(chan struct{})
+	go func() {
+		srv.serveStream(context.Background(), server)
+		close(done)
+	}()
+
+	// send two queries, and never read the responses
+	for i := 0; i < 2; i++ {
+		if _, err := client.Write(append([]byte{0, byte(len(req))}, req...)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("connection not closed after write timeout")
+	}
+}
+
+func TestServerSuppressDuplicates(t *testing.T) {
+	t.Parallel()
+
+	var (
+		calls    int32
+		startc   = make(chan struct{}, 3)
+		releasec = make(chan struct{})
+	)
+
+	srv := &Server{
+		Addr: mustUnusedAddr(),
+		Handler: HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+			atomic.AddInt32(&calls, 1)
+			startc <- struct{}{}
+			<-releasec
+
+			w.Answer("test.local.", time.Minute, &A{A: net.IPv4(127, 0, 0, 1).To4()})
+		}),
+		SuppressDuplicates: true,
+	}
+	mustStart(srv)
+
+	conn, err := net.Dial("udp", srv.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	pack := func(id int) []byte {
+		buf, err := (&Message{
+			ID:        id,
+			Questions: []Question{{Name: "test.local.", Type: TypeA, Class: ClassIN}},
+		}).Pack(nil, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return buf
+	}
+
+	if _, err := conn.Write(pack(1)); err != nil {
+		t.Fatal(err)
+	}
+	<-startc
+
+	// retransmit of the first query, and a distinct query
+	if _, err := conn.Write(pack(1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write(pack(2)); err != nil {
+		t.Fatal(err)
+	}
+	<-startc
+
+	time.Sleep(20 * time.Millisecond)
+	close(releasec)
+
+	ids := make(map[int]int)
+	for i := 0; i < 3; i++ {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+
+		buf := make([]byte, maxPacketLen)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var msg Message
+		if _, err := msg.Unpack(buf[:n]); err != nil {
+			t.Fatal(err)
+		}
+		if want, got := 1, len(msg.Answers); want != got {
+			t.Errorf("want %d answers, got %d", want, got)
+		}
+		ids[msg.ID]++
+	}
+
+	if want, got := map[int]int{1: 2, 2: 1}, ids; !reflect.DeepEqual(want, got) {
+		t.Errorf("want response IDs %v, got %v", want, got)
+	}
+	if want, got := int32(2), atomic.LoadInt32(&calls); want != got {
+		t.Errorf("want %d handler calls, got %d", want, got)
+	}
+}
+
+func TestServerCompression(t *testing.T) {
+	t.Parallel()
+
+	answer := func(w MessageWriter) {
+		for i := 0; i < 4; i++ {
+			w.Answer("test.local.", time.Minute, &A{A: net.IPv4(127, 0, 0, byte(i)).To4()})
+		}
+	}
+
+	tests := []struct {
+		name string
+
+		policy  CompressionPolicy
+		handler Handler
+
+		compressed bool
+	}{
+		{
+			name: "default",
+
+			handler:    HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) { answer(w) }),
+			compressed: true,
+		},
+		{
+			name: "never",
+
+			policy:  CompressNever,
+			handler: HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) { answer(w) }),
+		},
+		{
+			name: "handler-override",
+
+			policy: CompressNever,
+			handler: HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+				if !SetCompression(w, CompressAlways) {
+					t.Error("want compression policy supported by server writer")
+				}
+				answer(w)
+			}),
+			compressed: true,
+		},
+		{
+			name: "chain-override",
+
+			policy: CompressNever,
+			handler: Chain{HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+				if !SetCompression(w, CompressAlways) {
+					t.Error("want compression policy supported by chain writer")
+				}
+				answer(w)
+			})},
+			compressed: true,
+		},
+		{
+			name: "chain-recur-override",
+
+			policy: CompressNever,
+			handler: Chain{
+				HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+					if _, err := w.Recur(ctx); err != nil {
+						t.Error(err)
+					}
+					answer(w)
+				}),
+				HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+					if !SetCompression(w, CompressAlways) {
+						t.Error("want compression policy supported by chain recur writer")
+					}
+				}),
+			},
+			compressed: true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			srv := &Server{
+				Addr:        mustUnusedAddr(),
+				Handler:     test.handler,
+				Compression: test.policy,
+			}
+			mustStart(srv)
+
+			conn, err := net.Dial("udp", srv.Addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			req, err := (&Message{
+				ID:        1,
+				Questions: []Question{{Name: "test.local.", Type: TypeA, Class: ClassIN}},
+			}).Pack(nil, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := conn.Write(req); err != nil {
+				t.Fatal(err)
+			}
+
+			buf := make([]byte, maxPacketLen)
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			n, err := conn.Read(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var msg Message
+			if _, err := msg.Unpack(buf[:n]); err != nil {
+				t.Fatal(err)
+			}
+
+			want, err := msg.Pack(nil, test.compressed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, got := len(want), n; want != got {
+				t.Errorf("want response length %d, got %d", want, got)
+			}
+		})
+	}
+}
+
+func TestServerQueryTimeout(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+
+		network          string
+		packetTimeout    time.Duration
+		streamTimeout    time.Duration
+		wantDeadline     bool
+		wantMin, wantMax time.Duration
+	}{
+		{
+			name: "udp-default",
+
+			network:      "udp",
+			wantDeadline: true,
+			wantMin:      DefaultPacketQueryTimeout - time.Second,
+			wantMax:      DefaultPacketQueryTimeout,
+		},
+		{
+			name: "tcp-default",
+
+			network:      "tcp",
+			wantDeadline: true,
+			wantMin:      DefaultStreamQueryTimeout - time.Second,
+			wantMax:      DefaultStreamQueryTimeout,
+		},
+		{
+			name: "udp-configured",
+
+			network:       "udp",
+			packetTimeout: 2 * time.Second,
+			streamTimeout: time.Minute,
+			wantDeadline:  true,
+			wantMin:       time.Second,
+			wantMax:       2 * time.Second,
+		},
+		{
+			name: "tcp-configured",
+
+			network:       "tcp",
+			packetTimeout: 2 * time.Second,
+			streamTimeout: time.Minute,
+			wantDeadline:  true,
+			wantMin:       time.Minute - time.Second,
+			wantMax:       time.Minute,
+		},
+		{
+			name: "udp-disabled",
+
+			network:       "udp",
+			packetTimeout: -1,
+		},
+		{
+			name: "tcp-disabled",
+
+			network:       "tcp",
+			streamTimeout: -1,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			type result struct {
+				remaining time.Duration
+				ok        bool
+			}
+			resc := make(chan result, 1)
+
+			srv := &Server{
+				Addr: mustUnusedAddr(),
+				Handler: HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+					deadline, ok := ctx.Deadline()
+					resc <- result{remaining: time.Until(deadline), ok: ok}
+				}),
+				PacketQueryTimeout: test.packetTimeout,
+				StreamQueryTimeout: test.streamTimeout,
+			}
+			mustStart(srv)
+
+			var addr net.Addr
+			var err error
+			if test.network == "udp" {
+				addr, err = net.ResolveUDPAddr("udp", srv.Addr)
+			} else {
+				addr, err = net.ResolveTCPAddr("tcp", srv.Addr)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			query := &Query{
+				RemoteAddr: addr,
+				Message: &Message{
+					Questions: []Question{{Name: "test.local.", Type: TypeA, Class: ClassIN}},
+				},
+			}
+			if _, err := new(Client).Do(context.Background(), query); err != nil {
+				t.Fatal(err)
+			}
+
+			res := <-resc
+			if want, got := test.wantDeadline, res.ok; want != got {
+				t.Fatalf("want handler deadline %t, got %t", want, got)
+			}
+			if !res.ok {
+				return
+			}
+			if res.remaining < test.wantMin || res.remaining > test.wantMax {
+				t.Errorf("want handler deadline in %s to %s, got %s", test.wantMin, test.wantMax, res.remaining)
+			}
+		})
+	}
+}
+
+func TestServerQueryRaw(t *testing.T) {
+	t.Parallel()
+
+	for _, network := range []string{"udp", "tcp"} {
+		network := network
+
+		t.Run(network, func(t *testing.T) {
+			t.Parallel()
+
+			rawc := make(chan []byte, 1)
+
+			srv := &Server{
+				Addr: mustUnusedAddr(),
+				Handler: HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+					rawc <- r.Raw
+				}),
+			}
+			mustStart(srv)
+
+			conn, err := net.Dial(network, srv.Addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			var c Conn = &PacketConn{Conn: conn}
+			if network == "tcp" {
+				c = &StreamConn{Conn: conn}
+			}
+
+			req := &Message{
+				ID:        7,
+				Questions: []Question{{Name: "test.local.", Type: TypeA, Class: ClassIN}},
+			}
+			if err := c.Send(req); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Recv(new(Message)); err != nil {
+				t.Fatal(err)
+			}
+
+			want, err := req.Pack(nil, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := <-rawc; !reflect.DeepEqual(want, got) {
+				t.Errorf("want raw query %x, got %x", want, got)
+			}
+		})
+	}
 }
 
 func mustServer(handler Handler) *Server {
@@ -143,11 +143,12 @@ type session struct {
 type msgerr struct {
 	msg *Message
 	err error
+	raw []byte
 }
 
 func (s session) do(query *Query) {
 	msg, err := s.client.do(context.Background(), s.Conn, query)
-	s.msgerrc <- msgerr{msg, err}
+	s.msgerrc <- msgerr{msg: msg, err: err}
 }
 
 func (s session) recv() (*Message, error) {
@@ -158,14 +159,55 @@ func (s session) recv() (*Message, error) {
 	return me.msg, me.err
 }
 
-func truncate(buf []byte, maxPacketLength int) ([]byte, error) {
-	msg := new(Message)
-	if _, err := msg.Unpack(buf[:maxPacketLen]); err != nil {
-		if err != errResourceLen && err != errBaseLen {
-			return nil, err
+// truncate returns the packed message buf truncated to the records that fit
+// within size bytes, with the TC bit set. The OPT record of the message is
+// kept (RFC 6891, section 7), and room is made for it at the end of the
+// message.
+func truncate(buf []byte, size int) ([]byte, error) {
+	full := new(Message)
+	if _, err := full.Unpack(buf); err != nil {
+		return nil, err
+	}
+
+	var (
+		opt    *Resource
+		optLen int
+	)
+	for _, res := range full.Additionals {
+		if res.Record.Type() == TypeOPT {
+			b, err := res.Pack(nil, nil)
+			if err != nil {
+				return nil, err
+			}
+			opt, optLen = &res, len(b)
+			break
 		}
 	}
+
+	limit := size - optLen
+	if limit > len(buf) {
+		limit = len(buf)
+	}
+	if limit < 12 {
+		return nil, ErrOversizedMessage
+	}
+
+	msg := new(Message)
+	if _, err := msg.UnpackWith(buf[:limit], UnpackOptions{Partial: true}); err != nil {
+		return nil, err
+	}
 	msg.Truncated = true
 
+	additionals := msg.Additionals[:0]
+	for _, res := range msg.Additionals {
+		if typ := res.Record.Type(); typ != TypeOPT && typ != TypeTSIG {
+			additionals = append(additionals, res)
+		}
+	}
+	if opt != nil {
+		additionals = append(additionals, *opt)
+	}
+	msg.Additionals = additionals
+
 	return msg.Pack(buf[:0], true)
 }
@@ -53,17 +53,21 @@ func TestPacketSession(t *testing.T) {
 	}
 
 	buf = make([]byte, 100)
-	if _, err := ps.Read(buf); err != nil {
+	n, err := ps.Read(buf)
+	if err != nil {
 		t.Fatal(err)
 	}
 
-	_, err = msg.Unpack(buf)
-	if want, got := errResourceLen, err; want != got {
-		t.Fatalf("want %v error, got %v", want, got)
+	msg = new(Message)
+	if _, err := msg.Unpack(buf[:n]); err != nil {
+		t.Fatal(err)
 	}
 	if want, got := true, msg.Truncated; want != got {
 		t.Errorf("response message was not truncated")
 	}
+	if len(msg.Questions) == 0 || len(msg.Questions) >= 120 {
+		t.Errorf("want truncated questions, got %d", len(msg.Questions))
+	}
 }
 
 func TestStreamSession(t *testing.T) {
@@ -0,0 +1,179 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+)
+
+// An Endpoint is a dialable service endpoint resolved from SVCB records.
+type Endpoint struct {
+	Priority int      // ServiceMode priority, lower values are preferred
+	Target   string   // target domain name of the endpoint
+	Addr     string   // dial address in host:port form
+	ALPN     []string // application protocols supported by the endpoint
+}
+
+// maxAliasChain is the maximum number of AliasMode records followed when
+// resolving service endpoints.
+const maxAliasChain = 8
+
+var (
+	errAliasChain   = errors.New("SVCB AliasMode chain too long")
+	errLookupFailed = errors.New("lookup failed")
+)
+
+// LookupEndpoints resolves the endpoints of the service name from the SVCB
+// records of type typ, either TypeSVCB or TypeHTTPS, by sending queries to the
+// DNS server at addr.
+//
+// AliasMode records are followed, and the endpoints of ServiceMode records are
+// returned in priority order. The endpoint addresses are resolved from the A
+// and AAAA records of the target name, or the ipv4hint and ipv6hint parameters
+// if the target has no addresses. The port parameter overrides the default
+// port. If the name has no SVCB records, the endpoints are the addresses of
+// the name at the default port.
+func (c *Client) LookupEndpoints(ctx context.Context, addr net.Addr, typ Type, name string, port int) ([]Endpoint, error) {
+	owner := name
+
+	var svcbs []SVCB
+	for i := 0; ; i++ {
+		if i == maxAliasChain {
+			return nil, errAliasChain
+		}
+
+		recs, err := c.lookup(ctx, addr, name, typ)
+		if err != nil {
+			return nil, err
+		}
+
+		var alias string
+		for _, rec := range recs {
+			var svcb SVCB
+			switch rec := rec.(type) {
+			case *SVCB:
+				svcb = *rec
+			case *HTTPS:
+				svcb = rec.SVCB
+			default:
+				continue
+			}
+
+			if svcb.Priority == 0 {
+				alias = svcb.Target
+			} else {
+				svcbs = append(svcbs, svcb)
+			}
+		}
+
+		if len(svcbs) > 0 || alias == "" {
+			break
+		}
+		if alias == "." {
+			return nil, nil
+		}
+		name = alias
+	}
+
+	if len(svcbs) == 0 {
+		ips, err := c.lookupIPs(ctx, addr, owner)
+		if err != nil {
+			return nil, err
+		}
+		return endpoints(0, owner, ips, port, nil), nil
+	}
+
+	sort.SliceStable(svcbs, func(i, j int) bool {
+		return svcbs[i].Priority < svcbs[j].Priority
+	})
+
+	var eps []Endpoint
+	for _, svcb := range svcbs {
+		target := svcb.Target
+		if target == "." {
+			target = name
+		}
+
+		tport := port
+		if p, ok := svcb.Port(); ok {
+			tport = p
+		}
+		alpn := svcb.ALPN()
+
+		ips, err := c.lookupIPs(ctx, addr, target)
+		if err != nil {
+			return nil, err
+		}
+		if len(ips) == 0 {
+			ips = append(svcb.IPv6Hint(), svcb.IPv4Hint()...)
+		}
+
+		eps = append(eps, endpoints(svcb.Priority, target, ips, tport, alpn)...)
+	}
+	return eps, nil
+}
+
+// lookup returns the answer records of type typ for the name.
+func (c *Client) lookup(ctx context.Context, addr net.Addr, name string, typ Type) ([]Record, error) {
+	query := &Query{
+		RemoteAddr: addr,
+		Message: &Message{
+			RecursionDesired: true,
+			Questions: []Question{
+				{Name: name, Type: typ, Class: ClassIN},
+			},
+		},
+	}
+
+	msg, err := c.Do(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if msg.RCode != NoError && msg.RCode != NXDomain {
+		return nil, errLookupFailed
+	}
+
+	var recs []Record
+	for _, res := range msg.Answers {
+		if res.Record.Type() == typ {
+			recs = append(recs, res.Record)
+		}
+	}
+	return recs, nil
+}
+
+// lookupIPs returns the IPv6 and IPv4 addresses of the name.
+func (c *Client) lookupIPs(ctx context.Context, addr net.Addr, name string) ([]net.IP, error) {
+	var ips []net.IP
+	for _, typ := range []Type{TypeAAAA, TypeA} {
+		recs, err := c.lookup(ctx, addr, name, typ)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, rec := range recs {
+			switch rec := rec.(type) {
+			case *AAAA:
+				ips = append(ips, rec.AAAA)
+			case *A:
+				ips = append(ips, rec.A)
+			}
+		}
+	}
+	return ips, nil
+}
+
+func endpoints(priority int, target string, ips []net.IP, port int, alpn []string) []Endpoint {
+	eps := make([]Endpoint, 0, len(ips))
+	for _, ip := range ips {
+		eps = append(eps, Endpoint{
+			Priority: priority,
+			Target:   target,
+			Addr:     net.JoinHostPort(ip.String(), strconv.Itoa(port)),
+			ALPN:     alpn,
+		})
+	}
+	return eps
+}
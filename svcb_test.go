@@ -0,0 +1,136 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestClientLookupEndpoints(t *testing.T) {
+	t.Parallel()
+
+	zone := &Zone{
+		Origin: "example.com.",
+		TTL:    time.Minute,
+		RRs: RRSet{
+			"": {
+				TypeHTTPS: {
+					&HTTPS{SVCB{Priority: 0, Target: "svc.example.com."}},
+				},
+			},
+			"svc": {
+				TypeHTTPS: {
+					&HTTPS{SVCB{
+						Priority: 2,
+						Target:   ".",
+						Params: []SVCParam{
+							{Key: SVCParamALPN, Value: []byte("\x08http/1.1")},
+						},
+					}},
+					&HTTPS{SVCB{
+						Priority: 1,
+						Target:   "h3.example.com.",
+						Params: []SVCParam{
+							{Key: SVCParamALPN, Value: []byte("\x02h3")},
+							{Key: SVCParamPort, Value: []byte{0x20, 0xFB}},
+							{Key: SVCParamIPv4Hint, Value: []byte{192, 0, 2, 3}},
+						},
+					}},
+				},
+				TypeA: {
+					&A{A: net.IPv4(192, 0, 2, 1).To4()},
+				},
+				TypeAAAA: {
+					&AAAA{AAAA: net.ParseIP("2001:db8::1")},
+				},
+			},
+			"www": {
+				TypeA: {
+					&A{A: net.IPv4(192, 0, 2, 2).To4()},
+				},
+			},
+			"down": {
+				TypeHTTPS: {
+					&HTTPS{SVCB{Priority: 0, Target: "."}},
+				},
+			},
+			"loop": {
+				TypeHTTPS: {
+					&HTTPS{SVCB{Priority: 0, Target: "loop.example.com."}},
+				},
+			},
+		},
+	}
+
+	client := &Client{
+		Transport: nopDialer{},
+		Resolver:  zone,
+	}
+
+	tests := []struct {
+		name string
+
+		endpoints []Endpoint
+		err       error
+	}{
+		{
+			name: "example.com.",
+
+			endpoints: []Endpoint{
+				{
+					Priority: 1,
+					Target:   "h3.example.com.",
+					Addr:     "192.0.2.3:8443",
+					ALPN:     []string{"h3"},
+				},
+				{
+					Priority: 2,
+					Target:   "svc.example.com.",
+					Addr:     "[2001:db8::1]:443",
+					ALPN:     []string{"http/1.1"},
+				},
+				{
+					Priority: 2,
+					Target:   "svc.example.com.",
+					Addr:     "192.0.2.1:443",
+					ALPN:     []string{"http/1.1"},
+				},
+			},
+		},
+		{
+			name: "www.example.com.",
+
+			endpoints: []Endpoint{
+				{
+					Target: "www.example.com.",
+					Addr:   "192.0.2.2:443",
+				},
+			},
+		},
+		{
+			name: "down.example.com.",
+		},
+		{
+			name: "loop.example.com.",
+			err:  errAliasChain,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			eps, err := client.LookupEndpoints(context.Background(), nil, TypeHTTPS, test.name, 443)
+			if want, got := test.err, err; want != got {
+				t.Fatalf("want error %v, got %v", want, got)
+			}
+			if want, got := test.endpoints, eps; !reflect.DeepEqual(want, got) {
+				t.Errorf("want endpoints %+v, got %+v", want, got)
+			}
+		})
+	}
+}
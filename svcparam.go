@@ -0,0 +1,197 @@
+package dns
+
+import (
+	"errors"
+	"net"
+	"sort"
+)
+
+var errSVCParamValue = errors.New("invalid SvcParam value")
+
+// MandatoryParam returns a mandatory parameter of the keys that a client must
+// support to use the record.
+func MandatoryParam(keys ...SVCParamKey) SVCParam {
+	sorted := append([]SVCParamKey(nil), keys...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	v := make([]byte, 2*len(sorted))
+	for i, key := range sorted {
+		nbo.PutUint16(v[2*i:], uint16(key))
+	}
+	return SVCParam{Key: SVCParamMandatory, Value: v}
+}
+
+// ALPNParam returns an alpn parameter of the application protocol IDs.
+func ALPNParam(ids ...string) SVCParam {
+	var v []byte
+	for _, id := range ids {
+		v = append(append(v, byte(len(id))), id...)
+	}
+	return SVCParam{Key: SVCParamALPN, Value: v}
+}
+
+// NoDefaultALPNParam returns a no-default-alpn parameter.
+func NoDefaultALPNParam() SVCParam {
+	return SVCParam{Key: SVCParamNoDefaultALPN, Value: []byte{}}
+}
+
+// PortParam returns a port parameter.
+func PortParam(port uint16) SVCParam {
+	v := make([]byte, 2)
+	nbo.PutUint16(v, port)
+	return SVCParam{Key: SVCParamPort, Value: v}
+}
+
+// IPv4HintParam returns an ipv4hint parameter of the addresses.
+func IPv4HintParam(ips ...net.IP) SVCParam {
+	var v []byte
+	for _, ip := range ips {
+		v = append(v, ip.To4()...)
+	}
+	return SVCParam{Key: SVCParamIPv4Hint, Value: v}
+}
+
+// ECHParam returns an ech parameter of the ECHConfigList.
+func ECHParam(configs []byte) SVCParam {
+	return SVCParam{Key: SVCParamECH, Value: append([]byte(nil), configs...)}
+}
+
+// IPv6HintParam returns an ipv6hint parameter of the addresses.
+func IPv6HintParam(ips ...net.IP) SVCParam {
+	var v []byte
+	for _, ip := range ips {
+		v = append(v, ip.To16()...)
+	}
+	return SVCParam{Key: SVCParamIPv6Hint, Value: v}
+}
+
+// SetParam adds the service parameter, or replaces the parameter of the same
+// key. The parameters are kept sorted by key.
+func (s *SVCB) SetParam(param SVCParam) {
+	i := sort.Search(len(s.Params), func(i int) bool { return s.Params[i].Key >= param.Key })
+	if i < len(s.Params) && s.Params[i].Key == param.Key {
+		s.Params[i] = param
+		return
+	}
+
+	s.Params = append(s.Params, SVCParam{})
+	copy(s.Params[i+1:], s.Params[i:])
+	s.Params[i] = param
+}
+
+// Mandatory returns the keys of the mandatory parameter.
+func (s SVCB) Mandatory() []SVCParamKey {
+	v, _ := s.Param(SVCParamMandatory)
+
+	var keys []SVCParamKey
+	for ; len(v) >= 2; v = v[2:] {
+		keys = append(keys, SVCParamKey(nbo.Uint16(v)))
+	}
+	return keys
+}
+
+// ALPN returns the application protocol IDs of the alpn parameter.
+func (s SVCB) ALPN() []string {
+	v, _ := s.Param(SVCParamALPN)
+	return unpackALPN(v)
+}
+
+// NoDefaultALPN reports whether the record has a no-default-alpn parameter.
+func (s SVCB) NoDefaultALPN() bool {
+	_, ok := s.Param(SVCParamNoDefaultALPN)
+	return ok
+}
+
+// Port returns the value of the port parameter.
+func (s SVCB) Port() (int, bool) {
+	v, ok := s.Param(SVCParamPort)
+	if !ok || len(v) != 2 {
+		return 0, false
+	}
+	return int(nbo.Uint16(v)), true
+}
+
+// IPv4Hint returns the addresses of the ipv4hint parameter.
+func (s SVCB) IPv4Hint() []net.IP {
+	v, _ := s.Param(SVCParamIPv4Hint)
+	return unpackIPHints(v, net.IPv4len)
+}
+
+// ECH returns the ECHConfigList of the ech parameter.
+func (s SVCB) ECH() []byte {
+	v, _ := s.Param(SVCParamECH)
+	return v
+}
+
+// IPv6Hint returns the addresses of the ipv6hint parameter.
+func (s SVCB) IPv6Hint() []net.IP {
+	v, _ := s.Param(SVCParamIPv6Hint)
+	return unpackIPHints(v, net.IPv6len)
+}
+
+// checkValue validates the wire format value of a parameter with a key
+// defined by RFC 9460. Values of other keys are opaque.
+func (p SVCParam) checkValue() error {
+	v := p.Value
+
+	var ok bool
+	switch p.Key {
+	case SVCParamMandatory:
+		ok = len(v) > 0 && len(v)%2 == 0
+		for i := 2; ok && i < len(v); i += 2 {
+			ok = nbo.Uint16(v[i:]) > nbo.Uint16(v[i-2:])
+		}
+	case SVCParamALPN:
+		ok = len(v) > 0
+		for ok && len(v) > 0 {
+			n := int(v[0])
+			ok = n > 0 && len(v) >= 1+n
+			if ok {
+				v = v[1+n:]
+			}
+		}
+	case SVCParamNoDefaultALPN:
+		ok = len(v) == 0
+	case SVCParamPort:
+		ok = len(v) == 2
+	case SVCParamIPv4Hint:
+		ok = len(v) > 0 && len(v)%net.IPv4len == 0
+	case SVCParamECH:
+		ok = len(v) > 0
+	case SVCParamIPv6Hint:
+		ok = len(v) > 0 && len(v)%net.IPv6len == 0
+	default:
+		ok = true
+	}
+
+	if !ok {
+		return errSVCParamValue
+	}
+	return nil
+}
+
+// unpackALPN decodes the alpn-ids of an alpn parameter value.
+func unpackALPN(b []byte) []string {
+	var ids []string
+	for len(b) > 0 {
+		n := int(b[0])
+		if len(b) < 1+n {
+			break
+		}
+
+		ids = append(ids, string(b[1:1+n]))
+		b = b[1+n:]
+	}
+	return ids
+}
+
+// unpackIPHints decodes the addresses of an ipv4hint or ipv6hint parameter
+// value.
+func unpackIPHints(b []byte, size int) []net.IP {
+	var ips []net.IP
+	for len(b) >= size {
+		ips = append(ips, net.IP(append([]byte(nil), b[:size]...)))
+		b = b[size:]
+	}
+	return ips
+}
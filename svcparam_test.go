@@ -0,0 +1,103 @@
+package dns
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestSVCBParams(t *testing.T) {
+	t.Parallel()
+
+	var svcb SVCB
+	svcb.SetParam(IPv6HintParam(net.ParseIP("2001:db8::1")))
+	svcb.SetParam(PortParam(443))
+	svcb.SetParam(ALPNParam("h2"))
+	svcb.SetParam(IPv4HintParam(net.IPv4(192, 0, 2, 1)))
+	svcb.SetParam(ECHParam([]byte{1, 2, 3}))
+	svcb.SetParam(NoDefaultALPNParam())
+	svcb.SetParam(MandatoryParam(SVCParamPort, SVCParamALPN))
+	svcb.SetParam(ALPNParam("h3", "h2"))
+	svcb.SetParam(PortParam(8443))
+
+	var keys []SVCParamKey
+	for _, param := range svcb.Params {
+		keys = append(keys, param.Key)
+	}
+	if want, got := []SVCParamKey{0, 1, 2, 3, 4, 5, 6}, keys; !reflect.DeepEqual(want, got) {
+		t.Fatalf("want sorted keys %v, got %v", want, got)
+	}
+
+	https := &HTTPS{SVCB{Priority: 1, Target: ".", Params: svcb.Params}}
+
+	b, err := https.Pack(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := new(HTTPS)
+	if _, err := got.Unpack(b, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := []SVCParamKey{SVCParamALPN, SVCParamPort}, got.Mandatory(); !reflect.DeepEqual(want, got) {
+		t.Errorf("want mandatory %v, got %v", want, got)
+	}
+	if want, got := []string{"h3", "h2"}, got.ALPN(); !reflect.DeepEqual(want, got) {
+		t.Errorf("want alpn %v, got %v", want, got)
+	}
+	if !got.NoDefaultALPN() {
+		t.Error("want no-default-alpn")
+	}
+	if port, ok := got.Port(); !ok || port != 8443 {
+		t.Errorf("want port 8443, got %d", port)
+	}
+	if want, got := []net.IP{net.IPv4(192, 0, 2, 1).To4()}, got.IPv4Hint(); !reflect.DeepEqual(want, got) {
+		t.Errorf("want ipv4hint %v, got %v", want, got)
+	}
+	if want, got := []byte{1, 2, 3}, got.ECH(); !reflect.DeepEqual(want, got) {
+		t.Errorf("want ech %v, got %v", want, got)
+	}
+	if want, got := []net.IP{net.ParseIP("2001:db8::1")}, got.IPv6Hint(); !reflect.DeepEqual(want, got) {
+		t.Errorf("want ipv6hint %v, got %v", want, got)
+	}
+}
+
+func TestSVCBInvalidParams(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+
+		param SVCParam
+	}{
+		{name: "mandatory-empty", param: SVCParam{Key: SVCParamMandatory, Value: []byte{}}},
+		{name: "mandatory-unsorted", param: SVCParam{Key: SVCParamMandatory, Value: []byte{0, 3, 0, 1}}},
+		{name: "alpn-empty-id", param: SVCParam{Key: SVCParamALPN, Value: []byte{0}}},
+		{name: "alpn-short", param: SVCParam{Key: SVCParamALPN, Value: []byte("\x03h2")}},
+		{name: "no-default-alpn-value", param: SVCParam{Key: SVCParamNoDefaultALPN, Value: []byte{1}}},
+		{name: "port-short", param: SVCParam{Key: SVCParamPort, Value: []byte{1}}},
+		{name: "ipv4hint-short", param: SVCParam{Key: SVCParamIPv4Hint, Value: []byte{192, 0, 2}}},
+		{name: "ipv6hint-short", param: SVCParam{Key: SVCParamIPv6Hint, Value: []byte{0x20, 0x01}}},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			svcb := SVCB{Priority: 1, Target: ".", Params: []SVCParam{test.param}}
+			if _, err := svcb.Pack(nil, nil); err != errSVCParamValue {
+				t.Errorf("want pack error %v, got %v", errSVCParamValue, err)
+			}
+
+			b := []byte{0, 1, 0}
+			b = append(b, byte(test.param.Key>>8), byte(test.param.Key), 0, byte(len(test.param.Value)))
+			b = append(b, test.param.Value...)
+			if _, err := new(SVCB).Unpack(b, nil); err != errSVCParamValue {
+				t.Errorf("want unpack error %v, got %v", errSVCParamValue, err)
+			}
+		})
+	}
+}
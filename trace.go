@@ -0,0 +1,338 @@
+package dns
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errTraceLine  = errors.New("invalid trace line")
+	errNoExchange = errors.New("no recorded exchange for query")
+	errNoReplay   = errors.New("no pending replayed response")
+)
+
+// traceHeader is the first line of a trace file.
+const traceHeader = "; network address query response"
+
+// exchange is a query sent to a DNS server, and the response received, in
+// wire format.
+type exchange struct {
+	network, addr   string
+	query, response []byte
+
+	questions []Question // decoded questions of the query
+}
+
+// Recorder is an AddrDialer that records the query/response exchanges of the
+// connections dialed by Dialer. The recorded exchanges are written to a trace
+// that a Replayer replays without network access.
+type Recorder struct {
+	// Dialer dials the connections to DNS servers. If nil, a new Transport
+	// is used.
+	Dialer AddrDialer
+
+	mu        sync.Mutex
+	dialer    AddrDialer
+	exchanges []exchange
+}
+
+// DialAddr dials a net Addr and returns a Conn that records exchanges.
+func (r *Recorder) DialAddr(ctx context.Context, addr net.Addr) (Conn, error) {
+	conn, err := r.addrDialer().DialAddr(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &recordConn{
+		Conn:    conn,
+		rec:     r,
+		addr:    addr,
+		pending: make(map[int][]byte),
+	}, nil
+}
+
+// WriteTrace writes the recorded exchanges to w, in the order the responses
+// were received.
+func (r *Recorder) WriteTrace(w io.Writer) error {
+	r.mu.Lock()
+	exchanges := append([]exchange(nil), r.exchanges...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(traceHeader + "\n")
+	for _, ex := range exchanges {
+		bw.WriteString(strings.Join([]string{
+			ex.network,
+			ex.addr,
+			base64.StdEncoding.EncodeToString(ex.query),
+			base64.StdEncoding.EncodeToString(ex.response),
+		}, " ") + "\n")
+	}
+	return bw.Flush()
+}
+
+// Save writes the recorded exchanges to the trace file at path.
+func (r *Recorder) Save(path string) error {
+	var buf bytes.Buffer
+	if err := r.WriteTrace(&buf); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+func (r *Recorder) addrDialer() AddrDialer {
+	if r.Dialer != nil {
+		return r.Dialer
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.dialer == nil {
+		r.dialer = new(Transport)
+	}
+	return r.dialer
+}
+
+func (r *Recorder) record(ex exchange) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.exchanges = append(r.exchanges, ex)
+}
+
+type recordConn struct {
+	Conn
+
+	rec  *Recorder
+	addr net.Addr
+
+	mu      sync.Mutex
+	pending map[int][]byte
+}
+
+// Send sends msg on the underlying connection, and holds the query until the
+// response is received.
+func (c *recordConn) Send(msg *Message) error {
+	query, err := msg.Pack(nil, true)
+	if err != nil {
+		return err
+	}
+	if err := c.Conn.Send(msg); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.pending[msg.ID] = query
+	c.mu.Unlock()
+	return nil
+}
+
+// Recv reads a response from the underlying connection, and records the
+// exchange with the query of the same ID.
+func (c *recordConn) Recv(msg *Message) error {
+	if err := c.Conn.Recv(msg); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	query, ok := c.pending[msg.ID]
+	delete(c.pending, msg.ID)
+	c.mu.Unlock()
+
+	if ok {
+		raw, ok := rawBytes(c.Conn)
+		if !ok {
+			raw, _ = msg.Pack(nil, true)
+		}
+
+		c.rec.record(exchange{
+			network:  c.addr.Network(),
+			addr:     c.addr.String(),
+			query:    query,
+			response: append([]byte(nil), raw...),
+		})
+	}
+	return nil
+}
+
+// Replayer is an AddrDialer that answers queries with the responses of a
+// trace recorded by a Recorder, without network access. A query is answered
+// by the first unused exchange with the same server address and questions,
+// and the response ID is set to the query ID.
+type Replayer struct {
+	mu        sync.Mutex
+	exchanges []exchange
+	used      []bool
+}
+
+// ReadTrace reads a trace written by a Recorder.
+func ReadTrace(rd io.Reader) (*Replayer, error) {
+	r := new(Replayer)
+
+	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(nil, 4*maxStreamLen)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == ';' {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			return nil, errTraceLine
+		}
+
+		ex := exchange{network: fields[0], addr: fields[1]}
+
+		var err error
+		if ex.query, err = base64.StdEncoding.DecodeString(fields[2]); err != nil {
+			return nil, err
+		}
+		if ex.response, err = base64.StdEncoding.DecodeString(fields[3]); err != nil {
+			return nil, err
+		}
+
+		query := new(Message)
+		if _, err := query.Unpack(ex.query); err != nil {
+			return nil, err
+		}
+		ex.questions = query.Questions
+
+		r.exchanges = append(r.exchanges, ex)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	r.used = make([]bool, len(r.exchanges))
+	return r, nil
+}
+
+// LoadTrace reads the trace file at path.
+func LoadTrace(path string) (*Replayer, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ReadTrace(bytes.NewReader(buf))
+}
+
+// DialAddr returns a Conn that replays the exchanges recorded for addr.
+func (r *Replayer) DialAddr(_ context.Context, addr net.Addr) (Conn, error) {
+	return &replayConn{
+		replayer: r,
+		addr:     addr,
+	}, nil
+}
+
+// Unused returns the number of recorded exchanges that have not been
+// replayed.
+func (r *Replayer) Unused() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int
+	for _, used := range r.used {
+		if !used {
+			n++
+		}
+	}
+	return n
+}
+
+// replay returns the recorded response to msg sent to addr.
+func (r *Replayer) replay(addr net.Addr, msg *Message) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, ex := range r.exchanges {
+		if r.used[i] || ex.network != addr.Network() || ex.addr != addr.String() {
+			continue
+		}
+		if !sameQuestions(ex.questions, msg.Questions) {
+			continue
+		}
+
+		r.used[i] = true
+		return ex.response, nil
+	}
+	return nil, errNoExchange
+}
+
+func sameQuestions(a, b []Question) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Type != b[i].Type || a[i].Class != b[i].Class || !strings.EqualFold(a[i].Name, b[i].Name) {
+			return false
+		}
+	}
+	return true
+}
+
+type replayConn struct {
+	replayer *Replayer
+	addr     net.Addr
+
+	mu      sync.Mutex
+	pending []replayedResponse
+}
+
+type replayedResponse struct {
+	id  int
+	raw []byte
+}
+
+func (c *replayConn) Read([]byte) (int, error)  { return 0, ErrUnsupportedOp }
+func (c *replayConn) Write([]byte) (int, error) { return 0, ErrUnsupportedOp }
+
+func (c *replayConn) Close() error { return nil }
+
+func (c *replayConn) LocalAddr() net.Addr  { return nil }
+func (c *replayConn) RemoteAddr() net.Addr { return c.addr }
+
+func (c *replayConn) SetDeadline(time.Time) error      { return nil }
+func (c *replayConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *replayConn) SetWriteDeadline(time.Time) error { return nil }
+
+// Send looks up the recorded response to msg for Recv.
+func (c *replayConn) Send(msg *Message) error {
+	raw, err := c.replayer.replay(c.addr, msg)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.pending = append(c.pending, replayedResponse{id: msg.ID, raw: raw})
+	c.mu.Unlock()
+	return nil
+}
+
+// Recv decodes the recorded response to the first pending query.
+func (c *replayConn) Recv(msg *Message) error {
+	c.mu.Lock()
+	if len(c.pending) == 0 {
+		c.mu.Unlock()
+		return errNoReplay
+	}
+	res := c.pending[0]
+	c.pending = c.pending[1:]
+	c.mu.Unlock()
+
+	if _, err := msg.Unpack(res.raw); err != nil {
+		return err
+	}
+	msg.ID = res.id
+	return nil
+}
@@ -0,0 +1,130 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestTraceReplay(t *testing.T) {
+	t.Parallel()
+
+	srv := mustServer(&answerHandler{answers})
+
+	addr, err := net.ResolveUDPAddr("udp", srv.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := new(Recorder)
+	client := &Client{Transport: rec}
+
+	var want []*Message
+	for _, test := range transportTests {
+		msg, err := client.Do(context.Background(), &Query{
+			RemoteAddr: addr,
+			Message:    &Message{Questions: test.req.Questions},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, msg)
+	}
+
+	var buf bytes.Buffer
+	if err := rec.WriteTrace(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	replayer, err := ReadTrace(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := len(transportTests), replayer.Unused(); want != got {
+		t.Fatalf("want %d recorded exchanges, got %d", want, got)
+	}
+
+	client = &Client{Transport: replayer}
+
+	// replay in reverse order, with different message IDs
+	for i := len(transportTests) - 1; i >= 0; i-- {
+		msg, err := client.Do(context.Background(), &Query{
+			RemoteAddr: addr,
+			Message:    &Message{Questions: transportTests[i].req.Questions},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := want[i].Answers, msg.Answers; !reflect.DeepEqual(want, got) {
+			t.Errorf("want answers %+v, got %+v", want, got)
+		}
+	}
+
+	if want, got := 0, replayer.Unused(); want != got {
+		t.Errorf("want %d unused exchanges, got %d", want, got)
+	}
+
+	// exchanges are replayed once
+	_, err = client.Do(context.Background(), &Query{
+		RemoteAddr: addr,
+		Message:    &Message{Questions: transportTests[0].req.Questions},
+	})
+	if want, got := errNoExchange, err; want != got {
+		t.Errorf("want error %v, got %v", want, got)
+	}
+}
+
+func TestReadTrace(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+
+		trace string
+
+		err bool
+	}{
+		{
+			name: "empty",
+
+			trace: traceHeader + "\n",
+		},
+		{
+			name: "missing-response",
+
+			trace: "udp 127.0.0.1:53 AAEAAAAAAAAAAAAA\n",
+
+			err: true,
+		},
+		{
+			name: "invalid-base64",
+
+			trace: "udp 127.0.0.1:53 !!!! AAEAAAAAAAAAAAAA\n",
+
+			err: true,
+		},
+		{
+			name: "invalid-query",
+
+			trace: "udp 127.0.0.1:53 AAE= AAEAAAAAAAAAAAAA\n",
+
+			err: true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ReadTrace(bytes.NewBufferString(test.trace))
+			if want, got := test.err, err != nil; want != got {
+				t.Errorf("want error %t, got %v", want, err)
+			}
+		})
+	}
+}
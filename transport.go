@@ -2,10 +2,18 @@ package dns
 
 import (
 	"context"
+	cryptorand "crypto/rand"
 	"crypto/tls"
+	"errors"
+	"math/big"
 	"net"
+	"net/http"
+	"os"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 )
 
 // Transport is an implementation of AddrDialer that manages connections to DNS
@@ -14,39 +22,204 @@ import (
 type Transport struct {
 	TLSConfig *tls.Config // optional TLS config, used by DialAddr
 
+	// TLSConfigs optionally configures the TLS connections to individual DNS
+	// servers, such as the ServerName, RootCAs, or certificate pins of each
+	// provider. It is keyed by the address of the server, either as dialed
+	// or as picked by Proxy, in host:port form. Servers without a config
+	// use TLSConfig.
+	TLSConfigs map[string]*tls.Config
+
 	// DialContext func creates the underlying net connection. The DialContext
 	// method of a new net.Dialer is used by default.
 	DialContext func(context.Context, string, string) (net.Conn, error)
 
+	// LocalAddr is the source IP address of queries, for multi-homed hosts.
+	// If nil, the source address is chosen by the operating system. It is
+	// not used by a DialContext func.
+	LocalAddr net.IP
+
+	// Interface is the name of the network interface queries are sent from,
+	// such as a VRF device. Binding to an interface is only supported on
+	// Linux. It is not used by a DialContext func.
+	Interface string
+
+	// SourcePorts restricts the local port of UDP queries to a range, such
+	// as the ports permitted by a firewall. The port of each socket is
+	// picked at random from the range, and another port is tried if it is
+	// in use. If empty, the operating system picks an ephemeral port. It is
+	// not used by a DialContext func.
+	SourcePorts PortRange
+
 	// Proxy modifies the address of the DNS server to dial.
 	Proxy ProxyFunc
 
+	// UpstreamTrace is optionally called with each query sent, the address
+	// of the DNS server it was sent for, and the address of the DNS server
+	// it was sent to as picked by Proxy, for debugging routing policies.
+	// Queries answered by the Cache are not sent.
+	UpstreamTrace func(msg *Message, addr, upstream net.Addr)
+
+	// MaxResponseSize limits the length of responses read from stream
+	// oriented connections. A longer response fails the query with a
+	// MessageSizeError, and the connection is not reused. If zero,
+	// responses up to 65535 bytes are read.
+	MaxResponseSize int
+
 	// DisablePipelining disables query pipelining for stream oriented
 	// connections as defined in RFC 7766, section 6.2.1.1.
 	DisablePipelining bool
 
+	// ProbeInterval is the interval of health probes sent over idle
+	// pipelined DNS-over-TLS connections. A connection that does not answer
+	// a probe within the interval is closed, so that queries are sent over
+	// a new connection instead of a dead one. If zero, connections are not
+	// probed.
+	ProbeInterval time.Duration
+
+	// UnconnectedUDP sends UDP queries over a single unconnected socket
+	// shared by all DNS servers. Responses are matched to queries by source
+	// address and message ID. By default, a connected UDP socket with a new
+	// source port is dialed for each query, which makes forged responses
+	// harder to match to a query.
+	UnconnectedUDP bool
+
+	// DialQUIC dials a DNS-over-QUIC service. DNS-over-QUIC is not supported
+	// by default, dialing an OverQUICAddr returns ErrUnsupportedNetwork
+	// unless DialQUIC or DialQUICConn is set.
+	DialQUIC func(context.Context, OverQUICAddr, *tls.Config) (Conn, error)
+
+	// DialQUICConn dials a QUIC connection to a DNS-over-QUIC service with a
+	// QUIC implementation. Queries to the service are sent on new streams
+	// of a shared connection, which is redialed if it fails to open a
+	// stream. It is not used if DialQUIC is set.
+	DialQUICConn func(context.Context, net.Addr, *tls.Config) (QUICConn, error)
+
+	// Cache optionally caches responses, and answers queries for cached
+	// questions without sending them to the DNS server. Responses are cached
+	// per DNS server, after any Proxy, and per DO and CD bits of the query,
+	// apart from the responses cached by using the Cache as a handler.
+	Cache *Cache
+
 	plinemu sync.Mutex
 	plines  map[net.Addr]*pipeline
+
+	pmuxmu sync.Mutex
+	pmux   *packetMux
+
+	httpsmu sync.Mutex
+	https   map[httpsKey]*http.Client
+
+	quicmu sync.Mutex
+	quic   map[quicKey]QUICConn
+}
+
+// PortRange is an inclusive range of ports. The zero value is an empty range.
+type PortRange struct {
+	Min, Max int
+}
+
+// maxPortAttempts is the number of random ports of a PortRange tried before
+// failing to bind a socket.
+const maxPortAttempts = 8
+
+var errPortRange = errors.New("invalid source port range")
+
+// bind calls fn with random ports of r until fn does not fail because the
+// port is in use, at most maxPortAttempts times.
+func (r PortRange) bind(fn func(port int) error) error {
+	if r.Min < 1 || r.Max > 65535 || r.Min > r.Max {
+		return errPortRange
+	}
+
+	var err error
+	for i := 0; i < maxPortAttempts; i++ {
+		n, rerr := cryptorand.Int(cryptorand.Reader, big.NewInt(int64(r.Max-r.Min+1)))
+		if rerr != nil {
+			return rerr
+		}
+
+		if err = fn(r.Min + int(n.Int64())); !addrInUse(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// addrInUse reports whether err is caused by binding a socket to an address
+// in use.
+func addrInUse(err error) bool {
+	if oerr, ok := err.(*net.OpError); ok {
+		err = oerr.Err
+	}
+	if serr, ok := err.(*os.SyscallError); ok {
+		err = serr.Err
+	}
+	return err == syscall.EADDRINUSE
 }
 
 // DialAddr dials a net Addr and returns a Conn.
 func (t *Transport) DialAddr(ctx context.Context, addr net.Addr) (Conn, error) {
+	conn, upstream, err := t.dialConn(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.UpstreamTrace != nil || t.Proxy != nil {
+		conn = &upstreamConn{Conn: conn, trace: t.UpstreamTrace, addr: addr, upstream: upstream}
+	}
+	if t.Cache != nil {
+		return &cacheConn{Conn: conn, cache: t.Cache, addr: addr}, nil
+	}
+	return conn, nil
+}
+
+// redialAddr dials a new connection for addr like DialAddr, but without
+// reusing the pipelined connection of addr, so the proxy picks the server
+// again. The pipeline of addr is retired, and later queries use the new
+// connection.
+func (t *Transport) redialAddr(ctx context.Context, addr net.Addr) (Conn, error) {
+	t.plinemu.Lock()
+	pline := t.plines[addr]
+	delete(t.plines, addr)
+	t.plinemu.Unlock()
+
+	if pline != nil {
+		pline.retire()
+	}
+	return t.DialAddr(ctx, addr)
+}
+
+// dialConn returns a connection to the DNS server for addr, and the address
+// of the server picked by the proxy.
+func (t *Transport) dialConn(ctx context.Context, addr net.Addr) (Conn, net.Addr, error) {
 	if !t.DisablePipelining {
 		if pline := t.getPipeline(addr); pline != nil && pline.alive() {
-			return pline.conn(), nil
+			return pline.conn(), pline.upstream, nil
 		}
 	}
 
-	conn, err := t.dialAddr(ctx, addr)
+	raddr, err := t.proxy(ctx, addr)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return conn, nil
+	conn, err := t.dialAddr(ctx, addr, raddr)
+	return conn, raddr, err
 }
 
-func (t *Transport) dialAddr(ctx context.Context, addr net.Addr) (Conn, error) {
-	conn, dnsOverTLS, err := t.dial(ctx, addr)
+func (t *Transport) dialAddr(ctx context.Context, addr, raddr net.Addr) (Conn, error) {
+	switch raddr := raddr.(type) {
+	case OverHTTPSAddr:
+		return t.dialHTTPS(addr, raddr), nil
+	case OverQUICAddr:
+		return t.dialQUIC(ctx, addr, raddr)
+	}
+
+	if t.UnconnectedUDP && strings.HasPrefix(raddr.Network(), "udp") {
+		return t.dialPacketMux(ctx, raddr)
+	}
+
+	conn, dnsOverTLS, err := t.dial(ctx, raddr)
 	if err != nil {
 		return nil, err
 	}
@@ -55,14 +228,13 @@ func (t *Transport) dialAddr(ctx context.Context, addr net.Addr) (Conn, error) {
 	}
 
 	if _, ok := conn.(*tls.Conn); dnsOverTLS && !ok {
-		ipaddr, _, err := net.SplitHostPort(addr.String())
+		cfg, err := t.tlsConfig(addr, raddr)
 		if err != nil {
 			return nil, err
 		}
 
-		cfg := &tls.Config{ServerName: ipaddr}
-		if t.TLSConfig != nil {
-			cfg = t.TLSConfig.Clone()
+		if len(cfg.NextProtos) == 0 {
+			cfg.NextProtos = []string{"dot"} // RFC 7858, section 3.2
 		}
 
 		conn = tls.Client(conn, cfg)
@@ -78,11 +250,15 @@ func (t *Transport) dialAddr(ctx context.Context, addr net.Addr) (Conn, error) {
 	}
 
 	sconn := &StreamConn{
-		Conn: conn,
+		Conn:           conn,
+		MaxMessageSize: t.MaxResponseSize,
 	}
 
 	if !t.DisablePipelining {
-		pline := t.setPipeline(addr, sconn)
+		pline := t.setPipeline(addr, raddr, sconn)
+		if dnsOverTLS && t.ProbeInterval > 0 {
+			go pline.probe(t.ProbeInterval)
+		}
 		return pline.conn(), nil
 	}
 
@@ -93,22 +269,111 @@ var defaultDialer = &net.Dialer{
 	Resolver: &net.Resolver{},
 }
 
-func (t *Transport) dial(ctx context.Context, addr net.Addr) (net.Conn, bool, error) {
-	if t.Proxy != nil {
-		var err error
-		if addr, err = t.Proxy(ctx, addr); err != nil {
-			return nil, false, err
+// tlsConfig returns the TLS config for the DNS-over-TLS or DNS-over-QUIC
+// service at addr, or at raddr if modified by the proxy. The config of the
+// proxied address takes precedence over the config of addr, and both over
+// t.TLSConfig. The host of addr is the server name if none is configured.
+func (t *Transport) tlsConfig(addr, raddr net.Addr) (*tls.Config, error) {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := t.TLSConfig
+	for _, a := range []net.Addr{addr, raddr} {
+		if acfg := t.addrTLSConfig(a); acfg != nil {
+			cfg = acfg
+		}
+	}
+	if cfg == nil {
+		return &tls.Config{ServerName: host}, nil
+	}
+
+	cfg = cfg.Clone()
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+	return cfg, nil
+}
+
+// addrTLSConfig returns the TLS config of addr, or the config of t.TLSConfigs
+// for addr, or nil if there is none.
+func (t *Transport) addrTLSConfig(addr net.Addr) *tls.Config {
+	switch addr := addr.(type) {
+	case OverHTTPSAddr:
+		if addr.TLSConfig != nil {
+			return addr.TLSConfig
+		}
+	case OverQUICAddr:
+		if addr.TLSConfig != nil {
+			return addr.TLSConfig
 		}
 	}
+	return t.TLSConfigs[addr.String()]
+}
 
+// localAddr returns the local address of ip for the network, or nil if ip is
+// nil.
+func localAddr(network string, ip net.IP) net.Addr {
+	if ip == nil {
+		return nil
+	}
+	if strings.HasPrefix(network, "udp") {
+		return &net.UDPAddr{IP: ip}
+	}
+	return &net.TCPAddr{IP: ip}
+}
+
+// bindControl returns a socket control func that binds the socket to the
+// network interface, or nil if iface is empty.
+func bindControl(iface string) func(network, address string, c syscall.RawConn) error {
+	if iface == "" {
+		return nil
+	}
+	return func(_, _ string, c syscall.RawConn) error {
+		return bindToDevice(c, iface)
+	}
+}
+
+func (t *Transport) proxy(ctx context.Context, addr net.Addr) (net.Addr, error) {
+	if t.Proxy == nil {
+		return addr, nil
+	}
+	return t.Proxy(ctx, addr)
+}
+
+func (t *Transport) dial(ctx context.Context, addr net.Addr) (net.Conn, bool, error) {
 	network, dnsOverTLS := addr.Network(), false
-	if strings.HasSuffix(network, "-tls") {
-		network, dnsOverTLS = network[:len(network)-4], true
+	if i := strings.IndexByte(network, '-'); i >= 0 {
+		network, dnsOverTLS = network[:i], network[i:] == "-tls"
 	}
 
 	dial := t.DialContext
+	if dial == nil && t.SourcePorts != (PortRange{}) && strings.HasPrefix(network, "udp") {
+		var conn net.Conn
+		err := t.SourcePorts.bind(func(port int) error {
+			dialer := &net.Dialer{
+				Resolver:  defaultDialer.Resolver,
+				LocalAddr: &net.UDPAddr{IP: t.LocalAddr, Port: port},
+				Control:   bindControl(t.Interface),
+			}
+
+			var err error
+			conn, err = dialer.DialContext(ctx, network, addr.String())
+			return err
+		})
+		return conn, dnsOverTLS, err
+	}
 	if dial == nil {
 		dial = defaultDialer.DialContext
+		if t.LocalAddr != nil || t.Interface != "" {
+			dialer := &net.Dialer{
+				Resolver:  defaultDialer.Resolver,
+				LocalAddr: localAddr(network, t.LocalAddr),
+				Control:   bindControl(t.Interface),
+			}
+			dial = dialer.DialContext
+		}
 	}
 
 	conn, err := dial(ctx, network, addr.String())
@@ -130,9 +395,10 @@ func (t *Transport) getPipeline(addr net.Addr) *pipeline {
 	return t.plines[addr]
 }
 
-func (t *Transport) setPipeline(addr net.Addr, conn Conn) *pipeline {
+func (t *Transport) setPipeline(addr, upstream net.Addr, conn Conn) *pipeline {
 	pline := &pipeline{
 		Conn:     conn,
+		upstream: upstream,
 		inflight: make(map[int]pipelineTx),
 	}
 	go pline.run()
@@ -147,3 +413,86 @@ func (t *Transport) setPipeline(addr net.Addr, conn Conn) *pipeline {
 	t.plines[addr] = pline
 	return pline
 }
+
+func (t *Transport) dialPacketMux(ctx context.Context, addr net.Addr) (Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	uaddr, err := net.ResolveUDPAddr(addr.Network(), addr.String())
+	if err != nil {
+		return nil, err
+	}
+
+	// responses to queries sent to an unspecified address arrive from the
+	// loopback address.
+	switch {
+	case uaddr.IP == nil, uaddr.IP.Equal(net.IPv4zero):
+		uaddr.IP = net.IPv4(127, 0, 0, 1)
+	case uaddr.IP.Equal(net.IPv6unspecified):
+		uaddr.IP = net.IPv6loopback
+	}
+
+	t.pmuxmu.Lock()
+	defer t.pmuxmu.Unlock()
+
+	if t.pmux == nil || !t.pmux.alive() {
+		var host string
+		if t.LocalAddr != nil {
+			host = t.LocalAddr.String()
+		}
+
+		lc := net.ListenConfig{Control: bindControl(t.Interface)}
+
+		var conn net.PacketConn
+		listen := func(port int) error {
+			var err error
+			conn, err = lc.ListenPacket(ctx, "udp", net.JoinHostPort(host, strconv.Itoa(port)))
+			return err
+		}
+
+		var err error
+		if t.SourcePorts == (PortRange{}) {
+			err = listen(0)
+		} else {
+			err = t.SourcePorts.bind(listen)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		t.pmux = &packetMux{
+			PacketConn: conn,
+			inflight:   make(map[packetMuxKey]pipelineTx),
+		}
+		go t.pmux.run()
+	}
+
+	return t.pmux.conn(uaddr), nil
+}
+
+// upstreamConn reports the DNS server each query is sent to, to the trace
+// func if it is set.
+type upstreamConn struct {
+	Conn
+
+	trace          func(*Message, net.Addr, net.Addr)
+	addr, upstream net.Addr
+}
+
+func (c *upstreamConn) Send(msg *Message) error {
+	if c.trace != nil {
+		c.trace(msg, c.addr, c.upstream)
+	}
+	return c.Conn.Send(msg)
+}
+
+// Upstream returns the address of the DNS server picked by the proxy.
+func (c *upstreamConn) Upstream() net.Addr { return c.upstream }
+
+// Raw returns the wire format of the last message read by Recv, if the
+// underlying connection retains it.
+func (c *upstreamConn) Raw() []byte {
+	raw, _ := rawBytes(c.Conn)
+	return raw
+}
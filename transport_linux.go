@@ -0,0 +1,16 @@
+package dns
+
+import "syscall"
+
+// bindToDevice binds the socket to the network interface with the
+// SO_BINDTODEVICE socket option.
+func bindToDevice(c syscall.RawConn, iface string) error {
+	var err error
+	cerr := c.Control(func(fd uintptr) {
+		err = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, iface)
+	})
+	if cerr != nil {
+		return cerr
+	}
+	return err
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package dns
+
+import (
+	"errors"
+	"syscall"
+)
+
+var errBindToDevice = errors.New("interface binding not supported")
+
+func bindToDevice(syscall.RawConn, string) error {
+	return errBindToDevice
+}
@@ -5,6 +5,8 @@ import (
 	"crypto/tls"
 	"net"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -208,3 +210,750 @@ func (a *answerHandler) ServeDNS(ctx context.Context, w MessageWriter, r *Query)
 		}
 	}
 }
+
+func TestTransportUnconnectedUDP(t *testing.T) {
+	t.Parallel()
+
+	srv1 := mustServer(&answerHandler{answers})
+	srv2 := mustServer(&answerHandler{answers})
+
+	tport := &Transport{
+		UnconnectedUDP: true,
+	}
+
+	var laddrs []string
+	for _, srv := range []*Server{srv1, srv2} {
+		addr, err := net.ResolveUDPAddr("udp", srv.Addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, test := range transportTests {
+			conn, err := tport.DialAddr(context.Background(), addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := conn.Send(test.req); err != nil {
+				t.Fatal(err)
+			}
+
+			var msg Message
+			if err := conn.Recv(&msg); err != nil {
+				t.Fatal(err)
+			}
+
+			if want, got := test.res, &msg; !reflect.DeepEqual(want, got) {
+				t.Errorf("want response %+v, got %+v", want, got)
+			}
+
+			laddrs = append(laddrs, conn.LocalAddr().String())
+			conn.Close()
+		}
+	}
+
+	for _, laddr := range laddrs[1:] {
+		if want, got := laddrs[0], laddr; want != got {
+			t.Errorf("want shared local addr %q, got %q", want, got)
+		}
+	}
+
+	t.Run("timeout", func(t *testing.T) {
+		ln, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+
+		conn, err := tport.DialAddr(context.Background(), ln.LocalAddr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		if err := conn.SetDeadline(time.Now().Add(10 * time.Millisecond)); err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.Send(transportTests[0].req); err != nil {
+			t.Fatal(err)
+		}
+
+		err = conn.Recv(new(Message))
+		if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+			t.Errorf("want timeout error, got %v", err)
+		}
+	})
+
+	t.Run("pipelined", func(t *testing.T) {
+		addr, err := net.ResolveUDPAddr("udp", srv1.Addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		conn, err := tport.DialAddr(context.Background(), addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		for _, test := range transportTests {
+			if err := conn.Send(test.req); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		res := make(map[int]*Message)
+		for range transportTests {
+			msg := new(Message)
+			if err := conn.Recv(msg); err != nil {
+				t.Fatal(err)
+			}
+			res[msg.ID] = msg
+		}
+
+		for _, test := range transportTests {
+			if want, got := test.res, res[test.req.ID]; !reflect.DeepEqual(want, got) {
+				t.Errorf("want response %+v, got %+v", want, got)
+			}
+		}
+	})
+
+	t.Run("question-mismatch", func(t *testing.T) {
+		ln, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+
+		// answer each query with a forged response for another question
+		// and the same ID, followed by the response to the query
+		go func() {
+			buf := make([]byte, maxPacketLen)
+			for {
+				n, addr, err := ln.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+
+				var req Message
+				if _, err := req.Unpack(buf[:n]); err != nil {
+					continue
+				}
+
+				forged := *transportTests[1].res
+				forged.ID = req.ID
+
+				res := *transportTests[0].res
+				res.ID = req.ID
+
+				for _, msg := range []*Message{&forged, &res} {
+					b, err := msg.Pack(nil, true)
+					if err != nil {
+						return
+					}
+					if _, err := ln.WriteTo(b, addr); err != nil {
+						return
+					}
+				}
+			}
+		}()
+
+		conn, err := tport.DialAddr(context.Background(), ln.LocalAddr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		if err := conn.SetDeadline(time.Now().Add(time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.Send(transportTests[0].req); err != nil {
+			t.Fatal(err)
+		}
+
+		var msg Message
+		if err := conn.Recv(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if want, got := transportTests[0].res, &msg; !reflect.DeepEqual(want, got) {
+			t.Errorf("want response %+v, got %+v", want, got)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		addr, err := net.ResolveUDPAddr("udp", srv1.Addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = (&Transport{UnconnectedUDP: true}).DialAddr(ctx, addr)
+		if want, got := context.Canceled, err; want != got {
+			t.Errorf("want error %v, got %v", want, got)
+		}
+	})
+}
+
+func TestTransportLocalAddr(t *testing.T) {
+	t.Parallel()
+
+	srv := mustServer(&answerHandler{answers})
+
+	_, port, err := net.SplitHostPort(srv.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := net.JoinHostPort("127.0.0.1", port)
+
+	udpAddr, err := net.ResolveUDPAddr("udp", host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcpAddr, err := net.ResolveTCPAddr("tcp", host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+
+		tport *Transport
+		addr  net.Addr
+	}{
+		{
+			name: "udp",
+
+			tport: &Transport{LocalAddr: net.IPv4(127, 0, 0, 1)},
+			addr:  udpAddr,
+		},
+		{
+			name: "tcp",
+
+			tport: &Transport{LocalAddr: net.IPv4(127, 0, 0, 1), DisablePipelining: true},
+			addr:  tcpAddr,
+		},
+		{
+			name: "unconnected-udp",
+
+			tport: &Transport{LocalAddr: net.IPv4(127, 0, 0, 1), UnconnectedUDP: true},
+			addr:  udpAddr,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			conn, err := test.tport.DialAddr(context.Background(), test.addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			if err := conn.Send(transportTests[0].req); err != nil {
+				t.Fatal(err)
+			}
+
+			var msg Message
+			if err := conn.Recv(&msg); err != nil {
+				t.Fatal(err)
+			}
+			if want, got := transportTests[0].res, &msg; !reflect.DeepEqual(want, got) {
+				t.Errorf("want response %+v, got %+v", want, got)
+			}
+
+			if want, got := net.IPv4(127, 0, 0, 1), addrIP(conn.LocalAddr()); !want.Equal(got) {
+				t.Errorf("want local address %s, got %s", want, got)
+			}
+		})
+	}
+
+	t.Run("unknown-interface", func(t *testing.T) {
+		t.Parallel()
+
+		tport := &Transport{Interface: "dns-test-none0"}
+		if _, err := tport.DialAddr(context.Background(), udpAddr); err == nil {
+			t.Error("want dial error for unknown interface")
+		}
+	})
+}
+
+func TestTransportSourcePorts(t *testing.T) {
+	t.Parallel()
+
+	srv := mustServer(&answerHandler{answers})
+
+	_, port, err := net.SplitHostPort(srv.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort("127.0.0.1", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, unconnected := range []bool{false, true} {
+		unconnected := unconnected
+
+		name := "connected-udp"
+		if unconnected {
+			name = "unconnected-udp"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			port := mustUnusedUDPPort()
+			tport := &Transport{
+				SourcePorts:    PortRange{Min: port, Max: port},
+				UnconnectedUDP: unconnected,
+			}
+
+			conn, err := tport.DialAddr(context.Background(), udpAddr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			if err := conn.Send(transportTests[0].req); err != nil {
+				t.Fatal(err)
+			}
+
+			var msg Message
+			if err := conn.Recv(&msg); err != nil {
+				t.Fatal(err)
+			}
+			if want, got := transportTests[0].res, &msg; !reflect.DeepEqual(want, got) {
+				t.Errorf("want response %+v, got %+v", want, got)
+			}
+
+			if want, got := port, conn.LocalAddr().(*net.UDPAddr).Port; want != got {
+				t.Errorf("want local port %d, got %d", want, got)
+			}
+		})
+	}
+
+	t.Run("port-in-use", func(t *testing.T) {
+		t.Parallel()
+
+		pconn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pconn.Close()
+
+		port := pconn.LocalAddr().(*net.UDPAddr).Port
+		tport := &Transport{
+			LocalAddr:   net.IPv4(127, 0, 0, 1),
+			SourcePorts: PortRange{Min: port, Max: port},
+		}
+
+		_, err = tport.DialAddr(context.Background(), udpAddr)
+		if !addrInUse(err) {
+			t.Errorf("want address in use error, got %v", err)
+		}
+	})
+
+	t.Run("invalid-range", func(t *testing.T) {
+		t.Parallel()
+
+		tport := &Transport{SourcePorts: PortRange{Min: 2000, Max: 1000}}
+
+		_, err := tport.DialAddr(context.Background(), udpAddr)
+		if want, got := errPortRange, err; want != got {
+			t.Errorf("want error %v, got %v", want, got)
+		}
+	})
+}
+
+func mustUnusedUDPPort() int {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	defer conn.Close()
+
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestTransportUpstreamTrace(t *testing.T) {
+	t.Parallel()
+
+	srv1, srv2 := mustServer(&answerHandler{answers}), mustServer(&answerHandler{answers})
+
+	tests := []struct {
+		name string
+
+		network string
+
+		upstreams []string
+	}{
+		{
+			name: "udp-round-robin",
+
+			network: "udp",
+
+			upstreams: []string{srv1.Addr, srv2.Addr},
+		},
+		{
+			name: "tcp-pipelined",
+
+			network: "tcp",
+
+			upstreams: []string{srv1.Addr, srv1.Addr},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var nameservers NameServers
+			for _, srv := range []*Server{srv1, srv2} {
+				addr, err := resolveAddr(test.network, srv.Addr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				nameservers = append(nameservers, addr)
+			}
+
+			var (
+				mu        sync.Mutex
+				upstreams []string
+			)
+
+			client := &Client{
+				Transport: &Transport{
+					Proxy: nameservers.RoundRobin(),
+					UpstreamTrace: func(msg *Message, addr, upstream net.Addr) {
+						if want, got := nameservers[0], addr; want != got {
+							t.Errorf("want query address %s, got %s", want, got)
+						}
+
+						mu.Lock()
+						defer mu.Unlock()
+						upstreams = append(upstreams, upstream.String())
+					},
+				},
+			}
+
+			for i := 0; i < 2; i++ {
+				if _, err := client.Do(context.Background(), &Query{
+					RemoteAddr: nameservers[0],
+					Message:    transportTests[0].req,
+				}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if want, got := test.upstreams, upstreams; !reflect.DeepEqual(want, got) {
+				t.Errorf("want upstreams %v, got %v", want, got)
+			}
+		})
+	}
+}
+
+func resolveAddr(network, address string) (net.Addr, error) {
+	if network == "tcp" {
+		return net.ResolveTCPAddr(network, address)
+	}
+	return net.ResolveUDPAddr(network, address)
+}
+
+func TestTransportProbe(t *testing.T) {
+	t.Parallel()
+
+	var (
+		probes int32
+		stall  int32
+
+		protos = make(chan []string, 4)
+		done   = make(chan struct{})
+	)
+	defer close(done)
+
+	ca := must.CACert("ca.dev", nil)
+
+	srv := &Server{
+		Handler: HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+			if r.Questions[0] != probeQuestion {
+				w.Answer(r.Questions[0].Name, time.Minute, answers[questions["A"]])
+				return
+			}
+
+			atomic.AddInt32(&probes, 1)
+			if atomic.LoadInt32(&stall) == 1 {
+				<-done
+			}
+			w.Status(Refused)
+		}),
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{
+				*must.LeafCert("dns-server.dev", ca).TLS(),
+				*ca.TLS(),
+			},
+			GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+				protos <- hello.SupportedProtos
+				return nil, nil
+			},
+		},
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeTLS(context.Background(), ln)
+
+	tport := &Transport{
+		TLSConfig: &tls.Config{
+			ServerName: "dns-server.dev",
+			RootCAs:    must.CertPool(ca.TLS()),
+		},
+		ProbeInterval: 20 * time.Millisecond,
+	}
+	client := &Client{Transport: tport}
+	addr := OverTLSAddr{ln.Addr()}
+
+	lookup := func() {
+		query := &Query{
+			RemoteAddr: addr,
+			Message: &Message{
+				Questions: []Question{questions["A"]},
+			},
+		}
+		msg, err := client.Do(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := 1, len(msg.Answers); want != got {
+			t.Fatalf("want %d answers, got %d", want, got)
+		}
+	}
+
+	lookup()
+
+	if want, got := []string{"dot"}, <-protos; !reflect.DeepEqual(want, got) {
+		t.Errorf("want ALPN protocols %q, got %q", want, got)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if atomic.LoadInt32(&probes) == 0 {
+		t.Fatal("want health probes of idle connection")
+	}
+	if !tport.getPipeline(addr).alive() {
+		t.Fatal("want connection alive after answered probes")
+	}
+
+	// The connection is closed after an unanswered probe, and the next
+	// query is sent over a new connection.
+	atomic.StoreInt32(&stall, 1)
+	time.Sleep(100 * time.Millisecond)
+	if tport.getPipeline(addr).alive() {
+		t.Fatal("want connection closed after unanswered probe")
+	}
+	atomic.StoreInt32(&stall, 0)
+
+	lookup()
+
+	if !tport.getPipeline(addr).alive() {
+		t.Error("want new connection alive")
+	}
+}
+
+func TestTransportTLSConfig(t *testing.T) {
+	t.Parallel()
+
+	type provider struct {
+		addr net.Addr
+		cfg  *tls.Config
+	}
+
+	newProvider := func(name string) provider {
+		ca := must.CACert("ca."+name, nil)
+
+		srv := &Server{
+			Handler: &answerHandler{answers},
+			TLSConfig: &tls.Config{
+				Certificates: []tls.Certificate{
+					*must.LeafCert(name, ca).TLS(),
+					*ca.TLS(),
+				},
+			},
+		}
+
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go srv.ServeTLS(context.Background(), ln)
+
+		return provider{
+			addr: ln.Addr(),
+			cfg: &tls.Config{
+				ServerName: name,
+				RootCAs:    must.CertPool(ca.TLS()),
+			},
+		}
+	}
+
+	p1, p2 := newProvider("dns-one.dev"), newProvider("dns-two.dev")
+
+	tests := []struct {
+		name string
+
+		tport *Transport
+		addr  net.Addr
+
+		err bool
+	}{
+		{
+			name: "addr-config-one",
+
+			tport: &Transport{
+				TLSConfigs: map[string]*tls.Config{p1.addr.String(): p1.cfg},
+			},
+			addr: OverTLSAddr{p1.addr},
+		},
+		{
+			name: "addr-config-two",
+
+			tport: &Transport{
+				TLSConfig:  p1.cfg,
+				TLSConfigs: map[string]*tls.Config{p2.addr.String(): p2.cfg},
+			},
+			addr: OverTLSAddr{p2.addr},
+		},
+		{
+			name: "transport-config",
+
+			tport: &Transport{
+				TLSConfig:  p1.cfg,
+				TLSConfigs: map[string]*tls.Config{p2.addr.String(): p2.cfg},
+			},
+			addr: OverTLSAddr{p1.addr},
+		},
+		{
+			name: "mismatched-config",
+
+			tport: &Transport{
+				TLSConfigs: map[string]*tls.Config{p2.addr.String(): p1.cfg},
+			},
+			addr: OverTLSAddr{p2.addr},
+
+			err: true,
+		},
+		{
+			name: "proxy-config",
+
+			tport: &Transport{
+				TLSConfig:  p1.cfg,
+				TLSConfigs: map[string]*tls.Config{p2.addr.String(): p2.cfg},
+				Proxy: func(context.Context, net.Addr) (net.Addr, error) {
+					return OverTLSAddr{p2.addr}, nil
+				},
+			},
+			addr: OverTLSAddr{p1.addr},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			conn, err := test.tport.DialAddr(context.Background(), test.addr)
+			if test.err {
+				if err == nil {
+					conn.Close()
+					t.Error("want TLS handshake error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			if err := conn.Send(transportTests[0].req); err != nil {
+				t.Fatal(err)
+			}
+
+			var msg Message
+			if err := conn.Recv(&msg); err != nil {
+				t.Fatal(err)
+			}
+			if want, got := transportTests[0].res, &msg; !reflect.DeepEqual(want, got) {
+				t.Errorf("want response %+v, got %+v", want, got)
+			}
+		})
+	}
+}
+
+func TestTransportCache(t *testing.T) {
+	t.Parallel()
+
+	var queries int64
+	srv := mustServer(HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+		atomic.AddInt64(&queries, 1)
+		(&answerHandler{answers}).ServeDNS(ctx, w, r)
+	}))
+
+	addr, err := net.ResolveUDPAddr("udp", srv.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tport := &Transport{Cache: new(Cache)}
+
+	for i, test := range transportTests {
+		for j := 0; j < 2; j++ {
+			conn, err := tport.DialAddr(context.Background(), addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := *test.req
+			req.ID = 10*i + j
+			if err := conn.Send(&req); err != nil {
+				t.Fatal(err)
+			}
+
+			var msg Message
+			if err := conn.Recv(&msg); err != nil {
+				t.Fatal(err)
+			}
+			conn.Close()
+
+			if want, got := req.ID, msg.ID; want != got {
+				t.Errorf("want response ID %d, got %d", want, got)
+			}
+			if want, got := test.res.Questions, msg.Questions; !reflect.DeepEqual(want, got) {
+				t.Errorf("want questions %+v, got %+v", want, got)
+			}
+			if want, got := len(test.res.Answers), len(msg.Answers); want != got {
+				t.Fatalf("want %d answers, got %d", want, got)
+			}
+			if want, got := test.res.Answers[0].Record, msg.Answers[0].Record; !reflect.DeepEqual(want, got) {
+				t.Errorf("want answer %+v, got %+v", want, got)
+			}
+			if ttl := msg.Answers[0].TTL; ttl <= 0 || ttl > time.Minute {
+				t.Errorf("want answer TTL within 1m, got %s", ttl)
+			}
+		}
+	}
+
+	if want, got := int64(len(transportTests)), atomic.LoadInt64(&queries); want != got {
+		t.Errorf("want %d queries sent, got %d", want, got)
+	}
+}
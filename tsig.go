@@ -0,0 +1,235 @@
+package dns
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"hash"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TSIG algorithm names.
+//
+// Taken from https://www.iana.org/assignments/tsig-algorithm-names/tsig-algorithm-names.xhtml
+const (
+	HMACSHA1   = "hmac-sha1."   // [RFC4635]
+	HMACSHA256 = "hmac-sha256." // [RFC4635]
+	HMACSHA512 = "hmac-sha512." // [RFC4635]
+)
+
+// defaultFudge is the permitted clock skew of a TSIG signature recommended by
+// RFC 8945, section 10.
+const defaultFudge = 300 * time.Second
+
+var (
+	errTSIGAlgorithm = errors.New("unsupported TSIG algorithm")
+	errTSIGMissing   = errors.New("message not signed with TSIG")
+	errTSIGKey       = errors.New("TSIG key mismatch")
+	errTSIGBadSig    = errors.New("TSIG signature mismatch")
+	errTSIGBadTime   = errors.New("TSIG signature expired")
+	errNoRawMessage  = errors.New("connection does not retain the raw response for TSIG verification")
+)
+
+// A TSIGError is a TSIG error code returned by the signer of a message, such
+// as BADSIG (16), BADKEY (17), or BADTIME (18).
+type TSIGError struct {
+	RCode RCode
+}
+
+func (e *TSIGError) Error() string {
+	return "TSIG error " + strconv.Itoa(int(e.RCode))
+}
+
+// TSIGKey is a shared secret key for signing and verifying messages with a
+// transaction signature (RFC 8945).
+type TSIGKey struct {
+	// Name is the fully qualified name of the key.
+	Name string
+
+	// Algorithm is the HMAC algorithm name. If empty, HMACSHA256 is used.
+	Algorithm string
+
+	// Secret is the shared secret.
+	Secret []byte
+
+	// Fudge is the permitted clock skew between the signer and the
+	// verifier. If zero, 300 seconds is used.
+	Fudge time.Duration
+}
+
+// Sign signs msg and appends the TSIG record to the additional section. The
+// message must be sent with domain name compression, and without further
+// changes. The returned MAC is used to verify the signed response.
+func (k *TSIGKey) Sign(msg *Message) ([]byte, error) {
+	return k.sign(msg, nil, time.Now())
+}
+
+func (k *TSIGKey) sign(msg *Message, requestMAC []byte, now time.Time) ([]byte, error) {
+	wire, err := msg.Pack(nil, true)
+	if err != nil {
+		return nil, err
+	}
+
+	tsig := &TSIG{
+		Algorithm:  k.algorithm(),
+		TimeSigned: time.Unix(now.Unix(), 0),
+		Fudge:      k.fudge(),
+		OriginalID: msg.ID,
+	}
+	if tsig.MAC, err = k.mac(requestMAC, wire, tsig); err != nil {
+		return nil, err
+	}
+
+	msg.Additionals = append(msg.Additionals, Resource{
+		Name:   k.Name,
+		Class:  ClassANY,
+		Record: tsig,
+	})
+	return tsig.MAC, nil
+}
+
+// Verify checks the TSIG record of the wire format message raw. For a
+// response, requestMAC is the MAC returned by Sign for the request.
+func (k *TSIGKey) Verify(raw, requestMAC []byte) error {
+	return k.verify(raw, requestMAC, time.Now())
+}
+
+func (k *TSIGKey) verify(raw, requestMAC []byte, now time.Time) error {
+	msg := new(Message)
+	if _, err := msg.Unpack(raw); err != nil {
+		return err
+	}
+
+	n := len(msg.Additionals)
+	if n == 0 {
+		return errTSIGMissing
+	}
+	res := msg.Additionals[n-1]
+	tsig, ok := res.Record.(*TSIG)
+	if !ok {
+		return errTSIGMissing
+	}
+	if !strings.EqualFold(res.Name, k.Name) || !strings.EqualFold(tsig.Algorithm, k.algorithm()) {
+		return errTSIGKey
+	}
+	if tsig.Error != NoError {
+		return &TSIGError{RCode: tsig.Error}
+	}
+
+	off, err := tsigOffset(raw)
+	if err != nil {
+		return err
+	}
+
+	wire := append([]byte(nil), raw[:off]...)
+	nbo.PutUint16(wire[:2], uint16(tsig.OriginalID))
+	nbo.PutUint16(wire[10:12], uint16(n-1))
+
+	mac, err := k.mac(requestMAC, wire, tsig)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(mac, tsig.MAC) {
+		return errTSIGBadSig
+	}
+
+	if skew := now.Sub(tsig.TimeSigned); skew > tsig.Fudge || -skew > tsig.Fudge {
+		return errTSIGBadTime
+	}
+	return nil
+}
+
+// mac computes the MAC of the wire format message without the TSIG record,
+// and of the TSIG variables (RFC 8945, section 4.3).
+func (k *TSIGKey) mac(requestMAC, wire []byte, tsig *TSIG) ([]byte, error) {
+	newHash, err := tsigHash(k.algorithm())
+	if err != nil {
+		return nil, err
+	}
+	h := hmac.New(newHash, k.Secret)
+
+	var buf [8]byte
+	if requestMAC != nil {
+		nbo.PutUint16(buf[:2], uint16(len(requestMAC)))
+		h.Write(buf[:2])
+		h.Write(requestMAC)
+	}
+	h.Write(wire)
+
+	vars, err := compressor{}.Pack(nil, strings.ToLower(k.Name))
+	if err != nil {
+		return nil, err
+	}
+	nbo.PutUint16(buf[:2], uint16(ClassANY))
+	nbo.PutUint32(buf[2:6], 0)
+	vars = append(vars, buf[:6]...)
+
+	if vars, err = (compressor{}).Pack(vars, strings.ToLower(tsig.Algorithm)); err != nil {
+		return nil, err
+	}
+	if vars, err = tsig.packTimers(vars); err != nil {
+		return nil, err
+	}
+
+	nbo.PutUint16(buf[:2], uint16(tsig.Error))
+	nbo.PutUint16(buf[2:4], uint16(len(tsig.OtherData)))
+	vars = append(append(vars, buf[:4]...), tsig.OtherData...)
+
+	h.Write(vars)
+	return h.Sum(nil), nil
+}
+
+func (k *TSIGKey) algorithm() string {
+	if k.Algorithm == "" {
+		return HMACSHA256
+	}
+	return k.Algorithm
+}
+
+func (k *TSIGKey) fudge() time.Duration {
+	if k.Fudge == 0 {
+		return defaultFudge
+	}
+	return k.Fudge
+}
+
+func tsigHash(algorithm string) (func() hash.Hash, error) {
+	switch strings.ToLower(algorithm) {
+	case HMACSHA1:
+		return sha1.New, nil
+	case HMACSHA256:
+		return sha256.New, nil
+	case HMACSHA512:
+		return sha512.New, nil
+	default:
+		return nil, errTSIGAlgorithm
+	}
+}
+
+// tsigOffset returns the offset of the last record of the wire format
+// message raw, the TSIG record of a signed message.
+func tsigOffset(raw []byte) (int, error) {
+	b, counts, err := new(Message).unpackHeader(raw)
+	if err != nil {
+		return 0, err
+	}
+
+	dec := decompressor(raw)
+	for i := 0; i < counts[0]; i++ {
+		var q Question
+		if b, err = q.Unpack(b, dec); err != nil {
+			return 0, err
+		}
+	}
+	for i := 0; i < counts[1]+counts[2]+counts[3]-1; i++ {
+		var r Resource
+		if b, err = r.Unpack(b, dec); err != nil {
+			return 0, err
+		}
+	}
+	return len(raw) - len(b), nil
+}
@@ -0,0 +1,162 @@
+package dns
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTSIGKey(t *testing.T) {
+	t.Parallel()
+
+	key := &TSIGKey{
+		Name:   "update.example.",
+		Secret: []byte("secret"),
+	}
+
+	query := func() *Message {
+		return &Message{
+			ID:        42,
+			OpCode:    OpUpdate,
+			Questions: []Question{{Name: "example.", Type: TypeSOA, Class: ClassIN}},
+			Authorities: []Resource{{
+				Name:   "www.example.",
+				Class:  ClassIN,
+				TTL:    time.Minute,
+				Record: &A{A: net.IPv4(192, 0, 2, 1).To4()},
+			}},
+		}
+	}
+
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name string
+
+		key    *TSIGKey
+		mangle func([]byte)
+		now    time.Time
+
+		err error
+	}{
+		{
+			name: "valid",
+
+			key: key,
+			now: now,
+		},
+		{
+			name: "within-fudge",
+
+			key: key,
+			now: now.Add(defaultFudge),
+		},
+		{
+			name: "expired",
+
+			key: key,
+			now: now.Add(defaultFudge + time.Second),
+
+			err: errTSIGBadTime,
+		},
+		{
+			name: "tampered",
+
+			key:    key,
+			mangle: func(b []byte) { b[2] ^= 0x01 },
+			now:    now,
+
+			err: errTSIGBadSig,
+		},
+		{
+			name: "wrong-secret",
+
+			key: &TSIGKey{Name: key.Name, Secret: []byte("other")},
+			now: now,
+
+			err: errTSIGBadSig,
+		},
+		{
+			name: "wrong-name",
+
+			key: &TSIGKey{Name: "other.example.", Secret: key.Secret},
+			now: now,
+
+			err: errTSIGKey,
+		},
+		{
+			name: "wrong-algorithm",
+
+			key: &TSIGKey{Name: key.Name, Algorithm: HMACSHA512, Secret: key.Secret},
+			now: now,
+
+			err: errTSIGKey,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			msg := query()
+			if _, err := key.sign(msg, nil, now); err != nil {
+				t.Fatal(err)
+			}
+
+			raw, err := msg.Pack(nil, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.mangle != nil {
+				test.mangle(raw)
+			}
+
+			if want, got := test.err, test.key.verify(raw, nil, test.now); want != got {
+				t.Errorf("want error %v, got %v", want, got)
+			}
+		})
+	}
+
+	t.Run("unsigned", func(t *testing.T) {
+		t.Parallel()
+
+		raw, err := query().Pack(nil, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := errTSIGMissing, key.Verify(raw, nil); want != got {
+			t.Errorf("want error %v, got %v", want, got)
+		}
+	})
+
+	t.Run("response", func(t *testing.T) {
+		t.Parallel()
+
+		req := query()
+		mac, err := key.sign(req, nil, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res := query()
+		res.Response = true
+		res.Authorities = nil
+		if _, err := key.sign(res, mac, now); err != nil {
+			t.Fatal(err)
+		}
+
+		raw, err := res.Pack(nil, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := key.verify(raw, mac, now); err != nil {
+			t.Error(err)
+		}
+		if want, got := errTSIGBadSig, key.verify(raw, nil, now); want != got {
+			t.Errorf("want error %v without request MAC, got %v", want, got)
+		}
+	})
+}
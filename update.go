@@ -0,0 +1,175 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// EmptyRecord is a record of any type without RDATA. UPDATE messages use
+// empty records to require or delete all records of a name and type (RFC
+// 2136, sections 2.4 and 2.5).
+type EmptyRecord struct {
+	RRType Type
+}
+
+// Type returns the RR type identifier.
+func (e EmptyRecord) Type() Type { return e.RRType }
+
+// Length returns the encoded RDATA size.
+func (EmptyRecord) Length(Compressor) (int, error) { return 0, nil }
+
+// Pack encodes e as RDATA.
+func (EmptyRecord) Pack(b []byte, _ Compressor) ([]byte, error) { return b, nil }
+
+// Unpack decodes e from RDATA in b.
+func (EmptyRecord) Unpack(b []byte, _ Decompressor) ([]byte, error) {
+	if len(b) > 0 {
+		return nil, errResTooLong
+	}
+	return b, nil
+}
+
+// UpdateBuilder builds a dynamic update message for a zone (RFC 2136).
+// Prerequisites are checked by the server before any of the updates are
+// applied, and the updates are applied atomically.
+type UpdateBuilder struct {
+	// Zone is the name of the zone to update.
+	Zone string
+
+	// Key optionally signs the update with TSIG.
+	Key *TSIGKey
+
+	prereqs, updates []Resource
+}
+
+// NewUpdate returns an UpdateBuilder for the zone.
+func NewUpdate(zone string) *UpdateBuilder {
+	return &UpdateBuilder{Zone: zone}
+}
+
+// NameInUse requires that at least one record exists for the name.
+func (u *UpdateBuilder) NameInUse(name string) *UpdateBuilder {
+	return u.prereq(name, ClassANY, EmptyRecord{RRType: TypeALL})
+}
+
+// NameNotInUse requires that no records exist for the name.
+func (u *UpdateBuilder) NameNotInUse(name string) *UpdateBuilder {
+	return u.prereq(name, ClassNONE, EmptyRecord{RRType: TypeALL})
+}
+
+// RRSetExists requires that at least one record of the type exists for the
+// name.
+func (u *UpdateBuilder) RRSetExists(name string, typ Type) *UpdateBuilder {
+	return u.prereq(name, ClassANY, EmptyRecord{RRType: typ})
+}
+
+// RRSetNotExists requires that no records of the type exist for the name.
+func (u *UpdateBuilder) RRSetNotExists(name string, typ Type) *UpdateBuilder {
+	return u.prereq(name, ClassNONE, EmptyRecord{RRType: typ})
+}
+
+// RRSetEquals requires that the records of the name are exactly recs, for
+// each type of recs.
+func (u *UpdateBuilder) RRSetEquals(name string, recs ...Record) *UpdateBuilder {
+	for _, rec := range recs {
+		u.prereq(name, ClassIN, rec)
+	}
+	return u
+}
+
+// Add adds the records to the name.
+func (u *UpdateBuilder) Add(name string, ttl time.Duration, recs ...Record) *UpdateBuilder {
+	for _, rec := range recs {
+		u.update(name, ClassIN, ttl, rec)
+	}
+	return u
+}
+
+// Delete deletes the records from the name.
+func (u *UpdateBuilder) Delete(name string, recs ...Record) *UpdateBuilder {
+	for _, rec := range recs {
+		u.update(name, ClassNONE, 0, rec)
+	}
+	return u
+}
+
+// DeleteRRSet deletes the records of the type from the name.
+func (u *UpdateBuilder) DeleteRRSet(name string, typ Type) *UpdateBuilder {
+	return u.update(name, ClassANY, 0, EmptyRecord{RRType: typ})
+}
+
+// DeleteName deletes all records of the name.
+func (u *UpdateBuilder) DeleteName(name string) *UpdateBuilder {
+	return u.update(name, ClassANY, 0, EmptyRecord{RRType: TypeALL})
+}
+
+// Message returns the update message. The zone is the question, the
+// prerequisites are the answers, and the updates are the authorities.
+func (u *UpdateBuilder) Message() *Message {
+	return &Message{
+		OpCode:      OpUpdate,
+		Questions:   []Question{{Name: u.Zone, Type: TypeSOA, Class: ClassIN}},
+		Answers:     append([]Resource(nil), u.prereqs...),
+		Authorities: append([]Resource(nil), u.updates...),
+	}
+}
+
+func (u *UpdateBuilder) prereq(name string, class Class, rec Record) *UpdateBuilder {
+	u.prereqs = append(u.prereqs, Resource{Name: name, Class: class, Record: rec})
+	return u
+}
+
+func (u *UpdateBuilder) update(name string, class Class, ttl time.Duration, rec Record) *UpdateBuilder {
+	u.updates = append(u.updates, Resource{Name: name, Class: class, TTL: ttl, Record: rec})
+	return u
+}
+
+// Update sends the update to the primary name server at addr, and returns
+// the response. The Resolver of c is not used. If the update has a Key, the
+// update is signed, and the signature of the response is verified against the
+// raw bytes of the response, which the connection must retain.
+func (c *Client) Update(ctx context.Context, addr net.Addr, u *UpdateBuilder) (*Message, error) {
+	conn, err := c.dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if t, ok := ctx.Deadline(); ok && conn != nil {
+		if err := conn.SetDeadline(t); err != nil {
+			return nil, err
+		}
+	}
+
+	req := u.Message()
+	req.ID = c.nextID()
+
+	var mac []byte
+	if u.Key != nil {
+		if mac, err = u.Key.Sign(req); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := conn.Send(req); err != nil {
+		return nil, err
+	}
+
+	res := new(Message)
+	if err := conn.Recv(res); err != nil {
+		return nil, err
+	}
+
+	if u.Key != nil {
+		// the MAC covers the response as sent by the server, which may be
+		// compressed differently than if packed again
+		raw, ok := rawBytes(conn)
+		if !ok {
+			return nil, errNoRawMessage
+		}
+		if err := u.Key.Verify(raw, mac); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
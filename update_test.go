@@ -0,0 +1,245 @@
+package dns
+
+import (
+	"context"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUpdateBuilder(t *testing.T) {
+	t.Parallel()
+
+	a := &A{A: net.IPv4(192, 0, 2, 1).To4()}
+
+	msg := NewUpdate("example.").
+		NameInUse("app.example.").
+		NameNotInUse("new.example.").
+		RRSetExists("app.example.", TypeA).
+		RRSetNotExists("app.example.", TypeAAAA).
+		RRSetEquals("app.example.", a).
+		Add("new.example.", time.Minute, a).
+		Delete("app.example.", a).
+		DeleteRRSet("app.example.", TypeTXT).
+		DeleteName("old.example.").
+		Message()
+
+	want := &Message{
+		OpCode:    OpUpdate,
+		Questions: []Question{{Name: "example.", Type: TypeSOA, Class: ClassIN}},
+		Answers: []Resource{
+			{Name: "app.example.", Class: ClassANY, Record: EmptyRecord{RRType: TypeALL}},
+			{Name: "new.example.", Class: ClassNONE, Record: EmptyRecord{RRType: TypeALL}},
+			{Name: "app.example.", Class: ClassANY, Record: EmptyRecord{RRType: TypeA}},
+			{Name: "app.example.", Class: ClassNONE, Record: EmptyRecord{RRType: TypeAAAA}},
+			{Name: "app.example.", Class: ClassIN, Record: a},
+		},
+		Authorities: []Resource{
+			{Name: "new.example.", Class: ClassIN, TTL: time.Minute, Record: a},
+			{Name: "app.example.", Class: ClassNONE, Record: a},
+			{Name: "app.example.", Class: ClassANY, Record: EmptyRecord{RRType: TypeTXT}},
+			{Name: "old.example.", Class: ClassANY, Record: EmptyRecord{RRType: TypeALL}},
+		},
+	}
+	if got := msg; !reflect.DeepEqual(want, got) {
+		t.Fatalf("want update message %+v, got %+v", want, got)
+	}
+
+	buf, err := msg.Pack(nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := new(Message)
+	if _, err := got.Unpack(buf); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := msg.Answers, got.Answers; !reflect.DeepEqual(want, got) {
+		t.Errorf("want unpacked prerequisites %+v, got %+v", want, got)
+	}
+	if want, got := msg.Authorities[1:], got.Authorities[1:]; !reflect.DeepEqual(want, got) {
+		t.Errorf("want unpacked updates %+v, got %+v", want, got)
+	}
+}
+
+func TestClientUpdate(t *testing.T) {
+	t.Parallel()
+
+	key := &TSIGKey{
+		Name:   "update.example.",
+		Secret: []byte("secret"),
+	}
+
+	tests := []struct {
+		name string
+
+		network   string
+		clientKey *TSIGKey
+		signer    *TSIGKey
+
+		rcode RCode
+		err   bool
+	}{
+		{
+			name: "unsigned",
+		},
+		{
+			name: "signed",
+
+			clientKey: key,
+			signer:    key,
+		},
+		{
+			name: "signed-tcp",
+
+			network:   "tcp",
+			clientKey: key,
+			signer:    key,
+		},
+		{
+			name: "rejected",
+
+			clientKey: &TSIGKey{Name: key.Name, Secret: []byte("wrong")},
+			signer:    key,
+
+			err: true,
+		},
+		{
+			name: "unsigned-response",
+
+			clientKey: key,
+
+			err: true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			reqc := make(chan *Message, 1)
+
+			// respond returns the response to the update in buf. Responses
+			// over TCP are not compressed, so the MAC only matches the
+			// raw bytes of the response.
+			respond := func(buf []byte) []byte {
+				req := new(Message)
+				if _, err := req.Unpack(buf); err != nil {
+					t.Error(err)
+					return nil
+				}
+				reqc <- req
+
+				res := &Message{
+					ID:        req.ID,
+					Response:  true,
+					OpCode:    OpUpdate,
+					Questions: req.Questions,
+				}
+
+				if test.signer != nil {
+					if err := test.signer.Verify(buf, nil); err != nil {
+						res.RCode = NotAuth
+					} else {
+						mac := req.Additionals[len(req.Additionals)-1].Record.(*TSIG).MAC
+						if _, err := test.signer.sign(res, mac, time.Now()); err != nil {
+							t.Error(err)
+						}
+					}
+				}
+
+				buf, err := res.Pack(nil, test.network != "tcp")
+				if err != nil {
+					t.Error(err)
+					return nil
+				}
+				return buf
+			}
+
+			var addr net.Addr
+			if test.network == "tcp" {
+				ln, err := net.Listen("tcp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer ln.Close()
+				addr = ln.Addr()
+
+				go func() {
+					conn, err := ln.Accept()
+					if err != nil {
+						return
+					}
+					defer conn.Close()
+
+					var lbuf [2]byte
+					if _, err := io.ReadFull(conn, lbuf[:]); err != nil {
+						return
+					}
+					buf := make([]byte, nbo.Uint16(lbuf[:]))
+					if _, err := io.ReadFull(conn, buf); err != nil {
+						return
+					}
+
+					if res := respond(buf); res != nil {
+						nbo.PutUint16(lbuf[:], uint16(len(res)))
+						conn.Write(append(lbuf[:], res...))
+					}
+				}()
+			} else {
+				conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer conn.Close()
+				addr = conn.LocalAddr()
+
+				go func() {
+					buf := make([]byte, maxPacketLen)
+					n, raddr, err := conn.ReadFrom(buf)
+					if err != nil {
+						return
+					}
+
+					if res := respond(buf[:n]); res != nil {
+						conn.WriteTo(res, raddr)
+					}
+				}()
+			}
+
+			update := NewUpdate("example.").
+				RRSetNotExists("app.example.", TypeCNAME).
+				Add("app.example.", time.Minute, &A{A: net.IPv4(192, 0, 2, 1).To4()})
+			update.Key = test.clientKey
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			res, err := new(Client).Update(ctx, addr, update)
+			if test.err {
+				if err == nil {
+					t.Error("want update error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, got := test.rcode, res.RCode; want != got {
+				t.Errorf("want rcode %d, got %d", want, got)
+			}
+
+			req := <-reqc
+			if want, got := OpUpdate, req.OpCode; want != got {
+				t.Errorf("want opcode %d, got %d", want, got)
+			}
+			if want, got := 1, len(req.Authorities); want != got {
+				t.Errorf("want %d updates, got %d", want, got)
+			}
+		})
+	}
+}
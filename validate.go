@@ -0,0 +1,214 @@
+package dns
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+var (
+	errQuestionCount = errors.New("invalid number of questions")
+	errQuestionType  = errors.New("invalid question type")
+	errQueryRCode    = errors.New("query with a response code")
+	errQueryFlags    = errors.New("query with response flags")
+	errQueryRecords  = errors.New("query with answer or authority records")
+	errUpdateZone    = errors.New("update zone is not of type SOA")
+	errNilRecord     = errors.New("resource without a record")
+	errRecordType    = errors.New("invalid resource type")
+	errOPTPlacement  = errors.New("OPT record not a single root record of the additional section")
+	errTSIGPlacement = errors.New("TSIG record not the last record of the additional section")
+)
+
+// A ValidationError is returned by Validate for an invalid question or
+// resource of a message.
+type ValidationError struct {
+	Section string // "question", "answer", "authority", or "additional"
+	Index   int
+	Err     error
+}
+
+func (e *ValidationError) Error() string {
+	return "dns: " + e.Section + " " + strconv.Itoa(e.Index) + ": " + e.Err.Error()
+}
+
+// Validate reports whether m is a well-formed message that can be packed and
+// is consistent with its header. It checks that:
+//
+//   - the header fields and the section counts fit their wire format size
+//   - a query has no response code or AA and RA flags, a standard query has
+//     at least one question, and a notify has a single question, and
+//     neither has answer or authority records
+//   - an update has a single zone question of type SOA
+//   - names are fully qualified and within the label and name length limits
+//   - TTLs are within 0 and 2^31-1 seconds
+//   - questions are of a queryable type and a known class
+//   - resources are not of a meta type, and of class NONE or ANY only in
+//     the prerequisite and update sections of an update
+//   - an OPT record is the only OPT record, owned by the root, in the
+//     additional section, and a TSIG record is the last additional record
+//
+// Errors of a question or resource are returned as a *ValidationError.
+func (m *Message) Validate() error {
+	if err := m.validateHeader(); err != nil {
+		return err
+	}
+
+	for i, q := range m.Questions {
+		if err := validateQuestion(q); err != nil {
+			return &ValidationError{Section: "question", Index: i, Err: err}
+		}
+	}
+
+	sections := []struct {
+		name string
+		rrs  []Resource
+	}{
+		{"answer", m.Answers},
+		{"authority", m.Authorities},
+		{"additional", m.Additionals},
+	}
+	for _, section := range sections {
+		for i, res := range section.rrs {
+			if err := m.validateResource(section.name, i, res); err != nil {
+				return &ValidationError{Section: section.name, Index: i, Err: err}
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Message) validateHeader() error {
+	if m.ID < 0 || m.ID > math.MaxUint16 || m.OpCode > 0x0F || m.RCode > 0x0F {
+		return errFieldOverflow
+	}
+
+	switch {
+	case len(m.Questions) > math.MaxUint16:
+		return errTooManyQuestions
+	case len(m.Answers) > math.MaxUint16:
+		return errTooManyAnswers
+	case len(m.Authorities) > math.MaxUint16:
+		return errTooManyAuthorities
+	case len(m.Additionals) > math.MaxUint16:
+		return errTooManyAdditionals
+	}
+
+	if m.OpCode == OpUpdate {
+		if len(m.Questions) != 1 && !m.Response {
+			return errQuestionCount
+		}
+		if len(m.Questions) == 1 && m.Questions[0].Type != TypeSOA {
+			return errUpdateZone
+		}
+	}
+
+	if m.Response {
+		return nil
+	}
+
+	switch {
+	case m.RCode != NoError:
+		return errQueryRCode
+	case m.Authoritative || m.RecursionAvailable:
+		return errQueryFlags
+	}
+
+	switch m.OpCode {
+	case OpQuery:
+		if len(m.Questions) == 0 {
+			return errQuestionCount
+		}
+		if len(m.Answers) > 0 || len(m.Authorities) > 0 {
+			return errQueryRecords
+		}
+	case OpNotify:
+		if len(m.Questions) != 1 {
+			return errQuestionCount
+		}
+		if len(m.Authorities) > 0 {
+			return errQueryRecords
+		}
+	}
+	return nil
+}
+
+func validateQuestion(q Question) error {
+	if err := validateName(q.Name); err != nil {
+		return err
+	}
+
+	switch q.Type {
+	case TypeANY, TypeOPT, TypeTSIG:
+		return errQuestionType
+	}
+
+	switch q.Class {
+	case ClassIN, ClassCH, ClassHS, ClassANY:
+		return nil
+	}
+	return errInvalidClass
+}
+
+// validateResource validates the resource at index i of the named section of
+// m.
+func (m *Message) validateResource(section string, i int, res Resource) error {
+	if res.Record == nil {
+		return errNilRecord
+	}
+	if err := validateName(res.Name); err != nil {
+		return err
+	}
+	if _, err := packSeconds("TTL", res.TTL, math.MaxInt32); err != nil {
+		return err
+	}
+
+	// an update prerequisite or delete may be of a meta type and class
+	// NONE or ANY (RFC 2136, sections 2.4 and 2.5)
+	update := m.OpCode == OpUpdate && section != "additional"
+
+	switch typ := res.Record.Type(); typ {
+	case TypeOPT:
+		if section != "additional" || (res.Name != "." && res.Name != "") {
+			return errOPTPlacement
+		}
+		for j, add := range m.Additionals {
+			if j != i && add.Record != nil && add.Record.Type() == TypeOPT {
+				return errOPTPlacement
+			}
+		}
+		return nil // the class of an OPT record is the UDP payload size
+	case TypeTSIG:
+		if section != "additional" || i != len(m.Additionals)-1 {
+			return errTSIGPlacement
+		}
+	case TypeANY, TypeAXFR, TypeALL:
+		if !update || (res.Class != ClassANY && res.Class != ClassNONE) {
+			return errRecordType
+		}
+	}
+
+	switch res.Class {
+	case ClassIN, ClassCH, ClassHS:
+		return nil
+	case ClassNONE, ClassANY:
+		if update || res.Record.Type() == TypeTSIG {
+			return nil // a TSIG record is of class ANY (RFC 8945, section 4.2)
+		}
+	}
+	return errInvalidClass
+}
+
+// validateName reports whether name is a fully qualified domain name within
+// the label and name length limits.
+func validateName(name string) error {
+	var buf [maxNameLen + 2]byte
+
+	b, err := compressor{}.Pack(buf[:0], name)
+	if err != nil {
+		return err
+	}
+	if len(b) > maxNameLen+1 {
+		return errNameTooLong
+	}
+	return nil
+}
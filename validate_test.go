@@ -0,0 +1,271 @@
+package dns
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessageValidate(t *testing.T) {
+	t.Parallel()
+
+	a := &A{A: net.IPv4(192, 0, 2, 1).To4()}
+	opt := Resource{Name: ".", Class: 4096, Record: &OPT{}}
+	tsig := Resource{Name: "key.example.", Class: ClassANY, Record: &TSIG{Algorithm: "hmac-sha256."}}
+
+	query := func(q Question) *Message {
+		return &Message{ID: 1, Questions: []Question{q}}
+	}
+
+	tests := []struct {
+		name string
+
+		msg *Message
+
+		err   error
+		index int
+	}{
+		{
+			name: "query",
+
+			msg: &Message{
+				ID:               0xFFFF,
+				RecursionDesired: true,
+				Questions:        []Question{questions["A"]},
+				Additionals:      []Resource{opt},
+			},
+		},
+		{
+			name: "response",
+
+			msg: &Message{
+				Response:      true,
+				Authoritative: true,
+				RCode:         NXDomain,
+				Questions:     []Question{questions["A"]},
+				Answers: []Resource{
+					{Name: "Example.COM.", Class: ClassIN, TTL: time.Minute, Record: a},
+				},
+				Additionals: []Resource{opt, tsig},
+			},
+		},
+		{
+			name: "update",
+
+			msg: NewUpdate("example.com.").
+				NameInUse("www.example.com.").
+				DeleteRRSet("www.example.com.", TypeAAAA).
+				Delete("www.example.com.", a).
+				Message(),
+		},
+		{
+			name: "id-overflow",
+
+			msg: &Message{ID: 0x10000, Questions: []Question{questions["A"]}},
+
+			err: errFieldOverflow,
+		},
+		{
+			name: "query-rcode",
+
+			msg: &Message{RCode: ServFail, Questions: []Question{questions["A"]}},
+
+			err: errQueryRCode,
+		},
+		{
+			name: "query-flags",
+
+			msg: &Message{Authoritative: true, Questions: []Question{questions["A"]}},
+
+			err: errQueryFlags,
+		},
+		{
+			name: "query-without-question",
+
+			msg: &Message{},
+
+			err: errQuestionCount,
+		},
+		{
+			name: "query-answers",
+
+			msg: &Message{
+				Questions: []Question{questions["A"]},
+				Answers:   []Resource{{Name: "example.com.", Class: ClassIN, Record: a}},
+			},
+
+			err: errQueryRecords,
+		},
+		{
+			name: "multiple-questions",
+
+			msg: &Message{
+				Questions: []Question{questions["A"], questions["AAAA"]},
+			},
+		},
+		{
+			name: "notify-multiple-questions",
+
+			msg: &Message{
+				OpCode:    OpNotify,
+				Questions: []Question{questions["A"], questions["AAAA"]},
+			},
+
+			err: errQuestionCount,
+		},
+		{
+			name: "update-zone",
+
+			msg: &Message{
+				OpCode:    OpUpdate,
+				Questions: []Question{questions["A"]},
+			},
+
+			err: errUpdateZone,
+		},
+		{
+			name: "relative-name",
+
+			msg: query(Question{Name: "example.com", Type: TypeA, Class: ClassIN}),
+
+			err: errInvalidFQDN,
+		},
+		{
+			name: "long-label",
+
+			msg: query(Question{Name: strings.Repeat("a", 64) + ".com.", Type: TypeA, Class: ClassIN}),
+
+			err: errSegTooLong,
+		},
+		{
+			name: "long-name",
+
+			msg: query(Question{Name: strings.Repeat("abcdefg.", 32), Type: TypeA, Class: ClassIN}),
+
+			err: errNameTooLong,
+		},
+		{
+			name: "question-type",
+
+			msg: query(Question{Name: "example.com.", Type: TypeOPT, Class: ClassIN}),
+
+			err: errQuestionType,
+		},
+		{
+			name: "question-class",
+
+			msg: query(Question{Name: "example.com.", Type: TypeA, Class: ClassNONE}),
+
+			err: errInvalidClass,
+		},
+		{
+			name: "nil-record",
+
+			msg: &Message{
+				Response:  true,
+				Questions: []Question{questions["A"]},
+				Answers:   []Resource{{Name: "example.com.", Class: ClassIN}},
+			},
+
+			err: errNilRecord,
+		},
+		{
+			name: "negative-ttl",
+
+			msg: &Message{
+				Response: true,
+				Answers: []Resource{
+					{Name: "example.com.", Class: ClassIN, TTL: time.Minute, Record: a},
+					{Name: "example.com.", Class: ClassIN, TTL: -time.Second, Record: a},
+				},
+			},
+
+			index: 1,
+		},
+		{
+			name: "meta-type",
+
+			msg: &Message{
+				Response: true,
+				Answers:  []Resource{{Name: "example.com.", Class: ClassANY, Record: EmptyRecord{RRType: TypeALL}}},
+			},
+
+			err: errRecordType,
+		},
+		{
+			name: "class-any",
+
+			msg: &Message{
+				Response: true,
+				Answers:  []Resource{{Name: "example.com.", Class: ClassANY, Record: a}},
+			},
+
+			err: errInvalidClass,
+		},
+		{
+			name: "opt-owner",
+
+			msg: &Message{
+				Response:    true,
+				Additionals: []Resource{{Name: "example.com.", Class: 4096, Record: &OPT{}}},
+			},
+
+			err: errOPTPlacement,
+		},
+		{
+			name: "multiple-opt",
+
+			msg: &Message{
+				Response:    true,
+				Additionals: []Resource{opt, opt},
+			},
+
+			err: errOPTPlacement,
+		},
+		{
+			name: "tsig-not-last",
+
+			msg: &Message{
+				Response:    true,
+				Additionals: []Resource{tsig, opt},
+			},
+
+			err: errTSIGPlacement,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := test.msg.Validate()
+			if test.err == nil && test.index == 0 {
+				if err != nil {
+					t.Errorf("want valid message, got error %v", err)
+				}
+				return
+			}
+
+			verr, ok := err.(*ValidationError)
+			if !ok {
+				if want, got := test.err, err; want != got {
+					t.Errorf("want error %v, got %v", want, got)
+				}
+				return
+			}
+
+			if want, got := test.index, verr.Index; want != got {
+				t.Errorf("want error at index %d, got %d", want, got)
+			}
+			if _, ok := verr.Err.(*DurationError); ok && test.err == nil {
+				return
+			}
+			if want, got := test.err, verr.Err; want != got {
+				t.Errorf("want error %v, got %v", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"strings"
+)
+
+// A View serves queries from a class of clients, such as clients of an
+// internal network in a split DNS deployment.
+type View struct {
+	// Networks restricts the view to clients with an address in one of the
+	// networks. If empty, clients from any address match.
+	Networks []*net.IPNet
+
+	// Keys restricts the view to queries signed with one of the TSIG keys.
+	// The signature is verified against the raw bytes of the query, so a
+	// query without them, or with an invalid signature, does not match. If
+	// empty, queries with or without a TSIG record match.
+	Keys []*TSIGKey
+
+	// Handler serves the queries matched by the view.
+	Handler Handler
+}
+
+// Views is a handler that dispatches queries to the first matching View.
+// Queries from clients not matched by any view are refused.
+type Views []View
+
+// ServeDNS dispatches the query to the handler of the first matching view.
+func (v Views) ServeDNS(ctx context.Context, w MessageWriter, r *Query) {
+	for _, view := range v {
+		if view.Match(r) {
+			view.Handler.ServeDNS(ctx, w, r)
+			return
+		}
+	}
+
+	w.Status(Refused)
+}
+
+// Match reports whether the query is matched by the view.
+func (v View) Match(r *Query) bool {
+	if len(v.Networks) > 0 {
+		ip := addrIP(r.RemoteAddr)
+		if ip == nil {
+			return false
+		}
+
+		var ok bool
+		for _, ipnet := range v.Networks {
+			if ok = ipnet.Contains(ip); ok {
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	if len(v.Keys) > 0 {
+		name, ok := tsigKeyName(r.Message)
+		if !ok || r.Raw == nil {
+			return false
+		}
+
+		for _, key := range v.Keys {
+			if strings.EqualFold(name, key.Name) && key.Verify(r.Raw, nil) == nil {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// addrIP returns the IP address of addr, or nil if addr has no IP address.
+func addrIP(addr net.Addr) net.IP {
+	switch addr := addr.(type) {
+	case *net.UDPAddr:
+		return addr.IP
+	case *net.TCPAddr:
+		return addr.IP
+	case *net.IPAddr:
+		return addr.IP
+	case nil:
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	return net.ParseIP(host)
+}
+
+// tsigKeyName returns the key name of the TSIG record of msg. As defined in
+// RFC 8945, section 5.1, the TSIG record must be the last additional record.
+func tsigKeyName(msg *Message) (string, bool) {
+	if msg == nil || len(msg.Additionals) == 0 {
+		return "", false
+	}
+
+	res := msg.Additionals[len(msg.Additionals)-1]
+	if res.Record == nil || res.Record.Type() != TypeTSIG {
+		return "", false
+	}
+	return res.Name, true
+}
@@ -0,0 +1,147 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestViews(t *testing.T) {
+	t.Parallel()
+
+	_, internalNet, err := net.ParseCIDR("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	answer := func(ip net.IP) Handler {
+		return HandlerFunc(func(ctx context.Context, w MessageWriter, r *Query) {
+			w.Answer(r.Questions[0].Name, time.Minute, &A{A: ip.To4()})
+		})
+	}
+
+	key := &TSIGKey{
+		Name:   "transfer.key.",
+		Secret: []byte("secret"),
+	}
+
+	views := Views{
+		{
+			Keys:    []*TSIGKey{key},
+			Handler: answer(net.IPv4(192, 0, 2, 1)),
+		},
+		{
+			Networks: []*net.IPNet{internalNet},
+			Handler:  answer(net.IPv4(10, 0, 0, 1)),
+		},
+		{
+			Networks: mustParseCIDRs("192.0.2.0/24", "2001:db8::/32"),
+			Handler:  answer(net.IPv4(203, 0, 113, 1)),
+		},
+	}
+
+	client := &Client{
+		Transport: nopDialer{},
+		Resolver:  views,
+	}
+
+	tests := []struct {
+		name string
+
+		addr net.Addr
+		key  *TSIGKey
+		raw  bool
+
+		rcode  RCode
+		answer net.IP
+	}{
+		{
+			name:   "internal-udp",
+			addr:   &net.UDPAddr{IP: net.IPv4(10, 1, 2, 3), Port: 53},
+			answer: net.IPv4(10, 0, 0, 1),
+		},
+		{
+			name:   "internal-tcp",
+			addr:   &net.TCPAddr{IP: net.IPv4(10, 1, 2, 3), Port: 53},
+			answer: net.IPv4(10, 0, 0, 1),
+		},
+		{
+			name:   "external-ipv6",
+			addr:   &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 53},
+			answer: net.IPv4(203, 0, 113, 1),
+		},
+		{
+			name:   "tsig-key",
+			addr:   &net.UDPAddr{IP: net.IPv4(10, 1, 2, 3), Port: 53},
+			key:    &TSIGKey{Name: "Transfer.Key.", Secret: key.Secret},
+			raw:    true,
+			answer: net.IPv4(192, 0, 2, 1),
+		},
+		{
+			name:   "tsig-bad-signature",
+			addr:   &net.UDPAddr{IP: net.IPv4(10, 1, 2, 3), Port: 53},
+			key:    &TSIGKey{Name: key.Name, Secret: []byte("forged")},
+			raw:    true,
+			answer: net.IPv4(10, 0, 0, 1),
+		},
+		{
+			name:   "tsig-unverified",
+			addr:   &net.UDPAddr{IP: net.IPv4(10, 1, 2, 3), Port: 53},
+			key:    key,
+			answer: net.IPv4(10, 0, 0, 1),
+		},
+		{
+			name:  "unmatched",
+			addr:  &net.UDPAddr{IP: net.IPv4(198, 51, 100, 1), Port: 53},
+			rcode: Refused,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			query := &Query{
+				RemoteAddr: test.addr,
+				Message: &Message{
+					Questions: []Question{
+						{Name: "www.example.com.", Type: TypeA},
+					},
+				},
+			}
+			if test.key != nil {
+				if _, err := test.key.Sign(query.Message); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if test.raw {
+				raw, err := query.Pack(nil, true)
+				if err != nil {
+					t.Fatal(err)
+				}
+				query.Raw = raw
+			}
+
+			msg, err := client.Do(context.Background(), query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want, got := test.rcode, msg.RCode; want != got {
+				t.Errorf("want rcode %d, got %d", want, got)
+			}
+			if test.answer == nil {
+				return
+			}
+			if want, got := 1, len(msg.Answers); want != got {
+				t.Fatalf("want %d answers, got %d", want, got)
+			}
+			if want, got := test.answer, msg.Answers[0].Record.(*A).A; !want.Equal(got) {
+				t.Errorf("want A record %q, got %q", want, got)
+			}
+		})
+	}
+}
@@ -2,58 +2,375 @@ package dns
 
 import (
 	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
-// RRSet is a set of resource records indexed by name and type.
+// RRSet is a set of resource records indexed by name and type. Names are
+// matched exactly by Lookup, and case-insensitively by a Zone.
+//
+// Records are indexed by their own type, with the exception of CNAME records
+// which may be indexed by the type of query they answer.
 type RRSet map[string]map[Type][]Record
 
+// NewRRSet returns a set of the records indexed by name, with each record
+// indexed by its own type.
+func NewRRSet(rrs map[string][]Record) RRSet {
+	s := make(RRSet, len(rrs))
+	for dn, recs := range rrs {
+		s.Add(dn, recs...)
+	}
+	return s
+}
+
+// Add adds the records for the domain name dn, indexed by the type of each
+// record.
+func (s RRSet) Add(dn string, recs ...Record) {
+	rrs, ok := s[dn]
+	if !ok {
+		rrs = make(map[Type][]Record)
+		s[dn] = rrs
+	}
+
+	for _, rec := range recs {
+		typ := rec.Type()
+		rrs[typ] = append(rrs[typ], rec)
+	}
+}
+
+// A RecordTypeError is returned when validating a record indexed by a type
+// other than its own.
+type RecordTypeError struct {
+	Name   string
+	Type   Type
+	Record Record
+}
+
+func (e *RecordTypeError) Error() string {
+	return "dns: " + e.Name + " record of type " + strconv.Itoa(int(e.Record.Type())) +
+		" indexed by type " + strconv.Itoa(int(e.Type))
+}
+
+// Validate checks that each record in the set is indexed by its own type, or
+// is a CNAME record. The first inconsistent record is returned as a
+// *RecordTypeError.
+func (s RRSet) Validate() error {
+	for dn, rrs := range s {
+		for typ, recs := range rrs {
+			for _, rec := range recs {
+				if rtyp := rec.Type(); rtyp != typ && rtyp != TypeCNAME {
+					return &RecordTypeError{Name: dn, Type: typ, Record: rec}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Lookup returns the records of type typ for the domain name dn. The names
+// "" and "@" refer to the zone origin. Internationalized names match records
+// indexed by either their Unicode or punycode form.
+func (s RRSet) Lookup(_ context.Context, dn string, typ Type) ([]Record, bool, error) {
+	rrs, ok := s[dn]
+	if !ok && dn == "" {
+		rrs, ok = s["@"]
+	}
+	if !ok {
+		if alt, isIDN := idnAlternate(dn); isIDN {
+			rrs, ok = s[alt]
+		}
+	}
+	return rrs[typ], ok, nil
+}
+
+// Walk calls fn for the records of each name and type in the set.
+func (s RRSet) Walk(_ context.Context, fn func(dn string, typ Type, recs []Record) error) error {
+	for dn, rrs := range s {
+		for typ, recs := range rrs {
+			if err := fn(dn, typ, recs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ZoneStore is a storage backend for the records of a Zone. Domain names are
+// relative to the zone origin, and the empty name refers to the zone apex.
+type ZoneStore interface {
+	// Lookup returns the records of type typ for the domain name dn. The
+	// boolean result reports whether any records exist for the name. The
+	// Zone looks up lowercase names, so names stored with uppercase letters
+	// must be matched case-insensitively.
+	Lookup(ctx context.Context, dn string, typ Type) ([]Record, bool, error)
+
+	// Walk calls fn for the records of each name and type in the store. If
+	// fn returns an error, the walk stops and the error is returned.
+	Walk(ctx context.Context, fn func(dn string, typ Type, recs []Record) error) error
+}
+
+// RecordProvider provides records that are evaluated for each query, such as
+// records reflecting the live state of a service registry.
+type RecordProvider interface {
+	// Records returns the records that answer the question, and the TTL of
+	// the records. If the TTL is zero, the zone TTL is used.
+	Records(ctx context.Context, q Question) ([]Record, time.Duration, error)
+}
+
+// RecordProviderFunc is an adapter to allow the use of ordinary functions as
+// record providers.
+type RecordProviderFunc func(context.Context, Question) ([]Record, time.Duration, error)
+
+// Records calls f(ctx, q).
+func (f RecordProviderFunc) Records(ctx context.Context, q Question) ([]Record, time.Duration, error) {
+	return f(ctx, q)
+}
+
+// Providers is a set of record providers indexed by name and type.
+type Providers map[string]map[Type]RecordProvider
+
 // Zone is a contiguous set DNS records under an origin domain name.
+//
+// Query names are matched case-insensitively, with the lowercase names
+// relative to the origin, and answered with the case of the query name.
 type Zone struct {
 	Origin string
 	TTL    time.Duration
 
+	// Jitter is the maximum random duration subtracted from the TTL of
+	// answers, to spread out the expiration of records cached by a large
+	// number of clients. The same TTL is used for all records of a response.
+	Jitter time.Duration
+
 	SOA *SOA
 
+	// NS are the name servers of the zone apex. NS queries for the origin
+	// are answered with these records.
+	NS []*NS
+
+	// AuthorityNS includes the apex NS records in the authority section of
+	// positive answers.
+	AuthorityNS bool
+
+	// RRs are the records of the zone, indexed by name relative to the
+	// origin and by type. Use NewRRSet to build the set from records indexed
+	// by name only, and Validate to check a set built by hand. Names may be
+	// in Unicode, and are matched by queries for their punycode form.
 	RRs RRSet
+
+	// Store is the storage backend of the zone records. If nil, the records
+	// in RRs are used.
+	Store ZoneStore
+
+	// Providers are evaluated for each query of a name and type, and the
+	// records provided are answered in addition to the records in RRs.
+	Providers Providers
+
+	// Client resolves the target names of ALIAS records, by sending queries
+	// to the recursive resolver at ClientAddr. If nil, a default Client is
+	// used. Queries of names with ALIAS records are answered with a "Server
+	// Failure" message if ClientAddr is nil.
+	Client     *Client
+	ClientAddr net.Addr
+
+	foldmu sync.Mutex
+	fold   *foldIndex
 }
 
+// foldIndex maps the lowercase form of the names with uppercase letters in
+// the RRs and Providers of a zone to the names. It is rebuilt if either map
+// is replaced or changes in size.
+type foldIndex struct {
+	rrs, providers   uintptr
+	nrrs, nproviders int
+
+	names, providerNames map[string]string
+}
+
+// foldIndex returns the index of the names with uppercase letters of z.
+func (z *Zone) foldIndex() *foldIndex {
+	rrs := reflect.ValueOf(z.RRs).Pointer()
+	providers := reflect.ValueOf(z.Providers).Pointer()
+
+	z.foldmu.Lock()
+	defer z.foldmu.Unlock()
+
+	idx := z.fold
+	if idx != nil && idx.rrs == rrs && idx.nrrs == len(z.RRs) && idx.providers == providers && idx.nproviders == len(z.Providers) {
+		return idx
+	}
+
+	idx = &foldIndex{
+		rrs:        rrs,
+		nrrs:       len(z.RRs),
+		providers:  providers,
+		nproviders: len(z.Providers),
+	}
+	for name := range z.RRs {
+		if lower := strings.ToLower(name); lower != name {
+			if idx.names == nil {
+				idx.names = make(map[string]string)
+			}
+			idx.names[lower] = name
+		}
+	}
+	for name := range z.Providers {
+		if lower := strings.ToLower(name); lower != name {
+			if idx.providerNames == nil {
+				idx.providerNames = make(map[string]string)
+			}
+			idx.providerNames[lower] = name
+		}
+	}
+
+	z.fold = idx
+	return idx
+}
+
+// foldedRRSet is an RRSet that also matches the names with uppercase
+// letters by their lowercase form.
+type foldedRRSet struct {
+	RRSet
+
+	names map[string]string
+}
+
+func (s foldedRRSet) Lookup(ctx context.Context, dn string, typ Type) ([]Record, bool, error) {
+	recs, ok, err := s.RRSet.Lookup(ctx, dn, typ)
+	if !ok {
+		if name, found := s.names[dn]; found {
+			return s.RRSet.Lookup(ctx, name, typ)
+		}
+	}
+	return recs, ok, err
+}
+
+// maxCNAMEChain is the maximum number of CNAME records followed for a query.
+const maxCNAMEChain = 8
+
+var (
+	errAliasFailure = errors.New("ALIAS target resolution failed")
+	errAliasNoAddr  = errors.New("no client address for ALIAS target resolution")
+	errCNAMEChain   = errors.New("CNAME chain too long")
+	errCNAMELoop    = errors.New("CNAME loop")
+	errDNAMETooLong = errors.New("DNAME substitution too long")
+)
+
 // ServeDNS answers DNS queries in zone z.
 func (z *Zone) ServeDNS(ctx context.Context, w MessageWriter, r *Query) {
+	if len(r.Questions) == 0 {
+		w.Status(FormErr)
+		return
+	}
+
 	w.Authoritative(true)
 
-	var found bool
+	ttl, store := z.ttl(), z.store()
+
+	var (
+		found, answered bool
+
+		targets []string
+	)
 	for _, q := range r.Questions {
-		if !strings.HasSuffix(q.Name, z.Origin) {
+		if !isSubdomain(q.Name, z.Origin) {
 			continue
 		}
-		if q.Type == TypeSOA && q.Name == z.Origin {
-			w.Answer(q.Name, z.TTL, z.SOA)
+		if q.Type == TypeSOA && strings.EqualFold(q.Name, z.Origin) {
+			w.Answer(q.Name, ttl, z.SOA)
+			found, answered = true, true
+
+			continue
+		}
+		if q.Type == TypeNS && strings.EqualFold(q.Name, z.Origin) && len(z.NS) > 0 {
+			for _, ns := range z.NS {
+				w.Answer(q.Name, ttl, ns)
+				targets = append(targets, ns.NS)
+			}
+			found, answered = true, true
+
+			continue
+		}
+
+		dn, _ := z.relative(q.Name)
+
+		recs, ok, err := store.Lookup(ctx, dn, q.Type)
+		if err != nil {
+			w.Status(ServFail)
 			found = true
 
 			continue
 		}
 
-		dn := q.Name[:len(q.Name)-len(z.Origin)-1]
+		provider := z.provider(dn, q.Type)
+		if !ok && provider == nil {
+			owner, dname, err := z.dname(ctx, store, dn)
+			if err == nil && dname != nil {
+				err = z.answerDNAME(ctx, w, store, q, r.RecursionDesired, owner, dname, ttl)
+				answered = true
+			}
+			switch err {
+			case nil:
+			case errDNAMETooLong:
+				w.Status(YXDomain)
+			default:
+				w.Status(ServFail)
+			}
+			if err != nil || dname != nil {
+				found = true
+			}
 
-		rrs, ok := z.RRs[dn]
-		if !ok {
 			continue
 		}
 
-		for _, rr := range rrs[q.Type] {
-			w.Answer(q.Name, z.TTL, rr)
-			found = true
+		rttl := ttl
+		if provider != nil {
+			precs, pttl, err := provider.Records(ctx, q)
+			if err != nil {
+				w.Status(ServFail)
+				found = true
 
-			if r.RecursionDesired && rr.Type() == TypeCNAME {
-				name := rr.(*CNAME).CNAME
-				dn := name[:len(name)-len(z.Origin)-1]
+				continue
+			}
+			if pttl > 0 {
+				rttl = pttl
+			}
+
+			recs = append(recs[:len(recs):len(recs)], precs...)
+		}
+
+		if len(recs) == 0 && ok && (q.Type == TypeA || q.Type == TypeAAAA) {
+			aliases, _, err := store.Lookup(ctx, dn, TypeALIAS)
+			if err == nil && len(aliases) > 0 {
+				err = z.answerAlias(ctx, w, q, ttl, aliases)
+			}
+			if err != nil {
+				w.Status(ServFail)
+			}
+			if err != nil || len(aliases) > 0 {
+				found = true
+
+				continue
+			}
+		}
+
+		for _, rr := range recs {
+			w.Answer(q.Name, rttl, rr)
+			found, answered = true, true
+
+			if target := glueTarget(rr); target != "" {
+				targets = append(targets, target)
+			}
 
-				if rrs, ok := z.RRs[dn]; ok {
-					for _, rr := range rrs[q.Type] {
-						w.Answer(name, z.TTL, rr)
-					}
+			if r.RecursionDesired && rr.Type() == TypeCNAME {
+				if err := z.chase(ctx, w, store, q, rr.(*CNAME).CNAME, ttl); err != nil {
+					w.Status(ServFail)
 				}
 			}
 		}
@@ -63,7 +380,284 @@ func (z *Zone) ServeDNS(ctx context.Context, w MessageWriter, r *Query) {
 		w.Status(NXDomain)
 
 		if z.SOA != nil {
-			w.Authority(z.Origin, z.TTL, z.SOA)
+			w.Authority(z.Origin, ttl, z.SOA)
+		}
+		return
+	}
+
+	if answered && z.AuthorityNS {
+		for _, ns := range z.NS {
+			w.Authority(z.Origin, ttl, ns)
+			targets = append(targets, ns.NS)
+		}
+	}
+
+	z.glue(ctx, w, store, ttl, targets)
+}
+
+// glue adds the in-zone addresses of the target names to the additional
+// section, so clients need not query for them separately.
+func (z *Zone) glue(ctx context.Context, w MessageWriter, store ZoneStore, ttl time.Duration, targets []string) {
+	seen := make(map[string]bool, len(targets))
+	for _, target := range targets {
+		if seen[target] {
+			continue
+		}
+		seen[target] = true
+
+		dn, ok := z.relative(target)
+		if !ok {
+			continue
+		}
+
+		for _, typ := range []Type{TypeA, TypeAAAA} {
+			rrs, _, err := store.Lookup(ctx, dn, typ)
+			if err != nil {
+				continue
+			}
+			for _, rr := range rrs {
+				if rr.Type() == typ {
+					w.Additional(target, ttl, rr)
+				}
+			}
+		}
+	}
+}
+
+// glueTarget returns the target name of an MX, SRV, or NS record, or the
+// empty string for other records.
+func glueTarget(rr Record) string {
+	switch rr := rr.(type) {
+	case *MX:
+		return rr.MX
+	case *SRV:
+		return rr.Target
+	case *NS:
+		return rr.NS
+	default:
+		return ""
+	}
+}
+
+// chase answers the in-zone records of the CNAME target name for the
+// question, following chained CNAME records up to maxCNAMEChain links.
+func (z *Zone) chase(ctx context.Context, w MessageWriter, store ZoneStore, q Question, target string, ttl time.Duration) error {
+	seen := map[string]bool{strings.ToLower(q.Name): true}
+	for depth := 0; ; depth++ {
+		if seen[strings.ToLower(target)] {
+			return errCNAMELoop
+		}
+		if depth == maxCNAMEChain {
+			return errCNAMEChain
 		}
+		seen[strings.ToLower(target)] = true
+
+		dn, ok := z.relative(target)
+		if !ok {
+			return nil
+		}
+
+		rrs, _, err := store.Lookup(ctx, dn, q.Type)
+		if err != nil {
+			return err
+		}
+
+		var next string
+		for _, rr := range rrs {
+			w.Answer(target, ttl, rr)
+
+			if cname, ok := rr.(*CNAME); ok {
+				next = cname.CNAME
+			}
+		}
+		if next == "" {
+			return nil
+		}
+		target = next
+	}
+}
+
+// dname returns the owner name and the DNAME record of the closest ancestor
+// of the relative domain name dn with a DNAME record, or a nil record if
+// there is none.
+func (z *Zone) dname(ctx context.Context, store ZoneStore, dn string) (string, *DNAME, error) {
+	for dn != "" {
+		if i := strings.IndexByte(dn, '.'); i >= 0 {
+			dn = dn[i+1:]
+		} else {
+			dn = ""
+		}
+
+		rrs, _, err := store.Lookup(ctx, dn, TypeDNAME)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, rr := range rrs {
+			if dname, ok := rr.(*DNAME); ok {
+				return z.fqdn(dn), dname, nil
+			}
+		}
+	}
+	return "", nil, nil
+}
+
+// answerDNAME answers the question with the DNAME record of the owner name,
+// and a CNAME record synthesized by substituting the owner suffix of the
+// question name with the DNAME target (RFC 6672, section 3.3). If recursion
+// is desired, the in-zone records of the synthesized target are also
+// answered.
+func (z *Zone) answerDNAME(ctx context.Context, w MessageWriter, store ZoneStore, q Question, recurse bool, owner string, dname *DNAME, ttl time.Duration) error {
+	w.Answer(owner, ttl, dname)
+
+	target := q.Name[:len(q.Name)-len(owner)] + dname.DNAME
+	if len(target) > maxNameLen {
+		return errDNAMETooLong
+	}
+
+	w.Answer(q.Name, ttl, &CNAME{CNAME: target})
+
+	if !recurse {
+		return nil
+	}
+	return z.chase(ctx, w, store, q, target, ttl)
+}
+
+// answerAlias answers the question with the records of the ALIAS targets,
+// resolved with the zone client. The TTL of the answers is capped by ttl.
+func (z *Zone) answerAlias(ctx context.Context, w MessageWriter, q Question, ttl time.Duration, aliases []Record) error {
+	if z.ClientAddr == nil {
+		return errAliasNoAddr
+	}
+
+	client := z.Client
+	if client == nil {
+		client = new(Client)
+	}
+
+	for _, rr := range aliases {
+		query := &Query{
+			RemoteAddr: z.ClientAddr,
+			Message: &Message{
+				RecursionDesired: true,
+				Questions: []Question{
+					{Name: rr.(*ALIAS).ALIAS, Type: q.Type, Class: ClassIN},
+				},
+			},
+		}
+
+		msg, err := client.Do(ctx, query)
+		if err != nil {
+			return err
+		}
+		if msg.RCode != NoError && msg.RCode != NXDomain {
+			return errAliasFailure
+		}
+
+		for _, res := range msg.Answers {
+			if res.Record.Type() != q.Type {
+				continue
+			}
+
+			rttl := ttl
+			if res.TTL < rttl {
+				rttl = res.TTL
+			}
+			w.Answer(q.Name, rttl, res.Record)
+		}
+	}
+	return nil
+}
+
+// store returns the storage backend of the zone.
+func (z *Zone) store() ZoneStore {
+	if z.Store != nil {
+		return z.Store
+	}
+	if names := z.foldIndex().names; names != nil {
+		return foldedRRSet{RRSet: z.RRs, names: names}
+	}
+	return z.RRs
+}
+
+// provider returns the record provider of the zone for the relative domain
+// name and type, or nil if there is none.
+func (z *Zone) provider(dn string, typ Type) RecordProvider {
+	providers, ok := z.Providers[dn]
+	if !ok && dn == "" {
+		providers, ok = z.Providers["@"]
+	}
+	if !ok && len(z.Providers) > 0 {
+		if name, found := z.foldIndex().providerNames[dn]; found {
+			providers = z.Providers[name]
+		}
+	}
+	return providers[typ]
+}
+
+// relative returns the lowercase domain name relative to the zone origin, so
+// that names are matched case-insensitively. The zone apex is the empty name.
+func (z *Zone) relative(name string) (string, bool) {
+	if !isSubdomain(name, z.Origin) {
+		return "", false
+	}
+	if len(name) == len(z.Origin) {
+		return "", true
+	}
+	return strings.ToLower(name[:len(name)-len(z.Origin)-1]), true
+}
+
+// resources returns the records of the zone as resources.
+func (z *Zone) resources(ctx context.Context) ([]Resource, error) {
+	var rrs []Resource
+	if z.SOA != nil {
+		rrs = append(rrs, Resource{
+			Name:   z.Origin,
+			Class:  ClassIN,
+			TTL:    z.TTL,
+			Record: z.SOA,
+		})
+	}
+	for _, ns := range z.NS {
+		rrs = append(rrs, Resource{
+			Name:   z.Origin,
+			Class:  ClassIN,
+			TTL:    z.TTL,
+			Record: ns,
+		})
+	}
+
+	err := z.store().Walk(ctx, func(dn string, _ Type, recs []Record) error {
+		for _, rec := range recs {
+			rrs = append(rrs, Resource{
+				Name:   z.fqdn(dn),
+				Class:  ClassIN,
+				TTL:    z.TTL,
+				Record: rec,
+			})
+		}
+		return nil
+	})
+	return rrs, err
+}
+
+// ttl returns the zone TTL with a random jitter applied.
+func (z *Zone) ttl() time.Duration {
+	if z.Jitter <= 0 {
+		return z.TTL
+	}
+
+	jitter := z.Jitter
+	if jitter > z.TTL {
+		jitter = z.TTL
+	}
+	return z.TTL - time.Duration(rand.Int63n(int64(jitter)+1))
+}
+
+// fqdn returns the fully qualified domain name of the relative name dn. The
+// names "" and "@" refer to the zone origin.
+func (z *Zone) fqdn(dn string) string {
+	if dn == "" || dn == "@" {
+		return z.Origin
 	}
+	return dn + "." + z.Origin
 }
@@ -2,8 +2,13 @@ package dns
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net"
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -189,3 +194,1242 @@ func TestZone(t *testing.T) {
 		}
 	}
 }
+
+func TestZoneURI(t *testing.T) {
+	t.Parallel()
+
+	zone := &Zone{
+		Origin: "example.com.",
+		TTL:    time.Minute,
+		RRs: RRSet{
+			"_ftp._tcp": {
+				TypeURI: {
+					&URI{Priority: 10, Weight: 1, Target: "ftp://ftp1.example.com/public"},
+					&URI{Priority: 20, Weight: 2, Target: "ftp://ftp2.example.com/public"},
+				},
+			},
+		},
+	}
+
+	srv := mustServer(zone)
+
+	addr, err := net.ResolveUDPAddr("udp", srv.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := new(Client).Do(context.Background(), &Query{
+		RemoteAddr: addr,
+		Message: &Message{
+			Questions: []Question{
+				{
+					Name:  "_ftp._tcp.example.com.",
+					Type:  TypeURI,
+					Class: ClassIN,
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := 2, len(res.Answers); want != got {
+		t.Fatalf("want %d answers, got %d", want, got)
+	}
+	for i, answer := range res.Answers {
+		rec := zone.RRs["_ftp._tcp"][TypeURI][i]
+		if want, got := rec.(*URI), answer.Record.(*URI); !reflect.DeepEqual(*want, *got) {
+			t.Errorf("want answer record %+v, got %+v", *want, *got)
+		}
+	}
+}
+
+func TestZoneMixedCase(t *testing.T) {
+	t.Parallel()
+
+	srv := mustServer(localhostZone)
+
+	addr, err := net.ResolveUDPAddr("udp", srv.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+
+		question Question
+
+		answers []string
+	}{
+		{
+			name: "apex",
+
+			question: Question{Name: "LocalHost.", Type: TypeSOA, Class: ClassIN},
+
+			answers: []string{"LocalHost."},
+		},
+		{
+			name: "records",
+
+			question: Question{Name: "aPP.lOCALHOST.", Type: TypeA, Class: ClassIN},
+
+			answers: []string{"aPP.lOCALHOST.", "aPP.lOCALHOST.", "aPP.lOCALHOST."},
+		},
+		{
+			name: "cname",
+
+			question: Question{Name: "CName.localhost.", Type: TypeA, Class: ClassIN},
+
+			answers: []string{"CName.localhost.", "app.localhost.", "app.localhost.", "app.localhost."},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			query := &Query{
+				RemoteAddr: addr,
+				Message: &Message{
+					RecursionDesired: true,
+					Questions:        []Question{test.question},
+				},
+			}
+
+			res, err := new(Client).Do(context.Background(), query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want, got := NoError, res.RCode; want != got {
+				t.Fatalf("want rcode %d, got %d", want, got)
+			}
+			if want, got := []Question{test.question}, res.Questions; !reflect.DeepEqual(want, got) {
+				t.Errorf("want questions %+v, got %+v", want, got)
+			}
+
+			var names []string
+			for _, answer := range res.Answers {
+				names = append(names, answer.Name)
+			}
+			if want, got := test.answers, names; !reflect.DeepEqual(want, got) {
+				t.Errorf("want answer names %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestZoneMixedCaseKeys(t *testing.T) {
+	t.Parallel()
+
+	zone := &Zone{
+		Origin: "example.",
+		TTL:    time.Minute,
+		SOA: &SOA{
+			NS:   "ns1.example.",
+			MBox: "hostmaster.example.",
+		},
+		NS: []*NS{{NS: "NS1.example."}},
+		RRs: RRSet{
+			"WWW": {
+				TypeA: {&A{A: net.IPv4(192, 0, 2, 1).To4()}},
+			},
+			"NS1": {
+				TypeA: {&A{A: net.IPv4(192, 0, 2, 53).To4()}},
+			},
+		},
+	}
+
+	client := &Client{
+		Transport: nopDialer{},
+		Resolver:  zone,
+	}
+
+	for _, name := range []string{"WWW.example.", "www.example.", "wWw.EXAMPLE."} {
+		query := &Query{
+			Message: &Message{
+				Questions: []Question{{Name: name, Type: TypeA, Class: ClassIN}},
+			},
+		}
+
+		res, err := client.Do(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := NoError, res.RCode; want != got {
+			t.Errorf("%s: want rcode %d, got %d", name, want, got)
+		}
+		if want, got := 1, len(res.Answers); want != got {
+			t.Errorf("%s: want %d answers, got %d", name, want, got)
+		}
+	}
+
+	// names added after the zone serves queries are matched too
+	zone.RRs["MAIL"] = map[Type][]Record{
+		TypeA: {&A{A: net.IPv4(192, 0, 2, 25).To4()}},
+	}
+	zone.Providers = Providers{
+		"API": {
+			TypeA: RecordProviderFunc(func(context.Context, Question) ([]Record, time.Duration, error) {
+				return []Record{&A{A: net.IPv4(192, 0, 2, 80).To4()}}, 0, nil
+			}),
+		},
+	}
+
+	for _, name := range []string{"mail.example.", "api.example."} {
+		query := &Query{
+			Message: &Message{
+				Questions: []Question{{Name: name, Type: TypeA, Class: ClassIN}},
+			},
+		}
+
+		res, err := client.Do(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := 1, len(res.Answers); want != got {
+			t.Errorf("%s: want %d answers, got %d", name, want, got)
+		}
+	}
+
+	issues, err := zone.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) > 0 {
+		t.Errorf("want no issues, got %v", issues)
+	}
+}
+
+func TestZoneJitter(t *testing.T) {
+	t.Parallel()
+
+	zone := &Zone{
+		Origin: "localhost.",
+		TTL:    time.Hour,
+		Jitter: 10 * time.Minute,
+		RRs:    localhostZone.RRs,
+	}
+
+	client := &Client{
+		Transport: nopDialer{},
+		Resolver:  zone,
+	}
+
+	query := &Query{
+		Message: &Message{
+			Questions: []Question{
+				{Name: "app.localhost.", Type: TypeA, Class: ClassIN},
+			},
+		},
+	}
+
+	ttls := make(map[time.Duration]struct{})
+	for i := 0; i < 20; i++ {
+		res, err := client.Do(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := 3, len(res.Answers); want != got {
+			t.Fatalf("want %d answers, got %d", want, got)
+		}
+
+		ttl := res.Answers[0].TTL
+		if ttl > zone.TTL || ttl < zone.TTL-zone.Jitter {
+			t.Errorf("want TTL in [%s, %s], got %s", zone.TTL-zone.Jitter, zone.TTL, ttl)
+		}
+		for _, answer := range res.Answers[1:] {
+			if want, got := ttl, answer.TTL; want != got {
+				t.Errorf("want RRSet TTL %s, got %s", want, got)
+			}
+		}
+
+		ttls[ttl] = struct{}{}
+	}
+
+	if len(ttls) < 2 {
+		t.Errorf("want jittered TTLs, got %v", ttls)
+	}
+}
+
+func TestZoneALIAS(t *testing.T) {
+	t.Parallel()
+
+	upstream := mustServer(localhostZone)
+
+	addr, err := net.ResolveUDPAddr("udp", upstream.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zone := &Zone{
+		Origin: "example.com.",
+		TTL:    time.Minute,
+		SOA: &SOA{
+			NS:   "ns.example.com.",
+			MBox: "hostmaster.example.com.",
+		},
+		RRs: RRSet{
+			"": {
+				TypeALIAS: {&ALIAS{ALIAS: "app.localhost."}},
+				TypeMX:    {&MX{Pref: 10, MX: "mx.example.com."}},
+			},
+			"www": {
+				TypeALIAS: {&ALIAS{ALIAS: "1.app.localhost."}},
+				TypeA:     {&A{A: net.IPv4(192, 0, 2, 1).To4()}},
+			},
+		},
+		ClientAddr: addr,
+	}
+
+	client := &Client{
+		Transport: nopDialer{},
+		Resolver:  zone,
+	}
+
+	tests := []struct {
+		name  string
+		qtype Type
+
+		answers []Record
+	}{
+		{
+			name:    "example.com.",
+			qtype:   TypeA,
+			answers: localhostZone.RRs["app"][TypeA],
+		},
+		{
+			name:    "example.com.",
+			qtype:   TypeAAAA,
+			answers: localhostZone.RRs["app"][TypeAAAA],
+		},
+		{
+			name:    "example.com.",
+			qtype:   TypeMX,
+			answers: zone.RRs[""][TypeMX],
+		},
+		{
+			name:    "www.example.com.",
+			qtype:   TypeA,
+			answers: zone.RRs["www"][TypeA],
+		},
+		{
+			name:    "www.example.com.",
+			qtype:   TypeAAAA,
+			answers: localhostZone.RRs["1.app"][TypeAAAA],
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(fmt.Sprintf("%s%d", test.name, test.qtype), func(t *testing.T) {
+			t.Parallel()
+
+			query := &Query{
+				Message: &Message{
+					Questions: []Question{
+						{Name: test.name, Type: test.qtype, Class: ClassIN},
+					},
+				},
+			}
+
+			res, err := client.Do(context.Background(), query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want, got := len(test.answers), len(res.Answers); want != got {
+				t.Fatalf("want %d answers, got %d", want, got)
+			}
+			for i, answer := range res.Answers {
+				if want, got := test.name, answer.Name; want != got {
+					t.Errorf("want answer name %q, got %q", want, got)
+				}
+				if want, got := test.answers[i], answer.Record; !reflect.DeepEqual(want, got) {
+					t.Errorf("want answer record %+v, got %+v", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestZoneALIASNoClientAddr(t *testing.T) {
+	t.Parallel()
+
+	zone := &Zone{
+		Origin: "example.com.",
+		TTL:    time.Minute,
+		RRs: RRSet{
+			"": {
+				TypeALIAS: {&ALIAS{ALIAS: "app.localhost."}},
+			},
+		},
+	}
+
+	client := &Client{
+		Transport: nopDialer{},
+		Resolver:  zone,
+	}
+
+	query := &Query{
+		Message: &Message{
+			Questions: []Question{
+				{Name: "example.com.", Type: TypeA, Class: ClassIN},
+			},
+		},
+	}
+
+	res, err := client.Do(context.Background(), query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := ServFail, res.RCode; want != got {
+		t.Errorf("want rcode %v, got %v", want, got)
+	}
+	if want, got := 0, len(res.Answers); want != got {
+		t.Errorf("want %d answers, got %d", want, got)
+	}
+}
+
+func TestZoneProviders(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu       sync.Mutex
+		backends = []net.IP{net.IPv4(10, 0, 0, 1).To4()}
+	)
+
+	zone := &Zone{
+		Origin: "service.",
+		TTL:    time.Hour,
+		RRs: RRSet{
+			"api": {
+				TypeA: {&A{A: net.IPv4(10, 0, 0, 100).To4()}},
+			},
+		},
+		Providers: Providers{
+			"api": {
+				TypeA: RecordProviderFunc(func(ctx context.Context, q Question) ([]Record, time.Duration, error) {
+					mu.Lock()
+					defer mu.Unlock()
+
+					var recs []Record
+					for _, ip := range backends {
+						recs = append(recs, &A{A: ip})
+					}
+					return recs, 5 * time.Second, nil
+				}),
+			},
+			"broken": {
+				TypeA: RecordProviderFunc(func(ctx context.Context, q Question) ([]Record, time.Duration, error) {
+					return nil, 0, errors.New("registry unavailable")
+				}),
+			},
+		},
+	}
+
+	client := &Client{
+		Transport: nopDialer{},
+		Resolver:  zone,
+	}
+
+	query := func(name string) *Message {
+		res, err := client.Do(context.Background(), &Query{
+			Message: &Message{
+				Questions: []Question{
+					{Name: name, Type: TypeA, Class: ClassIN},
+				},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	res := query("api.service.")
+	if want, got := 2, len(res.Answers); want != got {
+		t.Fatalf("want %d answers, got %d", want, got)
+	}
+	for _, answer := range res.Answers {
+		if want, got := 5*time.Second, answer.TTL; want != got {
+			t.Errorf("want TTL %s, got %s", want, got)
+		}
+	}
+
+	mu.Lock()
+	backends = append(backends, net.IPv4(10, 0, 0, 2).To4())
+	mu.Unlock()
+
+	res = query("api.service.")
+	if want, got := 3, len(res.Answers); want != got {
+		t.Fatalf("want %d answers, got %d", want, got)
+	}
+	if want, got := net.IPv4(10, 0, 0, 2).To4(), res.Answers[2].Record.(*A).A; !want.Equal(got) {
+		t.Errorf("want A record %s, got %s", want, got)
+	}
+	if want, got := 1, len(zone.RRs["api"][TypeA]); want != got {
+		t.Errorf("want %d static records, got %d", want, got)
+	}
+
+	res = query("broken.service.")
+	if want, got := ServFail, res.RCode; want != got {
+		t.Errorf("want rcode %d, got %d", want, got)
+	}
+}
+
+func TestZoneStore(t *testing.T) {
+	t.Parallel()
+
+	store := &lookupStore{ZoneStore: localhostZone.RRs}
+
+	zone := &Zone{
+		Origin: localhostZone.Origin,
+		TTL:    localhostZone.TTL,
+		SOA:    localhostZone.SOA,
+		Store:  store,
+	}
+
+	client := &Client{
+		Transport: nopDialer{},
+		Resolver:  zone,
+	}
+
+	query := &Query{
+		Message: &Message{
+			Questions: []Question{
+				{Name: "app.localhost.", Type: TypeAAAA, Class: ClassIN},
+			},
+		},
+	}
+
+	res, err := client.Do(context.Background(), query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 3, len(res.Answers); want != got {
+		t.Fatalf("want %d answers, got %d", want, got)
+	}
+	if want, got := []string{"app"}, store.lookups(); !reflect.DeepEqual(want, got) {
+		t.Errorf("want lookups %q, got %q", want, got)
+	}
+
+	want, err := localhostZone.Digest(ZONEMDHashSHA384)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := zone.Digest(ZONEMDHashSHA384)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want zone digest %x, got %x", want, got)
+	}
+
+	store.err = errors.New("store unavailable")
+
+	if res, err = client.Do(context.Background(), query); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := ServFail, res.RCode; want != got {
+		t.Errorf("want rcode %d, got %d", want, got)
+	}
+}
+
+type lookupStore struct {
+	ZoneStore
+
+	mu  sync.Mutex
+	dns []string
+	err error
+}
+
+func (s *lookupStore) Lookup(ctx context.Context, dn string, typ Type) ([]Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return nil, false, s.err
+	}
+
+	s.dns = append(s.dns, dn)
+	return s.ZoneStore.Lookup(ctx, dn, typ)
+}
+
+func (s *lookupStore) lookups() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.dns...)
+}
+
+func TestZoneGlue(t *testing.T) {
+	t.Parallel()
+
+	zone := &Zone{
+		Origin: "localhost.",
+		TTL:    time.Hour,
+		RRs: RRSet{
+			"": {
+				TypeMX: {
+					&MX{Pref: 10, MX: "mail.localhost."},
+					&MX{Pref: 20, MX: "mail.example.com."},
+				},
+				TypeNS: {
+					&NS{NS: "ns.localhost."},
+				},
+			},
+			"_sip._tcp": {
+				TypeSRV: {
+					&SRV{Priority: 10, Weight: 5, Port: 5060, Target: "sip.localhost."},
+					&SRV{Priority: 20, Weight: 5, Port: 5060, Target: "sip.localhost."},
+				},
+			},
+			"mail": {
+				TypeA:    {&A{A: net.IPv4(10, 42, 0, 1).To4()}},
+				TypeAAAA: {&AAAA{AAAA: net.ParseIP("dead:beef::1")}},
+			},
+			"ns": {
+				TypeA: {&A{A: net.IPv4(10, 42, 0, 2).To4()}},
+			},
+			"sip": {
+				TypeA: {&A{A: net.IPv4(10, 42, 0, 3).To4()}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name string
+
+		question Question
+
+		additionals []string
+	}{
+		{
+			name: "MX",
+
+			question: Question{Name: "localhost.", Type: TypeMX, Class: ClassIN},
+
+			additionals: []string{"mail.localhost. A 10.42.0.1", "mail.localhost. AAAA dead:beef::1"},
+		},
+		{
+			name: "NS",
+
+			question: Question{Name: "localhost.", Type: TypeNS, Class: ClassIN},
+
+			additionals: []string{"ns.localhost. A 10.42.0.2"},
+		},
+		{
+			name: "SRV",
+
+			question: Question{Name: "_sip._tcp.localhost.", Type: TypeSRV, Class: ClassIN},
+
+			additionals: []string{"sip.localhost. A 10.42.0.3"},
+		},
+		{
+			name: "A",
+
+			question: Question{Name: "mail.localhost.", Type: TypeA, Class: ClassIN},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			client := &Client{
+				Transport: nopDialer{},
+				Resolver:  zone,
+			}
+
+			msg, err := client.Do(context.Background(), &Query{
+				Message: &Message{Questions: []Question{test.question}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var additionals []string
+			for _, res := range msg.Additionals {
+				var addr string
+				switch rr := res.Record.(type) {
+				case *A:
+					addr = "A " + rr.A.String()
+				case *AAAA:
+					addr = "AAAA " + rr.AAAA.String()
+				}
+				additionals = append(additionals, res.Name+" "+addr)
+			}
+
+			if want, got := test.additionals, additionals; !reflect.DeepEqual(want, got) {
+				t.Errorf("want additionals %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestRRSetValidate(t *testing.T) {
+	t.Parallel()
+
+	rrs := NewRRSet(map[string][]Record{
+		"": {
+			&MX{Pref: 10, MX: "mail.localhost."},
+			&NS{NS: "ns.localhost."},
+		},
+		"app": {
+			&A{A: net.IPv4(10, 42, 0, 1).To4()},
+			&A{A: net.IPv4(10, 42, 0, 2).To4()},
+			&AAAA{AAAA: net.ParseIP("dead:beef::1")},
+		},
+	})
+
+	if want, got := 2, len(rrs["app"][TypeA]); want != got {
+		t.Errorf("want %d A records, got %d", want, got)
+	}
+	if want, got := 1, len(rrs["app"][TypeAAAA]); want != got {
+		t.Errorf("want %d AAAA records, got %d", want, got)
+	}
+	if want, got := 1, len(rrs[""][TypeMX]); want != got {
+		t.Errorf("want %d MX records, got %d", want, got)
+	}
+
+	if err := rrs.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := localhostZone.RRs.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	rrs["bad"] = map[Type][]Record{
+		TypeA: {&AAAA{AAAA: net.ParseIP("dead:beef::2")}},
+	}
+
+	err := rrs.Validate()
+	rerr, ok := err.(*RecordTypeError)
+	if !ok {
+		t.Fatalf("want *RecordTypeError, got %v", err)
+	}
+	if want, got := "bad", rerr.Name; want != got {
+		t.Errorf("want error name %q, got %q", want, got)
+	}
+	if want, got := TypeA, rerr.Type; want != got {
+		t.Errorf("want error type %d, got %d", want, got)
+	}
+	if want, got := "dns: bad record of type 28 indexed by type 1", err.Error(); want != got {
+		t.Errorf("want error %q, got %q", want, got)
+	}
+}
+
+func TestZoneCNAMEChain(t *testing.T) {
+	t.Parallel()
+
+	rrs := RRSet{
+		"app": {
+			TypeA: {&A{A: net.IPv4(10, 42, 0, 1).To4()}},
+		},
+		"loop1": {
+			TypeA: {&CNAME{CNAME: "loop2.localhost."}},
+		},
+		"loop2": {
+			TypeA: {&CNAME{CNAME: "loop3.localhost."}},
+		},
+		"loop3": {
+			TypeA: {&CNAME{CNAME: "loop1.localhost."}},
+		},
+		"self": {
+			TypeA: {&CNAME{CNAME: "self.localhost."}},
+		},
+	}
+	for i := 0; i < 12; i++ {
+		target := "app.localhost."
+		if i > 0 {
+			target = fmt.Sprintf("chain%d.localhost.", i-1)
+		}
+		rrs[fmt.Sprintf("chain%d", i)] = map[Type][]Record{
+			TypeA: {&CNAME{CNAME: target}},
+		}
+	}
+
+	zone := &Zone{
+		Origin: "localhost.",
+		TTL:    time.Hour,
+		RRs:    rrs,
+	}
+
+	tests := []struct {
+		name string
+
+		rcode   RCode
+		answers int
+	}{
+		{name: "chain2.localhost.", answers: 4},
+		{name: "chain7.localhost.", answers: 9},
+		{name: "chain8.localhost.", rcode: ServFail, answers: 9},
+		{name: "chain11.localhost.", rcode: ServFail, answers: 9},
+		{name: "loop1.localhost.", rcode: ServFail, answers: 3},
+		{name: "self.localhost.", rcode: ServFail, answers: 1},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			client := &Client{
+				Transport: nopDialer{},
+				Resolver:  zone,
+			}
+
+			msg, err := client.Do(context.Background(), &Query{
+				Message: &Message{
+					RecursionDesired: true,
+					Questions:        []Question{{Name: test.name, Type: TypeA, Class: ClassIN}},
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want, got := test.rcode, msg.RCode; want != got {
+				t.Errorf("want rcode %d, got %d", want, got)
+			}
+			if want, got := test.answers, len(msg.Answers); want != got {
+				t.Errorf("want %d answers, got %d", want, got)
+			}
+		})
+	}
+}
+
+func TestZoneDNAME(t *testing.T) {
+	t.Parallel()
+
+	zone := &Zone{
+		Origin: "localhost.",
+		TTL:    time.Hour,
+		SOA: &SOA{
+			NS:     "ns.localhost.",
+			MBox:   "hostmaster.localhost.",
+			Serial: 1,
+		},
+		RRs: RRSet{
+			"old": {
+				TypeDNAME: {&DNAME{DNAME: "new.localhost."}},
+			},
+			"app.new": {
+				TypeA: {&A{A: net.IPv4(10, 42, 0, 1).To4()}},
+			},
+			"ext": {
+				TypeDNAME: {&DNAME{DNAME: "example.com."}},
+			},
+			"long": {
+				TypeDNAME: {&DNAME{DNAME: strings.Repeat("x", 63) + "." + strings.Repeat("y", 63) + "." + strings.Repeat("z", 63) + "."}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name string
+
+		qname   string
+		qtype   Type
+		recurse bool
+
+		rcode   RCode
+		answers []Resource
+	}{
+		{
+			name: "synthesized",
+
+			qname:   "app.old.localhost.",
+			qtype:   TypeA,
+			recurse: true,
+
+			answers: []Resource{
+				{
+					Name:   "old.localhost.",
+					Class:  ClassIN,
+					TTL:    time.Hour,
+					Record: &DNAME{DNAME: "new.localhost."},
+				},
+				{
+					Name:   "app.old.localhost.",
+					Class:  ClassIN,
+					TTL:    time.Hour,
+					Record: &CNAME{CNAME: "app.new.localhost."},
+				},
+				{
+					Name:   "app.new.localhost.",
+					Class:  ClassIN,
+					TTL:    time.Hour,
+					Record: &A{A: net.IPv4(10, 42, 0, 1).To4()},
+				},
+			},
+		},
+		{
+			name: "no-recursion",
+
+			qname: "app.old.localhost.",
+			qtype: TypeA,
+
+			answers: []Resource{
+				{
+					Name:   "old.localhost.",
+					Class:  ClassIN,
+					TTL:    time.Hour,
+					Record: &DNAME{DNAME: "new.localhost."},
+				},
+				{
+					Name:   "app.old.localhost.",
+					Class:  ClassIN,
+					TTL:    time.Hour,
+					Record: &CNAME{CNAME: "app.new.localhost."},
+				},
+			},
+		},
+		{
+			name: "out-of-zone",
+
+			qname:   "a.b.ext.localhost.",
+			qtype:   TypeAAAA,
+			recurse: true,
+
+			answers: []Resource{
+				{
+					Name:   "ext.localhost.",
+					Class:  ClassIN,
+					TTL:    time.Hour,
+					Record: &DNAME{DNAME: "example.com."},
+				},
+				{
+					Name:   "a.b.ext.localhost.",
+					Class:  ClassIN,
+					TTL:    time.Hour,
+					Record: &CNAME{CNAME: "a.b.example.com."},
+				},
+			},
+		},
+		{
+			name: "owner",
+
+			qname: "old.localhost.",
+			qtype: TypeDNAME,
+
+			answers: []Resource{
+				{
+					Name:   "old.localhost.",
+					Class:  ClassIN,
+					TTL:    time.Hour,
+					Record: &DNAME{DNAME: "new.localhost."},
+				},
+			},
+		},
+		{
+			name: "too-long",
+
+			qname: strings.Repeat("w", 63) + ".long.localhost.",
+			qtype: TypeA,
+
+			rcode: YXDomain,
+			answers: []Resource{
+				{
+					Name:   "long.localhost.",
+					Class:  ClassIN,
+					TTL:    time.Hour,
+					Record: &DNAME{DNAME: strings.Repeat("x", 63) + "." + strings.Repeat("y", 63) + "." + strings.Repeat("z", 63) + "."},
+				},
+			},
+		},
+		{
+			name: "nxdomain",
+
+			qname: "app.missing.localhost.",
+			qtype: TypeA,
+
+			rcode: NXDomain,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			client := &Client{
+				Transport: nopDialer{},
+				Resolver:  zone,
+			}
+
+			msg, err := client.Do(context.Background(), &Query{
+				Message: &Message{
+					RecursionDesired: test.recurse,
+					Questions:        []Question{{Name: test.qname, Type: test.qtype, Class: ClassIN}},
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want, got := test.rcode, msg.RCode; want != got {
+				t.Errorf("want rcode %d, got %d", want, got)
+			}
+			if want, got := test.answers, msg.Answers; !reflect.DeepEqual(want, got) {
+				t.Errorf("want answers %+v, got %+v", want, got)
+			}
+		})
+	}
+}
+
+func TestZoneApexNS(t *testing.T) {
+	t.Parallel()
+
+	zone := &Zone{
+		Origin: "localhost.",
+		TTL:    time.Hour,
+		SOA: &SOA{
+			NS:   "ns1.localhost.",
+			MBox: "hostmaster.localhost.",
+		},
+		NS: []*NS{
+			{NS: "ns1.localhost."},
+			{NS: "ns2.example.com."},
+		},
+		AuthorityNS: true,
+		RRs: RRSet{
+			"app": {
+				TypeA: {&A{A: net.IPv4(10, 42, 0, 1).To4()}},
+			},
+			"ns1": {
+				TypeA: {&A{A: net.IPv4(10, 42, 0, 53).To4()}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name string
+
+		question Question
+
+		rcode                             RCode
+		answers, authorities, additionals int
+	}{
+		{
+			name: "NS",
+
+			question: Question{Name: "localhost.", Type: TypeNS, Class: ClassIN},
+
+			answers:     2,
+			authorities: 2,
+			additionals: 1,
+		},
+		{
+			name: "positive",
+
+			question: Question{Name: "app.localhost.", Type: TypeA, Class: ClassIN},
+
+			answers:     1,
+			authorities: 2,
+			additionals: 1,
+		},
+		{
+			name: "negative",
+
+			question: Question{Name: "missing.localhost.", Type: TypeA, Class: ClassIN},
+
+			rcode:       NXDomain,
+			authorities: 1,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			client := &Client{
+				Transport: nopDialer{},
+				Resolver:  zone,
+			}
+
+			msg, err := client.Do(context.Background(), &Query{
+				Message: &Message{Questions: []Question{test.question}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want, got := test.rcode, msg.RCode; want != got {
+				t.Errorf("want rcode %d, got %d", want, got)
+			}
+			if want, got := test.answers, len(msg.Answers); want != got {
+				t.Errorf("want %d answers, got %d", want, got)
+			}
+			if want, got := test.authorities, len(msg.Authorities); want != got {
+				t.Errorf("want %d authorities, got %d", want, got)
+			}
+			if want, got := test.additionals, len(msg.Additionals); want != got {
+				t.Errorf("want %d additionals, got %d", want, got)
+			}
+		})
+	}
+}
+
+func TestZoneIDN(t *testing.T) {
+	t.Parallel()
+
+	zone := &Zone{
+		Origin: "example.",
+		TTL:    time.Hour,
+		SOA: &SOA{
+			NS:   "ns.example.",
+			MBox: "hostmaster.example.",
+		},
+		RRs: RRSet{
+			"bücher": {
+				TypeA: {&A{A: net.IPv4(10, 0, 0, 1).To4()}},
+			},
+			"xn--mnchen-3ya": {
+				TypeA: {&A{A: net.IPv4(10, 0, 0, 2).To4()}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name string
+
+		question Question
+
+		rcode RCode
+		a     net.IP
+	}{
+		{
+			name: "punycode-query-unicode-owner",
+
+			question: Question{Name: "xn--bcher-kva.example.", Type: TypeA, Class: ClassIN},
+
+			a: net.IPv4(10, 0, 0, 1).To4(),
+		},
+		{
+			name: "unicode-query-unicode-owner",
+
+			question: Question{Name: "bücher.example.", Type: TypeA, Class: ClassIN},
+
+			a: net.IPv4(10, 0, 0, 1).To4(),
+		},
+		{
+			name: "unicode-query-punycode-owner",
+
+			question: Question{Name: "münchen.example.", Type: TypeA, Class: ClassIN},
+
+			a: net.IPv4(10, 0, 0, 2).To4(),
+		},
+		{
+			name: "upper-case-ace-prefix",
+
+			question: Question{Name: "XN--bcher-kva.example.", Type: TypeA, Class: ClassIN},
+
+			a: net.IPv4(10, 0, 0, 1).To4(),
+		},
+		{
+			name: "missing",
+
+			question: Question{Name: "xn--ndern-gua.example.", Type: TypeA, Class: ClassIN},
+
+			rcode: NXDomain,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			client := &Client{
+				Transport: nopDialer{},
+				Resolver:  zone,
+			}
+
+			msg, err := client.Do(context.Background(), &Query{
+				Message: &Message{Questions: []Question{test.question}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want, got := test.rcode, msg.RCode; want != got {
+				t.Fatalf("want rcode %d, got %d", want, got)
+			}
+			if test.a == nil {
+				return
+			}
+			if want, got := 1, len(msg.Answers); want != got {
+				t.Fatalf("want %d answers, got %d", want, got)
+			}
+			if want, got := test.a, msg.Answers[0].Record.(*A).A; !want.Equal(got) {
+				t.Errorf("want A record %s, got %s", want, got)
+			}
+			if want, got := test.question.Name, msg.Answers[0].Name; want != got {
+				t.Errorf("want answer name %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestZoneCAA(t *testing.T) {
+	t.Parallel()
+
+	zone := &Zone{
+		Origin: "example.",
+		TTL:    time.Hour,
+		SOA: &SOA{
+			NS:   "ns.example.",
+			MBox: "hostmaster.example.",
+		},
+		RRs: RRSet{
+			"": {
+				TypeCAA: {
+					&CAA{Tag: "issue", Value: "ca.example.net"},
+					&CAA{IssuerCritical: true, Tag: "iodef", Value: "mailto:security@example."},
+				},
+			},
+		},
+	}
+
+	srv := mustServer(zone)
+
+	addr, err := net.ResolveUDPAddr("udp", srv.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := new(Client).Do(context.Background(), &Query{
+		RemoteAddr: addr,
+		Message: &Message{
+			Questions: []Question{
+				{Name: "example.", Type: TypeCAA, Class: ClassIN},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []Record
+	for _, answer := range res.Answers {
+		got = append(got, answer.Record)
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i].(*CAA).Tag > got[j].(*CAA).Tag })
+
+	if want := zone.RRs[""][TypeCAA]; !reflect.DeepEqual(want, got) {
+		t.Errorf("want CAA records %+v, got %+v", want, got)
+	}
+}
@@ -0,0 +1,148 @@
+package dns
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// An IssueKind is a class of zone consistency issue.
+type IssueKind int
+
+// Zone consistency issue kinds.
+const (
+	// IssueCNAMEData is a CNAME record at a name with other records.
+	IssueCNAMEData IssueKind = iota + 1
+
+	// IssueOutOfZone is a record with a domain name outside of the zone.
+	// Names in the zone records must be relative to the origin.
+	IssueOutOfZone
+
+	// IssueMissingGlue is an NS record with an in-zone target name that has
+	// no address records in the zone.
+	IssueMissingGlue
+
+	// IssueApexRecord is a record that is not allowed at its name, such as a
+	// CNAME record at the zone apex, or an SOA record in the zone records.
+	IssueApexRecord
+)
+
+var issueKindNames = map[IssueKind]string{
+	IssueCNAMEData:   "CNAME and other data",
+	IssueOutOfZone:   "out of zone",
+	IssueMissingGlue: "missing glue",
+	IssueApexRecord:  "illegal apex record",
+}
+
+func (k IssueKind) String() string {
+	if name, ok := issueKindNames[k]; ok {
+		return name
+	}
+	return "unknown issue"
+}
+
+// A ZoneIssue is a consistency issue of a zone reported by Check.
+type ZoneIssue struct {
+	Kind IssueKind
+
+	// Name is the domain name of the records with the issue, as it appears
+	// in the zone records.
+	Name string
+
+	// Type is the record type with the issue.
+	Type Type
+
+	// Target is the name server target name of an IssueMissingGlue issue.
+	Target string
+}
+
+func (i ZoneIssue) String() string {
+	s := i.Kind.String() + ": " + i.Name
+	if i.Target != "" {
+		s += " -> " + i.Target
+	}
+	return s
+}
+
+// Check reports the consistency issues of the zone records, sorted by name.
+// An error is returned only if the zone records cannot be read.
+func (z *Zone) Check(ctx context.Context) ([]ZoneIssue, error) {
+	var (
+		issues  []ZoneIssue
+		types   = make(map[string]map[Type]bool)
+		targets = make(map[string]string) // NS target -> name
+		addrs   = make(map[string]bool)   // lowercase names with address records
+	)
+
+	for _, ns := range z.NS {
+		targets[ns.NS] = ""
+	}
+
+	err := z.store().Walk(ctx, func(dn string, _ Type, recs []Record) error {
+		if dn == "@" {
+			dn = ""
+		}
+		if strings.HasSuffix(dn, ".") {
+			issues = append(issues, ZoneIssue{Kind: IssueOutOfZone, Name: dn})
+			return nil
+		}
+
+		if types[dn] == nil {
+			types[dn] = make(map[Type]bool)
+		}
+		for _, rec := range recs {
+			typ := rec.Type()
+			types[dn][typ] = true
+			if typ == TypeA || typ == TypeAAAA {
+				addrs[strings.ToLower(dn)] = true
+			}
+
+			switch rec := rec.(type) {
+			case *NS:
+				targets[rec.NS] = dn
+			case *SOA:
+				issues = append(issues, ZoneIssue{Kind: IssueApexRecord, Name: dn, Type: typ})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for dn, typs := range types {
+		if !typs[TypeCNAME] {
+			continue
+		}
+		if dn == "" {
+			issues = append(issues, ZoneIssue{Kind: IssueApexRecord, Name: dn, Type: TypeCNAME})
+		}
+		if len(typs) > 1 {
+			issues = append(issues, ZoneIssue{Kind: IssueCNAMEData, Name: dn, Type: TypeCNAME})
+		}
+	}
+
+	for target, dn := range targets {
+		rel, ok := z.relative(target)
+		if !ok {
+			continue
+		}
+		if !addrs[rel] {
+			issues = append(issues, ZoneIssue{Kind: IssueMissingGlue, Name: dn, Type: TypeNS, Target: target})
+		}
+	}
+
+	sort.Slice(issues, func(i, j int) bool {
+		if issues[i].Name != issues[j].Name {
+			return issues[i].Name < issues[j].Name
+		}
+		if issues[i].Kind != issues[j].Kind {
+			return issues[i].Kind < issues[j].Kind
+		}
+		if issues[i].Type != issues[j].Type {
+			return issues[i].Type < issues[j].Type
+		}
+		return issues[i].Target < issues[j].Target
+	})
+	return issues, nil
+}
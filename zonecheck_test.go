@@ -0,0 +1,78 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestZoneCheck(t *testing.T) {
+	t.Parallel()
+
+	zone := &Zone{
+		Origin: "localhost.",
+		NS: []*NS{
+			{NS: "ns1.localhost."},
+			{NS: "ns2.localhost."},
+			{NS: "ns.example.com."},
+		},
+		RRs: RRSet{
+			"@": {
+				TypeCNAME: {&CNAME{CNAME: "app.localhost."}},
+				TypeSOA:   {&SOA{NS: "ns1.localhost.", MBox: "hostmaster.localhost."}},
+			},
+			"app": {
+				TypeA: {&A{A: net.IPv4(10, 42, 0, 1).To4()}},
+			},
+			"www": {
+				TypeA:    {&CNAME{CNAME: "app.localhost."}},
+				TypeAAAA: {&AAAA{AAAA: net.ParseIP("dead:beef::1")}},
+			},
+			"alias": {
+				TypeA:    {&CNAME{CNAME: "app.localhost."}},
+				TypeAAAA: {&CNAME{CNAME: "app.localhost."}},
+			},
+			"ns1": {
+				TypeA: {&A{A: net.IPv4(10, 42, 0, 53).To4()}},
+			},
+			"sub": {
+				TypeNS: {&NS{NS: "ns.sub.localhost."}},
+			},
+			"app.example.com.": {
+				TypeA: {&A{A: net.IPv4(10, 42, 0, 2).To4()}},
+			},
+		},
+	}
+
+	issues, err := zone.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []ZoneIssue{
+		{Kind: IssueCNAMEData, Name: "", Type: TypeCNAME},
+		{Kind: IssueMissingGlue, Name: "", Type: TypeNS, Target: "ns2.localhost."},
+		{Kind: IssueApexRecord, Name: "", Type: TypeCNAME},
+		{Kind: IssueApexRecord, Name: "", Type: TypeSOA},
+		{Kind: IssueOutOfZone, Name: "app.example.com."},
+		{Kind: IssueMissingGlue, Name: "sub", Type: TypeNS, Target: "ns.sub.localhost."},
+		{Kind: IssueCNAMEData, Name: "www", Type: TypeCNAME},
+	}
+
+	if got := issues; !reflect.DeepEqual(want, got) {
+		t.Errorf("want issues:\n%v\ngot:\n%v", want, got)
+	}
+
+	if want, got := "missing glue: sub -> ns.sub.localhost.", issues[5].String(); want != got {
+		t.Errorf("want issue string %q, got %q", want, got)
+	}
+
+	issues, err = localhostZone.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) > 0 {
+		t.Errorf("want no issues, got %v", issues)
+	}
+}
@@ -0,0 +1,192 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha512"
+	"errors"
+	"hash"
+)
+
+// ZONEMD schemes and hash algorithms.
+//
+// Taken from https://www.iana.org/assignments/dns-parameters/dns-parameters.xhtml#zonemd-schemes
+const (
+	ZONEMDSchemeSimple = 1 // [RFC8976] SIMPLE
+
+	ZONEMDHashSHA384 = 1 // [RFC8976] SHA-384
+	ZONEMDHashSHA512 = 2 // [RFC8976] SHA-512
+)
+
+var (
+	// ErrZoneDigestMismatch indicates that no ZONEMD record matched the
+	// digest of the zone data.
+	ErrZoneDigestMismatch = errors.New("zone digest mismatch")
+
+	errNoApexSOA         = errors.New("missing apex SOA record")
+	errNoZONEMD          = errors.New("missing apex ZONEMD record")
+	errUnsupportedScheme = errors.New("unsupported ZONEMD scheme")
+	errUnsupportedHash   = errors.New("unsupported ZONEMD hash algorithm")
+	errZoneStore         = errors.New("zone records not stored in RRs")
+)
+
+// ZoneDigest computes the RFC 8976 message digest of the zone data in rrs
+// using the scheme and hash algorithm. All records must be within the origin
+// zone. The apex ZONEMD records, and the apex RRSIG records covering them, are
+// excluded from the digest as described in RFC 8976, section 3.3.1.
+func ZoneDigest(origin string, rrs []Resource, scheme, hashAlg int) ([]byte, error) {
+	if scheme != ZONEMDSchemeSimple {
+		return nil, errUnsupportedScheme
+	}
+
+	var h hash.Hash
+	switch hashAlg {
+	case ZONEMDHashSHA384:
+		h = sha512.New384()
+	case ZONEMDHashSHA512:
+		h = sha512.New()
+	default:
+		return nil, errUnsupportedHash
+	}
+
+	crrs := make([]canonicalRR, 0, len(rrs))
+	for _, res := range rrs {
+		if compareNames(res.Name, origin) == 0 && coversZONEMD(res.Record) {
+			continue
+		}
+
+		crr, err := newCanonicalRR(res)
+		if err != nil {
+			return nil, err
+		}
+		crrs = append(crrs, crr)
+	}
+
+	for _, crr := range sortCanonical(crrs) {
+		h.Write(crr.wire)
+	}
+	return h.Sum(nil), nil
+}
+
+// coversZONEMD reports whether rec is a ZONEMD record, or an RRSIG record
+// covering the ZONEMD RRset.
+func coversZONEMD(rec Record) bool {
+	if sig, ok := rec.(*RRSIG); ok {
+		return sig.TypeCovered == TypeZONEMD
+	}
+	return rec.Type() == TypeZONEMD
+}
+
+// VerifyZoneDigest verifies the zone data in rrs, such as the records of an
+// AXFR stream, against the apex ZONEMD records as described in RFC 8976,
+// section 4. A nil error is returned if the digest matches any supported
+// ZONEMD record with a serial equal to the apex SOA serial.
+func VerifyZoneDigest(origin string, rrs []Resource) error {
+	var (
+		soa     *SOA
+		zonemds []*ZONEMD
+	)
+
+	for _, res := range rrs {
+		if compareNames(res.Name, origin) != 0 {
+			continue
+		}
+
+		switch rec := res.Record.(type) {
+		case *SOA:
+			soa = rec
+		case *ZONEMD:
+			zonemds = append(zonemds, rec)
+		}
+	}
+
+	if soa == nil {
+		return errNoApexSOA
+	}
+	if len(zonemds) == 0 {
+		return errNoZONEMD
+	}
+
+	err := ErrZoneDigestMismatch
+	for _, zonemd := range zonemds {
+		if zonemd.Serial != soa.Serial {
+			continue
+		}
+
+		digest, derr := ZoneDigest(origin, rrs, zonemd.Scheme, zonemd.Hash)
+		if derr != nil {
+			if derr == errUnsupportedScheme || derr == errUnsupportedHash {
+				continue
+			}
+			return derr
+		}
+
+		if bytes.Equal(digest, zonemd.Digest) {
+			return nil
+		}
+	}
+	return err
+}
+
+// Digest computes the RFC 8976 message digest of the zone data using the
+// SIMPLE scheme and hash algorithm.
+func (z *Zone) Digest(hashAlg int) ([]byte, error) {
+	rrs, err := z.resources(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return ZoneDigest(z.Origin, rrs, ZONEMDSchemeSimple, hashAlg)
+}
+
+// VerifyDigest verifies the zone data against the ZONEMD records at the zone
+// apex.
+func (z *Zone) VerifyDigest() error {
+	rrs, err := z.resources(context.Background())
+	if err != nil {
+		return err
+	}
+	return VerifyZoneDigest(z.Origin, rrs)
+}
+
+// SetDigest computes the message digest of the zone data using the SIMPLE
+// scheme and hash algorithm, and replaces the apex ZONEMD records of RRs with
+// a ZONEMD record of the digest and the SOA serial. It must be called again
+// after the zone data or serial changes. The zone must have an SOA record, and
+// must not use a Store.
+func (z *Zone) SetDigest(hashAlg int) error {
+	if z.SOA == nil {
+		return errNoApexSOA
+	}
+	if z.Store != nil {
+		return errZoneStore
+	}
+
+	digest, err := z.Digest(hashAlg)
+	if err != nil {
+		return err
+	}
+
+	if z.RRs == nil {
+		z.RRs = make(RRSet)
+	}
+	for _, dn := range []string{"", "@"} {
+		if rrs, ok := z.RRs[dn]; ok {
+			delete(rrs, TypeZONEMD)
+		}
+	}
+
+	// add the record under the apex key of the other apex records, which
+	// Lookup prefers over "@"
+	apex := "@"
+	if _, ok := z.RRs[""]; ok {
+		apex = ""
+	}
+
+	z.RRs.Add(apex, &ZONEMD{
+		Serial: z.SOA.Serial,
+		Scheme: ZONEMDSchemeSimple,
+		Hash:   hashAlg,
+		Digest: digest,
+	})
+	return nil
+}
@@ -0,0 +1,321 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestZoneDigest(t *testing.T) {
+	t.Parallel()
+
+	// RFC 8976, Appendix A.1. Simple ZONEMD Example
+	digest, err := hex.DecodeString("" +
+		"c68090d90a7aed716bc459f9340e3d7c" +
+		"1370d4d24b7e2fc3a1ddc0b9a87153b9" +
+		"a9713b3c9ae5cc27777f98b8e730044c")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zonemd := &ZONEMD{
+		Serial: 2018031900,
+		Scheme: ZONEMDSchemeSimple,
+		Hash:   ZONEMDHashSHA384,
+		Digest: digest,
+	}
+
+	rrs := []Resource{
+		{
+			Name:  "example.",
+			Class: ClassIN,
+			TTL:   86400 * time.Second,
+			Record: &SOA{
+				NS:      "ns1.example.",
+				MBox:    "admin.example.",
+				Serial:  2018031900,
+				Refresh: 1800 * time.Second,
+				Retry:   900 * time.Second,
+				Expire:  604800 * time.Second,
+				MinTTL:  86400 * time.Second,
+			},
+		},
+		{Name: "example.", Class: ClassIN, TTL: 86400 * time.Second, Record: &NS{NS: "ns1.example."}},
+		{Name: "example.", Class: ClassIN, TTL: 86400 * time.Second, Record: &NS{NS: "ns2.example."}},
+		{Name: "example.", Class: ClassIN, TTL: 86400 * time.Second, Record: zonemd},
+		{Name: "ns1.example.", Class: ClassIN, TTL: 3600 * time.Second, Record: &A{A: net.IPv4(203, 0, 113, 63).To4()}},
+		{Name: "ns2.example.", Class: ClassIN, TTL: 3600 * time.Second, Record: &AAAA{AAAA: net.ParseIP("2001:db8::63")}},
+	}
+
+	got, err := ZoneDigest("example.", rrs, ZONEMDSchemeSimple, ZONEMDHashSHA384)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := digest; !bytes.Equal(want, got) {
+		t.Errorf("want zone digest %x, got %x", want, got)
+	}
+
+	if err := VerifyZoneDigest("example.", rrs); err != nil {
+		t.Error(err)
+	}
+
+	// record order, owner name case, and the case of NS RDATA names are not
+	// significant
+	rrs[0], rrs[5] = rrs[5], rrs[0]
+	rrs[1].Name = "EXAMPLE."
+	rrs[2].Record = &NS{NS: "NS2.Example."}
+	if err := VerifyZoneDigest("example.", rrs); err != nil {
+		t.Error(err)
+	}
+
+	rrs = append(rrs, Resource{
+		Name:   "ns3.example.",
+		Class:  ClassIN,
+		TTL:    3600 * time.Second,
+		Record: &A{A: net.IPv4(203, 0, 113, 64).To4()},
+	})
+	if want, got := ErrZoneDigestMismatch, VerifyZoneDigest("example.", rrs); want != got {
+		t.Errorf("want error %v, got %v", want, got)
+	}
+}
+
+func TestZoneDigestCanonicalForm(t *testing.T) {
+	t.Parallel()
+
+	digest, err := hex.DecodeString("" +
+		"aa5be60073390854c5fadb6b5a595c6f" +
+		"f3c633cd250792314ea7bebb8bcb2786" +
+		"8606c09847709d1bc63bf46877b57152")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the RDATA names of SOA, NS, SRV, and RRSIG records are lowercased,
+	// but not the NSEC next domain name (RFC 6840, section 5.1), and the
+	// apex ZONEMD and its RRSIG are excluded (RFC 8976, section 3.3.1)
+	rrs := []Resource{
+		{
+			Name:  "Example.",
+			Class: ClassIN,
+			TTL:   86400 * time.Second,
+			Record: &SOA{
+				NS:      "NS1.Example.",
+				MBox:    "Admin.EXAMPLE.",
+				Serial:  2018031900,
+				Refresh: 1800 * time.Second,
+				Retry:   900 * time.Second,
+				Expire:  604800 * time.Second,
+				MinTTL:  86400 * time.Second,
+			},
+		},
+		{Name: "example.", Class: ClassIN, TTL: 86400 * time.Second, Record: &NS{NS: "NS1.EXAMPLE."}},
+		{Name: "NS1.example.", Class: ClassIN, TTL: 3600 * time.Second, Record: &A{A: net.IPv4(203, 0, 113, 63).To4()}},
+		{
+			Name:   "_SIP._tcp.example.",
+			Class:  ClassIN,
+			TTL:    3600 * time.Second,
+			Record: &SRV{Priority: 0, Weight: 5, Port: 5060, Target: "SIP.Example."},
+		},
+		{
+			Name:   "example.",
+			Class:  ClassIN,
+			TTL:    86400 * time.Second,
+			Record: &NSEC{NextDomain: "Host.Example.", Types: TypeBitmap{TypeNS, TypeSOA}},
+		},
+		{
+			Name:  "example.",
+			Class: ClassIN,
+			TTL:   86400 * time.Second,
+			Record: &RRSIG{
+				TypeCovered: TypeNS,
+				Algorithm:   13,
+				Labels:      1,
+				OriginalTTL: 86400 * time.Second,
+				Expiration:  time.Unix(1700000000, 0),
+				Inception:   time.Unix(1690000000, 0),
+				KeyTag:      12345,
+				SignerName:  "EXAMPLE.",
+				Signature:   []byte{0x01, 0x02},
+			},
+		},
+		{
+			Name:  "example.",
+			Class: ClassIN,
+			TTL:   86400 * time.Second,
+			Record: &RRSIG{
+				TypeCovered: TypeZONEMD,
+				Algorithm:   13,
+				Labels:      1,
+				OriginalTTL: 86400 * time.Second,
+				Expiration:  time.Unix(1700000000, 0),
+				Inception:   time.Unix(1690000000, 0),
+				KeyTag:      12345,
+				SignerName:  "example.",
+				Signature:   []byte{0x03, 0x04},
+			},
+		},
+		{
+			Name:  "example.",
+			Class: ClassIN,
+			TTL:   86400 * time.Second,
+			Record: &ZONEMD{
+				Serial: 2018031900,
+				Scheme: ZONEMDSchemeSimple,
+				Hash:   ZONEMDHashSHA384,
+				Digest: digest,
+			},
+		},
+	}
+
+	got, err := ZoneDigest("example.", rrs, ZONEMDSchemeSimple, ZONEMDHashSHA384)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := digest; !bytes.Equal(want, got) {
+		t.Errorf("want zone digest %x, got %x", want, got)
+	}
+
+	if err := VerifyZoneDigest("example.", rrs); err != nil {
+		t.Error(err)
+	}
+
+	rrs[4].Record = &NSEC{NextDomain: "host.example.", Types: TypeBitmap{TypeNS, TypeSOA}}
+	if want, got := ErrZoneDigestMismatch, VerifyZoneDigest("example.", rrs); want != got {
+		t.Errorf("want error %v, got %v", want, got)
+	}
+}
+
+func TestZoneVerifyDigest(t *testing.T) {
+	t.Parallel()
+
+	zone := &Zone{
+		Origin: "example.",
+		TTL:    time.Hour,
+		SOA: &SOA{
+			NS:     "ns1.example.",
+			MBox:   "admin.example.",
+			Serial: 42,
+		},
+		RRs: RRSet{
+			"www": {
+				TypeA: {&A{A: net.IPv4(192, 0, 2, 1).To4()}},
+			},
+		},
+	}
+
+	digest, err := zone.Digest(ZONEMDHashSHA512)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zone.RRs["@"] = map[Type][]Record{
+		TypeZONEMD: {
+			&ZONEMD{
+				Serial: 42,
+				Scheme: ZONEMDSchemeSimple,
+				Hash:   ZONEMDHashSHA512,
+				Digest: digest,
+			},
+		},
+	}
+
+	if err := zone.VerifyDigest(); err != nil {
+		t.Fatal(err)
+	}
+
+	zone.SOA.Serial++
+	if want, got := ErrZoneDigestMismatch, zone.VerifyDigest(); want != got {
+		t.Errorf("want error %v, got %v", want, got)
+	}
+}
+
+func TestZoneSetDigest(t *testing.T) {
+	t.Parallel()
+
+	zone := &Zone{
+		Origin: "example.",
+		TTL:    time.Hour,
+		SOA: &SOA{
+			NS:     "ns1.example.",
+			MBox:   "admin.example.",
+			Serial: 42,
+		},
+		RRs: RRSet{
+			"www": {
+				TypeA: {&A{A: net.IPv4(192, 0, 2, 1).To4()}},
+			},
+		},
+	}
+
+	if want, got := errNoZONEMD, zone.VerifyDigest(); want != got {
+		t.Fatalf("want error %v, got %v", want, got)
+	}
+
+	if err := zone.SetDigest(ZONEMDHashSHA384); err != nil {
+		t.Fatal(err)
+	}
+	if err := zone.VerifyDigest(); err != nil {
+		t.Fatal(err)
+	}
+
+	zone.SOA.Serial++
+	zone.RRs.Add("mail", &A{A: net.IPv4(192, 0, 2, 2).To4()})
+	if err := zone.SetDigest(ZONEMDHashSHA512); err != nil {
+		t.Fatal(err)
+	}
+	if err := zone.VerifyDigest(); err != nil {
+		t.Fatal(err)
+	}
+
+	zonemds := zone.RRs["@"][TypeZONEMD]
+	if want, got := 1, len(zonemds); want != got {
+		t.Fatalf("want %d ZONEMD records, got %d", want, got)
+	}
+	if want, got := 43, zonemds[0].(*ZONEMD).Serial; want != got {
+		t.Errorf("want ZONEMD serial %d, got %d", want, got)
+	}
+
+	if want, got := errZoneStore, (&Zone{SOA: zone.SOA, Store: zone.RRs}).SetDigest(ZONEMDHashSHA384); want != got {
+		t.Errorf("want error %v, got %v", want, got)
+	}
+}
+
+func TestZoneSetDigestApexKey(t *testing.T) {
+	t.Parallel()
+
+	zone := &Zone{
+		Origin: "example.",
+		TTL:    time.Hour,
+		SOA: &SOA{
+			NS:     "ns1.example.",
+			MBox:   "admin.example.",
+			Serial: 42,
+		},
+		RRs: RRSet{
+			"": {
+				TypeMX: {&MX{Pref: 10, MX: "mx.example."}},
+			},
+		},
+	}
+
+	if err := zone.SetDigest(ZONEMDHashSHA384); err != nil {
+		t.Fatal(err)
+	}
+	if err := zone.VerifyDigest(); err != nil {
+		t.Fatal(err)
+	}
+
+	zonemds, _, err := zone.RRs.Lookup(context.Background(), "", TypeZONEMD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 1, len(zonemds); want != got {
+		t.Errorf("want %d ZONEMD records, got %d", want, got)
+	}
+	if _, ok := zone.RRs["@"]; ok {
+		t.Error("want no records under the @ apex key")
+	}
+}
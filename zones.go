@@ -0,0 +1,39 @@
+package dns
+
+import "context"
+
+// Zones is a handler that serves a set of zones. Queries are dispatched to
+// the zone with the longest origin containing the question name. Queries for
+// names outside of every zone are refused.
+type Zones []*Zone
+
+// ServeDNS dispatches the query to the zone of the first question.
+func (zs Zones) ServeDNS(ctx context.Context, w MessageWriter, r *Query) {
+	if len(r.Questions) == 0 {
+		w.Status(FormErr)
+		return
+	}
+
+	zone := zs.Match(r.Questions[0].Name)
+	if zone == nil {
+		w.Status(Refused)
+		return
+	}
+
+	zone.ServeDNS(ctx, w, r)
+}
+
+// Match returns the zone with the longest origin containing the domain name,
+// or nil if no zone contains the name.
+func (zs Zones) Match(name string) *Zone {
+	var match *Zone
+	for _, z := range zs {
+		if !isSubdomain(name, z.Origin) {
+			continue
+		}
+		if match == nil || len(z.Origin) > len(match.Origin) {
+			match = z
+		}
+	}
+	return match
+}
@@ -0,0 +1,95 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestZones(t *testing.T) {
+	t.Parallel()
+
+	zones := Zones{
+		{
+			Origin: "example.com.",
+			TTL:    time.Hour,
+			RRs: RRSet{
+				"www": {
+					TypeA: {&A{A: net.IPv4(192, 0, 2, 1).To4()}},
+				},
+			},
+		},
+		{
+			Origin: "sub.example.com.",
+			TTL:    time.Hour,
+			RRs: RRSet{
+				"www": {
+					TypeA: {&A{A: net.IPv4(192, 0, 2, 2).To4()}},
+				},
+			},
+		},
+		{
+			Origin: "example.net.",
+			TTL:    time.Hour,
+			RRs: RRSet{
+				"": {
+					TypeA: {&A{A: net.IPv4(192, 0, 2, 3).To4()}},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name string
+
+		rcode  RCode
+		answer string
+	}{
+		{name: "www.example.com.", answer: "192.0.2.1"},
+		{name: "www.sub.example.com.", answer: "192.0.2.2"},
+		{name: "example.net.", answer: "192.0.2.3"},
+		{name: "missing.example.net.", rcode: NXDomain},
+		{name: "www.example.org.", rcode: Refused},
+		{name: "notexample.com.", rcode: Refused},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			client := &Client{
+				Transport: nopDialer{},
+				Resolver:  zones,
+			}
+
+			msg, err := client.Do(context.Background(), &Query{
+				Message: &Message{
+					Questions: []Question{{Name: test.name, Type: TypeA, Class: ClassIN}},
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want, got := test.rcode, msg.RCode; want != got {
+				t.Errorf("want rcode %d, got %d", want, got)
+			}
+			if test.answer == "" {
+				if want, got := 0, len(msg.Answers); want != got {
+					t.Errorf("want %d answers, got %d", want, got)
+				}
+				return
+			}
+
+			if want, got := 1, len(msg.Answers); want != got {
+				t.Fatalf("want %d answers, got %d", want, got)
+			}
+			if want, got := test.answer, msg.Answers[0].Record.(*A).A.String(); want != got {
+				t.Errorf("want A record %q, got %q", want, got)
+			}
+		})
+	}
+}